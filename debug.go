@@ -104,7 +104,7 @@ func debugHookEditor(e editor.Editor) {
 	cmds := []wicore.Command{
 		&wicore.CommandImpl{
 			"command_log",
-			0,
+			nil,
 			cmdCommandLog,
 			wicore.DebugCategory,
 			lang.Map{
@@ -116,7 +116,7 @@ func debugHookEditor(e editor.Editor) {
 		},
 		&wicore.CommandImpl{
 			"key_log",
-			0,
+			nil,
 			cmdKeyLog,
 			wicore.DebugCategory,
 			lang.Map{
@@ -128,7 +128,7 @@ func debugHookEditor(e editor.Editor) {
 		},
 		&wicore.CommandImpl{
 			"log_all",
-			0,
+			nil,
 			cmdLogAll,
 			wicore.DebugCategory,
 			lang.Map{
@@ -140,7 +140,7 @@ func debugHookEditor(e editor.Editor) {
 		},
 		&wicore.CommandImpl{
 			"view_log",
-			0,
+			nil,
 			cmdViewLog,
 			wicore.DebugCategory,
 			lang.Map{
@@ -152,7 +152,7 @@ func debugHookEditor(e editor.Editor) {
 		},
 		&wicore.CommandImpl{
 			"window_log",
-			0,
+			nil,
 			cmdWindowLog,
 			wicore.DebugCategory,
 			lang.Map{
@@ -321,7 +321,11 @@ func commands(e wicore.Editor) interface{} {
 }
 
 func documents(e wicore.Editor) interface{} {
-	return e.AllDocuments()
+	out := map[string]int{}
+	for _, d := range e.AllDocuments() {
+		out[d.ID()] = d.ViewCount()
+	}
+	return out
 }
 
 func viewFactories(e wicore.Editor) interface{} {
@@ -351,12 +355,13 @@ func windows(e wicore.Editor) interface{} {
 	return recurseTree(wicore.RootWindow(e.ActiveWindow()))
 }
 
-func cmdCommandLog(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+func cmdCommandLog(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
 	out := commandRecurse(wicore.RootWindow(e.ActiveWindow()), []string{})
 	sort.Strings(out)
 	for _, i := range out {
 		log.Printf("  %s", i)
 	}
+	return nil, nil
 }
 
 func keyLogRecurse(w wicore.Window, e wicore.EditorW, mode wicore.KeyboardMode) {
@@ -375,28 +380,32 @@ func keyLogRecurse(w wicore.Window, e wicore.EditorW, mode wicore.KeyboardMode)
 	}
 }
 
-func cmdKeyLog(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+func cmdKeyLog(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
 	log.Printf("Normal commands")
 	rootWindow := wicore.RootWindow(e.ActiveWindow())
 	keyLogRecurse(rootWindow, e, wicore.Normal)
 	log.Printf("Insert commands")
 	keyLogRecurse(rootWindow, e, wicore.Insert)
+	return nil, nil
 }
 
-func cmdLogAll(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
-	e.ExecuteCommand(w, "command_log")
-	e.ExecuteCommand(w, "window_log")
-	e.ExecuteCommand(w, "view_log")
-	e.ExecuteCommand(w, "key_log")
+func cmdLogAll(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	for _, cmdName := range []string{"command_log", "window_log", "view_log", "key_log"} {
+		if _, err := e.ExecuteCommand(w, cmdName); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
 }
 
-func cmdViewLog(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+func cmdViewLog(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
 	names := e.ViewFactoryNames()
 	sort.Strings(names)
 	log.Printf("View factories:")
 	for _, name := range names {
 		log.Printf("  %s", name)
 	}
+	return nil, nil
 }
 
 func tree(w wicore.Window) string {
@@ -411,7 +420,8 @@ func tree(w wicore.Window) string {
 	return out
 }
 
-func cmdWindowLog(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+func cmdWindowLog(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
 	root := wicore.RootWindow(w)
 	log.Printf("Window tree:\n%s", tree(root))
+	return nil, nil
 }
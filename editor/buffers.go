@@ -0,0 +1,439 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/colors"
+	"github.com/wi-ed/wi/wicore/key"
+	"github.com/wi-ed/wi/wicore/lang"
+	"github.com/wi-ed/wi/wicore/raster"
+)
+
+// documentByNumber returns the loaded document with this buffer number.
+func (e *editor) documentByNumber(n int) *document {
+	for _, d := range e.documents {
+		if d.number == n {
+			return d
+		}
+	}
+	return nil
+}
+
+// showDocument makes the Window w show the document d. If w doesn't show a
+// document, a new Window is created.
+func (e *editor) showDocument(w *window, d *document) error {
+	v, ok := w.view.(*documentView)
+	if !ok {
+		// Creates an untitled document, which is discarded below.
+		if _, err := e.ExecuteCommand(w, "window_new", e.rootWindow.ID(), "fill", "new_document"); err != nil {
+			return err
+		}
+		w = newestChild(e.rootWindow)
+		if v, ok = w.view.(*documentView); !ok {
+			return errors.New("internal error")
+		}
+	}
+	if v.document == d {
+		return nil
+	}
+	if err := v.setDocument(d); err != nil {
+		return err
+	}
+	v.documentViewState = documentViewState{}
+	v.cursorMoved(e)
+	e.pruneDocuments()
+	wicore.PostCommand(e, nil, "editor_redraw")
+	return nil
+}
+
+// gotoDocument jumps to the line and the byte offset col, both 0-based, of
+// the document d. The position left is recorded in the jump list.
+func (e *editor) gotoDocument(d *document, line, col int) error {
+	e.recordJump()
+	return e.showLocation(d, line, col)
+}
+
+// showLocation moves the cursor to the line and the byte offset col, both
+// 0-based, in a Window showing the document d. The active Window is used if
+// it shows d, then any other Window showing d, otherwise a new Window is
+// created. The closed folds hiding the line are opened.
+func (e *editor) showLocation(d *document, line, col int) error {
+	var v *documentView
+	if dv, ok := e.ActiveWindow().View().(*documentView); ok && dv.document == d {
+		v = dv
+	} else if views := e.documentViews(d); len(views) != 0 {
+		v = views[0]
+	} else {
+		if err := e.showDocument(e.rootWindow, d); err != nil {
+			return err
+		}
+		if v, ok = newestChild(e.rootWindow).view.(*documentView); !ok {
+			return errors.New("internal error")
+		}
+	}
+	if err := e.activateWindow(v.window); err != nil {
+		return err
+	}
+	if line >= len(d.content) {
+		line = len(d.content) - 1
+	}
+	if line < 0 {
+		line = 0
+	}
+	l := d.content[line]
+	last := lastColumn(l)
+	c := 0
+	for c < col && c < last {
+		n := nextColumn(l, c)
+		if n > col {
+			break
+		}
+		c = n
+	}
+	v.CursorLine = line
+	v.CursorColumn = c
+	v.updateColumnMax()
+	v.updateFolds()
+	for i := range v.folds {
+		if f := &v.folds[i]; f.closed && line > f.start && line <= f.end {
+			f.closed = false
+		}
+	}
+	v.cursorMoved(e)
+	wicore.PostCommand(e, nil, "editor_redraw")
+	return nil
+}
+
+// cycleDocument shows the document before or after the one in w.
+func (e *editor) cycleDocument(w *window, delta int) error {
+	docs := e.sortedDocuments()
+	if len(docs) == 0 {
+		return errors.New(bufferNone.String())
+	}
+	i := -1
+	if v, ok := w.view.(*documentView); ok {
+		for j, d := range docs {
+			if d == v.document {
+				i = j
+				break
+			}
+		}
+	}
+	if i == -1 && delta < 0 {
+		// Starting from nowhere, going backward shows the last one.
+		i = 0
+	}
+	i = ((i+delta)%len(docs) + len(docs)) % len(docs)
+	return e.showDocument(w, docs[i])
+}
+
+// closeDocument unloads the document and closes the Windows showing it.
+func (e *editor) closeDocument(d *document) error {
+	if d.isDirty {
+		return errors.New(bufferDirty.Sprintf(d.number))
+	}
+	var windows []*window
+	var recurse func(w *window)
+	recurse = func(w *window) {
+		if v, ok := w.view.(*documentView); ok && v.document == d {
+			windows = append(windows, w)
+		}
+		for _, c := range w.childrenWindows {
+			recurse(c)
+		}
+	}
+	recurse(e.rootWindow)
+	for _, w := range windows {
+		if _, err := e.ExecuteCommand(e.rootWindow, "window_close", w.ID()); err != nil {
+			return err
+		}
+	}
+	if err := d.Close(); err != nil {
+		return err
+	}
+	e.pruneDocuments()
+	wicore.PostCommand(e, nil, "editor_redraw")
+	return nil
+}
+
+// buffersView lists the loaded documents.
+type buffersView struct {
+	view
+	e        *editor
+	selected int // Index of the selected document.
+}
+
+// lines returns one line per loaded document.
+func (v *buffersView) lines() ([]string, []*document) {
+	docs := v.e.sortedDocuments()
+	out := make([]string, len(docs))
+	for i, d := range docs {
+		dirty := " "
+		if d.isDirty {
+			dirty = "+"
+		}
+		name := d.filePath
+		if name == "" {
+			name = untitledDocument.String()
+		}
+		out[i] = fmt.Sprintf("%3d %s %-10s %s (%s)", d.number, dirty, d.FileType(), name, buffersViews.Sprintf(d.views))
+	}
+	return out, docs
+}
+
+func (v *buffersView) selectedDocument() *document {
+	_, docs := v.lines()
+	if v.selected >= len(docs) {
+		v.selected = len(docs) - 1
+	}
+	if v.selected < 0 {
+		v.selected = 0
+		return nil
+	}
+	return docs[v.selected]
+}
+
+func (v *buffersView) Buffer() *raster.Buffer {
+	v.buffer.Fill(raster.Cell{R: ' ', F: v.DefaultFormat()})
+	v.selectedDocument()
+	lines, _ := v.lines()
+	for i, l := range lines {
+		f := v.DefaultFormat()
+		if i == v.selected {
+			f.Fg, f.Bg = f.Bg, f.Fg
+		}
+		v.buffer.DrawString(l, 0, i, f)
+	}
+	return v.buffer
+}
+
+func (v *buffersView) onTerminalKeyPressed(k key.Press) {
+	if v.window == nil || v.e.ActiveWindow() != v.window {
+		return
+	}
+	d := v.selectedDocument()
+	switch {
+	case k.Key == key.Enter:
+		if d != nil {
+			// The document is shown in the Window that was active before.
+			v.e.TriggerCommands(wicore.EnqueuedCommands{
+				[][]string{{"window_close", v.window.ID()}, {"buffer", strconv.Itoa(d.number)}},
+				true,
+				nil,
+			})
+		}
+	case k.Ch == 'd':
+		if d != nil {
+			wicore.PostCommand(v.e, nil, "buffer_close", strconv.Itoa(d.number))
+		}
+	case k.Ch == 'q':
+		wicore.PostCommand(v.e, nil, "window_close", v.window.ID())
+	}
+}
+
+func cmdToBuffers(handler func(v *buffersView, e wicore.EditorW, w wicore.Window)) wicore.CommandImplHandler {
+	return func(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
+		v, ok := w.View().(*buffersView)
+		if !ok {
+			return nil, errors.New("internal error")
+		}
+		handler(v, e, w)
+		wicore.PostCommand(e, nil, "editor_redraw")
+		return nil, nil
+	}
+}
+
+func cmdBuffersClose(v *buffersView, e wicore.EditorW, w wicore.Window) {
+	wicore.PostCommand(e, nil, "window_close", w.ID())
+}
+
+func cmdBuffersCursorDown(v *buffersView, e wicore.EditorW, w wicore.Window) {
+	v.selected++
+	v.selectedDocument()
+}
+
+func cmdBuffersCursorUp(v *buffersView, e wicore.EditorW, w wicore.Window) {
+	if v.selected > 0 {
+		v.selected--
+	}
+}
+
+// buffersViewFactory returns a View listing the loaded documents.
+func buffersViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
+	dispatcher := makeCommands()
+	cmds := []wicore.Command{
+		&wicore.CommandImpl{
+			"buffers_close",
+			nil,
+			cmdToBuffers(cmdBuffersClose),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Closes the buffer list",
+			},
+			lang.Map{
+				lang.En: "Closes the buffer list window. The buffers stay loaded.",
+			},
+		},
+		&wicore.CommandImpl{
+			"buffers_cursor_down",
+			nil,
+			cmdToBuffers(cmdBuffersCursorDown),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Selects the next buffer",
+			},
+			lang.Map{
+				lang.En: "Selects the next buffer in the list.",
+			},
+		},
+		&wicore.CommandImpl{
+			"buffers_cursor_up",
+			nil,
+			cmdToBuffers(cmdBuffersCursorUp),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Selects the previous buffer",
+			},
+			lang.Map{
+				lang.En: "Selects the previous buffer in the list.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+	bindings := makeKeyBindings()
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Escape}, "buffers_close")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Down}, "buffers_cursor_down")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Up}, "buffers_cursor_up")
+
+	v := &buffersView{
+		view{
+			commands:      dispatcher,
+			keyBindings:   bindings,
+			eventRegistry: e,
+			id:            id,
+			title:         buffersTitle.String(),
+			naturalX:      78,
+			naturalY:      10,
+			defaultFormat: raster.CellFormat{Fg: colors.White, Bg: colors.Black},
+		},
+		e.(*editor),
+		0,
+	}
+	v.events = append(v.events, e.RegisterTerminalKeyPressed(v.onTerminalKeyPressed))
+	return v
+}
+
+// Commands.
+
+func cmdBuffer(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	d := e.documentByNumber(args.Int(0))
+	if d == nil {
+		return nil, errors.New(bufferNotFound.Sprintf(args.Int(0)))
+	}
+	return nil, e.showDocument(w, d)
+}
+
+func cmdBufferClose(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	var d *document
+	if args.Has(0) {
+		if d = e.documentByNumber(args.Int(0)); d == nil {
+			return nil, errors.New(bufferNotFound.Sprintf(args.Int(0)))
+		}
+	} else if v, ok := w.view.(*documentView); ok {
+		d = v.document
+	} else {
+		return nil, errors.New(noDocument.String())
+	}
+	return nil, e.closeDocument(d)
+}
+
+func cmdBufferNext(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	return nil, e.cycleDocument(w, 1)
+}
+
+func cmdBufferPrev(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	return nil, e.cycleDocument(w, -1)
+}
+
+func cmdBuffers(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	return e.ExecuteCommand(w, "window_new", wicore.RootWindow(w).ID(), "floating", "buffers")
+}
+
+// RegisterBufferCommands registers the commands to list and switch between
+// the loaded documents.
+func RegisterBufferCommands(dispatcher wicore.CommandsW) {
+	cmds := []wicore.Command{
+		&privilegedCommandImpl{
+			"buffer",
+			wicore.CommandArgs{{Name: "n", Type: wicore.ArgInt}},
+			cmdBuffer,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Shows a buffer",
+			},
+			lang.Map{
+				lang.En: "Shows the buffer with this number, as listed by \"buffers\", in the current window.",
+			},
+		},
+		&privilegedCommandImpl{
+			"buffer_close",
+			wicore.CommandArgs{{Name: "n", Type: wicore.ArgInt, Optional: true}},
+			cmdBufferClose,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Closes a buffer",
+			},
+			lang.Map{
+				lang.En: "Unloads the buffer with this number, or the buffer of the current window, and closes the windows showing it. It fails if the buffer is not saved.",
+			},
+		},
+		&privilegedCommandImpl{
+			"buffer_next",
+			nil,
+			cmdBufferNext,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Shows the next buffer",
+			},
+			lang.Map{
+				lang.En: "Shows the next buffer in the current window.",
+			},
+		},
+		&privilegedCommandImpl{
+			"buffer_prev",
+			nil,
+			cmdBufferPrev,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Shows the previous buffer",
+			},
+			lang.Map{
+				lang.En: "Shows the previous buffer in the current window.",
+			},
+		},
+		&wicore.CommandImpl{
+			"buffers",
+			nil,
+			cmdBuffers,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Lists the buffers",
+			},
+			lang.Map{
+				lang.En: "Lists the loaded documents with their number, whether they are modified, their file type, their path and the number of windows showing them. Use Enter to show the selected buffer in the current window and 'd' to close it.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+}
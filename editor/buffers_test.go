@@ -0,0 +1,78 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/key"
+)
+
+func TestBuffers(t *testing.T) {
+	defer keepLog(t)()
+
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	pathA := tmpDir + "/a.txt"
+	pathB := tmpDir + "/b.txt"
+	ut.AssertEqual(t, nil, ioutil.WriteFile(pathA, []byte("a\n"), 0600))
+	ut.AssertEqual(t, nil, ioutil.WriteFile(pathB, []byte("b\n"), 0600))
+
+	ed, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+	var shown []string
+	record := func(o wicore.CommandOutcome) {
+		ut.AssertEqual(t, nil, o.Err)
+		shown = append(shown, e.ActiveWindow().View().(*documentView).document.filePath)
+	}
+	var listed []string
+	closed := false
+	e.RegisterViewActivated(func(v wicore.View) {
+		switch v := v.(type) {
+		case *buffersView:
+			listed, _ = v.lines()
+			e.TriggerTerminalMetaKeyPressed(key.Press{Key: key.Up})
+			e.TriggerTerminalKeyPressed(key.Press{Key: key.Enter})
+		case *documentView:
+			if listed == nil || closed {
+				return
+			}
+			// Enter in the buffers View ran "buffer 1" after closing it.
+			closed = true
+			record(wicore.CommandOutcome{})
+			wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+				ut.AssertEqual(t, nil, o.Err)
+				ut.AssertEqual(t, 1, len(e.AllDocuments()))
+				wicore.PostCommand(e, nil, "q!")
+			}, "buffer_close", "1")
+		}
+	})
+	wicore.PostCommand(e, nil, "open", pathA)
+	wicore.PostCommand(e, record, "open", pathB)
+	wicore.PostCommand(e, record, "buffer_prev")
+	wicore.PostCommand(e, record, "buffer_next")
+	wicore.PostCommand(e, record, "buffer", "1")
+	wicore.PostCommand(e, record, "buffer_next")
+	wicore.PostCommand(e, nil, "buffers")
+	ut.AssertEqual(t, 0, e.EventLoop())
+
+	ut.AssertEqual(t, []string{pathB, pathA, pathB, pathA, pathB, pathA}, shown)
+	expected := []string{
+		"  1   Scanning   " + pathA + " (1 windows)",
+		"  2   Scanning   " + pathB + " (1 windows)",
+	}
+	ut.AssertEqual(t, expected, listed)
+}
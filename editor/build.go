@@ -0,0 +1,572 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"bufio"
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/colors"
+	"github.com/wi-ed/wi/wicore/key"
+	"github.com/wi-ed/wi/wicore/lang"
+	"github.com/wi-ed/wi/wicore/raster"
+)
+
+// buildSource is the source of the diagnostics parsed from the output of the
+// build and run commands.
+const buildSource = "build"
+
+// buildKey identifies a command to build or run the documents of a FileType.
+type buildKey struct {
+	fileType wicore.FileType
+	kind     string // "build" or "run".
+}
+
+// defaultBuildCommands are used unless build_command overrides them. %f is
+// replaced with the path of the document and %d with its directory.
+var defaultBuildCommands = map[buildKey]string{
+	{wicore.CodeGo, "build"}: "go build ./...",
+	{wicore.CodeGo, "run"}:   "go run %d",
+}
+
+// quickfixRe matches the compiler messages formatted as path:line: message or
+// path:line:col: message.
+var quickfixRe = regexp.MustCompile(`^\s*([^\s:][^:]*):(\d+)(?::(\d+))?:\s*(.*)$`)
+
+// quickfix is an error printed by a build, with its location.
+type quickfix struct {
+	row  int // Line of the output.
+	path string
+	*diagnostic
+}
+
+// parseQuickfix returns the error printed on the line of output of a command
+// run in dir, if any.
+func parseQuickfix(dir, line string) (string, *diagnostic, bool) {
+	m := quickfixRe.FindStringSubmatch(line)
+	if m == nil {
+		return "", nil, false
+	}
+	l, err := strconv.Atoi(m[2])
+	if err != nil || l < 1 {
+		return "", nil, false
+	}
+	c := 1
+	if m[3] != "" {
+		if c, err = strconv.Atoi(m[3]); err != nil || c < 1 {
+			return "", nil, false
+		}
+	}
+	path := m[1]
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	s := severityError
+	if strings.HasPrefix(m[4], "warning:") {
+		s = severityWarning
+	}
+	return path, &diagnostic{buildSource, s, l - 1, c - 1, l - 1, c - 1, m[4]}, true
+}
+
+// buildJob is a build or run command running in the background. Its output is
+// kept for the output View and the errors it prints form the quickfix list.
+type buildJob struct {
+	cmdLine   []string
+	dir       string // Working directory, the project root of the document.
+	proc      *os.Process
+	cancelled chan struct{}
+	started   time.Time
+	status    string
+	lines     []string
+	quickfix  []quickfix
+	current   int                      // Index in quickfix of the last error jumped to; -1 before the first one.
+	errors    map[string][]*diagnostic // Errors by path, as published.
+	done      bool
+}
+
+func (j *buildJob) String() string {
+	return strings.Join(j.cmdLine, " ")
+}
+
+// cancel kills the process group and discards its remaining output.
+func (j *buildJob) cancel() {
+	if j.done {
+		return
+	}
+	j.done = true
+	j.status = buildCancelled.String()
+	close(j.cancelled)
+	if err := killProcessGroup(j.proc); err != nil {
+		log.Printf("%s: kill failed: %s", j, err)
+	}
+}
+
+// buildCommand returns the command line to build or run the documents of the
+// FileType.
+func (e *editor) buildCommand(ft wicore.FileType, kind string) []string {
+	if cmdLine, ok := e.buildCommands[buildKey{ft, kind}]; ok {
+		return cmdLine
+	}
+	return wicore.SplitCommandLine(defaultBuildCommands[buildKey{ft, kind}])
+}
+
+// runInBackground starts the command in dir. onLine is called with each line
+// it prints and onDone with its exit status, both on the event loop. They are
+// not called anymore once cancelled is closed or the editor quit.
+//
+// The command runs in its own process group, to be killed with
+// killProcessGroup. The output is read from a pipe that the process and the
+// ones it starts write to directly, so waiting for the process doesn't depend
+// on them.
+func (e *editor) runInBackground(args []string, dir string, cancelled chan struct{}, onLine func(l string), onDone func(err error)) (*os.Process, error) {
+	r, pw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	setProcessGroup(cmd)
+	err = cmd.Start()
+	// The processes have their own copy of the write end.
+	_ = pw.Close()
+	if err != nil {
+		_ = r.Close()
+		return nil, err
+	}
+	waited := make(chan error, 1)
+	wicore.Go("processWait", func() {
+		waited <- cmd.Wait()
+	})
+	wicore.Go("processOutput", func() {
+		// The output is read until the end even when cancelled so the process
+		// is never blocked on the pipe.
+		ok := true
+		b := bufio.NewReader(r)
+		for {
+			l, err := b.ReadString('\n')
+			if l = strings.TrimRight(l, "\r\n"); l != "" && ok {
+				ok = e.post(cancelled, func() { onLine(l) })
+			}
+			if err != nil {
+				break
+			}
+		}
+		_ = r.Close()
+		err := <-waited
+		if ok {
+			e.post(cancelled, func() { onDone(err) })
+		}
+	})
+	return cmd.Process, nil
+}
+
+// startBuild runs the build or run command of the document of the Window in
+// the background, cancelling the one still running. The output is shown at
+// the bottom.
+func (e *editor) startBuild(w *window, kind string) error {
+	d, ok := getDocument(w).(*document)
+	if !ok || d.filePath == "" {
+		return errors.New(noDocument.String())
+	}
+	cmdLine := e.buildCommand(d.FileType(), kind)
+	if len(cmdLine) == 0 {
+		return errors.New(noBuildCommand.Sprintf(kind, d.FileType()))
+	}
+	// The command runs in the project root, so the paths are absolute.
+	path, err := filepath.Abs(d.filePath)
+	if err != nil {
+		return err
+	}
+	args := make([]string, len(cmdLine))
+	for i, a := range cmdLine {
+		a = strings.Replace(a, "%f", path, -1)
+		args[i] = strings.Replace(a, "%d", filepath.Dir(path), -1)
+	}
+	if e.build != nil {
+		e.build.cancel()
+	}
+	e.clearDiagnostics(buildSource)
+
+	j := &buildJob{
+		cmdLine:   args,
+		dir:       projectRoot(filepath.Dir(path)),
+		cancelled: make(chan struct{}),
+		started:   time.Now(),
+		status:    buildRunning.String(),
+		current:   -1,
+		errors:    map[string][]*diagnostic{},
+	}
+	proc, err := e.runInBackground(args, j.dir, j.cancelled, func(l string) {
+		e.onBuildOutput(j, l)
+	}, func(err error) {
+		e.onBuildDone(j, err)
+	})
+	if err != nil {
+		e.build = nil
+		return err
+	}
+	j.proc = proc
+	e.build = j
+	return e.showOutput(w)
+}
+
+// onBuildOutput appends a line of output of the job and publishes the error
+// it contains, if any.
+func (e *editor) onBuildOutput(j *buildJob, line string) {
+	if e.build != j || j.done {
+		return
+	}
+	if path, g, ok := parseQuickfix(j.dir, line); ok {
+		j.quickfix = append(j.quickfix, quickfix{len(j.lines), path, g})
+		p := diagnosticsPath(path)
+		j.errors[p] = append(j.errors[p], g)
+		e.publishDiagnostics(p, buildSource, j.errors[p])
+	}
+	j.lines = append(j.lines, line)
+	wicore.PostCommand(e, nil, "editor_redraw")
+}
+
+func (e *editor) onBuildDone(j *buildJob, err error) {
+	if e.build != j || j.done {
+		return
+	}
+	j.done = true
+	d := time.Since(j.started) / time.Millisecond * time.Millisecond
+	if err != nil {
+		j.status = buildExited.Sprintf(d, err)
+	} else {
+		j.status = buildSucceeded.Sprintf(d)
+	}
+	wicore.PostCommand(e, nil, "editor_redraw")
+}
+
+// showOutput shows the output View at the bottom, keeping the Window w
+// active.
+func (e *editor) showOutput(w *window) error {
+	for _, child := range e.rootWindow.childrenWindows {
+		if _, ok := child.view.(*outputView); ok {
+			return nil
+		}
+	}
+	if _, err := e.ExecuteCommand(w, "window_new", e.rootWindow.ID(), "bottom", "output"); err != nil {
+		return err
+	}
+	return e.activateWindow(w)
+}
+
+// gotoQuickfix jumps to the next or the previous error of the build.
+func (e *editor) gotoQuickfix(next bool) error {
+	j := e.build
+	if j == nil {
+		return errors.New(noBuildOutput.String())
+	}
+	i := j.current - 1
+	if next {
+		i = j.current + 1
+	}
+	if i < 0 || i >= len(j.quickfix) {
+		return errors.New(noMoreQuickfix.String())
+	}
+	return e.gotoQuickfixAt(i)
+}
+
+// gotoQuickfixAt jumps to the error of the build at index i of the quickfix
+// list.
+func (e *editor) gotoQuickfixAt(i int) error {
+	j := e.build
+	j.current = i
+	q := j.quickfix[i]
+	for _, child := range e.rootWindow.childrenWindows {
+		if v, ok := child.view.(*outputView); ok {
+			v.selected = q.row
+			v.follow = false
+		}
+	}
+	return e.gotoDiagnostic(q.path, q.diagnostic)
+}
+
+// outputView shows the output of the last build or run command.
+type outputView struct {
+	view
+	e        *editor
+	selected int  // Index of the selected row.
+	offset   int  // First row shown.
+	follow   bool // Keep the last row selected as the output grows.
+}
+
+func (v *outputView) lines() []string {
+	if v.e.build == nil {
+		return nil
+	}
+	return v.e.build.lines
+}
+
+func (v *outputView) Buffer() *raster.Buffer {
+	v.buffer.Fill(raster.Cell{R: ' ', F: v.DefaultFormat()})
+	j := v.e.build
+	if j == nil {
+		f := v.DefaultFormat()
+		f.Fg = colors.DarkGray
+		v.buffer.DrawString(noBuildOutput.String(), 0, 0, f)
+		return v.buffer
+	}
+	v.title = outputTitle.Sprintf(j, j.status)
+	lines := j.lines
+	if v.follow || v.selected >= len(lines) {
+		v.selected = len(lines) - 1
+	}
+	if v.selected < 0 {
+		v.selected = 0
+	}
+	if v.selected < v.offset {
+		v.offset = v.selected
+	} else if v.actualY > 0 && v.selected >= v.offset+v.actualY {
+		v.offset = v.selected - v.actualY + 1
+	}
+	errorRows := map[int]severity{}
+	for _, q := range j.quickfix {
+		errorRows[q.row] = q.severity
+	}
+	for i := v.offset; i < len(lines) && i-v.offset < v.actualY; i++ {
+		f := v.DefaultFormat()
+		if s, ok := errorRows[i]; ok {
+			f.Fg = severityInfos[s].fg
+		}
+		if i == v.selected {
+			f.Fg, f.Bg = v.DefaultFormat().Bg, v.DefaultFormat().Fg
+		}
+		v.buffer.DrawString(lines[i], 0, i-v.offset, f)
+	}
+	return v.buffer
+}
+
+func (v *outputView) onTerminalKeyPressed(k key.Press) {
+	if v.window == nil || v.e.ActiveWindow() != v.window {
+		return
+	}
+	switch {
+	case k.Key == key.Enter:
+		if j := v.e.build; j != nil {
+			for i, q := range j.quickfix {
+				if q.row == v.selected {
+					v.e.alertOnError(v.e.gotoQuickfixAt(i))
+					break
+				}
+			}
+		}
+	case k.Ch == 'q':
+		wicore.PostCommand(v.e, nil, "window_close", v.window.ID())
+	}
+	wicore.PostCommand(v.e, nil, "editor_redraw")
+}
+
+func cmdToOutput(handler func(v *outputView)) wicore.CommandImplHandler {
+	return func(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
+		v, ok := w.View().(*outputView)
+		if !ok {
+			return nil, errors.New("internal error")
+		}
+		handler(v)
+		wicore.PostCommand(e, nil, "editor_redraw")
+		return nil, nil
+	}
+}
+
+func cmdOutputCursorDown(v *outputView) {
+	if v.selected < len(v.lines())-1 {
+		v.selected++
+	}
+	// Going past the end follows the output again.
+	v.follow = v.selected >= len(v.lines())-1
+}
+
+func cmdOutputCursorUp(v *outputView) {
+	if v.selected > 0 {
+		v.selected--
+	}
+	v.follow = false
+}
+
+// outputViewFactory returns a View showing the output of the last build or
+// run command.
+func outputViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
+	dispatcher := makeCommands()
+	cmds := []wicore.Command{
+		&wicore.CommandImpl{
+			"output_cursor_down",
+			nil,
+			cmdToOutput(cmdOutputCursorDown),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Selects the next line of output",
+			},
+			lang.Map{
+				lang.En: "Selects the next line of output. Selecting the last line follows the output as it is printed.",
+			},
+		},
+		&wicore.CommandImpl{
+			"output_cursor_up",
+			nil,
+			cmdToOutput(cmdOutputCursorUp),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Selects the previous line of output",
+			},
+			lang.Map{
+				lang.En: "Selects the previous line of output.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+	bindings := makeKeyBindings()
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Down}, "output_cursor_down")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Up}, "output_cursor_up")
+
+	v := &outputView{
+		view{
+			commands:      dispatcher,
+			keyBindings:   bindings,
+			eventRegistry: e,
+			id:            id,
+			title:         "Output",
+			naturalX:      -1,
+			naturalY:      10,
+			defaultFormat: raster.CellFormat{Fg: colors.White, Bg: colors.Black},
+		},
+		e.(*editor),
+		0,
+		0,
+		true,
+	}
+	v.events = append(v.events, e.RegisterTerminalKeyPressed(v.onTerminalKeyPressed))
+	return v
+}
+
+// Commands.
+
+func cmdBuildCancel(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	if e.build != nil {
+		e.build.cancel()
+		wicore.PostCommand(e, nil, "editor_redraw")
+	}
+	return nil, nil
+}
+
+func cmdBuildCommand(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	k := buildKey{wicore.FileType(args.String(0)), args.String(1)}
+	if k.kind != "build" && k.kind != "run" {
+		return nil, errors.New(invalidBuildKind.Sprintf(k.kind))
+	}
+	if args.String(2) == "" {
+		delete(e.buildCommands, k)
+	} else {
+		e.buildCommands[k] = wicore.SplitCommandLine(args.String(2))
+	}
+	return nil, nil
+}
+
+func cmdOutput(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	for _, child := range e.rootWindow.childrenWindows {
+		if _, ok := child.view.(*outputView); ok {
+			return nil, e.activateWindow(child)
+		}
+	}
+	return e.ExecuteCommand(w, "window_new", e.rootWindow.ID(), "bottom", "output")
+}
+
+func cmdQuickfixNext(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	return nil, e.gotoQuickfix(true)
+}
+
+func cmdQuickfixPrev(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	return nil, e.gotoQuickfix(false)
+}
+
+// RegisterBuildCommands registers the commands to configure the build and run
+// commands and to navigate their errors.
+func RegisterBuildCommands(dispatcher wicore.CommandsW) {
+	cmds := []wicore.Command{
+		&privilegedCommandImpl{
+			"build_cancel",
+			nil,
+			cmdBuildCancel,
+			wicore.CommandsCategory,
+			lang.Map{
+				lang.En: "Cancels the build",
+			},
+			lang.Map{
+				lang.En: "Kills the build or run command still running.",
+			},
+		},
+		&privilegedCommandImpl{
+			"build_command",
+			wicore.CommandArgs{
+				{Name: "filetype", Type: wicore.ArgString},
+				{Name: "kind", Type: wicore.ArgString},
+				{Name: "command", Type: wicore.ArgString, Optional: true},
+			},
+			cmdBuildCommand,
+			wicore.CommandsCategory,
+			lang.Map{
+				lang.En: "Configures the build and run commands",
+			},
+			lang.Map{
+				lang.En: "Sets the command line used by document_build, when kind is build, or document_run, when kind is run, for the documents of the FileType, e.g. 'build_command Code.Go build \"go vet ./...\"' in the .wirc of the project. %f is replaced with the path of the document and %d with its directory. The command runs in the project root. Without a command line, the default one is restored.",
+			},
+		},
+		&privilegedCommandImpl{
+			"output",
+			nil,
+			cmdOutput,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Shows the output of the build",
+			},
+			lang.Map{
+				lang.En: "Shows the output of the last build or run command at the bottom. Use Enter to jump to the error on the selected line.",
+			},
+		},
+		&privilegedCommandImpl{
+			"quickfix_next",
+			nil,
+			cmdQuickfixNext,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Jumps to the next build error",
+			},
+			lang.Map{
+				lang.En: "Jumps to the next error printed by the last build or run command, loading its file as needed.",
+			},
+		},
+		&privilegedCommandImpl{
+			"quickfix_prev",
+			nil,
+			cmdQuickfixPrev,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Jumps to the previous build error",
+			},
+			lang.Map{
+				lang.En: "Jumps to the previous error printed by the last build or run command, loading its file as needed.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+)
+
+func TestBuild(t *testing.T) {
+	defer keepLog(t)()
+
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not in PATH")
+	}
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	tmpDir, err = filepath.EvalSymlinks(tmpDir)
+	ut.AssertEqual(t, nil, err)
+	path := filepath.Join(tmpDir, "a.go")
+	ut.AssertEqual(t, nil, ioutil.WriteFile(filepath.Join(tmpDir, "go.mod"), []byte("module example.com/b\n\ngo 1.16\n"), 0600))
+	ut.AssertEqual(t, nil, ioutil.WriteFile(path, []byte("package main\n\nfunc main() {\n\tundefined()\n}\n"), 0600))
+	sleeper := filepath.Join(tmpDir, "sleeper")
+	ut.AssertEqual(t, nil, os.Mkdir(filepath.Join(tmpDir, "sleep"), 0700))
+	// The sleeper starts a copy of itself that outlives it unless its process
+	// group is killed, and prints its PID.
+	sleeperSrc := "package main\n\nimport (\n\t\"fmt\"\n\t\"os\"\n\t\"os/exec\"\n\t\"time\"\n)\n\nfunc main() {\n\tif len(os.Args) == 1 {\n\t\tc := exec.Command(os.Args[0], \"child\")\n\t\tif err := c.Start(); err != nil {\n\t\t\tpanic(err)\n\t\t}\n\t\tfmt.Println(c.Process.Pid)\n\t}\n\ttime.Sleep(time.Minute)\n}\n"
+	ut.AssertEqual(t, nil, ioutil.WriteFile(filepath.Join(tmpDir, "sleep", "main.go"), []byte(sleeperSrc), 0600))
+	cmd := exec.Command("go", "build", "-o", sleeper, "./sleep")
+	cmd.Dir = tmpDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("failed to build: %s\n%s", err, out)
+	}
+
+	ed, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+	var errs []string
+	var got []string
+	post := func(cmd string, args ...string) {
+		wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+			if o.Err != nil {
+				errs = append(errs, o.Err.Error())
+			}
+		}, cmd, args...)
+	}
+	activeView := func() *documentView {
+		return e.ActiveWindow().View().(*documentView)
+	}
+	done := func() bool {
+		return e.build != nil && e.build.done
+	}
+	var first *buildJob
+	// running returns true if the process printed on the first line of the job
+	// is still running.
+	running := func(j *buildJob) bool {
+		if runtime.GOOS != "linux" {
+			return false
+		}
+		b, err := ioutil.ReadFile("/proc/" + j.lines[0] + "/stat")
+		return err == nil && !strings.Contains(string(b), ") Z ")
+	}
+	// Each step runs once the previous condition is met.
+	steps := []struct {
+		run   func()
+		until func() bool
+	}{
+		{
+			func() {
+				post("document_build")
+			},
+			done,
+		},
+		{
+			func() {
+				got = append(got, e.build.lines...)
+				got = append(got, e.build.status[:len("failed")])
+				// The focus stays on the document.
+				ut.AssertEqual(t, path, activeView().document.filePath)
+				g := e.diagnostics[path]
+				ut.AssertEqual(t, 1, len(g))
+				ut.AssertEqual(t, "3:1 undefined: undefined [build]", fmt.Sprintf("%d:%d %s [%s]", g[0].line, g[0].col, g[0].message, g[0].source))
+				post("quickfix_next")
+				post("quickfix_next")
+			},
+			func() bool { return activeView().CursorLine == 3 },
+		},
+		{
+			func() {
+				v := activeView()
+				got = append(got, fmt.Sprintf("cursor %d:%d", v.CursorLine, v.CursorColumn))
+				ut.AssertEqual(t, nil, ioutil.WriteFile(path, []byte("package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n"), 0600))
+				post("document_run")
+			},
+			done,
+		},
+		{
+			func() {
+				// The errors of the previous build are gone.
+				ut.AssertEqual(t, 0, len(e.diagnostics))
+				got = append(got, e.build.lines...)
+				got = append(got, e.build.status[:len("succeeded")])
+				for _, child := range e.rootWindow.childrenWindows {
+					if v, ok := child.view.(*outputView); ok {
+						got = append(got, string(v.Buffer().Line(0)[0].R))
+					}
+				}
+				// A build still running is cancelled when a new one starts.
+				post("build_command", "Code.Go", "build", sleeper)
+				post("document_build")
+			},
+			func() bool { return e.build != nil && !e.build.done && len(e.build.lines) == 1 },
+		},
+		{
+			func() {
+				first = e.build
+				post("document_build")
+			},
+			func() bool { return e.build != first && len(e.build.lines) == 1 },
+		},
+		{
+			func() {
+				got = append(got, first.status)
+				post("build_cancel")
+			},
+			done,
+		},
+		{
+			func() {
+				got = append(got, e.build.status)
+			},
+			// The processes started by the commands are killed with them.
+			func() bool { return !running(first) && !running(e.build) },
+		},
+		{
+			func() {
+				wicore.PostCommand(e, nil, "q!")
+			},
+			func() bool { return true },
+		},
+	}
+	step := 0
+	var wait func(o wicore.CommandOutcome)
+	wait = func(o wicore.CommandOutcome) {
+		if !steps[step].until() {
+			wicore.PostCommand(e, wait, "editor_redraw")
+			return
+		}
+		step++
+		steps[step].run()
+		if step < len(steps)-1 {
+			wicore.PostCommand(e, wait, "editor_redraw")
+		}
+	}
+	wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+		ut.AssertEqual(t, nil, o.Err)
+		steps[0].run()
+		wait(o)
+	}, "open", path)
+	ut.AssertEqual(t, 0, e.EventLoop())
+
+	expected := []string{
+		"# example.com/b",
+		"./a.go:4:2: undefined: undefined",
+		"failed",
+		"cursor 3:1",
+		"hello",
+		"succeeded",
+		"h",
+		"cancelled",
+		"cancelled",
+	}
+	ut.AssertEqual(t, expected, got)
+	ut.AssertEqual(t, []string{"There are no more errors in this direction."}, errs)
+}
+
+func TestBuildRelativePath(t *testing.T) {
+	defer keepLog(t)()
+
+	if _, err := exec.LookPath("echo"); err != nil {
+		t.Skip("echo is not in PATH")
+	}
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	tmpDir, err = filepath.EvalSymlinks(tmpDir)
+	ut.AssertEqual(t, nil, err)
+	sub := filepath.Join(tmpDir, "sub")
+	ut.AssertEqual(t, nil, os.Mkdir(sub, 0700))
+	ut.AssertEqual(t, nil, ioutil.WriteFile(filepath.Join(tmpDir, "go.mod"), []byte("module example.com/b\n"), 0600))
+	ut.AssertEqual(t, nil, ioutil.WriteFile(filepath.Join(sub, "a.go"), []byte("package sub\n"), 0600))
+	wd, err := os.Getwd()
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, nil, os.Chdir(sub))
+	defer func() {
+		ut.AssertEqual(t, nil, os.Chdir(wd))
+	}()
+
+	ed, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+	var wait func(o wicore.CommandOutcome)
+	wait = func(o wicore.CommandOutcome) {
+		if e.build == nil || !e.build.done {
+			wicore.PostCommand(e, wait, "editor_redraw")
+			return
+		}
+		wicore.PostCommand(e, nil, "q!")
+	}
+	wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+		ut.AssertEqual(t, nil, o.Err)
+		wicore.PostCommand(e, nil, "build_command", "Code.Go", "build", "echo %f %d")
+		wicore.PostCommand(e, wait, "document_build")
+	}, "open", "a.go")
+	ut.AssertEqual(t, 0, e.EventLoop())
+
+	// The document opened with a relative path is built from the project root.
+	ut.AssertEqual(t, tmpDir, e.build.dir)
+	ut.AssertEqual(t, []string{filepath.Join(sub, "a.go") + " " + sub}, e.build.lines)
+}
+
+func TestParseQuickfix(t *testing.T) {
+	data := []struct {
+		line     string
+		expected string
+	}{
+		{"./a.go:4:2: undefined: x", "/d/a.go 3:1 error undefined: x"},
+		{"\t/b/c_test.go:12: warning: odd", "/b/c_test.go 11:0 warning warning: odd"},
+		{"--- FAIL: TestX (0.00s)", ""},
+		{"# example.com/b", ""},
+		{"a.go:0: zero", ""},
+	}
+	for i, l := range data {
+		s := ""
+		if path, g, ok := parseQuickfix("/d", l.line); ok {
+			s = fmt.Sprintf("%s %d:%d %s %s", path, g.line, g.col, g.severity, g.message)
+		}
+		ut.AssertEqualIndex(t, i, l.expected, s)
+	}
+}
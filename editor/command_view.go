@@ -5,9 +5,14 @@
 package editor
 
 import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+
 	"github.com/wi-ed/wi/wicore"
 	"github.com/wi-ed/wi/wicore/colors"
 	"github.com/wi-ed/wi/wicore/key"
+	"github.com/wi-ed/wi/wicore/lang"
 	"github.com/wi-ed/wi/wicore/raster"
 )
 
@@ -16,45 +21,121 @@ import (
 // screen.
 type commandView struct {
 	view
+	e    wicore.Editor
 	text string
 }
 
 func (v *commandView) Buffer() *raster.Buffer {
-	v.buffer.Fill(raster.Cell{' ', v.DefaultFormat()})
+	v.buffer.Fill(raster.Cell{R: ' ', F: v.DefaultFormat()})
 	v.buffer.DrawString(v.text, 0, 0, v.DefaultFormat())
 	return v.buffer
 }
 
 func (v *commandView) onTerminalKeyPressed(k key.Press) {
-	// TODO(maruel): React to keys.
+	if v.window == nil || v.e.ActiveWindow() != v.window {
+		return
+	}
 	if k.Ch != '\000' {
 		v.text += string(k.Ch)
 	} else {
 		switch k.Key {
 		case key.Escape:
 			// Dismiss window.
+			wicore.PostCommand(v.e, nil, "window_close", v.window.ID())
 		case key.Enter:
-			// Execute command.
+			// Execute command. The command window is closed first so the command
+			// is executed in the context of the Window that was active before.
+			cmds := [][]string{{"window_close", v.window.ID()}}
+			if tokens := wicore.SplitCommandLine(v.text); len(tokens) != 0 {
+				cmds = append(cmds, tokens)
+			}
+			v.e.TriggerCommands(wicore.EnqueuedCommands{cmds, false, v.showResult})
 		case key.Space:
 			v.text += " "
 		case key.Tab:
-			// Command completion.
+			v.complete()
+		}
+	}
+	wicore.PostCommand(v.e, nil, "editor_redraw")
+}
+
+// showResult alerts the output of the command typed, e.g. the value returned
+// by "get".
+func (v *commandView) showResult(outcomes []wicore.CommandOutcome) {
+	if o := outcomes[len(outcomes)-1]; len(outcomes) > 1 && o.Err == nil && len(o.Result) != 0 {
+		wicore.PostCommand(v.e, nil, "alert", strings.Join(o.Result, " "))
+	}
+}
+
+// complete completes the last token of the command line up to the longest
+// common prefix of the candidates.
+func (v *commandView) complete() {
+	candidates := wicore.CompleteCommandLine(v.e, v.window.Parent(), v.text)
+	if len(candidates) == 0 {
+		return
+	}
+	tokens := wicore.SplitCommandLine(v.text)
+	if len(v.text) == 0 || strings.HasSuffix(v.text, " ") {
+		tokens = append(tokens, "")
+	}
+	last := commonPrefix(candidates)
+	tokens[len(tokens)-1] = last
+	v.text = wicore.JoinCommandLine(tokens)
+	if len(candidates) == 1 {
+		// Unambiguous, get ready for the next argument.
+		v.text += " "
+	}
+}
+
+// commonPrefix returns the longest prefix common to all the items. It is cut
+// on a rune boundary.
+func commonPrefix(items []string) string {
+	out := items[0]
+	for _, item := range items[1:] {
+		for !strings.HasPrefix(item, out) {
+			_, size := utf8.DecodeLastRuneInString(out)
+			out = out[:len(out)-size]
 		}
 	}
+	return out
 }
 
-// The command dialog box.
+func cmdCommandWindowBackspace(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	v, ok := w.View().(*commandView)
+	if !ok {
+		return nil, errors.New("internal error")
+	}
+	if r := []rune(v.text); len(r) != 0 {
+		v.text = string(r[:len(r)-1])
+		wicore.PostCommand(e, nil, "editor_redraw")
+	}
+	return nil, nil
+}
+
+// The command dialog box. The arguments, if any, are the initial text.
 //
 // TODO(maruel): Position it 5 lines below the cursor in the parent Window's
 // View. Do this via onAttach.
 func commandViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
+	dispatcher := makeCommands()
+	dispatcher.Register(&wicore.CommandImpl{
+		"command_window_backspace",
+		nil,
+		cmdCommandWindowBackspace,
+		wicore.CommandsCategory,
+		lang.Map{
+			lang.En: "Deletes the last character",
+		},
+		lang.Map{
+			lang.En: "Deletes the last character of the command being typed.",
+		},
+	})
 	bindings := makeKeyBindings()
 	// Fill up the key bindings. This includes basic cursor movement, help, etc.
-	//bindings.Set(wicore.AllMode, key.Press{Key: key.Enter}, "execute_command")
-	//bindings.Set(wicore.AllMode, key.Press{Key: key.Escape}, "window_close")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Backspace}, "command_window_backspace")
 	v := &commandView{
 		view{
-			commands:      makeCommands(),
+			commands:      dispatcher,
 			keyBindings:   bindings,
 			id:            id,
 			title:         "Command",
@@ -62,11 +143,9 @@ func commandViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
 			naturalY:      1,
 			defaultFormat: raster.CellFormat{Fg: colors.Green, Bg: colors.Black},
 		},
-		"",
+		e,
+		strings.Join(args, " "),
 	}
-	event := e.RegisterTerminalKeyPressed(v.onTerminalKeyPressed)
-	e.RegisterViewActivated(func(v wicore.View) {
-		_ = event.Close()
-	})
+	v.events = append(v.events, e.RegisterTerminalKeyPressed(v.onTerminalKeyPressed))
 	return v
 }
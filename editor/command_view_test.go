@@ -0,0 +1,19 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestCommonPrefix(t *testing.T) {
+	ut.AssertEqual(t, "doc", commonPrefix([]string{"document_save", "doc", "documents"}))
+	ut.AssertEqual(t, "", commonPrefix([]string{"a", "b"}))
+	// The prefix is not cut in the middle of a rune.
+	ut.AssertEqual(t, "", commonPrefix([]string{"éa", "è"}))
+	ut.AssertEqual(t, "é", commonPrefix([]string{"éa", "éb"}))
+}
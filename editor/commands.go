@@ -5,6 +5,7 @@
 package editor
 
 import (
+	"errors"
 	"github.com/wi-ed/wi/wicore"
 	"github.com/wi-ed/wi/wicore/lang"
 )
@@ -41,9 +42,8 @@ func makeCommands() wicore.CommandsW {
 	return &commands{make(map[string]wicore.Command), nil}
 }
 
-// privilegedCommandImplHandler is the CommandHandler to use when coupled with
-// privilegedCommandImpl.
-type privilegedCommandImplHandler func(c *privilegedCommandImpl, e *editor, w *window, args ...string)
+// privilegedCommandImplHandler is the handler of a privilegedCommandImpl.
+type privilegedCommandImplHandler func(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error)
 
 // privilegedCommandImpl is the boilerplate Command implementation for builtin
 // commands that can access the editor directly.
@@ -54,7 +54,7 @@ type privilegedCommandImplHandler func(c *privilegedCommandImpl, e *editor, w *w
 // this, it can only be native commands inside the editor process.
 type privilegedCommandImpl struct {
 	NameValue      string
-	ExpectedArgs   int // If >= 0, the command will be aborted if the number of arguments is not exactly this value. Set to -1 to disable verification. On abort, an alert with the long description of the command is done.
+	ArgsValue      wicore.CommandArgs // Arguments are validated and converted according to this schema before HandlerValue is called.
 	HandlerValue   privilegedCommandImplHandler
 	CategoryValue  wicore.CommandCategory
 	ShortDescValue lang.Map
@@ -65,14 +65,15 @@ func (c *privilegedCommandImpl) Name() string {
 	return c.NameValue
 }
 
-func (c *privilegedCommandImpl) Handle(e wicore.EditorW, w wicore.Window, args ...string) {
-	if c.ExpectedArgs != -1 && len(args) != c.ExpectedArgs {
-		e.ExecuteCommand(w, "alert", c.LongDesc())
-	}
+func (c *privilegedCommandImpl) Args() wicore.CommandArgs {
+	return c.ArgsValue
+}
+
+func (c *privilegedCommandImpl) Handle(e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
 	// Convert types to internal types.
 	ed := e.(*editor)
 	wInternal := w.(*window)
-	c.HandlerValue(c, ed, wInternal, args...)
+	return c.HandlerValue(c, ed, wInternal, args)
 }
 
 func (c *privilegedCommandImpl) Category(e wicore.Editor, w wicore.Window) wicore.CommandCategory {
@@ -89,23 +90,18 @@ func (c *privilegedCommandImpl) LongDesc() string {
 
 // Commands
 
-func cmdCommandAlias(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
-	if args[0] == "window" {
-	} else if args[0] == "global" {
+func cmdCommandAlias(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	if args.String(0) == "global" {
 		w = wicore.RootWindow(w)
-	} else {
-		cmd := wicore.GetCommand(e, w, "command_alias")
-		e.ExecuteCommand(w, "alert", cmd.LongDesc())
-		return
 	}
-	alias := &wicore.CommandAlias{args[1], args[2], nil}
+	alias := &wicore.CommandAlias{args.String(1), args.String(2), nil}
 	// TODO(maruel): Handle views in different process?
 	viewW, ok := w.View().(wicore.ViewW)
 	if !ok {
-		e.ExecuteCommand(w, "alert", "internal failure")
-		return
+		return nil, errors.New("internal failure")
 	}
 	viewW.CommandsW().Register(alias)
+	return nil, nil
 }
 
 // RegisterCommandCommands registers the top-level native commands.
@@ -113,7 +109,11 @@ func RegisterCommandCommands(dispatcher wicore.CommandsW) {
 	cmds := []wicore.Command{
 		&wicore.CommandImpl{
 			"command_alias",
-			3,
+			wicore.CommandArgs{
+				{Name: "scope", Type: wicore.ArgEnum, Values: []string{"window", "global"}},
+				{Name: "alias", Type: wicore.ArgString},
+				{Name: "name", Type: wicore.ArgString},
+			},
 			cmdCommandAlias,
 			wicore.CommandsCategory,
 			lang.Map{
@@ -121,7 +121,7 @@ func RegisterCommandCommands(dispatcher wicore.CommandsW) {
 			},
 			lang.Map{
 				// TODO(maruel): For complex aliasing, use macro?
-				lang.En: "Usage: command_alias [window|global] <alias> <name>\nBinds an alias to another command. The alias can either be local to the window or global",
+				lang.En: "Binds an alias to another command. The alias can either be local to the window or global.",
 			},
 		},
 
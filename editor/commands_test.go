@@ -0,0 +1,39 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+)
+
+func TestCommandsOutcome(t *testing.T) {
+	defer keepLog(t)()
+
+	terminal := NewTerminalFake(80, 25, []TerminalEvent{})
+	editor, err := MakeEditor(terminal, true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = editor.Close()
+	}()
+
+	var outcomes []wicore.CommandOutcome
+	editor.TriggerCommands(wicore.EnqueuedCommands{
+		[][]string{{"editor_redraw"}, {"invalid"}, {"editor_redraw"}},
+		true,
+		func(o []wicore.CommandOutcome) {
+			outcomes = o
+		},
+	})
+	wicore.PostCommand(editor, nil, "editor_quit")
+	ut.AssertEqual(t, 0, editor.EventLoop())
+
+	ut.AssertEqual(t, 3, len(outcomes))
+	ut.AssertEqual(t, nil, outcomes[0].Err)
+	ut.AssertEqual(t, "Command \"invalid\" is not registered.", outcomes[1].Err.Error())
+	ut.AssertEqual(t, "Command \"editor_redraw\" was skipped due to a previous failure.", outcomes[2].Err.Error())
+}
@@ -11,22 +11,20 @@ import (
 	"github.com/wi-ed/wi/wicore/lang"
 )
 
-func cmdDoc(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+func cmdDoc(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
 	// TODO(maruel): Grab the current word under selection if no args is
 	// provided. Pass this token to shell.
-	docArgs := make([]string, len(args)+1)
+	tokens := args.Strings(0)
+	docArgs := make([]string, len(tokens)+1)
 	docArgs[0] = "doc"
-	copy(docArgs[1:], args)
+	copy(docArgs[1:], tokens)
 	//dispatcher.Execute(w, "shell", docArgs...)
+	return nil, nil
 }
 
-func cmdHelp(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
-	// TODO(maruel): Creates a new Window with a ViewHelp.
-	log.Printf("Faking help: %s", args)
-}
-
-func cmdShell(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
-	log.Printf("Faking opening a new shell: %s", args)
+func cmdShell(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	log.Printf("Faking opening a new shell: %s", args.Strings(0))
+	return nil, nil
 }
 
 // RegisterTodoCommands registers the top-level native commands that are yet to
@@ -37,7 +35,7 @@ func RegisterTodoCommands(dispatcher wicore.CommandsW) {
 	cmds := []wicore.Command{
 		&wicore.CommandImpl{
 			"doc",
-			-1,
+			wicore.CommandArgs{{Name: "token", Type: wicore.ArgString, Optional: true, Variadic: true}},
 			cmdDoc,
 			wicore.WindowCategory,
 			lang.Map{
@@ -47,21 +45,9 @@ func RegisterTodoCommands(dispatcher wicore.CommandsW) {
 				lang.En: "Uses the 'doc' tool to get documentation about the text under the cursor.",
 			},
 		},
-		&wicore.CommandImpl{
-			"help",
-			-1,
-			cmdHelp,
-			wicore.WindowCategory,
-			lang.Map{
-				lang.En: "Prints help",
-			},
-			lang.Map{
-				lang.En: "Prints general help or help for a particular command.",
-			},
-		},
 		&wicore.CommandImpl{
 			"shell",
-			-1,
+			wicore.CommandArgs{{Name: "args", Type: wicore.ArgString, Optional: true, Variadic: true}},
 			cmdShell,
 			wicore.WindowCategory,
 			lang.Map{
@@ -0,0 +1,105 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/wi-ed/wi/wicore"
+)
+
+// userConfigDir returns the directory containing the user's configuration
+// directories.
+func userConfigDir() string {
+	if d := os.Getenv("XDG_CONFIG_HOME"); d != "" {
+		return d
+	}
+	if runtime.GOOS == "windows" {
+		if d := os.Getenv("APPDATA"); d != "" {
+			return d
+		}
+	}
+	if d := os.Getenv("HOME"); d != "" {
+		return filepath.Join(d, ".config")
+	}
+	return ""
+}
+
+// ConfigPaths returns the startup scripts that exist, in execution order. The
+// user's wirc is run first, then the project's .wirc found in the current
+// directory or the closest parent directory.
+func ConfigPaths() []string {
+	out := []string{}
+	if d := userConfigDir(); d != "" {
+		p := filepath.Join(d, "wi", "wirc")
+		if _, err := os.Stat(p); err == nil {
+			out = append(out, p)
+		}
+	}
+	if wd, err := os.Getwd(); err == nil {
+		for {
+			p := filepath.Join(wd, ".wirc")
+			if _, err := os.Stat(p); err == nil {
+				out = append(out, p)
+				break
+			}
+			parent := filepath.Dir(wd)
+			if parent == wd {
+				break
+			}
+			wd = parent
+		}
+	}
+	return out
+}
+
+// RunConfig enqueues the commands of the startup script at path. The script
+// contains one command line per line. Empty lines and lines starting with '#'
+// are ignored.
+//
+// The commands are enqueued as a single batch so they are run in order before
+// any command enqueued afterward. A failing command does not stop the script.
+func RunConfig(e wicore.EventRegistry, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	cmds := [][]string{}
+	lines := []int{}
+	scanner := bufio.NewScanner(f)
+	for i := 1; scanner.Scan(); i++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if tokens := wicore.SplitCommandLine(line); len(tokens) != 0 {
+			cmds = append(cmds, tokens)
+			lines = append(lines, i)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	e.TriggerCommands(wicore.EnqueuedCommands{
+		cmds,
+		false,
+		func(outcomes []wicore.CommandOutcome) {
+			for i, o := range outcomes {
+				if o.Err != nil {
+					log.Printf("%s:%d: %s", path, lines[i], o.Err)
+				}
+			}
+		},
+	})
+	return nil
+}
@@ -0,0 +1,310 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/colors"
+	"github.com/wi-ed/wi/wicore/lang"
+	"github.com/wi-ed/wi/wicore/raster"
+)
+
+// coverBlock is a block of statements of a coverage profile. The range is
+// 0-based with byte columns, the end excluded. It follows the edits of the
+// document it is attached to.
+type coverBlock struct {
+	line    int
+	col     int
+	endLine int
+	endCol  int
+	stmts   int
+	count   int
+}
+
+// coverageBg are the background of the statements covered and not covered.
+var coverageBg = map[bool]colors.RGB{
+	true:  colors.Green,
+	false: colors.Red,
+}
+
+// parseCoverProfile returns the blocks of the profile written by
+// 'go test -coverprofile' by file, as named in the profile, e.g.
+// "example.com/a/a.go". The counts of a block listed multiple times are
+// added.
+func parseCoverProfile(r io.Reader) (map[string][]*coverBlock, error) {
+	out := map[string][]*coverBlock{}
+	seen := map[string]*coverBlock{}
+	s := bufio.NewScanner(r)
+	for i := 1; s.Scan(); i++ {
+		l := strings.TrimSpace(s.Text())
+		if l == "" || strings.HasPrefix(l, "mode:") {
+			continue
+		}
+		// name:line.col,line.col stmts count
+		colon := strings.LastIndex(l, ":")
+		fields := strings.Fields(l[colon+1:])
+		var n [6]int
+		ok := colon > 0 && len(fields) == 3
+		if ok {
+			nums := strings.FieldsFunc(fields[0], func(r rune) bool { return r == '.' || r == ',' })
+			nums = append(nums, fields[1], fields[2])
+			ok = len(nums) == 6
+			for j := 0; ok && j < 6; j++ {
+				var err error
+				n[j], err = strconv.Atoi(nums[j])
+				ok = err == nil && n[j] >= 0
+			}
+		}
+		if !ok || n[0] < 1 || n[1] < 1 || n[2] < 1 || n[3] < 1 {
+			return nil, errors.New(invalidCoverProfile.Sprintf(i))
+		}
+		k := l[:strings.LastIndex(l, " ")]
+		if b := seen[k]; b != nil {
+			b.count += n[5]
+			continue
+		}
+		b := &coverBlock{n[0] - 1, n[1] - 1, n[2] - 1, n[3] - 1, n[4], n[5]}
+		seen[k] = b
+		out[l[:colon]] = append(out[l[:colon]], b)
+	}
+	return out, s.Err()
+}
+
+// goModule returns the directory of the closest go.mod from dir and the path
+// of its module.
+func goModule(dir string) (string, string) {
+	for d := dir; ; {
+		if b, err := ioutil.ReadFile(filepath.Join(d, "go.mod")); err == nil {
+			for _, l := range strings.Split(string(b), "\n") {
+				if f := strings.Fields(l); len(f) == 2 && f[0] == "module" {
+					return d, strings.Trim(f[1], "\"`")
+				}
+			}
+			return d, ""
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return "", ""
+		}
+		d = parent
+	}
+}
+
+// coveragePath returns the path of a file named in a profile found in dir,
+// or "" if it is neither in the module of dir nor in $GOPATH.
+func coveragePath(dir, name string) string {
+	if strings.HasPrefix(name, "_/") {
+		// Outside of a module, the path is prefixed with an underscore.
+		name = name[1:]
+	}
+	if filepath.IsAbs(name) {
+		return name
+	}
+	root, module := goModule(dir)
+	if module != "" && strings.HasPrefix(name, module+"/") {
+		return filepath.Join(root, filepath.FromSlash(name[len(module)+1:]))
+	}
+	// The profiles of the packages built in GOPATH mode use the import path.
+	for _, p := range filepath.SplitList(build.Default.GOPATH) {
+		path := filepath.Join(p, "src", filepath.FromSlash(name))
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// coveragePercent returns the percentage of the statements covered.
+func coveragePercent(blocks []*coverBlock) float64 {
+	covered, total := 0, 0
+	for _, b := range blocks {
+		total += b.stmts
+		if b.count != 0 {
+			covered += b.stmts
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(covered) / float64(total)
+}
+
+// attachCoverage shows the coverage of the document's file, if it is a Go
+// file. The document gets its own copy of the blocks, which follows its
+// edits.
+func (e *editor) attachCoverage(d *document) {
+	d.coverage = nil
+	if d.filePath == "" || d.FileType() != wicore.CodeGo {
+		return
+	}
+	for _, b := range e.coverage[diagnosticsPath(d.filePath)] {
+		c := *b
+		d.coverage = append(d.coverage, &c)
+	}
+}
+
+// tintCoverage sets the background of the cells of the row showing the bytes
+// [start, end) of the line that are in a block of the coverage profile. x is
+// the cell of start.
+func (d *document) tintCoverage(buffer *raster.Buffer, x, y, line, start, end, tabstop int) {
+	t := lineText(d.content[line])
+	for _, b := range d.coverage {
+		if line < b.line || line > b.endLine {
+			continue
+		}
+		s, e := 0, len(t)
+		if line == b.line {
+			s = b.col
+		}
+		if line == b.endLine && b.endCol < e {
+			e = b.endCol
+		}
+		if s < start {
+			s = start
+		}
+		if e > end {
+			e = end
+		}
+		if s >= e {
+			continue
+		}
+		x1 := x + displayColumn(t, s, tabstop) - displayColumn(t, start, tabstop)
+		x2 := x + displayColumn(t, e, tabstop) - displayColumn(t, start, tabstop)
+		for ; x1 < x2; x1++ {
+			buffer.Cell(x1, y).F.Bg = coverageBg[b.count != 0]
+		}
+	}
+}
+
+// statusCoverageView shows the percentage of the statements covered of the
+// document of the active Window in the status bar.
+type statusCoverageView struct {
+	view
+	e        *editor
+	document *document
+}
+
+func (v *statusCoverageView) Buffer() *raster.Buffer {
+	v.buffer.Fill(raster.Cell{R: ' ', F: v.DefaultFormat()})
+	if v.document == nil || v.document.closed || len(v.document.coverage) == 0 {
+		return v.buffer
+	}
+	v.buffer.DrawString(fmt.Sprintf("Cov:%.1f%%", coveragePercent(v.document.coverage)), 0, 0, v.DefaultFormat())
+	return v.buffer
+}
+
+func statusCoverageViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
+	v := &statusCoverageView{
+		view{
+			commands:      makeCommands(),
+			keyBindings:   makeKeyBindings(),
+			eventRegistry: e,
+			id:            id,
+			title:         "Status Coverage",
+			isDisabled:    true,
+			naturalX:      11,
+			naturalY:      1,
+		},
+		e.(*editor),
+		nil,
+	}
+	v.events = append(v.events, e.RegisterDocumentCursorMoved(func(doc wicore.Document, col, row int) {
+		if d, ok := doc.(*document); ok {
+			v.document = d
+		}
+	}))
+	return v
+}
+
+// Commands.
+
+func cmdCoverageHide(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	e.coverage = nil
+	for _, d := range e.documents {
+		d.coverage = nil
+	}
+	wicore.PostCommand(e, nil, "editor_redraw")
+	return nil, nil
+}
+
+func cmdCoverageShow(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	path := args.String(0)
+	if path == "" {
+		path = "cover.out"
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	profile, err := parseCoverProfile(f)
+	if err != nil {
+		return nil, err
+	}
+	coverage := map[string][]*coverBlock{}
+	for name, blocks := range profile {
+		if p := coveragePath(filepath.Dir(path), name); p != "" {
+			coverage[diagnosticsPath(p)] = blocks
+		}
+	}
+	if len(coverage) == 0 && len(profile) != 0 {
+		return nil, errors.New(coverageNoFile.Sprintf(path))
+	}
+	e.coverage = coverage
+	for _, d := range e.documents {
+		e.attachCoverage(d)
+	}
+	wicore.PostCommand(e, nil, "editor_redraw")
+	return nil, nil
+}
+
+// RegisterCoverageCommands registers the commands to show the coverage of the
+// Go tests.
+func RegisterCoverageCommands(dispatcher wicore.CommandsW) {
+	cmds := []wicore.Command{
+		&privilegedCommandImpl{
+			"coverage_hide",
+			nil,
+			cmdCoverageHide,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Hides the coverage",
+			},
+			lang.Map{
+				lang.En: "Removes the coverage shown by coverage_show from the documents.",
+			},
+		},
+		&privilegedCommandImpl{
+			"coverage_show",
+			wicore.CommandArgs{{Name: "profile", Type: wicore.ArgPath, Optional: true}},
+			cmdCoverageShow,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Shows the coverage of the tests",
+			},
+			lang.Map{
+				lang.En: "Loads the coverage profile written by 'go test -coverprofile', cover.out by default, and shows the statements covered in green and the ones not covered in red in the Go documents, including the ones opened later. The percentage of the statements covered in the document is shown in the status bar. Use coverage_hide to remove it.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/raster"
+)
+
+func TestCoverage(t *testing.T) {
+	defer keepLog(t)()
+
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	tmpDir, err = filepath.EvalSymlinks(tmpDir)
+	ut.AssertEqual(t, nil, err)
+	path := filepath.Join(tmpDir, "a.go")
+	src := "package a\n\nfunc F(x int) int {\n\tif x > 0 {\n\t\treturn 1\n\t}\n\treturn 0\n}\n"
+	ut.AssertEqual(t, nil, ioutil.WriteFile(filepath.Join(tmpDir, "go.mod"), []byte("module example.com/a\n\ngo 1.16\n"), 0600))
+	ut.AssertEqual(t, nil, ioutil.WriteFile(path, []byte(src), 0600))
+	ut.AssertEqual(t, nil, ioutil.WriteFile(filepath.Join(tmpDir, "a_test.go"), []byte("package a\n\nimport \"testing\"\n\nfunc TestF(t *testing.T) { F(1) }\n"), 0600))
+	profile := filepath.Join(tmpDir, "cover.out")
+	cmd := exec.Command("go", "test", "-coverprofile", profile, ".")
+	cmd.Dir = tmpDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("failed to run the tests: %s\n%s", err, out)
+	}
+
+	ed, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+	var errs []string
+	run := func(cmd string, args ...string) {
+		if _, err := e.ExecuteCommand(e.ActiveWindow(), cmd, args...); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	// tints returns the document as rendered, with the covered cells in upper
+	// case and the ones not covered replaced with '#'.
+	tints := func(v *documentView) []string {
+		d := v.document
+		buf := raster.NewBuffer(30, len(d.content))
+		d.RenderInto(buf, v, 0, 0)
+		var out []string
+		for y := 0; y < buf.Height; y++ {
+			l := ""
+			for _, c := range buf.Line(y) {
+				switch {
+				case c.R == 0:
+					l += " "
+				case c.F.Bg == coverageBg[true]:
+					l += strings.ToUpper(string(c.R))
+				case c.F.Bg == coverageBg[false]:
+					l += "#"
+				default:
+					l += string(c.R)
+				}
+			}
+			out = append(out, strings.TrimRight(l, " "))
+		}
+		return out
+	}
+	var got [][]string
+	status := ""
+	wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+		ut.AssertEqual(t, nil, o.Err)
+		v := e.ActiveWindow().View().(*documentView)
+		d := v.document
+		run("coverage_show", profile)
+		ut.AssertEqual(t, "66.7", fmt.Sprintf("%.1f", coveragePercent(d.coverage)))
+		got = append(got, tints(v))
+
+		// The blocks follow the edits.
+		e.replaceContent(d, append([]string{"// c\n"}, d.content...))
+		v.CursorLine, v.CursorColumn = 5, 1
+		v.insert("x")
+		v.CursorLine, v.CursorColumn = 4, 2
+		v.insertNewline()
+		got = append(got, tints(v))
+
+		sv := statusCoverageViewFactory(e, 0).(*statusCoverageView)
+		sv.SetSize(11, 1)
+		sv.document = d
+		for _, c := range sv.Buffer().Line(0) {
+			status += string(c.R)
+		}
+		run("coverage_hide")
+		ut.AssertEqual(t, []*coverBlock(nil), d.coverage)
+		run("coverage_show", filepath.Join(tmpDir, "missing.out"))
+		wicore.PostCommand(e, nil, "q!")
+	}, "open", path)
+	ut.AssertEqual(t, 0, e.EventLoop())
+
+	expected := [][]string{
+		{
+			"package a",
+			"",
+			"func F(x int) int {",
+			"        IF X > 0 {",
+			"                RETURN 1",
+			"        }",
+			"        ########",
+			"}",
+		},
+		{
+			"// c",
+			"package a",
+			"",
+			"func F(x int) int {",
+			"        I",
+			"        F X > 0 {",
+			"        x       RETURN 1",
+			"        }",
+			"        ########",
+			"}",
+		},
+	}
+	ut.AssertEqual(t, expected, got)
+	ut.AssertEqual(t, "Cov:66.7%  ", status)
+	ut.AssertEqual(t, 1, len(errs))
+
+	_, err = parseCoverProfile(strings.NewReader("mode: set\na.go:1.1 1 1\n"))
+	ut.AssertEqual(t, "Invalid coverage profile on line 2.", err.Error())
+}
+
+func TestCoveragePath(t *testing.T) {
+	defer keepLog(t)()
+
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	oldGOPATH := build.Default.GOPATH
+	defer func() {
+		build.Default.GOPATH = oldGOPATH
+	}()
+	build.Default.GOPATH = filepath.Join(tmpDir, "other") + string(filepath.ListSeparator) + tmpDir
+	pkg := filepath.Join(tmpDir, "src", "example.com", "b")
+	ut.AssertEqual(t, nil, os.MkdirAll(pkg, 0700))
+	ut.AssertEqual(t, nil, ioutil.WriteFile(filepath.Join(pkg, "b.go"), []byte("package b\n"), 0600))
+	ut.AssertEqual(t, filepath.Join(pkg, "b.go"), coveragePath(pkg, "example.com/b/b.go"))
+	ut.AssertEqual(t, "", coveragePath(pkg, "example.com/c/c.go"))
+
+	// A profile of which no file is found is an error.
+	profile := filepath.Join(tmpDir, "cover.out")
+	ut.AssertEqual(t, nil, ioutil.WriteFile(profile, []byte("mode: set\nexample.com/c/c.go:3.19,4.11 1 1\n"), 0600))
+	ed, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+	_, err = e.ExecuteCommand(e.ActiveWindow(), "coverage_show", profile)
+	ut.AssertEqual(t, "None of the files of "+profile+" were found.", err.Error())
+}
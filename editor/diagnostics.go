@@ -0,0 +1,623 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/colors"
+	"github.com/wi-ed/wi/wicore/key"
+	"github.com/wi-ed/wi/wicore/lang"
+	"github.com/wi-ed/wi/wicore/raster"
+)
+
+// severity is the importance of a diagnostic. The values are the ones of the
+// Language Server Protocol, the most severe first.
+type severity int
+
+const (
+	severityError severity = iota + 1
+	severityWarning
+	severityInfo
+	severityHint
+)
+
+// severityInfos are the name, the gutter sign and the color of the
+// severities.
+var severityInfos = map[severity]struct {
+	name   string
+	letter rune
+	fg     colors.RGB
+}{
+	severityError:   {"error", 'E', colors.BrightRed},
+	severityWarning: {"warning", 'W', colors.BrightYellow},
+	severityInfo:    {"info", 'I', colors.BrightBlue},
+	severityHint:    {"hint", 'H', colors.BrightCyan},
+}
+
+func (s severity) String() string {
+	return severityInfos[s].name
+}
+
+// parseSeverity returns the severity named s.
+func parseSeverity(s string) (severity, error) {
+	for k, v := range severityInfos {
+		if v.name == s {
+			return k, nil
+		}
+	}
+	return 0, errors.New(invalidSeverity.Sprintf(s))
+}
+
+// diagnostic is a message about a range of a file, like a compiler error.
+//
+// The diagnostics of a loaded document are anchored to their lines like the
+// signs.
+type diagnostic struct {
+	source   string // Producer, e.g. "build"; a producer replaces its diagnostics of a file at once.
+	severity severity
+	line     int // 0-based.
+	col      int // Byte offset.
+	endLine  int
+	endCol   int // Exclusive; the range is the grapheme at col if it is empty.
+	message  string
+}
+
+// diagnosticsByPosition sorts the diagnostics by position, the most severe
+// first.
+type diagnosticsByPosition []*diagnostic
+
+func (d diagnosticsByPosition) Len() int      { return len(d) }
+func (d diagnosticsByPosition) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+func (d diagnosticsByPosition) Less(i, j int) bool {
+	if d[i].line != d[j].line {
+		return d[i].line < d[j].line
+	}
+	if d[i].col != d[j].col {
+		return d[i].col < d[j].col
+	}
+	return d[i].severity < d[j].severity
+}
+
+// diagnosticCounts returns the number of errors and warnings.
+func diagnosticCounts(diags []*diagnostic) (int, int) {
+	errs, warnings := 0, 0
+	for _, g := range diags {
+		switch g.severity {
+		case severityError:
+			errs++
+		case severityWarning:
+			warnings++
+		}
+	}
+	return errs, warnings
+}
+
+// diagnosticsPath returns the key of the file in editor.diagnostics.
+func diagnosticsPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// publishDiagnostics replaces the diagnostics of the source for the file at
+// path. The file doesn't have to be loaded.
+func (e *editor) publishDiagnostics(path, source string, diags []*diagnostic) {
+	path = diagnosticsPath(path)
+	var all []*diagnostic
+	for _, g := range e.diagnostics[path] {
+		if g.source != source {
+			all = append(all, g)
+		}
+	}
+	for _, g := range diags {
+		g.source = source
+		all = append(all, g)
+	}
+	sort.Sort(diagnosticsByPosition(all))
+	if len(all) == 0 {
+		delete(e.diagnostics, path)
+	} else {
+		e.diagnostics[path] = all
+	}
+	if d := e.findDocument(path); d != nil {
+		e.attachDiagnostics(d)
+	}
+	wicore.PostCommand(e, nil, "editor_redraw")
+}
+
+// clearDiagnostics removes the diagnostics of the source from all the files.
+func (e *editor) clearDiagnostics(source string) {
+	for path := range e.diagnostics {
+		e.publishDiagnostics(path, source, nil)
+	}
+}
+
+// attachDiagnostics shows the diagnostics of the document's file in the
+// document: a sign for the most severe diagnostic of each line and the
+// underlined ranges.
+func (e *editor) attachDiagnostics(d *document) {
+	if d.filePath == "" {
+		return
+	}
+	d.diagnostics = e.diagnostics[diagnosticsPath(d.filePath)]
+	e.placeDiagnosticSigns(d)
+}
+
+// placeDiagnosticSigns shows the most severe diagnostic of each line in the
+// gutter.
+func (e *editor) placeDiagnosticSigns(d *document) {
+	d.removeSigns(0, "diagnostics")
+	worst := map[int]severity{}
+	for _, g := range d.diagnostics {
+		if s, ok := worst[g.line]; !ok || g.severity < s {
+			worst[g.line] = g.severity
+		}
+	}
+	for line, s := range worst {
+		if line >= 0 && line < len(d.content) {
+			e.placeSign(d, "diagnostics", line, string(severityInfos[s].letter), severityInfos[s].fg)
+		}
+	}
+}
+
+// underlineDiagnostics underlines the cells of the row showing the bytes
+// [start, end) of the line that are covered by a diagnostic. x is the cell of
+// start.
+func (d *document) underlineDiagnostics(buffer *raster.Buffer, x, y, line, start, end, tabstop int) {
+	t := lineText(d.content[line])
+	for _, g := range d.diagnostics {
+		if line < g.line || line > g.endLine {
+			continue
+		}
+		s, e := 0, len(t)
+		if line == g.line {
+			s = g.col
+		}
+		if line == g.endLine && g.endCol < e {
+			e = g.endCol
+		}
+		if s >= e && line == g.line {
+			// An empty range is shown on the grapheme it starts at.
+			e = nextColumn(t, s)
+		}
+		if s < start {
+			s = start
+		}
+		if e > end {
+			e = end
+		}
+		if s >= e {
+			continue
+		}
+		x1 := x + displayColumn(t, s, tabstop) - displayColumn(t, start, tabstop)
+		x2 := x + displayColumn(t, e, tabstop) - displayColumn(t, start, tabstop)
+		for ; x1 < x2; x1++ {
+			buffer.Cell(x1, y).F.Underline = true
+		}
+	}
+}
+
+// diagnosticsLine is a row of the diagnostics View.
+type diagnosticsLine struct {
+	path string
+	*diagnostic
+}
+
+// allDiagnostics returns the diagnostics of all the files, sorted by path and
+// position.
+func (e *editor) allDiagnostics() []diagnosticsLine {
+	paths := make([]string, 0, len(e.diagnostics))
+	for path := range e.diagnostics {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var out []diagnosticsLine
+	for _, path := range paths {
+		for _, g := range e.diagnostics[path] {
+			out = append(out, diagnosticsLine{path, g})
+		}
+	}
+	return out
+}
+
+// gotoDiagnostic jumps to the diagnostic in the file at path.
+func (e *editor) gotoDiagnostic(path string, g *diagnostic) error {
+	d, err := e.openDocument(path)
+	if err != nil {
+		return err
+	}
+	return e.gotoDocument(d, g.line, g.col)
+}
+
+// diagnosticsView lists the diagnostics of all the files.
+type diagnosticsView struct {
+	view
+	e        *editor
+	selected int // Index of the selected row.
+	offset   int // First row shown.
+}
+
+func (v *diagnosticsView) selectedDiagnostic() (diagnosticsLine, bool) {
+	lines := v.e.allDiagnostics()
+	if v.selected >= len(lines) {
+		v.selected = len(lines) - 1
+	}
+	if v.selected < 0 {
+		v.selected = 0
+		return diagnosticsLine{}, false
+	}
+	return lines[v.selected], true
+}
+
+func (v *diagnosticsView) Buffer() *raster.Buffer {
+	v.buffer.Fill(raster.Cell{R: ' ', F: v.DefaultFormat()})
+	lines := v.e.allDiagnostics()
+	errs, warnings := 0, 0
+	for _, diags := range v.e.diagnostics {
+		e, w := diagnosticCounts(diags)
+		errs += e
+		warnings += w
+	}
+	v.title = diagnosticsTitle.Sprintf(errs, warnings)
+	v.selectedDiagnostic()
+	if len(lines) == 0 {
+		f := v.DefaultFormat()
+		f.Fg = colors.DarkGray
+		v.buffer.DrawString(diagnosticsEmpty.String(), 0, 0, f)
+		return v.buffer
+	}
+	if v.selected < v.offset {
+		v.offset = v.selected
+	} else if v.actualY > 0 && v.selected >= v.offset+v.actualY {
+		v.offset = v.selected - v.actualY + 1
+	}
+	for i := v.offset; i < len(lines) && i-v.offset < v.actualY; i++ {
+		l := lines[i]
+		f := v.DefaultFormat()
+		if i == v.selected {
+			f.Fg, f.Bg = f.Bg, f.Fg
+		}
+		sf := f
+		if i != v.selected {
+			sf.Fg = severityInfos[l.severity].fg
+		}
+		*v.buffer.Cell(0, i-v.offset) = raster.Cell{R: severityInfos[l.severity].letter, F: sf}
+		text := fmt.Sprintf("%s:%d:%d  %s", filepath.Base(l.path), l.line+1, l.col+1, l.message)
+		if l.source != "" {
+			text += "  [" + l.source + "]"
+		}
+		v.buffer.DrawString(text, 2, i-v.offset, f)
+	}
+	return v.buffer
+}
+
+func (v *diagnosticsView) onTerminalKeyPressed(k key.Press) {
+	if v.window == nil || v.e.ActiveWindow() != v.window {
+		return
+	}
+	switch {
+	case k.Key == key.Enter:
+		if l, ok := v.selectedDiagnostic(); ok {
+			v.e.alertOnError(v.e.gotoDiagnostic(l.path, l.diagnostic))
+		}
+	case k.Ch == 'q':
+		wicore.PostCommand(v.e, nil, "window_close", v.window.ID())
+	}
+	wicore.PostCommand(v.e, nil, "editor_redraw")
+}
+
+func cmdToDiagnostics(handler func(v *diagnosticsView)) wicore.CommandImplHandler {
+	return func(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
+		v, ok := w.View().(*diagnosticsView)
+		if !ok {
+			return nil, errors.New("internal error")
+		}
+		handler(v)
+		wicore.PostCommand(e, nil, "editor_redraw")
+		return nil, nil
+	}
+}
+
+func cmdDiagnosticsCursorDown(v *diagnosticsView) {
+	v.selected++
+	v.selectedDiagnostic()
+}
+
+func cmdDiagnosticsCursorUp(v *diagnosticsView) {
+	if v.selected > 0 {
+		v.selected--
+	}
+}
+
+// diagnosticsViewFactory returns a View listing the diagnostics of all the
+// files.
+func diagnosticsViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
+	dispatcher := makeCommands()
+	cmds := []wicore.Command{
+		&wicore.CommandImpl{
+			"diagnostics_cursor_down",
+			nil,
+			cmdToDiagnostics(cmdDiagnosticsCursorDown),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Selects the next diagnostic",
+			},
+			lang.Map{
+				lang.En: "Selects the next diagnostic in the list.",
+			},
+		},
+		&wicore.CommandImpl{
+			"diagnostics_cursor_up",
+			nil,
+			cmdToDiagnostics(cmdDiagnosticsCursorUp),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Selects the previous diagnostic",
+			},
+			lang.Map{
+				lang.En: "Selects the previous diagnostic in the list.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+	bindings := makeKeyBindings()
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Down}, "diagnostics_cursor_down")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Up}, "diagnostics_cursor_up")
+
+	v := &diagnosticsView{
+		view{
+			commands:      dispatcher,
+			keyBindings:   bindings,
+			eventRegistry: e,
+			id:            id,
+			title:         diagnosticsTitle.Sprintf(0, 0),
+			naturalX:      -1,
+			naturalY:      8,
+			defaultFormat: raster.CellFormat{Fg: colors.White, Bg: colors.Black},
+		},
+		e.(*editor),
+		0,
+		0,
+	}
+	v.events = append(v.events, e.RegisterTerminalKeyPressed(v.onTerminalKeyPressed))
+	return v
+}
+
+// statusDiagnosticsView shows the number of errors and warnings of the
+// document of the active Window in the status bar.
+type statusDiagnosticsView struct {
+	view
+	e        *editor
+	document *document
+}
+
+func (v *statusDiagnosticsView) Buffer() *raster.Buffer {
+	v.buffer.Fill(raster.Cell{R: ' ', F: v.DefaultFormat()})
+	if v.document == nil || v.document.closed {
+		return v.buffer
+	}
+	errs, warnings := diagnosticCounts(v.document.diagnostics)
+	f := v.DefaultFormat()
+	x := 0
+	if errs != 0 {
+		f.Fg = colors.Red
+		s := fmt.Sprintf("E:%d ", errs)
+		v.buffer.DrawString(s, x, 0, f)
+		x += len(s)
+	}
+	if warnings != 0 {
+		f.Fg = colors.Brown
+		v.buffer.DrawString(fmt.Sprintf("W:%d", warnings), x, 0, f)
+	}
+	return v.buffer
+}
+
+func statusDiagnosticsViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
+	v := &statusDiagnosticsView{
+		view{
+			commands:      makeCommands(),
+			keyBindings:   makeKeyBindings(),
+			eventRegistry: e,
+			id:            id,
+			title:         "Status Diagnostics",
+			isDisabled:    true,
+			naturalX:      12,
+			naturalY:      1,
+		},
+		e.(*editor),
+		nil,
+	}
+	v.events = append(v.events, e.RegisterDocumentCursorMoved(func(doc wicore.Document, col, row int) {
+		if d, ok := doc.(*document); ok {
+			v.document = d
+		}
+	}))
+	return v
+}
+
+// parseRange parses a range formatted as line:col or line:col-line:col,
+// 1-based.
+func parseRange(s string) (int, int, int, int, error) {
+	parts := strings.SplitN(s, "-", 2)
+	var n []int
+	for _, p := range parts {
+		lc := strings.SplitN(p, ":", 2)
+		if len(lc) != 2 {
+			return 0, 0, 0, 0, errors.New(invalidRange.Sprintf(s))
+		}
+		for _, i := range lc {
+			v, err := strconv.Atoi(i)
+			if err != nil || v < 1 {
+				return 0, 0, 0, 0, errors.New(invalidRange.Sprintf(s))
+			}
+			n = append(n, v-1)
+		}
+	}
+	if len(n) == 2 {
+		n = append(n, n[0], n[1])
+	}
+	return n[0], n[1], n[2], n[3], nil
+}
+
+// moveToDiagnostic moves the cursor of the View to the next diagnostic of the
+// document after the cursor, or the previous one before it.
+func (e *editor) moveToDiagnostic(v *documentView, next bool) error {
+	diags := v.document.diagnostics
+	if next {
+		for _, g := range diags {
+			if g.line > v.CursorLine || (g.line == v.CursorLine && g.col > v.CursorColumn) {
+				return e.gotoDocument(v.document, g.line, g.col)
+			}
+		}
+	} else {
+		for i := len(diags) - 1; i >= 0; i-- {
+			if g := diags[i]; g.line < v.CursorLine || (g.line == v.CursorLine && g.col < v.CursorColumn) {
+				return e.gotoDocument(v.document, g.line, g.col)
+			}
+		}
+	}
+	return errors.New(noMoreDiagnostics.String())
+}
+
+// Commands.
+
+func cmdDiagClear(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	e.clearDiagnostics(args.String(0))
+	return nil, nil
+}
+
+func cmdDiagNext(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	v, ok := w.view.(*documentView)
+	if !ok {
+		return nil, errors.New(noDocument.String())
+	}
+	return nil, e.moveToDiagnostic(v, true)
+}
+
+func cmdDiagPrev(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	v, ok := w.view.(*documentView)
+	if !ok {
+		return nil, errors.New(noDocument.String())
+	}
+	return nil, e.moveToDiagnostic(v, false)
+}
+
+func cmdDiagPublish(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	path := args.String(0)
+	if d := e.documentByRef(path); d != nil {
+		path = d.filePath
+	}
+	entries := args.Strings(2)
+	if len(entries)%3 != 0 {
+		return nil, errors.New(invalidDiagnostics.String())
+	}
+	diags := make([]*diagnostic, 0, len(entries)/3)
+	for i := 0; i < len(entries); i += 3 {
+		line, col, endLine, endCol, err := parseRange(entries[i])
+		if err != nil {
+			return nil, err
+		}
+		s, err := parseSeverity(entries[i+1])
+		if err != nil {
+			return nil, err
+		}
+		diags = append(diags, &diagnostic{"", s, line, col, endLine, endCol, entries[i+2]})
+	}
+	e.publishDiagnostics(path, args.String(1), diags)
+	return nil, nil
+}
+
+func cmdDiagnostics(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	for _, child := range e.rootWindow.childrenWindows {
+		if _, ok := child.view.(*diagnosticsView); ok {
+			return nil, e.activateWindow(child)
+		}
+	}
+	return e.ExecuteCommand(w, "window_new", e.rootWindow.ID(), "bottom", "diagnostics")
+}
+
+// RegisterDiagnosticsCommands registers the commands to publish and navigate
+// the diagnostics.
+func RegisterDiagnosticsCommands(dispatcher wicore.CommandsW) {
+	cmds := []wicore.Command{
+		&privilegedCommandImpl{
+			"diag_clear",
+			wicore.CommandArgs{{Name: "source", Type: wicore.ArgString}},
+			cmdDiagClear,
+			wicore.CommandsCategory,
+			lang.Map{
+				lang.En: "Removes the diagnostics of a producer",
+			},
+			lang.Map{
+				lang.En: "Removes the diagnostics published by the source from all the files.",
+			},
+		},
+		&privilegedCommandImpl{
+			"diag_next",
+			nil,
+			cmdDiagNext,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Jumps to the next diagnostic",
+			},
+			lang.Map{
+				lang.En: "Moves the cursor to the next diagnostic of the document after the cursor.",
+			},
+		},
+		&privilegedCommandImpl{
+			"diag_prev",
+			nil,
+			cmdDiagPrev,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Jumps to the previous diagnostic",
+			},
+			lang.Map{
+				lang.En: "Moves the cursor to the previous diagnostic of the document before the cursor.",
+			},
+		},
+		&privilegedCommandImpl{
+			"diag_publish",
+			wicore.CommandArgs{
+				{Name: "document", Type: wicore.ArgString},
+				{Name: "source", Type: wicore.ArgString},
+				{Name: "range severity message", Type: wicore.ArgString, Optional: true, Variadic: true},
+			},
+			cmdDiagPublish,
+			wicore.CommandsCategory,
+			lang.Map{
+				lang.En: "Publishes the diagnostics of a file",
+			},
+			lang.Map{
+				lang.En: "Replaces the diagnostics of the source, e.g. a linter plugin, for the file. The document is specified by its ID or its path; the file doesn't have to be loaded. Each diagnostic is a range formatted as line:col or line:col-line:col, 1-based, a severity, one of error, warning, info or hint, and a message. Without diagnostics, the ones of the source are removed from the file.",
+			},
+		},
+		&privilegedCommandImpl{
+			"diagnostics",
+			nil,
+			cmdDiagnostics,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Lists the diagnostics",
+			},
+			lang.Map{
+				lang.En: "Lists the diagnostics of all the files at the bottom, like the compiler errors. Use Enter to jump to the selected diagnostic.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/key"
+	"github.com/wi-ed/wi/wicore/raster"
+)
+
+func TestDiagnostics(t *testing.T) {
+	defer keepLog(t)()
+
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	tmpDir, err = filepath.EvalSymlinks(tmpDir)
+	ut.AssertEqual(t, nil, err)
+	pathA := filepath.Join(tmpDir, "a.txt")
+	pathB := filepath.Join(tmpDir, "b.txt")
+	ut.AssertEqual(t, nil, ioutil.WriteFile(pathA, []byte("alpha beta\n\tgamma\ndelta\n"), 0600))
+	ut.AssertEqual(t, nil, ioutil.WriteFile(pathB, []byte("1\n2\n3\n"), 0600))
+
+	ed, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+	var errs []string
+	run := func(cmd string, args ...string) {
+		if _, err := e.ExecuteCommand(e.ActiveWindow(), cmd, args...); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	signs := func(d *document) []string {
+		var out []string
+		for _, s := range d.signs {
+			if s.group == "diagnostics" {
+				out = append(out, fmt.Sprintf("%d:%s", s.line, s.text))
+			}
+		}
+		sort.Strings(out)
+		return out
+	}
+	cursor := func() string {
+		v := e.ActiveWindow().View().(*documentView)
+		return fmt.Sprintf("%s:%d:%d", filepath.Base(v.document.filePath), v.CursorLine, v.CursorColumn)
+	}
+	var cursors []string
+	wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+		ut.AssertEqual(t, nil, o.Err)
+		v := e.ActiveWindow().View().(*documentView)
+		d := v.document
+		run("diag_publish", pathA, "lint", "1:7-1:11", "warning", "beta", "2:2", "error", "gamma")
+		// The file doesn't have to be loaded.
+		run("diag_publish", pathB, "build", "3:1", "error", "missing")
+		ut.AssertEqual(t, []string{"0:W", "1:E"}, signs(d))
+		errCount, warnCount := diagnosticCounts(d.diagnostics)
+		ut.AssertEqual(t, 1, errCount)
+		ut.AssertEqual(t, 1, warnCount)
+
+		// The ranges are underlined; an empty range covers a grapheme.
+		underline := func(d *document) []string {
+			buf := raster.NewBuffer(20, 3)
+			d.RenderInto(buf, v, 0, 0)
+			var underlined []string
+			for y := 0; y < buf.Height; y++ {
+				l := ""
+				for _, c := range buf.Line(y) {
+					if c.F.Underline {
+						l += "^"
+					} else {
+						l += " "
+					}
+				}
+				underlined = append(underlined, strings.TrimRight(l, " "))
+			}
+			return underlined
+		}
+		ut.AssertEqual(t, []string{"      ^^^^", "        ^", ""}, underline(d))
+
+		run("diag_next")
+		cursors = append(cursors, cursor())
+		run("diag_next")
+		cursors = append(cursors, cursor())
+		run("diag_next")
+		run("diag_prev")
+		cursors = append(cursors, cursor())
+
+		// The diagnostics follow the text typed before them.
+		v.onKeyPress(e, key.Press{Ch: 'x'})
+		v.onKeyPress(e, key.Press{Key: key.Enter})
+		ut.AssertEqual(t, []string{"alpha x\n", "beta\n", "\tgamma\n", "delta\n"}, d.content)
+		ut.AssertEqual(t, []string{"1:W", "2:E"}, signs(d))
+		ut.AssertEqual(t, []string{"", "^^^^", "        ^"}, underline(d))
+
+		// The diagnostics stay on their lines.
+		e.replaceContent(d, append([]string{"new\n"}, d.content...))
+		ut.AssertEqual(t, []string{"2:W", "3:E"}, signs(d))
+		ut.AssertEqual(t, 2, e.diagnostics[pathA][0].line)
+
+		run("diagnostics")
+		dv := e.ActiveWindow().View().(*diagnosticsView)
+		var rows []string
+		for y, b := 0, dv.Buffer(); y < 3; y++ {
+			l := ""
+			for _, c := range b.Line(y) {
+				l += string(c.R)
+			}
+			rows = append(rows, strings.TrimRight(l, " "))
+		}
+		ut.AssertEqual(t, []string{"W a.txt:3:1  beta  [lint]", "E a.txt:4:2  gamma  [lint]", "E b.txt:3:1  missing  [build]"}, rows)
+		ut.AssertEqual(t, "Diagnostics: 2 errors, 1 warnings", dv.Title())
+		run("diagnostics_cursor_down")
+		run("diagnostics_cursor_down")
+		dv.onTerminalKeyPressed(key.Press{Key: key.Enter})
+		cursors = append(cursors, cursor())
+		ut.AssertEqual(t, []string{"2:E"}, signs(e.findDocument(pathB)))
+
+		run("diag_clear", "lint")
+		ut.AssertEqual(t, []string(nil), signs(d))
+		ut.AssertEqual(t, 1, len(e.diagnostics))
+		wicore.PostCommand(e, nil, "q!")
+	}, "open", pathA)
+	ut.AssertEqual(t, 0, e.EventLoop())
+
+	ut.AssertEqual(t, []string{"a.txt:0:6", "a.txt:1:1", "a.txt:0:6", "b.txt:2:0"}, cursors)
+	ut.AssertEqual(t, []string{"There are no more diagnostics in this direction."}, errs)
+}
@@ -0,0 +1,192 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxDiffCells is the maximum size of the LCS table computed by diffLines.
+// Larger inputs are diffed as a full replacement.
+const maxDiffCells = 4 * 1024 * 1024
+
+// diffOp is the kind of a diffLine.
+type diffOp int
+
+const (
+	diffEqual diffOp = iota
+	diffDelete
+	diffInsert
+)
+
+// diffLine is a line of a line based diff.
+type diffLine struct {
+	Op diffOp
+	A  int // Line in a. Only valid for diffEqual and diffDelete.
+	B  int // Line in b. Only valid for diffEqual and diffInsert.
+}
+
+// diffLines returns the edit script to transform a into b, based on the
+// longest common subsequence.
+//
+// The table of the subsequences takes O(N*M) memory once the common prefix and
+// suffix are trimmed.
+func diffLines(a, b []string) []diffLine {
+	// Trim the common prefix and suffix first, it is the common case when
+	// comparing two versions of a file.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	out := make([]diffLine, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		out = append(out, diffLine{diffEqual, i, i})
+	}
+	out = append(out, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix], prefix, prefix)...)
+	for i := suffix; i > 0; i-- {
+		out = append(out, diffLine{diffEqual, len(a) - i, len(b) - i})
+	}
+	return out
+}
+
+// diffMiddle diffs a and b, which are offset by offA and offB in the original
+// slices.
+func diffMiddle(a, b []string, offA, offB int) []diffLine {
+	var out []diffLine
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		for i := range a {
+			out = append(out, diffLine{diffDelete, offA + i, -1})
+		}
+		for i := range b {
+			out = append(out, diffLine{diffInsert, -1, offB + i})
+		}
+		return out
+	}
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, diffLine{diffEqual, offA + i, offB + j})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, diffLine{diffDelete, offA + i, -1})
+			i++
+		default:
+			out = append(out, diffLine{diffInsert, -1, offB + j})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out = append(out, diffLine{diffDelete, offA + i, -1})
+	}
+	for ; j < len(b); j++ {
+		out = append(out, diffLine{diffInsert, -1, offB + j})
+	}
+	return out
+}
+
+// diffPreview returns a unified-like rendering of the changes from a to b,
+// with context lines of context around each hunk. Lines are returned without
+// their trailing "\n".
+func diffPreview(a, b []string, context int) []string {
+	script := diffLines(a, b)
+	// Mark the lines to keep: all the changes and their context.
+	keep := make([]bool, len(script))
+	for i, d := range script {
+		if d.Op == diffEqual {
+			continue
+		}
+		for j := i - context; j <= i+context; j++ {
+			if j >= 0 && j < len(script) {
+				keep[j] = true
+			}
+		}
+	}
+	var out []string
+	for i, d := range script {
+		if !keep[i] {
+			continue
+		}
+		if i == 0 || !keep[i-1] {
+			// Hunk header, 1-based like diff -u.
+			startA, startB := hunkStart(script[i:])
+			out = append(out, fmt.Sprintf("@@ -%d +%d @@", startA+1, startB+1))
+		}
+		switch d.Op {
+		case diffEqual:
+			out = append(out, " "+strings.TrimRight(a[d.A], "\r\n"))
+		case diffDelete:
+			out = append(out, "-"+strings.TrimRight(a[d.A], "\r\n"))
+		case diffInsert:
+			out = append(out, "+"+strings.TrimRight(b[d.B], "\r\n"))
+		}
+	}
+	return out
+}
+
+// hunkStart returns the first line in a and b of a hunk.
+func hunkStart(script []diffLine) (int, int) {
+	a, b := -1, -1
+	for _, d := range script {
+		if a == -1 && d.A != -1 {
+			a = d.A
+		}
+		if b == -1 && d.B != -1 {
+			b = d.B
+		}
+		if a != -1 && b != -1 {
+			break
+		}
+	}
+	if a == -1 {
+		a = 0
+	}
+	if b == -1 {
+		b = 0
+	}
+	return a, b
+}
+
+// mapLine returns the line in b corresponding to line in a. A deleted line is
+// mapped to the line that replaced it or that follows it.
+func mapLine(script []diffLine, line int) int {
+	last := 0
+	found := false
+	for _, d := range script {
+		if d.A == line {
+			found = true
+		}
+		if d.B == -1 {
+			continue
+		}
+		if found {
+			return d.B
+		}
+		last = d.B
+	}
+	return last
+}
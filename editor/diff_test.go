@@ -0,0 +1,36 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestDiffPreview(t *testing.T) {
+	a := []string{"a\n", "b\n", "c\n", "d\n", "e\n", "f\n", "g\n", "h\n"}
+	b := []string{"a\n", "B\n", "c\n", "d\n", "e\n", "f\n", "g\n", "h\n", "i\n"}
+	expected := []string{
+		"@@ -1 +1 @@",
+		" a",
+		"-b",
+		"+B",
+		" c",
+		"@@ -8 +8 @@",
+		" h",
+		"+i",
+	}
+	ut.AssertEqual(t, expected, diffPreview(a, b, 1))
+	ut.AssertEqual(t, []string(nil), diffPreview(a, a, 1))
+}
+
+func TestMapLine(t *testing.T) {
+	script := diffLines([]string{"a", "b", "c", "d"}, []string{"new", "a", "c", "B", "d"})
+	ut.AssertEqual(t, 1, mapLine(script, 0))
+	ut.AssertEqual(t, 2, mapLine(script, 1))
+	ut.AssertEqual(t, 2, mapLine(script, 2))
+	ut.AssertEqual(t, 4, mapLine(script, 3))
+}
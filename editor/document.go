@@ -5,9 +5,14 @@
 package editor
 
 import (
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"unicode"
 
@@ -29,19 +34,30 @@ type ReadWriteSeekCloser interface {
 // TODO(maruel): This will probably have to be moved into wicore, since
 // documents could be useful to plugins (?)
 //
-// TODO(maruel): editor needs to have the list of opened document. They may
-// have multiple views associated to a single document.
+// A document is loaded only once; opening the same file again, even via a
+// symlink or a hardlink, creates another View on the same document. A
+// document stays loaded when no View shows it anymore, until it is closed
+// with buffer_close.
 //
 // TODO(maruel): Strictly speaking, a Window could be in the wi parent process,
 // a View in a plugin process and a Document in a separate plugin process (e.g.
 // output from a live command, whatever). This means wicore.Document would need
 // to be a proper interface.
 type document struct {
-	filePath string              // filePath encoded in unicode. This can cause problems with systems not using an unicode code page.
-	fileType string              // One of the known file type. Generally described by a file extension, optionally followed by a version (?). TODO(maruel): Design.
-	handle   ReadWriteSeekCloser // Handle to the file. For unsaved files, it's empty.
-	content  []string            // Content as a slice of string, each being a line. In practice, it could be desired that a document not to be fully loaded in memory, or loaded asynchronously. TODO(maruel): Implement partial loading.
-	isDirty  bool                // true if the content was not saved to disk.
+	filePath    string              // filePath encoded in unicode. This can cause problems with systems not using an unicode code page.
+	fileType    string              // One of the known file type. Generally described by a file extension, optionally followed by a version (?). TODO(maruel): Design.
+	handle      ReadWriteSeekCloser // Handle to the file. For unsaved files, it's empty.
+	content     []string            // Content as a slice of string, each being a line. In practice, it could be desired that a document not to be fully loaded in memory, or loaded asynchronously. TODO(maruel): Implement partial loading.
+	isDirty     bool                // true if the content was not saved to disk.
+	identity    string              // Canonical identity, see documentIdentity().
+	number      int                 // Buffer number, as shown in the buffers View.
+	views       int                 // Number of documentView showing this document.
+	closed      bool                // true once no View shows the document anymore.
+	conflict    bool                // true while the user is asked about a modification on disk.
+	signs       []*sign             // Markers shown in the gutter.
+	diagnostics []*diagnostic       // Diagnostics of the file; see editor.attachDiagnostics().
+	coverage    []*coverBlock       // Coverage of the file; see editor.attachCoverage().
+	version     int                 // Incremented on each change of the content.
 }
 
 func makeDocument() *document {
@@ -51,13 +67,52 @@ func makeDocument() *document {
 	}
 }
 
+// loadDocument loads the file at path. A file that doesn't exist yet results
+// in an empty document associated with this path.
+func loadDocument(path string) (*document, error) {
+	d := &document{filePath: path, content: []string{"\n"}}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return d, nil
+		}
+		return nil, err
+	}
+	if len(b) != 0 {
+		d.content = splitLines(string(b))
+	}
+	return d, nil
+}
+
+// splitLines splits the text in lines, keeping the line terminators.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if len(lines) > 1 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// documentIdentity returns the canonical identity of the file at path. Paths
+// that resolve to the same file via symlinks or relative paths have the same
+// identity. Hardlinks are handled by editor.findDocument().
+func documentIdentity(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		return real
+	}
+	// The file may not exist yet, resolve its directory.
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+		return filepath.Join(dir, filepath.Base(abs))
+	}
+	return abs
+}
+
 func (d *document) ID() string {
-	// TODO(maruel): This implies the same document should never be loaded twice.
-	// It think it's a valid assumption, multiple DocumentView should be created
-	// instead.
-	// TODO(maruel): Implement uniqueness. And look at hardlinks and symlinks too
-	// to dedupe paths.
-	return fmt.Sprintf("document:%s", d.filePath)
+	return fmt.Sprintf("document:%s", d.identity)
 }
 
 func (d *document) String() string {
@@ -65,26 +120,77 @@ func (d *document) String() string {
 }
 
 func (d *document) Close() error {
+	d.closed = true
 	return nil
 }
 
 func (d *document) RenderInto(buffer *raster.Buffer, view wicore.View, offsetColumn, offsetLine int) {
-	for row, l := range d.content {
-		// This will automatically elide text.
-		if offsetColumn != 0 {
-			// TODO(maruel): This is a hot path and should be optimized accordingly
-			// by not requiring converting the full string.
-			// TODO(maruel): Handle zero width space U+200B. It should (obviously)
-			// not take any space.
-			l = string([]rune(l)[offsetColumn:])
+	for row := 0; row < buffer.Height && offsetLine+row < len(d.content); row++ {
+		t := lineText(d.content[offsetLine+row])
+		d.renderRow(buffer, 0, row, offsetLine+row, columnAt(t, offsetColumn, defaultTabstop), -1, view.DefaultFormat(), &whitespace{tabstop: defaultTabstop})
+	}
+}
+
+// renderRow draws the bytes [start, end) of the line at the row y of buffer,
+// starting at the column x. end is -1 to draw up to the end of the line. The
+// offsets must be on grapheme cluster boundaries.
+//
+// The tabs are expanded to the tab stops of the line, not of the row, and the
+// whitespace is drawn with the markers of ws.
+func (d *document) renderRow(buffer *raster.Buffer, x, y, line, start, end int, f raster.CellFormat, ws *whitespace) {
+	// TODO(maruel): This is a hot path and should be optimized accordingly by
+	// not scanning the line from its start.
+	// The line terminator is not drawn. It is particularly important on
+	// Windows, as "\r" would be rendered as an invalid character.
+	t := lineText(d.content[line])
+	if end == -1 || end > len(t) {
+		end = len(t)
+	}
+	if start >= end {
+		return
+	}
+	x0 := x
+	trailing := len(strings.TrimRightFunc(t, unicode.IsSpace))
+	lx := displayColumn(t, start, ws.tabstop)
+	// Runs of regular text are drawn at once. This will automatically elide
+	// text.
+	run := start
+	runX := x
+	for i := start; i < end; {
+		size, width := graphemeAt(t, i, lx, ws.tabstop)
+		if ws.draw(buffer, t[i:i+size], x, y, width, i >= trailing, f) {
+			buffer.DrawString(t[run:i], runX, y, f)
+			run = i + size
+			runX = x + width
 		}
-		// It is particularly important on Windows, as "\n" would be rendered as an invalid character.
-		l := strings.TrimRightFunc(l, unicode.IsSpace)
-		buffer.DrawString(l, offsetColumn, row+offsetLine, view.DefaultFormat())
+		x += width
+		lx += width
+		i += size
 	}
+	buffer.DrawString(t[run:end], runX, y, f)
+	d.tintCoverage(buffer, x0, y, line, start, end, ws.tabstop)
+	d.underlineDiagnostics(buffer, x0, y, line, start, end, ws.tabstop)
+}
+
+// fileTypes maps the file extensions to their FileType.
+//
+// The type is not detected from the content, e.g. a shebang.
+var fileTypes = map[string]wicore.FileType{
+	".c":   wicore.CodeCCSource,
+	".cc":  wicore.CodeCCPPSource,
+	".cpp": wicore.CodeCCPPSource,
+	".cxx": wicore.CodeCCPPSource,
+	".go":  wicore.CodeGo,
+	".h":   wicore.CodeCCHeader,
+	".hh":  wicore.CodeCCPPHeader,
+	".hpp": wicore.CodeCCPPHeader,
+	".hxx": wicore.CodeCCPPHeader,
 }
 
 func (d *document) FileType() wicore.FileType {
+	if t, ok := fileTypes[strings.ToLower(filepath.Ext(d.filePath))]; ok {
+		return t
+	}
 	return wicore.Scanning
 }
 
@@ -92,51 +198,329 @@ func (d *document) IsDirty() bool {
 	return d.isDirty
 }
 
+func (d *document) ViewCount() int {
+	return d.views
+}
+
+// save writes the content to path. If path is empty, the current file path is
+// used.
+func (d *document) save(path string) error {
+	if path == "" {
+		path = d.filePath
+	}
+	if path == "" {
+		return errors.New(noFilePath.String())
+	}
+	if err := ioutil.WriteFile(path, []byte(strings.Join(d.content, "")), 0644); err != nil {
+		return err
+	}
+	d.filePath = path
+	d.isDirty = false
+	return nil
+}
+
+// openDocument returns the document for the file at path, loading it only if
+// it is not already loaded. An empty path creates a new untitled document.
+func (e *editor) openDocument(path string) (*document, error) {
+	if path == "" {
+		d := makeDocument()
+		e.lastDocument++
+		d.number = e.lastDocument
+		d.identity = fmt.Sprintf("untitled:%d", d.number)
+		e.documents[d.identity] = d
+		e.TriggerDocumentCreated(d)
+		return d, nil
+	}
+	e.touchRecentFile(path)
+	if d := e.findDocument(path); d != nil {
+		return d, nil
+	}
+	d, err := loadDocument(path)
+	if err != nil {
+		return nil, err
+	}
+	e.lastDocument++
+	d.number = e.lastDocument
+	d.identity = documentIdentity(path)
+	e.documents[d.identity] = d
+	e.detectDocumentIndent(d)
+	e.attachDiagnostics(d)
+	e.attachCoverage(d)
+	e.syncWatches()
+	e.TriggerDocumentCreated(d)
+	return d, nil
+}
+
+// findDocument returns the loaded document for the file at path, if any.
+func (e *editor) findDocument(path string) *document {
+	if d := e.documents[documentIdentity(path)]; d != nil && !d.closed {
+		return d
+	}
+	// Look for hardlinks. os.SameFile() compares the device and inode. The
+	// documents are few so they are scanned.
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	for _, d := range e.documents {
+		if d.filePath == "" || d.closed {
+			continue
+		}
+		if fi2, err := os.Stat(d.filePath); err == nil && os.SameFile(fi, fi2) {
+			return d
+		}
+	}
+	return nil
+}
+
+// documentEdited must be called once the content of the document was edited.
+// The bytes from the column col of the line up to its end are now at the
+// column newCol of newLine, and the following lines moved by newLine-line.
+// Inserting n bytes is documentEdited(d, line, col, line, col+n) and splitting
+// a line documentEdited(d, line, col, line+1, newCol). The positions in bytes
+// removed move to newCol.
+//
+// The positions attached to the document follow the text they are on.
+func (e *editor) documentEdited(d *document, line, col, newLine, newCol int) {
+	// A position at col moves only if after is true, so a range starting at
+	// the edit includes the inserted text and a range ending there doesn't.
+	move := func(l, c *int, after bool) {
+		switch {
+		case *l > line:
+			*l += newLine - line
+		case *l != line:
+		case *c > col || (after && *c == col):
+			*l = newLine
+			if *c += newCol - col; *c < 0 {
+				*c = 0
+			}
+		case newLine == line && *c > newCol:
+			*c = newCol
+		}
+	}
+	for _, s := range d.signs {
+		// A sign stays on a line split after its text.
+		if s.line > line || (s.line == line && newLine != line && strings.TrimSpace(d.content[line]) == "") {
+			s.line += newLine - line
+		}
+	}
+	for _, g := range d.diagnostics {
+		move(&g.line, &g.col, true)
+		move(&g.endLine, &g.endCol, false)
+	}
+	if len(d.diagnostics) != 0 {
+		e.placeDiagnosticSigns(d)
+	}
+	for _, b := range d.coverage {
+		move(&b.line, &b.col, true)
+		move(&b.endLine, &b.endCol, false)
+	}
+	e.contentChanged(d)
+}
+
+// replaceContent replaces the content of the document. The positions
+// attached to the document stay on the same lines of text. It returns the edit
+// script from the old content.
+func (e *editor) replaceContent(d *document, content []string) []diffLine {
+	script := diffLines(d.content, content)
+	for _, s := range d.signs {
+		s.line = mapLine(script, s.line)
+	}
+	for _, g := range d.diagnostics {
+		g.line = mapLine(script, g.line)
+		g.endLine = mapLine(script, g.endLine)
+	}
+	for _, b := range d.coverage {
+		b.line = mapLine(script, b.line)
+		b.endLine = mapLine(script, b.endLine)
+	}
+	d.content = content
+	e.contentChanged(d)
+	return script
+}
+
+// contentChanged is called on each modification of the content of the
+// document.
+func (e *editor) contentChanged(d *document) {
+	d.version++
+	if e.swap != nil {
+		e.swap.modified(d)
+	}
+}
+
+// reindexDocuments updates the identity of the documents, which changes when
+// a document is saved to a new path.
+func (e *editor) reindexDocuments() {
+	docs := make(map[string]*document, len(e.documents))
+	for _, d := range e.documents {
+		if d.filePath != "" {
+			// The settings set on the document follow it.
+			old := d.ID()
+			d.identity = documentIdentity(d.filePath)
+			e.settings.rename(old, d.ID())
+		}
+		docs[d.identity] = d
+	}
+	e.documents = docs
+	e.syncWatches()
+}
+
+// saveDocument saves the document to path, or its current file path if empty.
+// Saving over the file of another loaded document is refused, otherwise both
+// documents would have the same identity.
+func (e *editor) saveDocument(d *document, path string) error {
+	if path != "" {
+		if other := e.findDocument(path); other != nil && other != d {
+			return errors.New(documentAlreadyLoaded.Sprintf(path))
+		}
+	}
+	if err := d.save(path); err != nil {
+		return err
+	}
+	// The path may have changed.
+	e.reindexDocuments()
+	return nil
+}
+
+// pruneDocuments forgets the documents that are not shown anymore.
+func (e *editor) pruneDocuments() {
+	for id, d := range e.documents {
+		if d.closed {
+			e.lspDidClose(d)
+			delete(e.documents, id)
+		}
+	}
+	e.syncWatches()
+}
+
+// sortedDocuments returns the loaded documents sorted by buffer number.
+func (e *editor) sortedDocuments() []*document {
+	out := make(documentsByNumber, 0, len(e.documents))
+	for _, d := range e.documents {
+		out = append(out, d)
+	}
+	sort.Sort(out)
+	return out
+}
+
+type documentsByNumber []*document
+
+func (d documentsByNumber) Len() int           { return len(d) }
+func (d documentsByNumber) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d documentsByNumber) Less(i, j int) bool { return d[i].number < d[j].number }
+
+// parseLocation parses a location as printed by compilers, "path:line" or
+// "path:line:column", both 1-based. The path can contain colons.
+func parseLocation(s string) (string, int, int, error) {
+	parts := strings.Split(s, ":")
+	var nums []int
+	for len(parts) > 1 && len(nums) < 2 {
+		n, err := strconv.Atoi(parts[len(parts)-1])
+		if err != nil {
+			break
+		}
+		nums = append([]int{n}, nums...)
+		parts = parts[:len(parts)-1]
+	}
+	path := strings.Join(parts, ":")
+	if len(nums) == 0 || path == "" || nums[0] < 1 {
+		return "", 0, 0, errors.New(invalidLocation.Sprintf(s))
+	}
+	col := 1
+	if len(nums) == 2 {
+		col = nums[1]
+	}
+	return path, nums[0], col, nil
+}
+
+// gotoLocation jumps to the location formatted as accepted by parseLocation,
+// loading the document if needed.
+func (e *editor) gotoLocation(loc string) error {
+	path, line, col, err := parseLocation(loc)
+	if err != nil {
+		return err
+	}
+	d, err := e.openDocument(path)
+	if err != nil {
+		return err
+	}
+	return e.gotoDocument(d, line-1, col-1)
+}
+
 // Commands.
 
-func cmdDocumentBuild(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
-	e.ExecuteCommand(w, "alert", "Implement 'document_build' for your document")
+func cmdDocumentBuild(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	return nil, e.startBuild(w, "build")
 }
 
-func cmdDocumentNew(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
-	cmd := make([]string, 3+len(args))
-	//cmd[0] = w.ID()
-	cmd[0] = wicore.RootWindow(w).ID()
-	cmd[1] = "fill"
-	cmd[2] = "new_document"
-	copy(cmd[3:], args)
-	e.ExecuteCommand(w, "window_new", cmd...)
+func cmdDocumentGoto(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	return nil, e.gotoLocation(args.String(0))
 }
 
-func cmdDocumentOpen(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
-	// The Window and View are created synchronously. The View is populated
-	// asynchronously.
-	log.Printf("Faking opening a file: %s", args)
+func cmdDocumentNew(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	//e.ExecuteCommand(w, "window_new", w.ID(), "fill", "new_document")
+	return e.ExecuteCommand(w, "window_new", wicore.RootWindow(w).ID(), "fill", "new_document")
+}
+
+func cmdDocumentOpen(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	// The Window and View are created synchronously, and so is the content
+	// read. If the file is already loaded, the new View shows the same
+	// document.
+	return e.ExecuteCommand(w, "window_new", wicore.RootWindow(w).ID(), "fill", "new_document", args.String(0))
+}
+
+func cmdDocumentSave(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	d, ok := getDocument(w).(*document)
+	if !ok {
+		return nil, errors.New(noDocument.String())
+	}
+	if err := e.saveDocument(d, args.String(0)); err != nil {
+		return nil, err
+	}
+	if filepath.Ext(d.filePath) == ".go" {
+		// Other packages may import the one of the document.
+		e.goTypes.invalidate()
+	}
+	e.lspDidSave(d)
+	wicore.PostCommand(e, nil, "editor_redraw")
+	return nil, nil
 }
 
-func cmdDocumentRun(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
-	e.ExecuteCommand(w, "alert", "Implement 'document_run' for your document")
+func cmdDocumentRun(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	return nil, e.startBuild(w, "run")
 }
 
 // RegisterDocumentCommands registers the top-level native commands to manage
 // documents.
 func RegisterDocumentCommands(dispatcher wicore.CommandsW) {
 	cmds := []wicore.Command{
-		&wicore.CommandImpl{
+		&privilegedCommandImpl{
 			"document_build",
-			0,
+			nil,
 			cmdDocumentBuild,
 			wicore.WindowCategory,
 			lang.Map{
 				lang.En: "Build a file",
 			},
 			lang.Map{
-				lang.En: "Build a file.",
+				lang.En: "Builds the project of the document in the background with the build command of its FileType, 'go build ./...' for Go; see build_command. The output is shown at the bottom and the errors it prints are shown in the documents; use quickfix_next to go through them. A build still running is cancelled.",
+			},
+		},
+		&privilegedCommandImpl{
+			"document_goto",
+			wicore.CommandArgs{{Name: "location", Type: wicore.ArgString}},
+			cmdDocumentGoto,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Moves the cursor to a location",
+			},
+			lang.Map{
+				lang.En: "Moves the cursor to a location formatted as path:line or path:line:column, 1-based, the format printed by compilers. A window already showing the file is reused, otherwise the file is opened in a new window.",
 			},
 		},
 		&wicore.CommandImpl{
 			"document_new",
-			0,
+			nil,
 			cmdDocumentNew,
 			wicore.WindowCategory,
 			lang.Map{
@@ -151,32 +535,45 @@ func RegisterDocumentCommands(dispatcher wicore.CommandsW) {
 		},
 		&wicore.CommandImpl{
 			"document_open",
-			1,
+			wicore.CommandArgs{{Name: "path", Type: wicore.ArgPath}},
 			cmdDocumentOpen,
 			wicore.WindowCategory,
 			lang.Map{
 				lang.En: "Opens a file in a new buffer",
 			},
 			lang.Map{
-				lang.En: "Opens a file in a new buffer.",
+				lang.En: "Opens a file in a new window. If the file is already opened, even via a symlink or a hardlink, the new window shows the same buffer.",
 			},
 		},
-		&wicore.CommandImpl{
+		&privilegedCommandImpl{
 			"document_run",
-			0,
+			nil,
 			cmdDocumentRun,
 			wicore.WindowCategory,
 			lang.Map{
 				lang.En: "Run a file",
 			},
 			lang.Map{
-				lang.En: "Run a file.",
+				lang.En: "Runs the document in the background with the run command of its FileType, 'go run' of its directory for Go; see build_command. The output is shown at the bottom like for document_build. A command still running is cancelled.",
+			},
+		},
+		&privilegedCommandImpl{
+			"document_save",
+			wicore.CommandArgs{{Name: "path", Type: wicore.ArgPath, Optional: true}},
+			cmdDocumentSave,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Saves the document",
+			},
+			lang.Map{
+				lang.En: "Saves the document of the current window. When a path is specified, the document is saved there and is then associated with this path.",
 			},
 		},
 
 		&wicore.CommandAlias{"new", "document_new", nil},
 		&wicore.CommandAlias{"o", "document_open", nil},
 		&wicore.CommandAlias{"open", "document_open", nil},
+		&wicore.CommandAlias{"w", "document_save", nil},
 	}
 	for _, cmd := range cmds {
 		dispatcher.Register(cmd)
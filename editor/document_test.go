@@ -0,0 +1,106 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/key"
+)
+
+func TestDocumentDedupe(t *testing.T) {
+	defer keepLog(t)()
+
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	path := tmpDir + "/doc.txt"
+	ut.AssertEqual(t, nil, ioutil.WriteFile(path, []byte("a\n"), 0600))
+	ut.AssertEqual(t, nil, os.Mkdir(tmpDir+"/sub", 0700))
+	paths := []string{path, tmpDir + "/sub/../doc.txt"}
+	if err := os.Symlink(path, tmpDir+"/symlink.txt"); err == nil {
+		paths = append(paths, tmpDir+"/symlink.txt")
+	}
+	if err := os.Link(path, tmpDir+"/hardlink.txt"); err == nil {
+		paths = append(paths, tmpDir+"/hardlink.txt")
+	}
+
+	ed, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+	for _, p := range paths {
+		wicore.PostCommand(e, nil, "open", p)
+	}
+	var counts []int
+	wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+		docs := e.AllDocuments()
+		ut.AssertEqual(t, 1, len(docs))
+		counts = append(counts, docs[0].ViewCount())
+		// Edits are seen by all the Views.
+		e.TriggerTerminalKeyPressed(key.Press{Ch: 'x'})
+		e.deferred <- func() {
+			for _, v := range e.documentViews(e.sortedDocuments()[0]) {
+				ut.AssertEqual(t, "xa\n", v.document.content[0])
+			}
+			wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+				counts = append(counts, e.AllDocuments()[0].ViewCount())
+				wicore.PostCommand(e, nil, "q!")
+			}, "window_close", e.ActiveWindow().ID())
+		}
+	}, "editor_redraw")
+	ut.AssertEqual(t, 0, e.EventLoop())
+	ut.AssertEqual(t, []int{len(paths), len(paths) - 1}, counts)
+}
+
+func TestDocumentSaveAs(t *testing.T) {
+	defer keepLog(t)()
+
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	pathA := tmpDir + "/a.txt"
+	pathB := tmpDir + "/b.txt"
+	ut.AssertEqual(t, nil, ioutil.WriteFile(pathA, []byte("a\n"), 0600))
+	ut.AssertEqual(t, nil, ioutil.WriteFile(pathB, []byte("b\n"), 0600))
+
+	ed, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+	wicore.PostCommand(e, nil, "open", pathA)
+	wicore.PostCommand(e, nil, "open", pathB)
+	wicore.PostCommand(e, nil, "set", "document", "tabstop", "7")
+	var overErr, saveErr error
+	tabstop := ""
+	wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+		w := e.ActiveWindow()
+		_, overErr = e.ExecuteCommand(w, "document_save", pathA)
+		_, saveErr = e.ExecuteCommand(w, "document_save", tmpDir+"/c.txt")
+		tabstop = e.GetSetting(w, "tabstop")
+		wicore.PostCommand(e, nil, "q!")
+	}, "editor_redraw")
+	ut.AssertEqual(t, 0, e.EventLoop())
+	ut.AssertEqual(t, pathA+" is already loaded in another buffer.", overErr.Error())
+	ut.AssertEqual(t, nil, saveErr)
+	ut.AssertEqual(t, 2, len(e.AllDocuments()))
+	// The setting followed the document to its new path.
+	ut.AssertEqual(t, "7", tabstop)
+	b, err := ioutil.ReadFile(pathA)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "a\n", string(b))
+}
@@ -5,6 +5,12 @@
 package editor
 
 import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"unicode"
+
 	"github.com/wi-ed/wi/wicore"
 	"github.com/wi-ed/wi/wicore/colors"
 	"github.com/wi-ed/wi/wicore/key"
@@ -25,150 +31,350 @@ type ColorMode int
 //
 // TODO(maruel): In some cases, the cursor position could be shared. A good
 // example is vimdiff in 4-way mode.
-//
-// TODO(maruel): The part that is serializable has to be in its own structure
-// for easier deserialization.
 type documentView struct {
 	view
-	document        *document
-	cursorLine      int // cursor position is 0-based.
-	cursorColumn    int
-	cursorColumnMax int         // cursor position if the line was long enough.
-	offsetLine      int         // Offset of the view of the document.
-	offsetColumn    int         // Offset of the view of the document. Only make sense when wordWrap==false.
-	wordWrap        bool        // true if word-wrapping is in effect. TODO(maruel): Implement.
-	columnMode      bool        // true if free movement is in effect. TODO(maruel): Implement.
-	colorMode       ColorMode   // Coloring of the file. Technically it'd be possible to have one file view without color and another with. TODO(maruel): Determine if useful.
-	selection       raster.Rect // selection if any. TODO(maruel): Selection in columnMode vs normal selection vs line selection.
+	documentViewState
+	e          wicore.Editor
+	document   *document
+	columnMode bool        // true if free movement is in effect. TODO(maruel): Implement.
+	colorMode  ColorMode   // Coloring of the file. Technically it'd be possible to have one file view without color and another with. TODO(maruel): Determine if useful.
+	selection  raster.Rect // selection if any. TODO(maruel): Selection in columnMode vs normal selection vs line selection.
+	folds      []fold      // Ranges of lines that can be collapsed, sorted by start.
+	// offsetSegment is the first wrapped segment of OffsetLine shown, when
+	// the "wordwrap" setting is on.
+	offsetSegment int
+	// foldMethod and foldVersion are the "foldmethod" setting and the
+	// version of the document the folds were calculated for.
+	foldMethod  string
+	foldVersion int
+}
+
+// documentViewState is the part of documentView that is persisted in a
+// session.
+type documentViewState struct {
+	CursorLine      int // cursor position is 0-based.
+	CursorColumn    int // Byte offset in the line, always on a grapheme cluster boundary.
+	CursorColumnMax int // Cell of the cursor if the line was long enough.
+	OffsetLine      int // Offset of the view of the document.
+	OffsetColumn    int // Offset in cells of the view of the document. Only make sense when the "wordwrap" setting is off.
 }
 
 func (v *documentView) Close() error {
 	err := v.view.Close()
-	err2 := v.document.Close()
-	if err != nil {
-		return err
+	if err2 := v.setDocument(nil); err == nil {
+		err = err2
 	}
-	return err2
+	return err
+}
+
+// setDocument makes the View show d. The previous document stays loaded even
+// if no other View shows it, unless it is an unmodified untitled document.
+func (v *documentView) setDocument(d *document) error {
+	var err error
+	if old := v.document; old != nil {
+		old.views--
+		if old.views == 0 && old.filePath == "" && !old.isDirty {
+			err = old.Close()
+		}
+	}
+	v.document = d
+	if d != nil {
+		d.views++
+		v.title = d.filePath
+		if v.title == "" {
+			v.title = emptyDocument.String()
+		}
+	}
+	return err
 }
 
 func (v *documentView) Buffer() *raster.Buffer {
-	v.buffer.Fill(raster.Cell{' ', v.defaultFormat})
-	v.document.RenderInto(v.buffer, v, v.offsetColumn, v.offsetLine)
-	// TODO(maruel): Draw the cursor using proper terminal function.
-	cell := v.buffer.Cell(v.offsetColumn+v.cursorColumn, v.offsetLine+v.cursorLine)
-	cell.F.Bg = colors.White
-	cell.F.Fg = colors.Black
+	v.buffer.Fill(raster.Cell{R: ' ', F: v.DefaultFormat()})
+	v.updateFolds()
+	g := v.gutter()
+	w := g.width()
+	p := v.viewport(w)
+	// The size or the settings may have changed since the cursor moved.
+	p.scrollToCursor()
+	rows := p.rows()
+	g.draw(v.buffer.SubBuffer(raster.Rect{0, 0, w, v.buffer.Height}), v, rows)
+	text := v.buffer.SubBuffer(raster.Rect{w, 0, p.width, v.buffer.Height})
+	breakFormat := v.DefaultFormat()
+	breakFormat.Fg = colors.DarkGray
+	ws := v.whitespace()
+	cursor := v.visibleLine(v.CursorLine)
+	for y, r := range rows {
+		t := lineText(v.document.content[r.line])
+		x := 0
+		if r.wrapped {
+			text.DrawString(p.showbreak, 0, y, breakFormat)
+			x = raster.StringWidth(p.showbreak)
+		} else if !p.wrap {
+			// The first character shown may start after the left edge, e.g.
+			// when a tab is cut.
+			x = displayColumn(t, r.start, p.tabstop) - v.OffsetColumn
+		}
+		v.document.renderRow(text, x, y, r.line, r.start, r.end, v.DefaultFormat(), &ws)
+		if f := v.closedFold(r.line); f != nil {
+			end := len(strings.TrimRightFunc(t, unicode.IsSpace))
+			sx := x + displayColumn(t, end, p.tabstop) - displayColumn(t, r.start, p.tabstop) + 1
+			if sx < 0 {
+				sx = 0
+			}
+			text.DrawString(foldSummary.Sprintf(f.end-f.start+1), sx, y, breakFormat)
+		}
+		// TODO(maruel): Draw the cursor using proper terminal function.
+		last := y == len(rows)-1 || rows[y+1].line != r.line
+		if r.line == cursor && v.CursorColumn >= r.start && (v.CursorColumn < r.end || last) {
+			cell := text.Cell(x+displayColumn(t, v.CursorColumn, p.tabstop)-displayColumn(t, r.start, p.tabstop), y)
+			cell.F.Bg = colors.White
+			cell.F.Fg = colors.Black
+		}
+	}
 	// TODO(maruel): Draw the selection over.
 	return v.buffer
 }
 
+// Document implements wicore.DocumentView.
+func (v *documentView) Document() wicore.Document {
+	return v.document
+}
+
+// DefaultFormat returns the format of the theme in effect.
+func (v *documentView) DefaultFormat() raster.CellFormat {
+	if f, ok := themes[v.e.GetSetting(v.window, "theme")]; ok {
+		return f
+	}
+	return v.defaultFormat
+}
+
+// documentViewSession is the state of a documentView saved in a session.
+type documentViewSession struct {
+	Path string // Path of the document. Empty if it was never saved.
+	documentViewState
+}
+
+func (v *documentView) sessionState() interface{} {
+	return &documentViewSession{v.document.filePath, v.documentViewState}
+}
+
+func (v *documentView) restoreSessionState(data []byte) error {
+	s := &documentViewSession{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return err
+	}
+	if s.Path != "" && s.Path != v.document.filePath {
+		d, err := v.e.(*editor).openDocument(s.Path)
+		if err != nil {
+			return err
+		}
+		if err := v.setDocument(d); err != nil {
+			return err
+		}
+	}
+	// The file may have changed since the session was saved and the session
+	// file may have been edited.
+	content := v.document.content
+	if s.CursorLine >= len(content) {
+		s.CursorLine = len(content) - 1
+	}
+	if s.CursorLine < 0 {
+		s.CursorLine = 0
+	}
+	if last := lastColumn(content[s.CursorLine]); s.CursorColumn > last {
+		s.CursorColumn = last
+	}
+	if s.CursorColumn < 0 {
+		s.CursorColumn = 0
+	}
+	if s.OffsetLine > s.CursorLine {
+		s.OffsetLine = s.CursorLine
+	}
+	if s.OffsetLine < 0 {
+		s.OffsetLine = 0
+	}
+	if s.OffsetColumn < 0 {
+		s.OffsetColumn = 0
+	}
+	v.documentViewState = s.documentViewState
+	v.cursorMoved(v.e)
+	return nil
+}
+
 // cursorMoved triggers the event and ensures the cursor is visible.
 func (v *documentView) cursorMoved(e wicore.Editor) {
-	e.TriggerDocumentCursorMoved(v.document, v.cursorColumn, v.cursorLine)
-	// TODO(maruel): Adjust v.offsetLine and v.offsetColumn as necessary.
+	v.viewport(v.gutter().width()).scrollToCursor()
+	e.TriggerDocumentCursorMoved(v.document, v.CursorColumn, v.CursorLine)
 	// TODO(maruel): Trigger redraw.
 }
 
 func (v *documentView) onKeyPress(e wicore.Editor, k key.Press) {
-	// TODO(maruel): Only get when the View is active.
-	l := v.document.content[v.cursorLine]
-	v.document.content[v.cursorLine] = l[:v.cursorColumn] + string(k.Ch) + l[v.cursorColumn:]
-	v.cursorColumn++
-	v.cursorColumnMax = v.cursorColumn
+	if e.ActiveWindow().View() != wicore.View(v) {
+		return
+	}
+	switch k.Key {
+	case key.Enter:
+		v.insertNewline()
+	case key.Tab:
+		v.insertTab()
+	case key.Space:
+		v.insert(" ")
+	case key.None:
+		v.insert(string(k.Ch))
+	default:
+		return
+	}
 	v.cursorMoved(e)
-	// TODO(maruel): Implement dirty instead.
+	// TODO(maruel): Trigger a redraw instead.
 	e.TriggerTerminalResized()
 }
 
 func cmdToDoc(handler func(v *documentView, e wicore.EditorW)) wicore.CommandImplHandler {
-	return func(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+	return func(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
 		v, ok := w.View().(*documentView)
 		if !ok {
-			e.ExecuteCommand(w, "alert", "Internal error")
-			return
+			return nil, errors.New("internal error")
 		}
 		handler(v, e)
+		return nil, nil
+	}
+}
+
+// updateColumnMax remembers the cell of the cursor, to keep it when moving
+// to shorter lines and back.
+func (v *documentView) updateColumnMax() {
+	v.CursorColumnMax = displayColumn(v.document.content[v.CursorLine], v.CursorColumn, v.tabstop())
+}
+
+// moveToLine moves the cursor to the line, on the grapheme cluster covering
+// the cell CursorColumnMax.
+func (v *documentView) moveToLine(line int) {
+	l := v.document.content[line]
+	v.CursorLine = line
+	v.CursorColumn = columnAt(l, v.CursorColumnMax, v.tabstop())
+	if last := lastColumn(l); v.CursorColumn > last {
+		v.CursorColumn = last
 	}
 }
 
 func cmdDocumentCursorLeft(v *documentView, e wicore.EditorW) {
-	if v.cursorColumn == 0 {
+	v.updateFolds()
+	if v.CursorColumn == 0 {
 		// TODO(maruel): Make wrap behavior optional.
-		if v.cursorLine == 0 {
+		prev := v.prevLine(v.visibleLine(v.CursorLine))
+		if prev == -1 {
 			// TODO(maruel): Beep.
 			return
 		}
-		v.cursorLine--
-		v.cursorColumn = len(v.document.content[v.cursorLine]) - 1
+		v.CursorLine = prev
+		v.CursorColumn = lastColumn(v.document.content[v.CursorLine])
+	} else {
+		v.CursorColumn = prevColumn(v.document.content[v.CursorLine], v.CursorColumn)
 	}
-	v.cursorColumnMax = v.cursorColumn
+	v.updateColumnMax()
 	v.cursorMoved(e)
 }
 
 func cmdDocumentCursorRight(v *documentView, e wicore.EditorW) {
-	if v.cursorColumn == len(v.document.content[v.cursorLine])-1 {
+	v.updateFolds()
+	l := v.document.content[v.CursorLine]
+	if v.CursorColumn >= lastColumn(l) || v.closedFold(v.CursorLine) != nil {
 		// TODO(maruel): Make wrap behavior optional.
-		if v.cursorLine > len(v.document.content)-1 {
+		next := v.nextLine(v.visibleLine(v.CursorLine))
+		if next == -1 {
 			// TODO(maruel): Beep.
 			return
 		}
-		v.cursorLine++
-		v.cursorColumn = 0
+		v.CursorLine = next
+		v.CursorColumn = 0
 	} else {
-		v.cursorColumn++
+		v.CursorColumn = nextColumn(l, v.CursorColumn)
 	}
-	v.cursorColumnMax = v.cursorColumn
+	v.updateColumnMax()
 	v.cursorMoved(e)
 }
 
+// The closed folds are skipped over.
+
 func cmdDocumentCursorUp(v *documentView, e wicore.EditorW) {
-	if v.cursorLine == 0 {
+	v.updateFolds()
+	prev := v.prevLine(v.visibleLine(v.CursorLine))
+	if prev == -1 {
 		// TODO(maruel): Beep.
 		return
 	}
-	v.cursorLine--
-	if v.cursorColumn >= len(v.document.content[v.cursorLine]) {
-		v.cursorColumn = len(v.document.content[v.cursorLine]) - 1
-	}
+	v.moveToLine(prev)
 	v.cursorMoved(e)
 }
 
 func cmdDocumentCursorDown(v *documentView, e wicore.EditorW) {
-	if v.cursorLine >= len(v.document.content)-1 {
+	v.updateFolds()
+	next := v.nextLine(v.visibleLine(v.CursorLine))
+	if next == -1 {
 		// TODO(maruel): Beep.
 		return
 	}
-	v.cursorLine++
-	if v.cursorColumn >= len(v.document.content[v.cursorLine]) {
-		v.cursorColumn = len(v.document.content[v.cursorLine]) - 1
-	}
+	v.moveToLine(next)
 	v.cursorMoved(e)
 }
 
 func cmdDocumentCursorHome(v *documentView, e wicore.EditorW) {
-	if v.cursorLine != 0 || v.cursorColumnMax != 0 {
-		v.cursorLine = 0
-		v.cursorColumn = 0
-		v.cursorColumnMax = v.cursorColumn
+	if v.CursorLine != 0 || v.CursorColumnMax != 0 {
+		v.CursorLine = 0
+		v.CursorColumn = 0
+		v.CursorColumnMax = v.CursorColumn
 		v.cursorMoved(e)
 	}
 }
 
 func cmdDocumentCursorEnd(v *documentView, e wicore.EditorW) {
-	if v.cursorLine != len(v.document.content)-1 || v.cursorColumnMax != len(v.document.content[v.cursorLine])-1 {
-		v.cursorLine = len(v.document.content) - 1
-		v.cursorColumn = len(v.document.content[v.cursorLine]) - 1
-		v.cursorColumnMax = v.cursorColumn
+	if v.CursorLine != len(v.document.content)-1 || v.CursorColumn != lastColumn(v.document.content[v.CursorLine]) {
+		v.CursorLine = len(v.document.content) - 1
+		v.CursorColumn = lastColumn(v.document.content[v.CursorLine])
+		v.updateColumnMax()
 		v.cursorMoved(e)
 	}
 }
 
+// pageRows returns the number of rows scrolled by a page, keeping two rows of
+// context.
+func (p viewport) pageRows() int {
+	if p.height > 3 {
+		return p.height - 2
+	}
+	return 1
+}
+
+func cmdDocumentPageDown(v *documentView, e wicore.EditorW) {
+	p := v.viewport(v.gutter().width())
+	p.scroll(p.pageRows())
+	v.cursorMoved(e)
+}
+
+func cmdDocumentPageUp(v *documentView, e wicore.EditorW) {
+	p := v.viewport(v.gutter().width())
+	p.scroll(-p.pageRows())
+	v.cursorMoved(e)
+}
+
+func cmdDocumentHalfPageDown(v *documentView, e wicore.EditorW) {
+	p := v.viewport(v.gutter().width())
+	p.scroll((p.height + 1) / 2)
+	v.cursorMoved(e)
+}
+
+func cmdDocumentHalfPageUp(v *documentView, e wicore.EditorW) {
+	p := v.viewport(v.gutter().width())
+	p.scroll(-(p.height + 1) / 2)
+	v.cursorMoved(e)
+}
+
 func documentViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
 	dispatcher := makeCommands()
 	cmds := []wicore.Command{
 		&wicore.CommandImpl{
 			"document_cursor_left",
-			0,
+			nil,
 			cmdToDoc(cmdDocumentCursorLeft),
 			wicore.WindowCategory,
 			lang.Map{
@@ -180,7 +386,7 @@ func documentViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
 		},
 		&wicore.CommandImpl{
 			"document_cursor_right",
-			0,
+			nil,
 			cmdToDoc(cmdDocumentCursorRight),
 			wicore.WindowCategory,
 			lang.Map{
@@ -192,7 +398,7 @@ func documentViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
 		},
 		&wicore.CommandImpl{
 			"document_cursor_up",
-			0,
+			nil,
 			cmdToDoc(cmdDocumentCursorUp),
 			wicore.WindowCategory,
 			lang.Map{
@@ -204,7 +410,7 @@ func documentViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
 		},
 		&wicore.CommandImpl{
 			"document_cursor_down",
-			0,
+			nil,
 			cmdToDoc(cmdDocumentCursorDown),
 			wicore.WindowCategory,
 			lang.Map{
@@ -216,7 +422,7 @@ func documentViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
 		},
 		&wicore.CommandImpl{
 			"document_cursor_home",
-			0,
+			nil,
 			cmdToDoc(cmdDocumentCursorHome),
 			wicore.WindowCategory,
 			lang.Map{
@@ -228,7 +434,7 @@ func documentViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
 		},
 		&wicore.CommandImpl{
 			"document_cursor_end",
-			0,
+			nil,
 			cmdToDoc(cmdDocumentCursorEnd),
 			wicore.WindowCategory,
 			lang.Map{
@@ -238,7 +444,80 @@ func documentViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
 				lang.En: "Moves cursor to the end of the document.",
 			},
 		},
+		&wicore.CommandImpl{
+			"document_dedent",
+			nil,
+			cmdToDoc(cmdDocumentDedent),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Removes an indentation level from the line",
+			},
+			lang.Map{
+				lang.En: "Removes an indentation level of \"shiftwidth\" cells from the line.",
+			},
+		},
+		&wicore.CommandImpl{
+			"document_half_page_down",
+			nil,
+			cmdToDoc(cmdDocumentHalfPageDown),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Scrolls down half a page",
+			},
+			lang.Map{
+				lang.En: "Scrolls down half a page, moving the cursor by as many rows.",
+			},
+		},
+		&wicore.CommandImpl{
+			"document_half_page_up",
+			nil,
+			cmdToDoc(cmdDocumentHalfPageUp),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Scrolls up half a page",
+			},
+			lang.Map{
+				lang.En: "Scrolls up half a page, moving the cursor by as many rows.",
+			},
+		},
+		&wicore.CommandImpl{
+			"document_indent",
+			nil,
+			cmdToDoc(cmdDocumentIndent),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Adds an indentation level to the line",
+			},
+			lang.Map{
+				lang.En: "Adds an indentation level of \"shiftwidth\" cells to the line, with tabs unless \"expandtab\" is set.",
+			},
+		},
+		&wicore.CommandImpl{
+			"document_page_down",
+			nil,
+			cmdToDoc(cmdDocumentPageDown),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Scrolls down a page",
+			},
+			lang.Map{
+				lang.En: "Scrolls down a page, keeping two rows of context, and moves the cursor by as many rows.",
+			},
+		},
+		&wicore.CommandImpl{
+			"document_page_up",
+			nil,
+			cmdToDoc(cmdDocumentPageUp),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Scrolls up a page",
+			},
+			lang.Map{
+				lang.En: "Scrolls up a page, keeping two rows of context, and moves the cursor by as many rows.",
+			},
+		},
 	}
+	cmds = append(cmds, foldCommands()...)
 	for _, cmd := range cmds {
 		dispatcher.Register(cmd)
 	}
@@ -250,26 +529,48 @@ func documentViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
 	bindings.Set(wicore.AllMode, key.Press{Key: key.Down}, "document_cursor_down")
 	bindings.Set(wicore.AllMode, key.Press{Key: key.Home}, "document_cursor_home")
 	bindings.Set(wicore.AllMode, key.Press{Key: key.End}, "document_cursor_end")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.PageDown}, "document_page_down")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.PageUp}, "document_page_up")
 	// vim style movement.
 	bindings.Set(wicore.Normal, key.Press{Ch: 'h'}, "document_cursor_left")
 	bindings.Set(wicore.Normal, key.Press{Ch: 'l'}, "document_cursor_right")
 	bindings.Set(wicore.Normal, key.Press{Ch: 'k'}, "document_cursor_up")
 	bindings.Set(wicore.Normal, key.Press{Ch: 'j'}, "document_cursor_down")
+	bindings.Set(wicore.Normal, key.Press{Ctrl: true, Ch: 'b'}, "document_page_up")
+	bindings.Set(wicore.Normal, key.Press{Ctrl: true, Ch: 'd'}, "document_half_page_down")
+	bindings.Set(wicore.Normal, key.Press{Ctrl: true, Ch: 'f'}, "document_page_down")
+	bindings.Set(wicore.Normal, key.Press{Ctrl: true, Ch: 'u'}, "document_half_page_up")
+	bindings.Set(wicore.Normal, key.Press{Ch: '<'}, "document_dedent")
+	bindings.Set(wicore.Normal, key.Press{Ch: '>'}, "document_indent")
+	bindings.Set(wicore.Normal, key.Press{Ch: 'z'}, "fold_toggle")
+
+	// Opening a file already loaded shows the same document. window_new loaded
+	// it already and returned the error if it can't be read.
+	ed := e.(*editor)
+	path := ""
+	if len(args) != 0 {
+		path = args[0]
+	}
+	doc, err := ed.openDocument(path)
+	if err != nil {
+		log.Printf("Failed to load %s: %s", path, err)
+		doc, _ = ed.openDocument("")
+	}
 
 	// TODO(maruel): Sort out "use max space".
-	// TODO(maruel): Load last cursor position from config.
+	// The last cursor position is restored by session_load.
 	v := &documentView{
 		view: view{
 			commands:      dispatcher,
 			keyBindings:   bindings,
 			id:            id,
-			title:         "<Empty document>", // TODO(maruel): Title == document.filePath ?
 			naturalX:      100,
 			naturalY:      100,
 			defaultFormat: raster.CellFormat{Fg: colors.BrightYellow, Bg: colors.Black},
 		},
-		document: makeDocument(),
+		e: e,
 	}
+	_ = v.setDocument(doc)
 	v.onAttach = func(_ *view, w wicore.Window) {
 		v.cursorMoved(e)
 	}
@@ -0,0 +1,64 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/colors"
+	"github.com/wi-ed/wi/wicore/raster"
+)
+
+func TestDocumentGraphemes(t *testing.T) {
+	defer keepLog(t)()
+
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	path := filepath.Join(tmpDir, "a.txt")
+	ut.AssertEqual(t, nil, ioutil.WriteFile(path, []byte("a日e\u0301b\nxyzwvu\n"), 0600))
+
+	ed, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+	var v *documentView
+	var cursors [][2]int
+	snapshot := func(o wicore.CommandOutcome) {
+		ut.AssertEqual(t, nil, o.Err)
+		cursors = append(cursors, [2]int{v.CursorLine, v.CursorColumn})
+	}
+	wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+		v = e.ActiveWindow().View().(*documentView)
+		v.SetSize(10, 3)
+	}, "open", path)
+	for _, cmd := range []string{"right", "right", "down", "left", "up", "right", "right", "right", "right", "left"} {
+		wicore.PostCommand(e, snapshot, "document_cursor_"+cmd)
+	}
+	wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+		snapshot(o)
+		b := v.Buffer()
+		ut.AssertEqual(t, "a日e\u0301b", strings.TrimRight(string(b.Line(0).Runes()), " "))
+		// The combining mark is merged into the cell of e and the cursor is
+		// drawn on b, after the wide character.
+		ut.AssertEqual(t, raster.Cell{R: 'e', F: v.DefaultFormat(), Comb: "\u0301"}, *b.Cell(3, 0))
+		ut.AssertEqual(t, colors.White, b.Cell(4, 0).F.Bg)
+		wicore.PostCommand(e, nil, "q!")
+	}, "document_cursor_left")
+	ut.AssertEqual(t, 0, e.EventLoop())
+
+	expected := [][2]int{{0, 1}, {0, 4}, {1, 3}, {1, 2}, {0, 1}, {0, 4}, {0, 7}, {0, 8}, {1, 0}, {0, 8}, {0, 7}}
+	ut.AssertEqual(t, expected, cursors)
+}
@@ -5,6 +5,7 @@
 package editor
 
 import (
+	"errors"
 	"io"
 	"log"
 	"time"
@@ -32,6 +33,14 @@ type Editor interface {
 	// EventLoop runs the event loop until the command "quit" executes
 	// successfully.
 	EventLoop() int
+
+	// EnableSwapFiles starts journaling the modified documents in swap files in
+	// dir, so they can be recovered with "document_recover" after a crash.
+	EnableSwapFiles(dir string) error
+
+	// FlushSwapFiles writes the modified documents to their swap files
+	// synchronously. It is meant to be called after a panic.
+	FlushSwapFiles()
 }
 
 // editor is the global structure that holds everything together. It implements
@@ -42,19 +51,60 @@ type editor struct {
 	terminal      Terminal                      // Abstract terminal interface to the real terminal.
 	rootWindow    *window                       // The rootWindow is always DockingFill and set to the size of the terminal.
 	lastActive    []wicore.Window               // Most recently used order of Window activatd.
-	documents     []wicore.Document             // All loaded documents.
+	documents     map[string]*document          // All loaded documents, by identity.
+	lastDocument  int                           // Last buffer number given to a document.
+	recentFiles   []string                      // Most recently used files, by absolute path.
+	lastSign      int                           // Last ID given to a sign.
 	viewFactories map[string]wicore.ViewFactory // All the ViewFactory's that can be used to create new View.
 	viewReady     chan bool                     // A View.Buffer() is ready to be drawn.
 	keyboardMode  wicore.KeyboardMode           // Global keyboard mode instead of per Window, it's more logical for users.
 	plugins       Plugins                       // All loaded plugin processes.
+	settings      *settings                     // Registered settings and their values.
+	quitting      bool                          // A shutdown is in progress.
+	done          chan struct{}                 // Closed when the editor quits, to unblock the requests of the plugins.
+	quitVetoes    []string                      // Reasons given by the listeners of EditorQuitting to not quit.
+	exitCode      int                           // Value returned by EventLoop().
+	swap          *swapFiles                    // Journaling of the modified documents; nil if disabled.
+	watcher       fileWatcher                   // Detects modifications of the documents by other programs.
+	watched       map[string]bool               // Paths watched by watcher.
+	goTypes       *goTypes                      // Type checked Go packages.
+	jumps         []jump                        // Jump list; see recordJump().
+	jumpIndex     int                           // Current position in jumps.
+	lsp           *lspServers                   // Configured language servers.
+	diagnostics   map[string][]*diagnostic      // Diagnostics by absolute path; see publishDiagnostics().
+	buildCommands map[buildKey][]string         // Build and run commands set by build_command.
+	build         *buildJob                     // Last build or run command.
+	goTest        *goTestRun                    // Last tests run.
+	coverage      map[string][]*coverBlock      // Coverage profile by absolute path; see coverage_show.
 	nextViewID    int
 }
 
 func (e *editor) Close() error {
+	var err error
+	if e.swap != nil {
+		err = e.swap.Close()
+	}
+	if e.watcher != nil {
+		if err2 := e.watcher.Close(); err2 != nil {
+			err = err2
+		}
+		e.watcher = nil
+	}
+	if e.build != nil {
+		e.build.cancel()
+	}
+	if e.goTest != nil {
+		e.goTest.cancel()
+	}
+	if err2 := e.lsp.Close(); err2 != nil {
+		err = err2
+	}
 	if e.plugins == nil {
-		return nil
+		return err
+	}
+	if err2 := e.plugins.Close(); err2 != nil {
+		err = err2
 	}
-	err := e.plugins.Close()
 	e.plugins = nil
 	return err
 }
@@ -75,13 +125,20 @@ func (e *editor) onTerminalMetaKeyPressed(k key.Press) {
 	if !k.IsMeta() {
 		panic("Unexpected non-meta")
 	}
-	cmdName := wicore.GetKeyBindingCommand(e, e.KeyboardMode(), k)
+	cmdName := ""
+	if v, ok := e.ActiveWindow().View().(*promptView); ok {
+		// A prompt is modal; the global key bindings are ignored.
+		cmdName = v.KeyBindings().Get(e.KeyboardMode(), k)
+	} else {
+		cmdName = wicore.GetKeyBindingCommand(e, e.KeyboardMode(), k)
+	}
 	if cmdName != "" {
 		// The command is executed inline, since the key was already enqueued in
 		// the event queue.
-		e.ExecuteCommand(e.ActiveWindow(), cmdName)
+		_, err := e.ExecuteCommand(e.ActiveWindow(), cmdName)
+		e.alertOnError(err)
 	} else {
-		e.ExecuteCommand(e.ActiveWindow(), "alert", notMapped.Sprintf(k))
+		e.alertOnError(errors.New(notMapped.Sprintf(k)))
 	}
 }
 
@@ -94,25 +151,73 @@ func (e *editor) onTerminalKeyPressed(k key.Press) {
 	}
 }
 
-func (e *editor) ExecuteCommand(w wicore.Window, cmdName string, args ...string) {
+func (e *editor) ExecuteCommand(w wicore.Window, cmdName string, args ...string) (wicore.CommandResult, error) {
 	log.Printf("ExecuteCommand(%s, %s, %s)", w, cmdName, args)
 	if w == nil {
 		w = e.ActiveWindow()
 	}
 	cmd := wicore.GetCommand(e, w, cmdName)
 	if cmd == nil {
-		e.ExecuteCommand(w, "alert", notFound.Sprintf(cmdName))
-	} else {
-		cmd.Handle(e, w, args...)
+		return nil, errors.New(notFound.Sprintf(cmdName))
+	}
+	// Validate and convert the arguments before dispatching, so that the usage
+	// is reported uniformly, including for commands implemented by plugins.
+	values, err := cmd.Args().Parse(e, cmdName, args)
+	if err != nil {
+		return nil, err
+	}
+	return cmd.Handle(e, w, values)
+}
+
+// alertOnError is the central place where failures of commands are reported
+// to the user.
+func (e *editor) alertOnError(err error) {
+	if err == nil {
+		return
+	}
+	log.Printf("Command failed: %s", err)
+	if _, err2 := e.ExecuteCommand(e.ActiveWindow(), "alert", err.Error()); err2 != nil {
+		log.Printf("Failed to alert: %s", err2)
+	}
+}
+
+// post enqueues f to be run by the UI goroutine. It returns false without
+// enqueuing f when cancelled is closed or the editor quit first; cancelled may
+// be nil.
+//
+// It blocks while the queue is full so it must not be called from the UI
+// goroutine.
+func (e *editor) post(cancelled <-chan struct{}, f func()) bool {
+	select {
+	case e.deferred <- f:
+		return true
+	case <-cancelled:
+		return false
+	case <-e.done:
+		return false
 	}
 }
 
 func (e *editor) onCommands(cmds wicore.EnqueuedCommands) {
-	for _, cmd := range cmds.Commands {
-		e.ExecuteCommand(e.ActiveWindow(), cmd[0], cmd[1:]...)
+	outcomes := make([]wicore.CommandOutcome, len(cmds.Commands))
+	failed := false
+	for i, cmd := range cmds.Commands {
+		outcomes[i].Command = cmd
+		if len(cmd) == 0 {
+			outcomes[i].Err = errors.New(emptyCommand.String())
+		} else if failed && cmds.StopOnError {
+			outcomes[i].Err = errors.New(commandSkipped.Sprintf(cmd[0]))
+			continue
+		} else {
+			outcomes[i].Result, outcomes[i].Err = e.ExecuteCommand(e.ActiveWindow(), cmd[0], cmd[1:]...)
+		}
+		if outcomes[i].Err != nil {
+			failed = true
+			e.alertOnError(outcomes[i].Err)
+		}
 	}
 	if cmds.Callback != nil {
-		cmds.Callback()
+		cmds.Callback(outcomes)
 	}
 }
 
@@ -131,8 +236,9 @@ func (e *editor) draw() {
 }
 
 func (e *editor) AllDocuments() []wicore.Document {
-	out := make([]wicore.Document, len(e.documents))
-	for i, v := range e.documents {
+	docs := e.sortedDocuments()
+	out := make([]wicore.Document, len(docs))
+	for i, v := range docs {
 		out[i] = v
 	}
 	return out
@@ -150,12 +256,24 @@ func (e *editor) ActiveWindow() wicore.Window {
 	return e.lastActive[0]
 }
 
-func (e *editor) activateWindow(w wicore.Window) {
+func (e *editor) activateWindow(w wicore.Window) error {
 	view := w.View()
 	log.Printf("ActivateWindow(%s)", view.Title())
 	if view.IsDisabled() {
-		e.ExecuteCommand(w, "alert", activateDisabled.String())
-		return
+		return errors.New(activateDisabled.String())
+	}
+	if _, ok := e.lastActive[0].View().(*promptView); ok && e.lastActive[0] != w {
+		// A prompt is modal, only another prompt can take the focus from it.
+		if _, ok := view.(*promptView); !ok {
+			return errors.New(promptPending.String())
+		}
+	}
+
+	if w, ok := w.(*window); ok {
+		bringToFront(w)
+	}
+	if v, ok := view.(*documentView); ok && v.document != nil {
+		e.touchRecentFile(v.document.filePath)
 	}
 
 	// First remove w from e.lastActive, second add w as e.lastActive[0].
@@ -165,19 +283,46 @@ func (e *editor) activateWindow(w wicore.Window) {
 	for i, v := range e.lastActive {
 		if v == w {
 			if i > 0 {
-				copy(e.lastActive[:i], e.lastActive[1:i+1])
+				copy(e.lastActive[1:i+1], e.lastActive[:i])
 				e.lastActive[0] = w
 			}
-			return
+			return nil
 		}
 	}
 
 	// This Window has never been active.
 	l := len(e.lastActive)
 	e.lastActive = append(e.lastActive, nil)
-	copy(e.lastActive[:l], e.lastActive[1:l])
+	copy(e.lastActive[1:], e.lastActive[:l])
 	e.lastActive[0] = w
 	e.TriggerViewActivated(view)
+	return nil
+}
+
+// forgetWindow removes a Window tree from the most recently used list. If the
+// active Window was removed, the next most recently used Window becomes
+// active.
+func (e *editor) forgetWindow(w *window) {
+	for _, c := range w.childrenWindows {
+		e.forgetWindow(c)
+	}
+	wasActive := e.lastActive[0] == wicore.Window(w)
+	for i, v := range e.lastActive {
+		if v == wicore.Window(w) {
+			copy(e.lastActive[i:], e.lastActive[i+1:])
+			e.lastActive = e.lastActive[:len(e.lastActive)-1]
+			break
+		}
+	}
+	if len(e.lastActive) == 0 {
+		e.lastActive = append(e.lastActive, e.rootWindow)
+	}
+	if wasActive {
+		if next, ok := e.lastActive[0].(*window); ok {
+			bringToFront(next)
+		}
+		e.TriggerViewActivated(e.lastActive[0].View())
+	}
 }
 
 func (e *editor) RegisterViewFactory(name string, viewFactory wicore.ViewFactory) bool {
@@ -235,7 +380,7 @@ func (e *editor) EventLoop() int {
 				// Happens on exit. Drawing only happens to make unit tests happy.
 				// Should be removed eventually.
 				e.draw()
-				return 0
+				return e.exitCode
 			}
 			// The core of the event loop. See the generated file
 			// event_registry_impl.go for how the functions are enqueued.
@@ -266,15 +411,6 @@ func (e *editor) EventLoop() int {
 	}
 }
 
-func (e *editor) isDirty() bool {
-	for _, doc := range e.documents {
-		if doc.IsDirty() {
-			return true
-		}
-	}
-	return false
-}
-
 func (e *editor) loadPlugins() {
 	paths, err := enumPlugins(getPluginsPaths())
 	if err != nil {
@@ -313,10 +449,17 @@ func MakeEditor(terminal Terminal, noPlugin bool) (Editor, error) {
 		terminal:      terminal,
 		rootWindow:    nil,                         // It is set below due to circular reference.
 		lastActive:    make([]wicore.Window, 1, 8), // It is set below.
-		documents:     []wicore.Document{},
+		documents:     map[string]*document{},
 		viewFactories: make(map[string]wicore.ViewFactory),
 		viewReady:     make(chan bool),
 		keyboardMode:  wicore.Normal,
+		settings:      makeSettings(),
+		watched:       map[string]bool{},
+		goTypes:       makeGoTypes(),
+		lsp:           makeLSPServers(),
+		diagnostics:   map[string][]*diagnostic{},
+		buildCommands: map[buildKey][]string{},
+		done:          make(chan struct{}),
 		nextViewID:    1,
 	}
 
@@ -332,6 +475,22 @@ func MakeEditor(terminal Terminal, noPlugin bool) (Editor, error) {
 	RegisterViewCommands(cmds)
 	RegisterWindowCommands(cmds)
 	RegisterDocumentCommands(cmds)
+	RegisterHelpCommands(cmds)
+	RegisterSettingCommands(cmds)
+	RegisterPromptCommands(cmds)
+	RegisterSessionCommands(cmds)
+	RegisterSwapCommands(cmds)
+	RegisterBufferCommands(cmds)
+	RegisterFileTreeCommands(cmds)
+	RegisterFindFileCommands(cmds)
+	RegisterGutterCommands(cmds)
+	RegisterOutlineCommands(cmds)
+	RegisterGoTypesCommands(cmds)
+	RegisterLSPCommands(cmds)
+	RegisterDiagnosticsCommands(cmds)
+	RegisterBuildCommands(cmds)
+	RegisterGoTestCommands(cmds)
+	RegisterCoverageCommands(cmds)
 	RegisterEditorDefaults(rootView)
 
 	RegisterDefaultViewFactories(e)
@@ -345,6 +504,14 @@ func MakeEditor(terminal Terminal, noPlugin bool) (Editor, error) {
 	e.RegisterTerminalResized(e.onTerminalResized)
 	e.RegisterCommands(e.onCommands)
 	e.RegisterDocumentCursorMoved(e.onDocumentCursorMoved)
+	e.RegisterDocumentChangedOnDisk(e.onDocumentChangedOnDisk)
+	e.RegisterDocumentCreated(e.onLSPDocumentCreated)
+	e.RegisterDocumentCursorMoved(e.onLSPDocumentCursorMoved)
+	e.watcher = makeFileWatcher(func(path string) {
+		e.deferred <- func() {
+			e.onFileChanged(path)
+		}
+	})
 
 	if !noPlugin {
 		e.loadPlugins()
@@ -362,48 +529,25 @@ func MakeEditor(terminal Terminal, noPlugin bool) (Editor, error) {
 
 // Commands
 
-func cmdAlert(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
-	e.ExecuteCommand(w, "window_new", "0", "bottom", "infobar_alert", args[0])
+func cmdAlert(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	return e.ExecuteCommand(w, "window_new", "0", "bottom", "infobar_alert", args.String(0))
 }
 
-func cmdEditorBootstrapUI(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
-	e.ExecuteCommand(w, "window_new", "0", "bottom", "status_root")
+func cmdEditorBootstrapUI(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	return e.ExecuteCommand(w, "window_new", "0", "bottom", "status_root")
 }
 
-func cmdEditorCommandWindow(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
+func cmdEditorCommandWindow(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
 	// Create the Window with the command view and attach it to the currently
 	// focused Window.
-	e.ExecuteCommand(w, "window_new", w.ID(), "floating", "command")
+	return e.ExecuteCommand(w, "window_new", w.ID(), "floating", "command")
 }
 
-func cmdEditorQuit(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
-	if len(args) >= 1 {
-		e.ExecuteCommand(w, "alert", c.LongDesc())
-		return
-	} else if len(args) == 1 {
-		if args[0] != "force" {
-			e.ExecuteCommand(w, "alert", c.LongDesc())
-			return
-		}
-	} else {
-		if e.isDirty() {
-			// TODO(maruel): For each dirty Document, "prompt" y/n to force quit. If
-			// 'n', stop there.
-			return
-		}
-		// TODO(maruel):
-		// - Send a signal to each plugin.
-		// - Send a signal back to the main loop.
-	}
-
-	// This tells the editor.EventLoop() to quit.
-	e.deferred <- nil
-}
-
-func cmdEditorRedraw(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
+func cmdEditorRedraw(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
 	wicore.Go("viewReady", func() {
 		e.viewReady <- true
 	})
+	return nil, nil
 }
 
 // RegisterEditorDefaults registers the top-level native commands and key
@@ -412,7 +556,7 @@ func RegisterEditorDefaults(view wicore.ViewW) {
 	cmds := []wicore.Command{
 		&wicore.CommandImpl{
 			"alert",
-			1,
+			wicore.CommandArgs{{Name: "message", Type: wicore.ArgString}},
 			cmdAlert,
 			wicore.WindowCategory,
 			lang.Map{
@@ -424,7 +568,7 @@ func RegisterEditorDefaults(view wicore.ViewW) {
 		},
 		&wicore.CommandImpl{
 			"editor_bootstrap_ui",
-			0,
+			nil,
 			cmdEditorBootstrapUI,
 			wicore.WindowCategory,
 			lang.Map{
@@ -436,7 +580,7 @@ func RegisterEditorDefaults(view wicore.ViewW) {
 		},
 		&wicore.CommandImpl{
 			"editor_command_window",
-			0,
+			nil,
 			cmdEditorCommandWindow,
 			wicore.CommandsCategory,
 			lang.Map{
@@ -448,19 +592,34 @@ func RegisterEditorDefaults(view wicore.ViewW) {
 		},
 		&privilegedCommandImpl{
 			"editor_quit",
-			-1,
+			wicore.CommandArgs{
+				{Name: "mode", Type: wicore.ArgEnum, Optional: true, Values: []string{"safe", "force"}},
+				{Name: "exit_code", Type: wicore.ArgInt, Optional: true},
+			},
 			cmdEditorQuit,
 			wicore.EditorCategory,
 			lang.Map{
 				lang.En: "Quits",
 			},
 			lang.Map{
-				lang.En: "Quits the editor. Use 'force' to bypasses writing the files to disk.",
+				lang.En: "Quits the editor. In 'safe' mode, the default, the user is asked whether to save, discard or cancel for each modified document, then the plugins can veto. Use 'force' to quit immediately without writing the files to disk. The editor process exits with exit_code.",
+			},
+		},
+		&privilegedCommandImpl{
+			"editor_quit_veto",
+			wicore.CommandArgs{{Name: "reason", Type: wicore.ArgString}},
+			cmdEditorQuitVeto,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Cancels quitting",
+			},
+			lang.Map{
+				lang.En: "Cancels the shutdown in progress. It is meant to be run by the listeners of the event EditorQuitting. The reason is shown to the user.",
 			},
 		},
 		&privilegedCommandImpl{
 			"editor_redraw",
-			0,
+			nil,
 			cmdEditorRedraw,
 			wicore.EditorCategory,
 			lang.Map{
@@ -483,5 +642,9 @@ func RegisterEditorDefaults(view wicore.ViewW) {
 	bindings.Set(wicore.AllMode, key.Press{Key: key.F1}, "help")
 	bindings.Set(wicore.AllMode, key.Press{Ch: ':'}, "editor_command_window")
 	bindings.Set(wicore.AllMode, key.Press{Ctrl: true, Ch: 'c'}, "quit")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.F8}, "diag_next")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.F12}, "goto_definition")
+	// jump_forward isn't bound since Ctrl-I is Tab in a terminal.
+	bindings.Set(wicore.Normal, key.Press{Ctrl: true, Ch: 'o'}, "jump_back")
 	bindings.Set(wicore.Insert, key.Press{Key: key.Escape}, "key_set_normal")
 }
@@ -23,10 +23,13 @@ func makeEventRegistry() (wicore.EventRegistry, chan func()) {
 	e := &eventRegistry{
 		deferred:                  c,
 		commands:                  make([]listenerCommands, 0, 64),
+		documentChangedOnDisk:     make([]listenerDocumentChangedOnDisk, 0, 64),
 		documentCreated:           make([]listenerDocumentCreated, 0, 64),
 		documentCursorMoved:       make([]listenerDocumentCursorMoved, 0, 64),
 		editorKeyboardModeChanged: make([]listenerEditorKeyboardModeChanged, 0, 64),
 		editorLanguage:            make([]listenerEditorLanguage, 0, 64),
+		editorQuitting:            make([]listenerEditorQuitting, 0, 64),
+		settingChanged:            make([]listenerSettingChanged, 0, 64),
 		terminalKeyPressed:        make([]listenerTerminalKeyPressed, 0, 64),
 		terminalMetaKeyPressed:    make([]listenerTerminalMetaKeyPressed, 0, 64),
 		terminalResized:           make([]listenerTerminalResized, 0, 64),
@@ -49,6 +52,13 @@ func registerPluginEvents(client *rpc.Client, e wicore.EventRegistry) wicore.Eve
 				log.Printf("RPC Commands call failure: %s", err)
 			}
 		}),
+		e.RegisterDocumentChangedOnDisk(func(doc wicore.Document) {
+			packet := internal.PacketDocumentChangedOnDisk{doc}
+			out := 0
+			if err := client.Call("EventTriggerRPC.TriggerDocumentChangedOnDiskRPC", packet, &out); err != nil {
+				log.Printf("RPC DocumentChangedOnDisk call failure: %s", err)
+			}
+		}),
 		e.RegisterDocumentCreated(func(doc wicore.Document) {
 			packet := internal.PacketDocumentCreated{doc}
 			out := 0
@@ -77,6 +87,20 @@ func registerPluginEvents(client *rpc.Client, e wicore.EventRegistry) wicore.Eve
 				log.Printf("RPC EditorLanguage call failure: %s", err)
 			}
 		}),
+		e.RegisterEditorQuitting(func() {
+			packet := internal.PacketEditorQuitting{}
+			out := 0
+			if err := client.Call("EventTriggerRPC.TriggerEditorQuittingRPC", packet, &out); err != nil {
+				log.Printf("RPC EditorQuitting call failure: %s", err)
+			}
+		}),
+		e.RegisterSettingChanged(func(scope wicore.SettingScope, owner, name, value string) {
+			packet := internal.PacketSettingChanged{scope, owner, name, value}
+			out := 0
+			if err := client.Call("EventTriggerRPC.TriggerSettingChangedRPC", packet, &out); err != nil {
+				log.Printf("RPC SettingChanged call failure: %s", err)
+			}
+		}),
 		e.RegisterTerminalKeyPressed(func(k key.Press) {
 			packet := internal.PacketTerminalKeyPressed{k}
 			out := 0
@@ -134,6 +158,11 @@ type listenerCommands struct {
 	callback func(cmds wicore.EnqueuedCommands)
 }
 
+type listenerDocumentChangedOnDisk struct {
+	id       int
+	callback func(doc wicore.Document)
+}
+
 type listenerDocumentCreated struct {
 	id       int
 	callback func(doc wicore.Document)
@@ -154,6 +183,16 @@ type listenerEditorLanguage struct {
 	callback func(l lang.Language)
 }
 
+type listenerEditorQuitting struct {
+	id       int
+	callback func()
+}
+
+type listenerSettingChanged struct {
+	id       int
+	callback func(scope wicore.SettingScope, owner, name, value string)
+}
+
 type listenerTerminalKeyPressed struct {
 	id       int
 	callback func(k key.Press)
@@ -198,10 +237,13 @@ type eventRegistry struct {
 	deferred chan<- func()
 
 	commands                  []listenerCommands
+	documentChangedOnDisk     []listenerDocumentChangedOnDisk
 	documentCreated           []listenerDocumentCreated
 	documentCursorMoved       []listenerDocumentCursorMoved
 	editorKeyboardModeChanged []listenerEditorKeyboardModeChanged
 	editorLanguage            []listenerEditorLanguage
+	editorQuitting            []listenerEditorQuitting
+	settingChanged            []listenerSettingChanged
 	terminalKeyPressed        []listenerTerminalKeyPressed
 	terminalMetaKeyPressed    []listenerTerminalMetaKeyPressed
 	terminalResized           []listenerTerminalResized
@@ -226,6 +268,14 @@ func (er *eventRegistry) unregister(eventID int) {
 			}
 		}
 	case 0x2000000:
+		for index, value := range er.documentChangedOnDisk {
+			if value.id == eventID {
+				copy(er.documentChangedOnDisk[index:], er.documentChangedOnDisk[index+1:])
+				er.documentChangedOnDisk = er.documentChangedOnDisk[0 : len(er.documentChangedOnDisk)-1]
+				return
+			}
+		}
+	case 0x3000000:
 		for index, value := range er.documentCreated {
 			if value.id == eventID {
 				copy(er.documentCreated[index:], er.documentCreated[index+1:])
@@ -233,7 +283,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0x3000000:
+	case 0x4000000:
 		for index, value := range er.documentCursorMoved {
 			if value.id == eventID {
 				copy(er.documentCursorMoved[index:], er.documentCursorMoved[index+1:])
@@ -241,7 +291,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0x4000000:
+	case 0x5000000:
 		for index, value := range er.editorKeyboardModeChanged {
 			if value.id == eventID {
 				copy(er.editorKeyboardModeChanged[index:], er.editorKeyboardModeChanged[index+1:])
@@ -249,7 +299,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0x5000000:
+	case 0x6000000:
 		for index, value := range er.editorLanguage {
 			if value.id == eventID {
 				copy(er.editorLanguage[index:], er.editorLanguage[index+1:])
@@ -257,7 +307,23 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0x6000000:
+	case 0x7000000:
+		for index, value := range er.editorQuitting {
+			if value.id == eventID {
+				copy(er.editorQuitting[index:], er.editorQuitting[index+1:])
+				er.editorQuitting = er.editorQuitting[0 : len(er.editorQuitting)-1]
+				return
+			}
+		}
+	case 0x8000000:
+		for index, value := range er.settingChanged {
+			if value.id == eventID {
+				copy(er.settingChanged[index:], er.settingChanged[index+1:])
+				er.settingChanged = er.settingChanged[0 : len(er.settingChanged)-1]
+				return
+			}
+		}
+	case 0x9000000:
 		for index, value := range er.terminalKeyPressed {
 			if value.id == eventID {
 				copy(er.terminalKeyPressed[index:], er.terminalKeyPressed[index+1:])
@@ -265,7 +331,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0x7000000:
+	case 0xa000000:
 		for index, value := range er.terminalMetaKeyPressed {
 			if value.id == eventID {
 				copy(er.terminalMetaKeyPressed[index:], er.terminalMetaKeyPressed[index+1:])
@@ -273,7 +339,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0x8000000:
+	case 0xb000000:
 		for index, value := range er.terminalResized {
 			if value.id == eventID {
 				copy(er.terminalResized[index:], er.terminalResized[index+1:])
@@ -281,7 +347,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0x9000000:
+	case 0xc000000:
 		for index, value := range er.viewActivated {
 			if value.id == eventID {
 				copy(er.viewActivated[index:], er.viewActivated[index+1:])
@@ -289,7 +355,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0xa000000:
+	case 0xd000000:
 		for index, value := range er.viewCreated {
 			if value.id == eventID {
 				copy(er.viewCreated[index:], er.viewCreated[index+1:])
@@ -297,7 +363,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0xb000000:
+	case 0xe000000:
 		for index, value := range er.windowCreated {
 			if value.id == eventID {
 				copy(er.windowCreated[index:], er.windowCreated[index+1:])
@@ -305,7 +371,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0xc000000:
+	case 0xf000000:
 		for index, value := range er.windowResized {
 			if value.id == eventID {
 				copy(er.windowResized[index:], er.windowResized[index+1:])
@@ -325,13 +391,22 @@ func (er *eventRegistry) RegisterCommands(callback func(cmds wicore.EnqueuedComm
 	return &eventListener{er, i | 0x1000000}
 }
 
+func (er *eventRegistry) RegisterDocumentChangedOnDisk(callback func(doc wicore.Document)) wicore.EventListener {
+	er.lock.Lock()
+	defer er.lock.Unlock()
+	i := er.nextID
+	er.nextID++
+	er.documentChangedOnDisk = append(er.documentChangedOnDisk, listenerDocumentChangedOnDisk{i, callback})
+	return &eventListener{er, i | 0x2000000}
+}
+
 func (er *eventRegistry) RegisterDocumentCreated(callback func(doc wicore.Document)) wicore.EventListener {
 	er.lock.Lock()
 	defer er.lock.Unlock()
 	i := er.nextID
 	er.nextID++
 	er.documentCreated = append(er.documentCreated, listenerDocumentCreated{i, callback})
-	return &eventListener{er, i | 0x2000000}
+	return &eventListener{er, i | 0x3000000}
 }
 
 func (er *eventRegistry) RegisterDocumentCursorMoved(callback func(doc wicore.Document, col, row int)) wicore.EventListener {
@@ -340,7 +415,7 @@ func (er *eventRegistry) RegisterDocumentCursorMoved(callback func(doc wicore.Do
 	i := er.nextID
 	er.nextID++
 	er.documentCursorMoved = append(er.documentCursorMoved, listenerDocumentCursorMoved{i, callback})
-	return &eventListener{er, i | 0x3000000}
+	return &eventListener{er, i | 0x4000000}
 }
 
 func (er *eventRegistry) RegisterEditorKeyboardModeChanged(callback func(mode wicore.KeyboardMode)) wicore.EventListener {
@@ -349,7 +424,7 @@ func (er *eventRegistry) RegisterEditorKeyboardModeChanged(callback func(mode wi
 	i := er.nextID
 	er.nextID++
 	er.editorKeyboardModeChanged = append(er.editorKeyboardModeChanged, listenerEditorKeyboardModeChanged{i, callback})
-	return &eventListener{er, i | 0x4000000}
+	return &eventListener{er, i | 0x5000000}
 }
 
 func (er *eventRegistry) RegisterEditorLanguage(callback func(l lang.Language)) wicore.EventListener {
@@ -358,7 +433,25 @@ func (er *eventRegistry) RegisterEditorLanguage(callback func(l lang.Language))
 	i := er.nextID
 	er.nextID++
 	er.editorLanguage = append(er.editorLanguage, listenerEditorLanguage{i, callback})
-	return &eventListener{er, i | 0x5000000}
+	return &eventListener{er, i | 0x6000000}
+}
+
+func (er *eventRegistry) RegisterEditorQuitting(callback func()) wicore.EventListener {
+	er.lock.Lock()
+	defer er.lock.Unlock()
+	i := er.nextID
+	er.nextID++
+	er.editorQuitting = append(er.editorQuitting, listenerEditorQuitting{i, callback})
+	return &eventListener{er, i | 0x7000000}
+}
+
+func (er *eventRegistry) RegisterSettingChanged(callback func(scope wicore.SettingScope, owner, name, value string)) wicore.EventListener {
+	er.lock.Lock()
+	defer er.lock.Unlock()
+	i := er.nextID
+	er.nextID++
+	er.settingChanged = append(er.settingChanged, listenerSettingChanged{i, callback})
+	return &eventListener{er, i | 0x8000000}
 }
 
 func (er *eventRegistry) RegisterTerminalKeyPressed(callback func(k key.Press)) wicore.EventListener {
@@ -367,7 +460,7 @@ func (er *eventRegistry) RegisterTerminalKeyPressed(callback func(k key.Press))
 	i := er.nextID
 	er.nextID++
 	er.terminalKeyPressed = append(er.terminalKeyPressed, listenerTerminalKeyPressed{i, callback})
-	return &eventListener{er, i | 0x6000000}
+	return &eventListener{er, i | 0x9000000}
 }
 
 func (er *eventRegistry) RegisterTerminalMetaKeyPressed(callback func(k key.Press)) wicore.EventListener {
@@ -376,7 +469,7 @@ func (er *eventRegistry) RegisterTerminalMetaKeyPressed(callback func(k key.Pres
 	i := er.nextID
 	er.nextID++
 	er.terminalMetaKeyPressed = append(er.terminalMetaKeyPressed, listenerTerminalMetaKeyPressed{i, callback})
-	return &eventListener{er, i | 0x7000000}
+	return &eventListener{er, i | 0xa000000}
 }
 
 func (er *eventRegistry) RegisterTerminalResized(callback func()) wicore.EventListener {
@@ -385,7 +478,7 @@ func (er *eventRegistry) RegisterTerminalResized(callback func()) wicore.EventLi
 	i := er.nextID
 	er.nextID++
 	er.terminalResized = append(er.terminalResized, listenerTerminalResized{i, callback})
-	return &eventListener{er, i | 0x8000000}
+	return &eventListener{er, i | 0xb000000}
 }
 
 func (er *eventRegistry) RegisterViewActivated(callback func(view wicore.View)) wicore.EventListener {
@@ -394,7 +487,7 @@ func (er *eventRegistry) RegisterViewActivated(callback func(view wicore.View))
 	i := er.nextID
 	er.nextID++
 	er.viewActivated = append(er.viewActivated, listenerViewActivated{i, callback})
-	return &eventListener{er, i | 0x9000000}
+	return &eventListener{er, i | 0xc000000}
 }
 
 func (er *eventRegistry) RegisterViewCreated(callback func(view wicore.View)) wicore.EventListener {
@@ -403,7 +496,7 @@ func (er *eventRegistry) RegisterViewCreated(callback func(view wicore.View)) wi
 	i := er.nextID
 	er.nextID++
 	er.viewCreated = append(er.viewCreated, listenerViewCreated{i, callback})
-	return &eventListener{er, i | 0xa000000}
+	return &eventListener{er, i | 0xd000000}
 }
 
 func (er *eventRegistry) RegisterWindowCreated(callback func(window wicore.Window)) wicore.EventListener {
@@ -412,7 +505,7 @@ func (er *eventRegistry) RegisterWindowCreated(callback func(window wicore.Windo
 	i := er.nextID
 	er.nextID++
 	er.windowCreated = append(er.windowCreated, listenerWindowCreated{i, callback})
-	return &eventListener{er, i | 0xb000000}
+	return &eventListener{er, i | 0xe000000}
 }
 
 func (er *eventRegistry) RegisterWindowResized(callback func(window wicore.Window)) wicore.EventListener {
@@ -421,7 +514,7 @@ func (er *eventRegistry) RegisterWindowResized(callback func(window wicore.Windo
 	i := er.nextID
 	er.nextID++
 	er.windowResized = append(er.windowResized, listenerWindowResized{i, callback})
-	return &eventListener{er, i | 0xc000000}
+	return &eventListener{er, i | 0xf000000}
 }
 
 func (er *eventRegistry) TriggerCommands(cmds wicore.EnqueuedCommands) {
@@ -441,6 +534,23 @@ func (er *eventRegistry) TriggerCommands(cmds wicore.EnqueuedCommands) {
 	}
 }
 
+func (er *eventRegistry) TriggerDocumentChangedOnDisk(doc wicore.Document) {
+	er.deferred <- func() {
+		items := func() []func(doc wicore.Document) {
+			er.lock.Lock()
+			defer er.lock.Unlock()
+			items := make([]func(doc wicore.Document), 0, len(er.documentChangedOnDisk))
+			for _, item := range er.documentChangedOnDisk {
+				items = append(items, item.callback)
+			}
+			return items
+		}()
+		for _, item := range items {
+			item(doc)
+		}
+	}
+}
+
 func (er *eventRegistry) TriggerDocumentCreated(doc wicore.Document) {
 	er.deferred <- func() {
 		items := func() []func(doc wicore.Document) {
@@ -509,6 +619,40 @@ func (er *eventRegistry) TriggerEditorLanguage(l lang.Language) {
 	}
 }
 
+func (er *eventRegistry) TriggerEditorQuitting() {
+	er.deferred <- func() {
+		items := func() []func() {
+			er.lock.Lock()
+			defer er.lock.Unlock()
+			items := make([]func(), 0, len(er.editorQuitting))
+			for _, item := range er.editorQuitting {
+				items = append(items, item.callback)
+			}
+			return items
+		}()
+		for _, item := range items {
+			item()
+		}
+	}
+}
+
+func (er *eventRegistry) TriggerSettingChanged(scope wicore.SettingScope, owner, name, value string) {
+	er.deferred <- func() {
+		items := func() []func(scope wicore.SettingScope, owner, name, value string) {
+			er.lock.Lock()
+			defer er.lock.Unlock()
+			items := make([]func(scope wicore.SettingScope, owner, name, value string), 0, len(er.settingChanged))
+			for _, item := range er.settingChanged {
+				items = append(items, item.callback)
+			}
+			return items
+		}()
+		for _, item := range items {
+			item(scope, owner, name, value)
+		}
+	}
+}
+
 func (er *eventRegistry) TriggerTerminalKeyPressed(k key.Press) {
 	er.deferred <- func() {
 		items := func() []func(k key.Press) {
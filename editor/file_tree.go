@@ -0,0 +1,688 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/colors"
+	"github.com/wi-ed/wi/wicore/key"
+	"github.com/wi-ed/wi/wicore/lang"
+	"github.com/wi-ed/wi/wicore/raster"
+)
+
+// fileNode is a file or a directory in the fileTreeView.
+type fileNode struct {
+	name     string
+	path     string // Absolute path.
+	isDir    bool
+	expanded bool
+	loaded   bool // The children were listed at least once.
+	children []*fileNode
+}
+
+// fileRow is a visible line of the fileTreeView.
+type fileRow struct {
+	node  *fileNode
+	depth int
+}
+
+// fileNodes sorts the directories first, then by name.
+type fileNodes []*fileNode
+
+func (f fileNodes) Len() int      { return len(f) }
+func (f fileNodes) Swap(i, j int) { f[i], f[j] = f[j], f[i] }
+func (f fileNodes) Less(i, j int) bool {
+	if f[i].isDir != f[j].isDir {
+		return f[i].isDir
+	}
+	return f[i].name < f[j].name
+}
+
+// listDir returns the entries of the directory. .git is skipped.
+func listDir(path string) ([]*fileNode, error) {
+	infos, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	out := make(fileNodes, 0, len(infos))
+	for _, fi := range infos {
+		if fi.Name() == ".git" {
+			continue
+		}
+		out = append(out, &fileNode{name: fi.Name(), path: filepath.Join(path, fi.Name()), isDir: fi.IsDir()})
+	}
+	sort.Sort(out)
+	return out, nil
+}
+
+// gitStatus returns the git status of the modified files under root, by
+// absolute path, as the letter shown by "git status --short". The
+// directories containing modified files are marked with '*'. It returns nil
+// if root is not in a git checkout.
+func gitStatus(root string) map[string]byte {
+	cmd := exec.Command("git", "rev-parse", "--show-prefix")
+	cmd.Dir = root
+	prefix, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+	cmd = exec.Command("git", "status", "--porcelain", "-z", "-uall", ".")
+	cmd.Dir = root
+	out, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+	p := strings.TrimSpace(string(prefix))
+	status := map[string]byte{}
+	entries := strings.Split(string(out), "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		marker := entry[0]
+		if entry[0] == 'R' || entry[0] == 'C' {
+			// The next entry is the source of the rename or the copy.
+			i++
+		}
+		if marker == ' ' {
+			marker = entry[1]
+		}
+		if !strings.HasPrefix(entry[3:], p) {
+			continue
+		}
+		path := filepath.Join(root, filepath.FromSlash(entry[3+len(p):]))
+		status[path] = marker
+		for d := filepath.Dir(path); len(d) > len(root); d = filepath.Dir(d) {
+			status[d] = '*'
+		}
+	}
+	return status
+}
+
+// fileTreeView shows the files under a directory as a tree. The directories
+// are listed when expanded. The expanded directories are watched to show the
+// files modified on disk.
+type fileTreeView struct {
+	view
+	e          *editor
+	root       *fileNode
+	status     map[string]byte // git status markers; see gitStatus().
+	selected   int             // Index of the selected row.
+	offset     int             // First row shown.
+	refreshing bool            // A refresh is in progress.
+	pending    bool            // Another refresh was requested meanwhile.
+	stale      bool            // The git status must be updated by the next refresh.
+	watched    map[string]bool // Directories watched by the editor's fileWatcher.
+	closed     chan struct{}
+}
+
+func (v *fileTreeView) Close() error {
+	select {
+	case <-v.closed:
+	default:
+		close(v.closed)
+	}
+	if v.e.watcher != nil {
+		for d := range v.watched {
+			v.e.watcher.Remove(d)
+		}
+	}
+	v.watched = map[string]bool{}
+	return v.view.Close()
+}
+
+// rows returns the visible rows.
+func (v *fileTreeView) rows() []fileRow {
+	var out []fileRow
+	var recurse func(n *fileNode, depth int)
+	recurse = func(n *fileNode, depth int) {
+		for _, c := range n.children {
+			out = append(out, fileRow{c, depth})
+			if c.expanded {
+				recurse(c, depth+1)
+			}
+		}
+	}
+	recurse(v.root, 0)
+	return out
+}
+
+func (v *fileTreeView) selectedNode() *fileNode {
+	rows := v.rows()
+	if v.selected >= len(rows) {
+		v.selected = len(rows) - 1
+	}
+	if v.selected < 0 {
+		v.selected = 0
+		return nil
+	}
+	return rows[v.selected].node
+}
+
+// selectPath selects the row of the file at path, if visible.
+func (v *fileTreeView) selectPath(path string) {
+	for i, r := range v.rows() {
+		if r.node.path == path {
+			v.selected = i
+			return
+		}
+	}
+}
+
+// refresh lists again the expanded directories in the background, and the
+// git status if changed is true. It must be called in the UI goroutine.
+func (v *fileTreeView) refresh(changed bool) {
+	v.stale = v.stale || changed
+	if v.refreshing {
+		v.pending = true
+		return
+	}
+	v.refreshing = true
+	withStatus := v.stale
+	v.stale = false
+	var dirs []string
+	var recurse func(n *fileNode)
+	recurse = func(n *fileNode) {
+		dirs = append(dirs, n.path)
+		for _, c := range n.children {
+			if c.expanded {
+				recurse(c)
+			}
+		}
+	}
+	recurse(v.root)
+	root := v.root.path
+	status := v.status
+	wicore.Go("fileTreeRefresh", func() {
+		listings := map[string][]*fileNode{}
+		for _, d := range dirs {
+			nodes, err := listDir(d)
+			if err != nil {
+				log.Printf("Failed to list %s: %s", d, err)
+				continue
+			}
+			listings[d] = nodes
+		}
+		if withStatus {
+			status = gitStatus(root)
+		}
+		v.e.post(v.closed, func() {
+			v.apply(listings, status)
+		})
+	})
+}
+
+// apply updates the tree with the directory listings. The state of the
+// nodes that still exist is kept.
+func (v *fileTreeView) apply(listings map[string][]*fileNode, status map[string]byte) {
+	var selected string
+	if n := v.selectedNode(); n != nil {
+		selected = n.path
+	}
+	var recurse func(n *fileNode)
+	recurse = func(n *fileNode) {
+		if nodes, ok := listings[n.path]; ok {
+			old := map[string]*fileNode{}
+			for _, c := range n.children {
+				old[c.name] = c
+			}
+			for i, c := range nodes {
+				if o := old[c.name]; o != nil && o.isDir == c.isDir {
+					nodes[i] = o
+				}
+			}
+			n.children = nodes
+			n.loaded = true
+		}
+		for _, c := range n.children {
+			if c.expanded {
+				recurse(c)
+			}
+		}
+	}
+	recurse(v.root)
+	v.status = status
+	v.refreshing = false
+	if selected != "" {
+		v.selectPath(selected)
+	}
+	v.watch()
+	if v.pending {
+		v.pending = false
+		v.refresh(false)
+	}
+	wicore.PostCommand(v.e, nil, "editor_redraw")
+}
+
+// watch makes the watched directories match the expanded ones.
+func (v *fileTreeView) watch() {
+	if v.e.watcher == nil {
+		return
+	}
+	dirs := map[string]bool{}
+	var recurse func(n *fileNode)
+	recurse = func(n *fileNode) {
+		dirs[n.path] = true
+		for _, c := range n.children {
+			if c.expanded {
+				recurse(c)
+			}
+		}
+	}
+	recurse(v.root)
+	for d := range v.watched {
+		if !dirs[d] {
+			v.e.watcher.Remove(d)
+			delete(v.watched, d)
+		}
+	}
+	for d := range dirs {
+		if !v.watched[d] {
+			if err := v.e.watcher.Add(d); err != nil {
+				log.Printf("Failed to watch %s: %s", d, err)
+				continue
+			}
+			v.watched[d] = true
+		}
+	}
+}
+
+// onFileChanged refreshes the tree when a file in a watched directory
+// changed.
+func (v *fileTreeView) onFileChanged(path string) {
+	if v.watched[path] {
+		v.refresh(true)
+	}
+}
+
+func (v *fileTreeView) Buffer() *raster.Buffer {
+	v.buffer.Fill(raster.Cell{R: ' ', F: v.DefaultFormat()})
+	v.selectedNode()
+	rows := v.rows()
+	if v.selected < v.offset {
+		v.offset = v.selected
+	} else if v.actualY > 0 && v.selected >= v.offset+v.actualY {
+		v.offset = v.selected - v.actualY + 1
+	}
+	for i := v.offset; i < len(rows) && i-v.offset < v.actualY; i++ {
+		n := rows[i].node
+		f := v.DefaultFormat()
+		marker := v.status[n.path]
+		switch marker {
+		case 'M', '*':
+			f.Fg = colors.BrightYellow
+		case 'A', '?':
+			f.Fg = colors.Green
+		case 'D':
+			f.Fg = colors.Red
+		}
+		if marker == 0 {
+			marker = ' '
+		}
+		name := n.name
+		if n.isDir {
+			arrow := "+"
+			if n.expanded {
+				arrow = "-"
+			}
+			name = arrow + " " + name + "/"
+		} else {
+			name = "  " + name
+		}
+		if i == v.selected {
+			f.Fg, f.Bg = f.Bg, f.Fg
+		}
+		v.buffer.DrawString(fmt.Sprintf("%c %s%s", marker, strings.Repeat("  ", rows[i].depth), name), 0, i-v.offset, f)
+	}
+	return v.buffer
+}
+
+// expand shows the children of the directory, listing it if needed.
+func (v *fileTreeView) expand(n *fileNode) {
+	if !n.isDir || n.expanded {
+		return
+	}
+	n.expanded = true
+	if !n.loaded {
+		v.refresh(false)
+	}
+}
+
+// targetDir returns the directory where a new file is created: the selected
+// directory or the directory of the selected file.
+func (v *fileTreeView) targetDir() string {
+	n := v.selectedNode()
+	if n == nil {
+		return v.root.path
+	}
+	if n.isDir {
+		return n.path
+	}
+	return filepath.Dir(n.path)
+}
+
+// create asks for the name of a new file or directory.
+func (v *fileTreeView) create() {
+	dir := v.targetDir()
+	v.e.Prompt(wicore.Prompt{wicore.PromptInput, fileTreeCreate.Sprintf(dir), nil}, func(a wicore.PromptAnswer) {
+		if a.Cancelled || a.Answer == "" {
+			return
+		}
+		path := filepath.Join(dir, a.Answer)
+		var err error
+		if strings.HasSuffix(a.Answer, "/") {
+			err = os.MkdirAll(path, 0777)
+		} else if err = os.MkdirAll(filepath.Dir(path), 0777); err == nil {
+			var f *os.File
+			if f, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666); err == nil {
+				err = f.Close()
+			}
+		}
+		if err != nil {
+			v.e.alertOnError(err)
+			return
+		}
+		for _, r := range v.rows() {
+			if r.node.path == dir {
+				v.expand(r.node)
+			}
+		}
+		v.refresh(true)
+	})
+}
+
+// rename asks for the new name of the selected file.
+func (v *fileTreeView) rename() {
+	n := v.selectedNode()
+	if n == nil {
+		return
+	}
+	v.e.Prompt(wicore.Prompt{wicore.PromptInput, fileTreeRename.Sprintf(n.path), []string{n.name}}, func(a wicore.PromptAnswer) {
+		if a.Cancelled || a.Answer == "" || a.Answer == n.name {
+			return
+		}
+		path := filepath.Join(filepath.Dir(n.path), a.Answer)
+		if err := os.Rename(n.path, path); err != nil {
+			v.e.alertOnError(err)
+			return
+		}
+		v.e.renameDocuments(n.path, path)
+		v.refresh(true)
+	})
+}
+
+// remove asks to confirm the deletion of the selected file.
+func (v *fileTreeView) remove() {
+	n := v.selectedNode()
+	if n == nil {
+		return
+	}
+	v.e.Prompt(wicore.Prompt{wicore.PromptYesNoCancel, fileTreeDelete.Sprintf(n.path), nil}, func(a wicore.PromptAnswer) {
+		if a.Answer != "yes" {
+			return
+		}
+		if err := os.RemoveAll(n.path); err != nil {
+			v.e.alertOnError(err)
+			return
+		}
+		v.refresh(true)
+	})
+}
+
+func (v *fileTreeView) onTerminalKeyPressed(k key.Press) {
+	if v.window == nil || v.e.ActiveWindow() != v.window {
+		return
+	}
+	n := v.selectedNode()
+	switch {
+	case k.Key == key.Enter:
+		if n == nil {
+		} else if n.isDir {
+			if n.expanded {
+				n.expanded = false
+			} else {
+				v.expand(n)
+			}
+		} else {
+			wicore.PostCommand(v.e, nil, "document_open", n.path)
+		}
+	case k.Ch == 'a':
+		v.create()
+	case k.Ch == 'd':
+		v.remove()
+	case k.Ch == 'q':
+		wicore.PostCommand(v.e, nil, "window_close", v.window.ID())
+	case k.Ch == 'r':
+		v.rename()
+	case k.Ch == 'R':
+		v.refresh(true)
+	}
+	wicore.PostCommand(v.e, nil, "editor_redraw")
+}
+
+// renameDocuments updates the path of the documents after the file or
+// directory oldPath was renamed to newPath.
+func (e *editor) renameDocuments(oldPath, newPath string) {
+	for _, d := range e.sortedDocuments() {
+		if d.filePath == "" {
+			continue
+		}
+		abs, err := filepath.Abs(d.filePath)
+		if err != nil {
+			continue
+		}
+		if abs != oldPath && !strings.HasPrefix(abs, oldPath+string(filepath.Separator)) {
+			continue
+		}
+		d.filePath = newPath + abs[len(oldPath):]
+		for _, v := range e.documentViews(d) {
+			v.title = d.filePath
+		}
+	}
+	e.reindexDocuments()
+}
+
+func cmdToFileTree(handler func(v *fileTreeView)) wicore.CommandImplHandler {
+	return func(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
+		v, ok := w.View().(*fileTreeView)
+		if !ok {
+			return nil, errors.New("internal error")
+		}
+		handler(v)
+		wicore.PostCommand(e, nil, "editor_redraw")
+		return nil, nil
+	}
+}
+
+func cmdFileTreeCollapse(v *fileTreeView) {
+	n := v.selectedNode()
+	if n == nil {
+		return
+	}
+	if n.isDir && n.expanded {
+		n.expanded = false
+		return
+	}
+	// Select the parent directory.
+	rows := v.rows()
+	for i := v.selected - 1; i >= 0; i-- {
+		if rows[i].depth < rows[v.selected].depth {
+			v.selected = i
+			return
+		}
+	}
+}
+
+func cmdFileTreeCursorDown(v *fileTreeView) {
+	v.selected++
+	v.selectedNode()
+}
+
+func cmdFileTreeCursorUp(v *fileTreeView) {
+	if v.selected > 0 {
+		v.selected--
+	}
+}
+
+func cmdFileTreeExpand(v *fileTreeView) {
+	if n := v.selectedNode(); n != nil {
+		v.expand(n)
+	}
+}
+
+// fileTreeViewFactory returns a View showing the files under the directory
+// passed as argument, by default the project root.
+func fileTreeViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
+	dispatcher := makeCommands()
+	cmds := []wicore.Command{
+		&wicore.CommandImpl{
+			"file_tree_collapse",
+			nil,
+			cmdToFileTree(cmdFileTreeCollapse),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Collapses the directory",
+			},
+			lang.Map{
+				lang.En: "Hides the content of the selected directory, or selects the parent directory.",
+			},
+		},
+		&wicore.CommandImpl{
+			"file_tree_cursor_down",
+			nil,
+			cmdToFileTree(cmdFileTreeCursorDown),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Selects the next file",
+			},
+			lang.Map{
+				lang.En: "Selects the next file in the tree.",
+			},
+		},
+		&wicore.CommandImpl{
+			"file_tree_cursor_up",
+			nil,
+			cmdToFileTree(cmdFileTreeCursorUp),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Selects the previous file",
+			},
+			lang.Map{
+				lang.En: "Selects the previous file in the tree.",
+			},
+		},
+		&wicore.CommandImpl{
+			"file_tree_expand",
+			nil,
+			cmdToFileTree(cmdFileTreeExpand),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Expands the directory",
+			},
+			lang.Map{
+				lang.En: "Shows the content of the selected directory.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+	bindings := makeKeyBindings()
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Down}, "file_tree_cursor_down")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Left}, "file_tree_collapse")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Right}, "file_tree_expand")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Up}, "file_tree_cursor_up")
+
+	root := ""
+	if len(args) > 0 {
+		root = args[0]
+	} else if wd, err := os.Getwd(); err == nil {
+		root = projectRoot(wd)
+	}
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+	v := &fileTreeView{
+		view{
+			commands:      dispatcher,
+			keyBindings:   bindings,
+			eventRegistry: e,
+			id:            id,
+			title:         filepath.Base(root),
+			naturalX:      30,
+			naturalY:      -1,
+			defaultFormat: raster.CellFormat{Fg: colors.White, Bg: colors.Black},
+		},
+		e.(*editor),
+		&fileNode{name: filepath.Base(root), path: root, isDir: true, expanded: true},
+		nil,
+		0,
+		0,
+		false,
+		false,
+		false,
+		map[string]bool{},
+		make(chan struct{}),
+	}
+	v.events = append(v.events, e.RegisterTerminalKeyPressed(v.onTerminalKeyPressed))
+	v.refresh(true)
+	return v
+}
+
+// Commands.
+
+func cmdFileTree(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	for _, child := range e.rootWindow.childrenWindows {
+		if _, ok := child.view.(*fileTreeView); ok {
+			return nil, e.activateWindow(child)
+		}
+	}
+	root := args.String(0)
+	if root == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		root = projectRoot(wd)
+	}
+	// The root is resolved so a restored session shows the same directory.
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	return e.ExecuteCommand(w, "window_new", e.rootWindow.ID(), "left", "file_tree", root)
+}
+
+// RegisterFileTreeCommands registers the commands to browse the files.
+func RegisterFileTreeCommands(dispatcher wicore.CommandsW) {
+	cmds := []wicore.Command{
+		&privilegedCommandImpl{
+			"file_tree",
+			wicore.CommandArgs{{Name: "root", Type: wicore.ArgString, Optional: true}},
+			cmdFileTree,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Shows the file tree",
+			},
+			lang.Map{
+				lang.En: "Shows the files under the project root, or under root if specified, in a window docked on the left. Use Enter to open a file or expand a directory, 'a' to create a file or a directory, 'r' to rename, 'd' to delete and 'q' to close the tree. The files modified according to git are marked.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+}
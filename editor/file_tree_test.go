@@ -0,0 +1,183 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/key"
+)
+
+func TestFileTree(t *testing.T) {
+	defer keepLog(t)()
+
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	// Resolve symlinks like git does, e.g. on OSX.
+	tmpDir, err = filepath.EvalSymlinks(tmpDir)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, nil, os.Mkdir(filepath.Join(tmpDir, "sub"), 0700))
+	ut.AssertEqual(t, nil, ioutil.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("a\n"), 0600))
+	ut.AssertEqual(t, nil, ioutil.WriteFile(filepath.Join(tmpDir, "sub", "b.txt"), []byte("b\n"), 0600))
+	cmd := exec.Command("git", "init", "-q")
+	cmd.Dir = tmpDir
+	hasGit := cmd.Run() == nil
+
+	ed, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+	var tree *fileTreeView
+	rows := func() []string {
+		var out []string
+		for _, r := range tree.rows() {
+			s := strings.Repeat(" ", r.depth) + r.node.name
+			if r.node.isDir {
+				s += "/"
+			}
+			out = append(out, s)
+		}
+		return out
+	}
+	contains := func(name string) func() bool {
+		return func() bool {
+			for _, r := range rows() {
+				if r == name {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	var snapshots [][]string
+	// Each step runs once the previous condition is met and the tree is
+	// refreshed.
+	steps := []struct {
+		run   func()
+		until func() bool
+	}{
+		{
+			func() {},
+			contains("a.txt"),
+		},
+		{
+			func() {
+				if hasGit {
+					ut.AssertEqual(t, byte('?'), tree.status[filepath.Join(tmpDir, "a.txt")])
+					ut.AssertEqual(t, byte('*'), tree.status[filepath.Join(tmpDir, "sub")])
+				}
+				// Expand "sub".
+				e.TriggerTerminalMetaKeyPressed(key.Press{Key: key.Right})
+			},
+			contains(" b.txt"),
+		},
+		{
+			func() {
+				snapshots = append(snapshots, rows())
+				// Create "sub/c.txt".
+				e.TriggerTerminalKeyPressed(key.Press{Ch: 'a'})
+			},
+			contains(" c.txt"),
+		},
+		{
+			func() {
+				snapshots = append(snapshots, rows())
+				// Delete "a.txt".
+				tree.selectPath(filepath.Join(tmpDir, "a.txt"))
+				e.TriggerTerminalKeyPressed(key.Press{Ch: 'd'})
+			},
+			func() bool { return !contains("a.txt")() },
+		},
+		{
+			func() {
+				snapshots = append(snapshots, rows())
+				// Rename "sub/b.txt" to "sub/d.txt".
+				tree.selectPath(filepath.Join(tmpDir, "sub", "b.txt"))
+				e.TriggerTerminalKeyPressed(key.Press{Ch: 'r'})
+			},
+			contains(" d.txt"),
+		},
+		{
+			func() {
+				snapshots = append(snapshots, rows())
+				// Modified by another program, the tree is refreshed by the
+				// fileWatcher.
+				ut.AssertEqual(t, nil, ioutil.WriteFile(filepath.Join(tmpDir, "e.txt"), []byte("e\n"), 0600))
+			},
+			contains("e.txt"),
+		},
+		{
+			func() {
+				if hasGit {
+					ut.AssertEqual(t, byte('?'), tree.status[filepath.Join(tmpDir, "e.txt")])
+				}
+				snapshots = append(snapshots, rows())
+				wicore.PostCommand(e, nil, "q!")
+			},
+			func() bool { return true },
+		},
+	}
+	step := 0
+	var wait func(o wicore.CommandOutcome)
+	wait = func(o wicore.CommandOutcome) {
+		if tree.refreshing || !steps[step].until() {
+			wicore.PostCommand(e, wait, "editor_redraw")
+			return
+		}
+		step++
+		steps[step].run()
+		if step < len(steps)-1 {
+			wicore.PostCommand(e, wait, "editor_redraw")
+		}
+	}
+	e.RegisterViewActivated(func(v wicore.View) {
+		switch v := v.(type) {
+		case *fileTreeView:
+			if tree == nil {
+				tree = v
+				wait(wicore.CommandOutcome{})
+			}
+		case *promptView:
+			if v.kind == wicore.PromptYesNoCancel {
+				e.TriggerTerminalKeyPressed(key.Press{Ch: 'y'})
+				return
+			}
+			for range v.text {
+				e.TriggerTerminalMetaKeyPressed(key.Press{Key: key.Backspace})
+			}
+			name := "c.txt"
+			if v.text != "" {
+				name = "d.txt"
+			}
+			for _, c := range name {
+				e.TriggerTerminalKeyPressed(key.Press{Ch: c})
+			}
+			e.TriggerTerminalKeyPressed(key.Press{Key: key.Enter})
+		}
+	})
+	wicore.PostCommand(e, nil, "file_tree", tmpDir)
+	ut.AssertEqual(t, 0, e.EventLoop())
+
+	expected := [][]string{
+		{"sub/", " b.txt", "a.txt"},
+		{"sub/", " b.txt", " c.txt", "a.txt"},
+		{"sub/", " b.txt", " c.txt"},
+		{"sub/", " c.txt", " d.txt"},
+		{"sub/", " c.txt", " d.txt", "e.txt"},
+	}
+	ut.AssertEqual(t, expected, snapshots)
+}
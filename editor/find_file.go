@@ -0,0 +1,175 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/lang"
+)
+
+const (
+	// maxRecentFiles is the number of recently used files remembered to rank
+	// the find_file results.
+	maxRecentFiles = 100
+	// findFileBatch is the maximum number of files sent at once to the picker.
+	findFileBatch = 256
+	// findFileLatency is the maximum delay before the files found are sent to
+	// the picker.
+	findFileLatency = 50 * time.Millisecond
+	// recentFileBonus is the score added to the most recently used file; the
+	// bonus decreases with the age.
+	recentFileBonus = 10
+)
+
+var errWalkStopped = errors.New("walk stopped")
+
+// projectRoot returns the root of the project containing dir, detected by a
+// .git or a go.mod. It returns dir if there is none.
+func projectRoot(dir string) string {
+	for d := dir; ; {
+		for _, marker := range []string{".git", "go.mod"} {
+			if _, err := os.Stat(filepath.Join(d, marker)); err == nil {
+				return d
+			}
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return dir
+		}
+		d = parent
+	}
+}
+
+// walkFiles sends the files under root in batches. The hidden directories,
+// like .git, are skipped.
+func walkFiles(root string, send func(items []pickerItem) bool) {
+	var batch []pickerItem
+	last := time.Now()
+	flush := func() bool {
+		if len(batch) == 0 {
+			return true
+		}
+		ok := send(batch)
+		batch = nil
+		last = time.Now()
+		return ok
+	}
+	_ = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Unreadable directory; skip it.
+			return nil
+		}
+		if info.IsDir() {
+			if path != root && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		batch = append(batch, pickerItem{filepath.ToSlash(rel), path})
+		if len(batch) >= findFileBatch || time.Since(last) >= findFileLatency {
+			if !flush() {
+				return errWalkStopped
+			}
+		}
+		return nil
+	})
+	flush()
+}
+
+// touchRecentFile marks the file as the most recently used one.
+func (e *editor) touchRecentFile(path string) {
+	if path == "" {
+		return
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	for i, p := range e.recentFiles {
+		if p == path {
+			copy(e.recentFiles[1:i+1], e.recentFiles[:i])
+			e.recentFiles[0] = path
+			return
+		}
+	}
+	if len(e.recentFiles) < maxRecentFiles {
+		e.recentFiles = append(e.recentFiles, "")
+	}
+	copy(e.recentFiles[1:], e.recentFiles)
+	e.recentFiles[0] = path
+}
+
+// recentFilesRank returns the score bonus of the recently used files.
+func (e *editor) recentFilesRank() func(path string) int {
+	bonus := map[string]int{}
+	for i, p := range e.recentFiles {
+		if b := recentFileBonus - i; b > 0 {
+			bonus[p] = b
+		}
+	}
+	return func(path string) int {
+		return bonus[path]
+	}
+}
+
+// Commands.
+
+func cmdFindFile(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	root := args.String(0)
+	if root == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		root = projectRoot(wd)
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := e.ExecuteCommand(w, "window_new", e.rootWindow.ID(), "floating", "picker", findFileTitle.Sprintf(root), "document_open"); err != nil {
+		return nil, err
+	}
+	v, ok := newestChild(e.rootWindow).view.(*pickerView)
+	if !ok {
+		return nil, errors.New("internal error")
+	}
+	v.rank = e.recentFilesRank()
+	v.stream("findFile", func(send func(items []pickerItem) bool) {
+		walkFiles(root, send)
+	})
+	return nil, nil
+}
+
+// RegisterFindFileCommands registers the commands to find files in the
+// project.
+func RegisterFindFileCommands(dispatcher wicore.CommandsW) {
+	cmds := []wicore.Command{
+		&privilegedCommandImpl{
+			"find_file",
+			wicore.CommandArgs{{Name: "root", Type: wicore.ArgString, Optional: true}},
+			cmdFindFile,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Finds a file in the project",
+			},
+			lang.Map{
+				lang.En: "Lists the files under the project root, the closest parent directory with a .git or a go.mod, or under root if specified. Type to filter the files with fuzzy matching; the recently used files are listed first. Use Enter to open the selected file.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/key"
+)
+
+func TestFindFile(t *testing.T) {
+	defer keepLog(t)()
+
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	for _, p := range []string{".git/config", "go.mod", "sub/foo_bar.go", "sub/other.go", "xfyb.txt"} {
+		p = filepath.Join(tmpDir, p)
+		ut.AssertEqual(t, nil, os.MkdirAll(filepath.Dir(p), 0700))
+		ut.AssertEqual(t, nil, ioutil.WriteFile(p, []byte("a\n"), 0600))
+	}
+	ut.AssertEqual(t, tmpDir, projectRoot(filepath.Join(tmpDir, "sub")))
+
+	ed, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+	// The recently used file is listed first.
+	e.touchRecentFile(filepath.Join(tmpDir, "xfyb.txt"))
+	var all []string
+	var matched []string
+	e.RegisterViewActivated(func(v wicore.View) {
+		switch v := v.(type) {
+		case *pickerView:
+			var wait func(o wicore.CommandOutcome)
+			wait = func(o wicore.CommandOutcome) {
+				if v.loading {
+					wicore.PostCommand(e, wait, "editor_redraw")
+					return
+				}
+				for _, m := range v.matches {
+					all = append(all, m.item.Text)
+				}
+				e.TriggerTerminalKeyPressed(key.Press{Ch: 'f'})
+				e.TriggerTerminalKeyPressed(key.Press{Ch: 'b'})
+				e.TriggerTerminalKeyPressed(key.Press{Ch: 'x'})
+				e.TriggerTerminalMetaKeyPressed(key.Press{Key: key.Backspace})
+				e.deferred <- func() {
+					for _, m := range v.matches {
+						matched = append(matched, m.item.Text)
+					}
+					e.TriggerTerminalKeyPressed(key.Press{Key: key.Enter})
+				}
+			}
+			wait(wicore.CommandOutcome{})
+		case *documentView:
+			if matched == nil || v.document == nil {
+				return
+			}
+			ut.AssertEqual(t, filepath.Join(tmpDir, "sub", "foo_bar.go"), v.document.filePath)
+			wicore.PostCommand(e, nil, "q!")
+		}
+	})
+	wicore.PostCommand(e, nil, "find_file", tmpDir)
+	ut.AssertEqual(t, 0, e.EventLoop())
+
+	ut.AssertEqual(t, []string{"xfyb.txt", "go.mod", "sub/other.go", "sub/foo_bar.go"}, all)
+	ut.AssertEqual(t, []string{"sub/foo_bar.go", "xfyb.txt"}, matched)
+}
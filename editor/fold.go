@@ -0,0 +1,307 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/lang"
+)
+
+// foldsByStart sorts the folds by their first line, the outermost first.
+type foldsByStart []fold
+
+func (f foldsByStart) Len() int      { return len(f) }
+func (f foldsByStart) Swap(i, j int) { f[i], f[j] = f[j], f[i] }
+func (f foldsByStart) Less(i, j int) bool {
+	if f[i].start != f[j].start {
+		return f[i].start < f[j].start
+	}
+	return f[i].end > f[j].end
+}
+
+// normalizeFolds sorts the folds and removes the ones spanning a single line.
+// Only the outermost fold starting on a line is kept, so a fold is identified
+// by its first line.
+func normalizeFolds(folds []fold) []fold {
+	sort.Sort(foldsByStart(folds))
+	out := folds[:0]
+	for _, f := range folds {
+		if f.end <= f.start || (len(out) != 0 && out[len(out)-1].start == f.start) {
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// indentWidth returns the number of cells of the indentation of the line and
+// false if the line is blank.
+func indentWidth(l string, tabstop int) (int, bool) {
+	if strings.TrimSpace(l) == "" {
+		return 0, false
+	}
+	indent := indentation(l)
+	return displayColumn(indent, len(indent), tabstop), true
+}
+
+// indentFolds returns a fold for each line followed by more indented lines.
+// The trailing blank lines are not part of the fold.
+func indentFolds(content []string, tabstop int) []fold {
+	var folds []fold
+	// Lines that started a fold not yet ended, with their indentation.
+	var open []fold
+	var indents []int
+	last := -1
+	for i, l := range content {
+		n, ok := indentWidth(l, tabstop)
+		if !ok {
+			continue
+		}
+		for len(open) != 0 && indents[len(indents)-1] >= n {
+			f := open[len(open)-1]
+			f.end = last
+			folds = append(folds, f)
+			open = open[:len(open)-1]
+			indents = indents[:len(indents)-1]
+		}
+		if last != -1 {
+			if prev, _ := indentWidth(content[last], tabstop); n > prev {
+				open = append(open, fold{start: last})
+				indents = append(indents, prev)
+			}
+		}
+		last = i
+	}
+	for _, f := range open {
+		f.end = last
+		folds = append(folds, f)
+	}
+	return normalizeFolds(folds)
+}
+
+// markerFolds returns the folds between the lines containing the start and
+// the end markers, e.g. "{{{" and "}}}". The markers can be nested.
+func markerFolds(content []string, start, end string) []fold {
+	var folds []fold
+	var open []int
+	for i, l := range content {
+		if strings.Contains(l, start) {
+			open = append(open, i)
+		}
+		if strings.Contains(l, end) && len(open) != 0 {
+			folds = append(folds, fold{start: open[len(open)-1], end: i})
+			open = open[:len(open)-1]
+		}
+	}
+	return normalizeFolds(folds)
+}
+
+// goFolds returns the folds of the Go source: the functions, the blocks, the
+// parenthesized declarations and the multiline composite literals.
+//
+// A source with syntax errors is folded as far as it could be parsed.
+func goFolds(content []string) []fold {
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, "", strings.Join(content, ""), parser.ParseComments)
+	if f == nil {
+		return nil
+	}
+	var folds []fold
+	add := func(start, end token.Pos) {
+		if start.IsValid() && end.IsValid() {
+			folds = append(folds, fold{start: fset.Position(start).Line - 1, end: fset.Position(end).Line - 1})
+		}
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if n.Body != nil {
+				add(n.Pos(), n.Body.Rbrace)
+			}
+		case *ast.BlockStmt:
+			add(n.Lbrace, n.Rbrace)
+		case *ast.CaseClause:
+			add(n.Case, n.End())
+		case *ast.CommClause:
+			add(n.Case, n.End())
+		case *ast.CompositeLit:
+			add(n.Lbrace, n.Rbrace)
+		case *ast.FieldList:
+			add(n.Opening, n.Closing)
+		case *ast.GenDecl:
+			add(n.Lparen, n.Rparen)
+		}
+		return true
+	})
+	for _, c := range f.Comments {
+		add(c.Pos(), c.End())
+	}
+	return normalizeFolds(folds)
+}
+
+// updateFolds recalculates the folds if the document or the "foldmethod"
+// setting changed. The folds starting on the same line stay closed.
+func (v *documentView) updateFolds() {
+	method := v.e.GetSetting(v.window, "foldmethod")
+	if method == v.foldMethod && v.document.version == v.foldVersion {
+		return
+	}
+	var folds []fold
+	content := v.document.content
+	switch method {
+	case "indent":
+		folds = indentFolds(content, v.tabstop())
+	case "marker":
+		markers := strings.SplitN(v.e.GetSetting(v.window, "foldmarker"), ",", 2)
+		if len(markers) == 2 && markers[0] != "" && markers[1] != "" {
+			folds = markerFolds(content, markers[0], markers[1])
+		}
+	case "syntax":
+		if filepath.Ext(v.document.filePath) == ".go" {
+			folds = goFolds(content)
+		} else {
+			folds = indentFolds(content, v.tabstop())
+		}
+	}
+	closed := map[int]bool{}
+	for _, f := range v.folds {
+		if f.closed {
+			closed[f.start] = true
+		}
+	}
+	for i := range folds {
+		folds[i].closed = closed[folds[i].start]
+	}
+	v.folds = folds
+	v.foldMethod = method
+	v.foldVersion = v.document.version
+}
+
+// closedFold returns the closed fold starting on the line, if it is shown as
+// a summary row.
+func (v *documentView) closedFold(line int) *fold {
+	for i := range v.folds {
+		if f := &v.folds[i]; f.start == line && f.closed {
+			return f
+		}
+	}
+	return nil
+}
+
+// foldAt returns the innermost fold containing the line, if any.
+func (v *documentView) foldAt(line int) *fold {
+	var out *fold
+	for i := range v.folds {
+		if f := &v.folds[i]; f.start <= line && line <= f.end {
+			// The folds are sorted by start, so the last one is the innermost.
+			out = f
+		}
+	}
+	return out
+}
+
+// Commands.
+
+func cmdFoldToggle(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	v, ok := w.View().(*documentView)
+	if !ok {
+		return nil, errors.New("internal error")
+	}
+	v.updateFolds()
+	line := v.visibleLine(v.CursorLine)
+	if f := v.closedFold(line); f != nil {
+		f.closed = false
+	} else if f := v.foldAt(line); f != nil {
+		f.closed = true
+		v.CursorLine = f.start
+		v.CursorColumn = 0
+		v.updateColumnMax()
+	} else {
+		return nil, errors.New(noFold.String())
+	}
+	v.cursorMoved(e)
+	return nil, nil
+}
+
+func cmdFoldOpenAll(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	v, ok := w.View().(*documentView)
+	if !ok {
+		return nil, errors.New("internal error")
+	}
+	v.updateFolds()
+	for i := range v.folds {
+		v.folds[i].closed = false
+	}
+	v.cursorMoved(e)
+	return nil, nil
+}
+
+func cmdFoldCloseAll(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	v, ok := w.View().(*documentView)
+	if !ok {
+		return nil, errors.New("internal error")
+	}
+	v.updateFolds()
+	for i := range v.folds {
+		v.folds[i].closed = true
+	}
+	if line := v.visibleLine(v.CursorLine); line != v.CursorLine {
+		v.CursorLine = line
+		v.CursorColumn = 0
+		v.updateColumnMax()
+	}
+	v.cursorMoved(e)
+	return nil, nil
+}
+
+// foldCommands returns the commands of a documentView to manage the folds.
+func foldCommands() []wicore.Command {
+	return []wicore.Command{
+		&wicore.CommandImpl{
+			"fold_close_all",
+			nil,
+			cmdFoldCloseAll,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Closes all the folds",
+			},
+			lang.Map{
+				lang.En: "Closes all the folds of the document, as defined by the \"foldmethod\" setting.",
+			},
+		},
+		&wicore.CommandImpl{
+			"fold_open_all",
+			nil,
+			cmdFoldOpenAll,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Opens all the folds",
+			},
+			lang.Map{
+				lang.En: "Opens all the folds of the document.",
+			},
+		},
+		&wicore.CommandImpl{
+			"fold_toggle",
+			nil,
+			cmdFoldToggle,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Opens or closes the fold at the cursor",
+			},
+			lang.Map{
+				lang.En: "Opens the closed fold at the cursor, or closes the innermost fold containing the cursor. A closed fold is shown as a single summary line.",
+			},
+		},
+	}
+}
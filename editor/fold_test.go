@@ -0,0 +1,97 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+)
+
+func TestFoldRanges(t *testing.T) {
+	content := strings.SplitAfter("a\n  b\n    c\n\n  d\ne\n  f\n", "\n")
+	ut.AssertEqual(t, []fold{{0, 4, false}, {1, 2, false}, {5, 6, false}}, indentFolds(content, 8))
+	content = strings.SplitAfter("a {{{\nb\nc {{{\nd }}}\n}}}\n}}}\n", "\n")
+	ut.AssertEqual(t, []fold{{0, 4, false}, {2, 3, false}}, markerFolds(content, "{{{", "}}}"))
+	content = strings.SplitAfter("package a\n\nfunc f() {\n\tswitch {\n\tcase true:\n\t\tf()\n\t}\n}\n\nvar x = []int{\n\t1,\n}\n", "\n")
+	ut.AssertEqual(t, []fold{{2, 7, false}, {3, 6, false}, {4, 5, false}, {9, 11, false}}, goFolds(content))
+	// Syntax errors are tolerated.
+	content = strings.SplitAfter("package a\n\nfunc f() {\n\tif x {\n\t}\n", "\n")
+	ut.AssertEqual(t, []fold{{3, 4, false}}, goFolds(content))
+}
+
+func TestFold(t *testing.T) {
+	defer keepLog(t)()
+
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	path := filepath.Join(tmpDir, "a.go")
+	src := "package a\n\nimport (\n\t\"fmt\"\n\t\"os\"\n)\n\nfunc f() {\n\tif true {\n\t\tfmt.Println()\n\t}\n\tos.Exit(0)\n}\n"
+	ut.AssertEqual(t, nil, ioutil.WriteFile(path, []byte(src), 0600))
+
+	ed, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+	var v *documentView
+	var screens [][]string
+	var cursors []int
+	snapshot := func(o wicore.CommandOutcome) {
+		ut.AssertEqual(t, nil, o.Err)
+		b := v.Buffer()
+		var out []string
+		for y := 0; y < b.Height; y++ {
+			if l := strings.TrimRight(string(b.Line(y).Runes()), " "); l != "" {
+				out = append(out, l)
+			}
+		}
+		screens = append(screens, out)
+		cursors = append(cursors, v.CursorLine)
+	}
+	wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+		v = e.ActiveWindow().View().(*documentView)
+		v.SetSize(40, 10)
+	}, "open", path)
+	wicore.PostCommand(e, nil, "set", "global", "foldcolumn", "no")
+	wicore.PostCommand(e, snapshot, "fold_close_all")
+	wicore.PostCommand(e, snapshot, "document_cursor_down")
+	wicore.PostCommand(e, snapshot, "document_cursor_down")
+	wicore.PostCommand(e, snapshot, "document_cursor_down")
+	wicore.PostCommand(e, snapshot, "document_cursor_down")
+	wicore.PostCommand(e, snapshot, "fold_toggle")
+	wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+		snapshot(o)
+		ut.AssertEqual(t, []fold{{2, 4, true}, {7, 11, false}, {8, 9, true}}, v.folds)
+	}, "set", "global", "foldmethod", "indent")
+	wicore.PostCommand(e, snapshot, "document_cursor_up")
+	wicore.PostCommand(e, snapshot, "fold_open_all")
+	wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+		snapshot(o)
+		ut.AssertEqual(t, []fold(nil), v.folds)
+	}, "set", "global", "foldmethod", "none")
+	wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+		ut.AssertEqual(t, "There is no fold at the cursor.", o.Err.Error())
+		wicore.PostCommand(e, nil, "q!")
+	}, "fold_toggle")
+	ut.AssertEqual(t, 0, e.EventLoop())
+
+	closed := []string{"package a", "import ( ··· 4 lines", "func f() { ··· 6 lines"}
+	funcOpen := []string{"package a", "import ( ··· 4 lines", "func f() {", "        if true { ··· 3 lines", "        os.Exit(0)", "}"}
+	indent := []string{"package a", "import ( ··· 3 lines", ")", "func f() {", "        if true { ··· 2 lines", "        }", "        os.Exit(0)", "}"}
+	allOpen := []string{"package a", "import (", "        \"fmt\"", "        \"os\"", ")", "func f() {", "        if true {", "                fmt.Println()"}
+	expected := [][]string{closed, closed, closed, closed, closed, funcOpen, indent, indent, allOpen, allOpen}
+	ut.AssertEqual(t, expected, screens)
+	ut.AssertEqual(t, []int{0, 1, 2, 6, 7, 7, 7, 6, 6, 6}, cursors)
+}
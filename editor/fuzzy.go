@@ -0,0 +1,123 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"unicode"
+)
+
+// Scores used by fuzzyMatch.
+const (
+	fuzzyMatched     = 1 // Each matched character.
+	fuzzyConsecutive = 8 // Matched right after the previous matched character.
+	fuzzyBoundary    = 8 // Matched at the start of a word or a path element.
+	fuzzyCamel       = 6 // Matched on a lower to upper case transition.
+	fuzzyBasename    = 2 // Matched in the last path element.
+	fuzzyGapStart    = 3 // Characters skipped between two matches.
+	fuzzyGap         = 1 // Each additional character skipped.
+)
+
+// fuzzyMatch returns the score of s for pattern and true if pattern is a
+// subsequence of s. A higher score is a better match.
+//
+// The match is case insensitive, unless pattern contains an upper case letter.
+// The best alignment is found, favoring consecutive characters and the start
+// of words.
+func fuzzyMatch(pattern, s string) (int, bool) {
+	p := []rune(pattern)
+	if len(p) == 0 {
+		return 0, true
+	}
+	r := []rune(s)
+	if len(p) > len(r) {
+		return 0, false
+	}
+	smartCase := false
+	for _, c := range p {
+		if unicode.IsUpper(c) {
+			smartCase = true
+			break
+		}
+	}
+	basename := 0
+	for i, c := range r {
+		if c == '/' || c == '\\' {
+			basename = i + 1
+		}
+	}
+	bonus := make([]int, len(r))
+	for j, c := range r {
+		bonus[j] = fuzzyMatched
+		if j == 0 {
+			bonus[j] += fuzzyBoundary
+		} else if prev := r[j-1]; isFuzzySeparator(prev) {
+			bonus[j] += fuzzyBoundary
+		} else if unicode.IsLower(prev) && unicode.IsUpper(c) {
+			bonus[j] += fuzzyCamel
+		}
+		if j >= basename {
+			bonus[j] += fuzzyBasename
+		}
+	}
+	equal := func(a, b rune) bool {
+		if smartCase {
+			return a == b
+		}
+		return unicode.ToLower(a) == unicode.ToLower(b)
+	}
+
+	// best[j] is the best score with the current pattern character matched at
+	// r[j]; noMatch denotes an impossible alignment.
+	const noMatch = -1 << 30
+	best := make([]int, len(r))
+	prev := make([]int, len(r))
+	for i, c := range p {
+		best, prev = prev, best
+		// carry is the best score of the previous pattern character matched
+		// at least two characters before j, minus the gap.
+		carry := noMatch
+		for j := range r {
+			if carry != noMatch {
+				carry -= fuzzyGap
+			}
+			if j >= 2 && prev[j-2] != noMatch && prev[j-2]-fuzzyGapStart > carry {
+				carry = prev[j-2] - fuzzyGapStart
+			}
+			best[j] = noMatch
+			if !equal(c, r[j]) {
+				continue
+			}
+			if i == 0 {
+				best[j] = bonus[j]
+				continue
+			}
+			score := carry
+			if j >= 1 && prev[j-1] != noMatch && prev[j-1]+fuzzyConsecutive > score {
+				score = prev[j-1] + fuzzyConsecutive
+			}
+			if score != noMatch {
+				best[j] = score + bonus[j]
+			}
+		}
+	}
+	out := noMatch
+	for _, s := range best {
+		if s > out {
+			out = s
+		}
+	}
+	if out == noMatch {
+		return 0, false
+	}
+	return out, true
+}
+
+func isFuzzySeparator(c rune) bool {
+	switch c {
+	case '/', '\\', '_', '-', '.', ' ':
+		return true
+	}
+	return false
+}
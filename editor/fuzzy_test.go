@@ -0,0 +1,45 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	data := []struct {
+		pattern string
+		s       string
+		ok      bool
+	}{
+		{"", "foo", true},
+		{"fb", "foo_bar.go", true},
+		{"FB", "foo_bar.go", false},
+		{"FB", "FooBar.go", true},
+		{"bf", "foo_bar.go", false},
+		{"foobargox", "foo_bar.go", false},
+	}
+	for i, line := range data {
+		_, ok := fuzzyMatch(line.pattern, line.s)
+		ut.AssertEqualIndex(t, i, line.ok, ok)
+	}
+
+	// Ranking: consecutive and word starts first, then the basename.
+	better := [][3]string{
+		{"bar", "foo/bar.go", "foo/b_a_r.go"},
+		{"fb", "foo_bar.go", "fooxbar.go"},
+		{"fb", "FooBar.go", "Foobar.go"},
+		{"ed", "wi/editor.go", "editor/wi.go"},
+	}
+	for i, line := range better {
+		a, ok := fuzzyMatch(line[0], line[1])
+		ut.AssertEqualIndex(t, i, true, ok)
+		b, ok := fuzzyMatch(line[0], line[2])
+		ut.AssertEqualIndex(t, i, true, ok)
+		ut.AssertEqualIndex(t, i, true, a > b)
+	}
+}
@@ -0,0 +1,639 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/colors"
+	"github.com/wi-ed/wi/wicore/key"
+	"github.com/wi-ed/wi/wicore/lang"
+	"github.com/wi-ed/wi/wicore/raster"
+)
+
+// goTestSource is the source of the diagnostics of the failed tests.
+const goTestSource = "go_test"
+
+// goTestEvent is a line printed by 'go test -json'.
+type goTestEvent struct {
+	Action     string
+	Package    string
+	ImportPath string // Set for the build-output action.
+	Test       string
+	Elapsed    float64
+	Output     string
+}
+
+// goTestStates are the word shown for the state of a test and its color.
+var goTestStates = map[string]struct {
+	word string
+	fg   colors.RGB
+}{
+	"run":  {"RUN ", colors.White},
+	"pass": {"PASS", colors.Green},
+	"fail": {"FAIL", colors.Red},
+	"skip": {"SKIP", colors.Brown},
+}
+
+// goTestResult is the result of a package, a test or a subtest.
+type goTestResult struct {
+	pkg      string
+	name     string // Empty for a package.
+	state    string // One of goTestStates.
+	elapsed  float64
+	output   []string
+	children []*goTestResult
+	// Location of the failure; the first location printed or the declaration
+	// of the test.
+	path string
+	line int
+	col  int
+}
+
+// label returns the text shown in the tree.
+func (t *goTestResult) label() string {
+	if t.name == "" {
+		return t.pkg
+	}
+	return t.name[strings.LastIndex(t.name, "/")+1:]
+}
+
+// goTestRun is a 'go test -json' running in the background, or done.
+type goTestRun struct {
+	args      []string
+	dir       string // Directory of the package.
+	proc      *os.Process
+	cancelled chan struct{}
+	done      bool
+	packages  []*goTestResult
+	results   map[string]*goTestResult  // By package and name.
+	decls     map[string]token.Position // Declarations of the test functions; 0-based.
+	errors    map[string][]*diagnostic  // Failures by path, as published.
+}
+
+func (r *goTestRun) String() string {
+	return strings.Join(r.args, " ")
+}
+
+// cancel kills the process group and discards its remaining output.
+func (r *goTestRun) cancel() {
+	if r.done {
+		return
+	}
+	r.done = true
+	close(r.cancelled)
+	if err := killProcessGroup(r.proc); err != nil {
+		log.Printf("%s: kill failed: %s", r, err)
+	}
+}
+
+// result returns the result of the test of the package, creating it as
+// needed. A subtest is added to its parent and a test to its package.
+func (r *goTestRun) result(pkg, name string) *goTestResult {
+	k := pkg + " " + name
+	if t := r.results[k]; t != nil {
+		return t
+	}
+	t := &goTestResult{pkg: pkg, name: name, state: "run"}
+	r.results[k] = t
+	if name == "" {
+		r.packages = append(r.packages, t)
+		return t
+	}
+	parent := ""
+	if i := strings.LastIndex(name, "/"); i != -1 {
+		parent = name[:i]
+	}
+	p := r.result(pkg, parent)
+	p.children = append(p.children, t)
+	return t
+}
+
+// counts returns the number of tests passed, failed and skipped. The packages
+// are not counted.
+func (r *goTestRun) counts() (int, int, int) {
+	n := map[string]int{}
+	for _, t := range r.results {
+		if t.name != "" {
+			n[t.state]++
+		}
+	}
+	return n["pass"], n["fail"], n["skip"]
+}
+
+// isGoTest returns true if the function is run by 'go test -run'.
+func isGoTest(name string) bool {
+	for _, prefix := range []string{"Test", "Example", "Fuzz"} {
+		if strings.HasPrefix(name, prefix) {
+			r, _ := utf8.DecodeRuneInString(name[len(prefix):])
+			return !unicode.IsLower(r)
+		}
+	}
+	return false
+}
+
+// goTestFuncs returns the test functions of the Go source.
+func goTestFuncs(src string) []*symbol {
+	var out []*symbol
+	for _, s := range goSymbols(src) {
+		if s.kind == "func" && isGoTest(s.name) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// goTestDecls returns the declarations of the test functions of the package
+// in dir. The loaded documents are used instead of the files.
+func (e *editor) goTestDecls(dir string) map[string]token.Position {
+	out := map[string]token.Position{}
+	paths, _ := filepath.Glob(filepath.Join(dir, "*_test.go"))
+	for _, path := range paths {
+		var src string
+		if d := e.findDocument(path); d != nil {
+			src = strings.Join(d.content, "")
+		} else if b, err := ioutil.ReadFile(path); err == nil {
+			src = string(b)
+		}
+		for _, s := range goTestFuncs(src) {
+			out[s.name] = token.Position{Filename: path, Line: s.line, Column: s.col}
+		}
+	}
+	return out
+}
+
+// startGoTest runs the tests of the package in dir in the background,
+// cancelling the tests still running. Only the tests named are run, unless
+// there are none. The results are shown on the right.
+func (e *editor) startGoTest(w *window, dir string, names []string) error {
+	args := []string{"go", "test", "-json"}
+	if len(names) != 0 {
+		args = append(args, "-run", "^("+strings.Join(names, "|")+")$")
+	}
+	args = append(args, ".")
+	if e.goTest != nil {
+		e.goTest.cancel()
+	}
+	e.clearDiagnostics(goTestSource)
+
+	r := &goTestRun{
+		args:      args,
+		dir:       dir,
+		cancelled: make(chan struct{}),
+		results:   map[string]*goTestResult{},
+		decls:     e.goTestDecls(dir),
+		errors:    map[string][]*diagnostic{},
+	}
+	proc, err := e.runInBackground(args, dir, r.cancelled, func(l string) {
+		e.onGoTestOutput(r, l)
+	}, func(err error) {
+		e.onGoTestDone(r, err)
+	})
+	if err != nil {
+		e.goTest = nil
+		return err
+	}
+	r.proc = proc
+	e.goTest = r
+	for _, child := range e.rootWindow.childrenWindows {
+		if v, ok := child.view.(*goTestView); ok {
+			v.selected = 0
+			return nil
+		}
+	}
+	if _, err := e.ExecuteCommand(w, "window_new", e.rootWindow.ID(), "right", "go_test"); err != nil {
+		return err
+	}
+	return e.activateWindow(w)
+}
+
+// publishGoTestFailure marks the failure in the document.
+func (e *editor) publishGoTestFailure(r *goTestRun, path string, g *diagnostic) {
+	p := diagnosticsPath(path)
+	r.errors[p] = append(r.errors[p], g)
+	e.publishDiagnostics(p, goTestSource, r.errors[p])
+}
+
+// onGoTestFailed publishes the locations printed by the failed test. The
+// declaration of the test is used when none is printed.
+func (e *editor) onGoTestFailed(r *goTestRun, t *goTestResult) {
+	for _, l := range t.output {
+		if path, g, ok := parseQuickfix(r.dir, l); ok {
+			if t.path == "" {
+				t.path, t.line, t.col = path, g.line, g.col
+			}
+			g.message = t.name + ": " + g.message
+			e.publishGoTestFailure(r, path, g)
+		}
+	}
+	// A test failing because of a subtest shows the failure of the subtest.
+	for _, c := range t.children {
+		if t.path == "" && c.path != "" {
+			t.path, t.line, t.col = c.path, c.line, c.col
+		}
+	}
+	if t.path != "" {
+		return
+	}
+	top := t.name
+	if i := strings.Index(top, "/"); i != -1 {
+		top = top[:i]
+	}
+	if p, ok := r.decls[top]; ok {
+		t.path, t.line, t.col = p.Filename, p.Line, p.Column
+		e.publishGoTestFailure(r, p.Filename, &diagnostic{"", severityError, p.Line, p.Column, p.Line, p.Column, goTestFailed.Sprintf(t.name)})
+	}
+}
+
+// onGoTestOutput processes a line printed by 'go test -json'.
+func (e *editor) onGoTestOutput(r *goTestRun, line string) {
+	if e.goTest != r || r.done {
+		return
+	}
+	ev := goTestEvent{}
+	if err := json.Unmarshal([]byte(line), &ev); err != nil {
+		// Not JSON, e.g. a build error printed by an older version of Go.
+		ev = goTestEvent{Action: "build-output", Output: line}
+	}
+	switch ev.Action {
+	case "build-output":
+		// The import path is formatted as "pkg [pkg.test]".
+		if i := strings.Index(ev.ImportPath, " "); i != -1 {
+			ev.ImportPath = ev.ImportPath[:i]
+		}
+		t := r.result(ev.ImportPath, "")
+		l := strings.TrimRight(ev.Output, "\n")
+		t.output = append(t.output, l)
+		if path, g, ok := parseQuickfix(r.dir, l); ok {
+			if t.path == "" {
+				t.path, t.line, t.col = path, g.line, g.col
+			}
+			e.publishGoTestFailure(r, path, g)
+		}
+	case "output":
+		t := r.result(ev.Package, ev.Test)
+		t.output = append(t.output, strings.TrimRight(ev.Output, "\n"))
+	case "run", "start":
+		r.result(ev.Package, ev.Test)
+	case "pass", "skip", "fail":
+		t := r.result(ev.Package, ev.Test)
+		t.state = ev.Action
+		t.elapsed = ev.Elapsed
+		if ev.Action == "fail" && ev.Test != "" {
+			e.onGoTestFailed(r, t)
+		}
+	}
+	wicore.PostCommand(e, nil, "editor_redraw")
+}
+
+func (e *editor) onGoTestDone(r *goTestRun, err error) {
+	if e.goTest != r || r.done {
+		return
+	}
+	r.done = true
+	if err != nil && len(r.packages) == 0 {
+		e.alertOnError(err)
+	}
+	wicore.PostCommand(e, nil, "editor_redraw")
+}
+
+// goTestRow is a visible line of the goTestView.
+type goTestRow struct {
+	result *goTestResult
+	depth  int
+}
+
+// goTestView shows the results of the last tests as a tree of packages, tests
+// and subtests.
+type goTestView struct {
+	view
+	e        *editor
+	selected int // Index of the selected row.
+	offset   int // First row shown.
+}
+
+func (v *goTestView) rows() []goTestRow {
+	if v.e.goTest == nil {
+		return nil
+	}
+	var out []goTestRow
+	var add func(results []*goTestResult, depth int)
+	add = func(results []*goTestResult, depth int) {
+		for _, t := range results {
+			out = append(out, goTestRow{t, depth})
+			add(t.children, depth+1)
+		}
+	}
+	add(v.e.goTest.packages, 0)
+	return out
+}
+
+func (v *goTestView) selectedResult() *goTestResult {
+	rows := v.rows()
+	if v.selected >= len(rows) {
+		v.selected = len(rows) - 1
+	}
+	if v.selected < 0 {
+		v.selected = 0
+		return nil
+	}
+	return rows[v.selected].result
+}
+
+func (v *goTestView) Buffer() *raster.Buffer {
+	v.buffer.Fill(raster.Cell{R: ' ', F: v.DefaultFormat()})
+	r := v.e.goTest
+	if r == nil {
+		f := v.DefaultFormat()
+		f.Fg = colors.DarkGray
+		v.buffer.DrawString(goTestEmpty.String(), 0, 0, f)
+		return v.buffer
+	}
+	passed, failed, skipped := r.counts()
+	if r.done {
+		v.title = goTestTitle.Sprintf(passed, failed, skipped)
+	} else {
+		v.title = goTestRunningTitle.Sprintf(passed, failed, skipped)
+	}
+	v.selectedResult()
+	rows := v.rows()
+	if v.selected < v.offset {
+		v.offset = v.selected
+	} else if v.actualY > 0 && v.selected >= v.offset+v.actualY {
+		v.offset = v.selected - v.actualY + 1
+	}
+	for i := v.offset; i < len(rows) && i-v.offset < v.actualY; i++ {
+		row := rows[i]
+		f := v.DefaultFormat()
+		if i == v.selected {
+			f.Fg, f.Bg = f.Bg, f.Fg
+		}
+		sf := f
+		if i != v.selected {
+			sf.Fg = goTestStates[row.result.state].fg
+		}
+		x := 2 * row.depth
+		v.buffer.DrawString(goTestStates[row.result.state].word, x, i-v.offset, sf)
+		text := row.result.label()
+		if row.result.state != "run" {
+			text += fmt.Sprintf(" (%.2fs)", row.result.elapsed)
+		}
+		v.buffer.DrawString(text, x+5, i-v.offset, f)
+	}
+	return v.buffer
+}
+
+// showOutput shows the output of the selected test.
+func (v *goTestView) showOutput() {
+	t := v.selectedResult()
+	if t == nil {
+		return
+	}
+	name := t.name
+	if name == "" {
+		name = t.pkg
+	}
+	args := append([]string{v.e.rootWindow.ID(), "floating", "text", goTestOutputTitle.Sprintf(name)}, t.output...)
+	_, err := v.e.ExecuteCommand(v.e.rootWindow, "window_new", args...)
+	v.e.alertOnError(err)
+}
+
+// gotoFailure jumps to the location of the failure of the selected test.
+func (v *goTestView) gotoFailure() {
+	t := v.selectedResult()
+	if t == nil || t.path == "" {
+		return
+	}
+	d, err := v.e.openDocument(t.path)
+	if err == nil {
+		err = v.e.gotoDocument(d, t.line, t.col)
+	}
+	v.e.alertOnError(err)
+}
+
+func (v *goTestView) onTerminalKeyPressed(k key.Press) {
+	if v.window == nil || v.e.ActiveWindow() != v.window {
+		return
+	}
+	switch {
+	case k.Key == key.Enter:
+		v.gotoFailure()
+	case k.Ch == 'o':
+		v.showOutput()
+	case k.Ch == 'q':
+		wicore.PostCommand(v.e, nil, "window_close", v.window.ID())
+	}
+	wicore.PostCommand(v.e, nil, "editor_redraw")
+}
+
+func cmdToGoTest(handler func(v *goTestView)) wicore.CommandImplHandler {
+	return func(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
+		v, ok := w.View().(*goTestView)
+		if !ok {
+			return nil, errors.New("internal error")
+		}
+		handler(v)
+		wicore.PostCommand(e, nil, "editor_redraw")
+		return nil, nil
+	}
+}
+
+func cmdGoTestCursorDown(v *goTestView) {
+	v.selected++
+	v.selectedResult()
+}
+
+func cmdGoTestCursorUp(v *goTestView) {
+	if v.selected > 0 {
+		v.selected--
+	}
+}
+
+// goTestViewFactory returns a View showing the results of the last tests.
+func goTestViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
+	dispatcher := makeCommands()
+	cmds := []wicore.Command{
+		&wicore.CommandImpl{
+			"go_test_cursor_down",
+			nil,
+			cmdToGoTest(cmdGoTestCursorDown),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Selects the next test",
+			},
+			lang.Map{
+				lang.En: "Selects the next test in the results.",
+			},
+		},
+		&wicore.CommandImpl{
+			"go_test_cursor_up",
+			nil,
+			cmdToGoTest(cmdGoTestCursorUp),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Selects the previous test",
+			},
+			lang.Map{
+				lang.En: "Selects the previous test in the results.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+	bindings := makeKeyBindings()
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Down}, "go_test_cursor_down")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Up}, "go_test_cursor_up")
+
+	v := &goTestView{
+		view{
+			commands:      dispatcher,
+			keyBindings:   bindings,
+			eventRegistry: e,
+			id:            id,
+			title:         goTestTitle.Sprintf(0, 0, 0),
+			naturalX:      40,
+			naturalY:      -1,
+			defaultFormat: raster.CellFormat{Fg: colors.White, Bg: colors.Black},
+		},
+		e.(*editor),
+		0,
+		0,
+	}
+	v.events = append(v.events, e.RegisterTerminalKeyPressed(v.onTerminalKeyPressed))
+	return v
+}
+
+// goTestDocument returns the Go document of the Window.
+func goTestDocument(w *window) (*documentView, error) {
+	v, ok := w.view.(*documentView)
+	if !ok || v.document.filePath == "" {
+		return nil, errors.New(noDocument.String())
+	}
+	if v.document.FileType() != wicore.CodeGo {
+		return nil, errors.New(notGoDocument.String())
+	}
+	return v, nil
+}
+
+// Commands.
+
+func cmdGoTestCursor(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	v, err := goTestDocument(w)
+	if err != nil {
+		return nil, err
+	}
+	// The test is the last function declared before the cursor.
+	var test *symbol
+	for _, s := range goSymbols(strings.Join(v.document.content, "")) {
+		if s.kind == "func" && s.line <= v.CursorLine && (test == nil || s.line > test.line) {
+			test = s
+		}
+	}
+	if test == nil || !isGoTest(test.name) {
+		return nil, errors.New(noTestAtCursor.String())
+	}
+	return nil, e.startGoTest(w, filepath.Dir(v.document.filePath), []string{test.name})
+}
+
+func cmdGoTestFile(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	v, err := goTestDocument(w)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, s := range goTestFuncs(strings.Join(v.document.content, "")) {
+		names = append(names, s.name)
+	}
+	if len(names) == 0 {
+		return nil, errors.New(noTestInFile.String())
+	}
+	return nil, e.startGoTest(w, filepath.Dir(v.document.filePath), names)
+}
+
+func cmdGoTestPackage(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	v, err := goTestDocument(w)
+	if err != nil {
+		return nil, err
+	}
+	return nil, e.startGoTest(w, filepath.Dir(v.document.filePath), nil)
+}
+
+func cmdGoTestResults(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	for _, child := range e.rootWindow.childrenWindows {
+		if _, ok := child.view.(*goTestView); ok {
+			return nil, e.activateWindow(child)
+		}
+	}
+	return e.ExecuteCommand(w, "window_new", e.rootWindow.ID(), "right", "go_test")
+}
+
+// RegisterGoTestCommands registers the commands to run the Go tests.
+func RegisterGoTestCommands(dispatcher wicore.CommandsW) {
+	cmds := []wicore.Command{
+		&privilegedCommandImpl{
+			"go_test_cursor",
+			nil,
+			cmdGoTestCursor,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Runs the test at the cursor",
+			},
+			lang.Map{
+				lang.En: "Runs the Go test function the cursor is in with 'go test -json' in the background. The results are shown on the right; see go_test_results.",
+			},
+		},
+		&privilegedCommandImpl{
+			"go_test_file",
+			nil,
+			cmdGoTestFile,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Runs the tests of the file",
+			},
+			lang.Map{
+				lang.En: "Runs the Go test functions declared in the document with 'go test -json' in the background. The results are shown on the right; see go_test_results.",
+			},
+		},
+		&privilegedCommandImpl{
+			"go_test_package",
+			nil,
+			cmdGoTestPackage,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Runs the tests of the package",
+			},
+			lang.Map{
+				lang.En: "Runs the tests of the package of the document with 'go test -json' in the background. The results are shown on the right; see go_test_results.",
+			},
+		},
+		&privilegedCommandImpl{
+			"go_test_results",
+			nil,
+			cmdGoTestResults,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Shows the results of the tests",
+			},
+			lang.Map{
+				lang.En: "Shows the packages, tests and subtests of the last go_test_cursor, go_test_file or go_test_package on the right, with their state and duration. The tests still running are cancelled when new ones are started. Use Enter to jump to the failure of the selected test and o to show its output. The failures are also shown in the documents.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/key"
+)
+
+func TestGoTest(t *testing.T) {
+	defer keepLog(t)()
+
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not in PATH")
+	}
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	tmpDir, err = filepath.EvalSymlinks(tmpDir)
+	ut.AssertEqual(t, nil, err)
+	path := filepath.Join(tmpDir, "a_test.go")
+	src := "package a\n\nimport \"testing\"\n\nfunc TestA(t *testing.T) { t.Log(\"hi\") }\nfunc TestB(t *testing.T) { t.Run(\"sub\", func(t *testing.T) { t.Fatal(\"boom\") }) }\nfunc TestC(t *testing.T) {\n\tt.Skip(\"later\")\n}\n"
+	ut.AssertEqual(t, nil, ioutil.WriteFile(filepath.Join(tmpDir, "go.mod"), []byte("module example.com/a\n\ngo 1.16\n"), 0600))
+	ut.AssertEqual(t, nil, ioutil.WriteFile(path, []byte(src), 0600))
+
+	ed, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+	var errs []string
+	var got []string
+	post := func(cmd string, args ...string) {
+		wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+			if o.Err != nil {
+				errs = append(errs, o.Err.Error())
+			}
+		}, cmd, args...)
+	}
+	resultsView := func() *goTestView {
+		for _, child := range e.rootWindow.childrenWindows {
+			if v, ok := child.view.(*goTestView); ok {
+				return v
+			}
+		}
+		return nil
+	}
+	done := func() bool {
+		return e.goTest != nil && e.goTest.done
+	}
+	recordResults := func() {
+		v := resultsView()
+		for _, row := range v.rows() {
+			got = append(got, strings.Repeat(" ", row.depth)+row.result.state+" "+row.result.label())
+		}
+		v.Buffer()
+		got = append(got, v.Title())
+	}
+	isDocument := func() bool {
+		_, ok := e.ActiveWindow().View().(*documentView)
+		return ok
+	}
+	// Each step runs once the previous condition is met.
+	steps := []struct {
+		run   func()
+		until func() bool
+	}{
+		{
+			func() {
+				post("go_test_package")
+			},
+			done,
+		},
+		{
+			func() {
+				recordResults()
+				// The focus stays on the document.
+				ut.AssertEqual(t, true, isDocument())
+				for _, g := range e.diagnostics[path] {
+					got = append(got, fmt.Sprintf("%d:%d %s", g.line, g.col, g.message))
+				}
+				v := resultsView()
+				ut.AssertEqual(t, nil, e.activateWindow(v.window))
+				v.selected = 3
+				v.onTerminalKeyPressed(key.Press{Key: key.Enter})
+			},
+			isDocument,
+		},
+		{
+			func() {
+				d := e.ActiveWindow().View().(*documentView)
+				got = append(got, fmt.Sprintf("cursor %d:%d", d.CursorLine, d.CursorColumn))
+				v := resultsView()
+				ut.AssertEqual(t, nil, e.activateWindow(v.window))
+				v.onTerminalKeyPressed(key.Press{Ch: 'o'})
+			},
+			func() bool {
+				_, ok := e.ActiveWindow().View().(*textView)
+				return ok
+			},
+		},
+		{
+			func() {
+				tv := e.ActiveWindow().View().(*textView)
+				got = append(got, tv.Title())
+				got = append(got, tv.lines...)
+				post("text_close")
+			},
+			func() bool {
+				_, ok := e.ActiveWindow().View().(*goTestView)
+				return ok
+			},
+		},
+		{
+			func() {
+				for _, child := range e.rootWindow.childrenWindows {
+					if _, ok := child.view.(*documentView); ok {
+						ut.AssertEqual(t, nil, e.activateWindow(child))
+					}
+				}
+				d := e.ActiveWindow().View().(*documentView)
+				d.CursorLine = 7
+				post("go_test_cursor")
+			},
+			done,
+		},
+		{
+			func() {
+				recordResults()
+				ut.AssertEqual(t, 0, len(e.diagnostics))
+				e.ActiveWindow().View().(*documentView).CursorLine = 1
+				post("go_test_cursor")
+				wicore.PostCommand(e, nil, "q!")
+			},
+			func() bool { return true },
+		},
+	}
+	step := 0
+	var wait func(o wicore.CommandOutcome)
+	wait = func(o wicore.CommandOutcome) {
+		if !steps[step].until() {
+			wicore.PostCommand(e, wait, "editor_redraw")
+			return
+		}
+		step++
+		steps[step].run()
+		if step < len(steps)-1 {
+			wicore.PostCommand(e, wait, "editor_redraw")
+		}
+	}
+	wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+		ut.AssertEqual(t, nil, o.Err)
+		steps[0].run()
+		wait(o)
+	}, "open", path)
+	ut.AssertEqual(t, 0, e.EventLoop())
+
+	expected := []string{
+		"fail example.com/a",
+		" pass TestA",
+		" fail TestB",
+		"  fail sub",
+		" skip TestC",
+		"Tests: 1 passed, 2 failed, 1 skipped",
+		"5:0 TestB/sub: boom",
+		"cursor 5:0",
+		"Output of TestB/sub",
+		"=== RUN   TestB/sub",
+		"    a_test.go:6: boom",
+		"--- FAIL: TestB/sub (0.00s)",
+		"pass example.com/a",
+		" skip TestC",
+		"Tests: 0 passed, 0 failed, 1 skipped",
+	}
+	ut.AssertEqual(t, expected, got)
+	ut.AssertEqual(t, []string{"The cursor is not in a test function."}, errs)
+}
@@ -0,0 +1,429 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"errors"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/lang"
+	"golang.org/x/tools/go/packages"
+)
+
+// goProgram is the type checked Go packages of a module, including their
+// tests, with the unsaved changes of the loaded documents. Outside of a
+// module, it is the package of a directory.
+type goProgram struct {
+	root     string
+	fset     *token.FileSet
+	packages []*packages.Package
+	files    map[string]*packages.Package // Package of each file, by absolute path.
+	versions map[*document]int            // Versions of the loaded documents used.
+}
+
+// goTypes caches the type checked programs. The programs are loaded in the
+// background, from the local files only.
+//
+// Only accessed in the UI goroutine.
+type goTypes struct {
+	packages   map[string]*goProgram                // By root directory.
+	waiters    map[string][]func(*goProgram, error) // Loads in progress, by root directory.
+	generation int                                  // Incremented when the cache is invalidated.
+}
+
+func makeGoTypes() *goTypes {
+	return &goTypes{
+		packages: map[string]*goProgram{},
+		waiters:  map[string][]func(*goProgram, error){},
+	}
+}
+
+// invalidate forgets the programs loaded. It is called when a Go file is
+// saved or modified on disk, since it may be imported by other packages.
+func (g *goTypes) invalidate() {
+	g.packages = map[string]*goProgram{}
+	g.generation++
+}
+
+// goRoot returns the directory of the module containing dir, or dir itself
+// outside of a module.
+func goRoot(dir string) string {
+	if root, _ := goModule(dir); root != "" {
+		return root
+	}
+	return dir
+}
+
+// loadGoProgram parses and type checks the packages of the module at root
+// with their dependencies. overlay is the content of the loaded documents, by
+// absolute path.
+//
+// It is safe to call concurrently. The errors in the packages are ignored so
+// a package being edited is usable; the files are type checked as far as
+// possible.
+func loadGoProgram(root string, overlay map[string][]byte) (*goProgram, error) {
+	patterns := []string{"./..."}
+	if _, module := goModule(root); module == "" {
+		// Outside of a module, the files are listed explicitly.
+		names, err := filepath.Glob(filepath.Join(root, "*.go"))
+		if err != nil {
+			return nil, err
+		}
+		patterns = names
+	}
+	p := &goProgram{
+		root:  root,
+		fset:  token.NewFileSet(),
+		files: map[string]*packages.Package{},
+	}
+	conf := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedDeps | packages.NeedTypes | packages.NeedSyntax | packages.NeedTypesInfo,
+		Dir:  root,
+		Fset: p.fset,
+		// Only the local files and the module cache are used; nothing is
+		// downloaded.
+		Env:     append(os.Environ(), "GOPROXY=off", "GOFLAGS=-mod=mod"),
+		Tests:   true,
+		Overlay: overlay,
+	}
+	var err error
+	if p.packages, err = packages.Load(conf, patterns...); err != nil {
+		return nil, err
+	}
+	for _, pkg := range p.packages {
+		for _, f := range pkg.Syntax {
+			// The test variant of a package also contains its test files.
+			name := p.fset.File(f.Pos()).Name()
+			if p.files[name] == nil || strings.HasSuffix(pkg.ID, ".test]") {
+				p.files[name] = pkg
+			}
+		}
+	}
+	return p, nil
+}
+
+// stale returns true if a loaded document of the program was modified since
+// it was loaded.
+func (p *goProgram) stale(e *editor) bool {
+	for _, d := range e.goDocuments(p.root) {
+		if v, ok := p.versions[d]; (ok && v != d.version) || (!ok && d.isDirty) {
+			return true
+		}
+	}
+	return false
+}
+
+// goDocuments returns the loaded Go documents in the directory and its
+// subdirectories.
+func (e *editor) goDocuments(root string) []*document {
+	var out []*document
+	for _, d := range e.documents {
+		if d.closed || filepath.Ext(d.filePath) != ".go" {
+			continue
+		}
+		if abs, err := filepath.Abs(d.filePath); err == nil && strings.HasPrefix(abs, root+string(filepath.Separator)) {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// withGoProgram calls f in the UI goroutine with the type checked program of
+// the document, loading it in the background if it is not cached.
+func (e *editor) withGoProgram(d *document, f func(p *goProgram, err error)) {
+	if filepath.Ext(d.filePath) != ".go" {
+		f(nil, errors.New(noGoDocument.String()))
+		return
+	}
+	file, err := filepath.Abs(d.filePath)
+	if err != nil {
+		f(nil, err)
+		return
+	}
+	root := goRoot(filepath.Dir(file))
+	g := e.goTypes
+	if p := g.packages[root]; p != nil && p.files[file] != nil && !p.stale(e) {
+		f(p, nil)
+		return
+	}
+	g.waiters[root] = append(g.waiters[root], f)
+	if len(g.waiters[root]) != 1 {
+		// Already loading.
+		return
+	}
+	// The content of the documents is taken in the UI goroutine.
+	overlay := map[string][]byte{}
+	versions := map[*document]int{}
+	for _, doc := range e.goDocuments(root) {
+		abs, _ := filepath.Abs(doc.filePath)
+		overlay[abs] = []byte(strings.Join(doc.content, ""))
+		versions[doc] = doc.version
+	}
+	generation := g.generation
+	wicore.Go("goTypesLoad", func() {
+		p, err := loadGoProgram(root, overlay)
+		if err == nil {
+			p.versions = versions
+		}
+		e.post(nil, func() {
+			if err == nil && g.generation == generation {
+				g.packages[root] = p
+			}
+			waiters := g.waiters[root]
+			delete(g.waiters, root)
+			for _, w := range waiters {
+				w(p, err)
+			}
+		})
+	})
+}
+
+// offset returns the byte offset in the document of the line and the byte
+// offset col in this line.
+func (d *document) offset(line, col int) int {
+	o := 0
+	for _, l := range d.content[:line] {
+		o += len(l)
+	}
+	return o + col
+}
+
+// identAt returns the identifier at the byte offset of the file, or right
+// before it, and the package of the file.
+func (p *goProgram) identAt(file string, offset int) (*ast.Ident, *packages.Package) {
+	pkg := p.files[file]
+	if pkg == nil {
+		return nil, nil
+	}
+	var f *ast.File
+	for _, s := range pkg.Syntax {
+		if p.fset.File(s.Pos()).Name() == file {
+			f = s
+		}
+	}
+	if f == nil {
+		return nil, nil
+	}
+	tf := p.fset.File(f.Pos())
+	if offset > tf.Size() {
+		return nil, nil
+	}
+	pos := tf.Pos(offset)
+	var out *ast.Ident
+	ast.Inspect(f, func(n ast.Node) bool {
+		if n == nil || out != nil || n.Pos() > pos || n.End() < pos {
+			return false
+		}
+		if id, ok := n.(*ast.Ident); ok {
+			out = id
+		}
+		return true
+	})
+	return out, pkg
+}
+
+// objectAt returns the object referred to or defined by the identifier at
+// the cursor of the View.
+func (p *goProgram) objectAt(v *documentView) (*ast.Ident, types.Object, error) {
+	file, _ := filepath.Abs(v.document.filePath)
+	id, pkg := p.identAt(file, v.document.offset(v.CursorLine, v.CursorColumn))
+	if id == nil {
+		return nil, nil, errors.New(noIdentifier.String())
+	}
+	obj := pkg.TypesInfo.Uses[id]
+	if obj == nil {
+		obj = pkg.TypesInfo.Defs[id]
+	}
+	if obj == nil || !obj.Pos().IsValid() {
+		return nil, nil, errors.New(noDefinition.Sprintf(id.Name))
+	}
+	return id, obj, nil
+}
+
+// references returns the positions of the definition and the uses of the
+// object in all the packages of the program. The packages type checked more
+// than once, for their tests, have distinct objects for the same definition
+// so the objects are matched by their position.
+func (p *goProgram) references(obj types.Object) []token.Position {
+	want := p.fset.Position(obj.Pos())
+	seen := map[token.Position]bool{}
+	var refs []token.Position
+	for _, pkg := range p.packages {
+		if pkg.TypesInfo == nil {
+			continue
+		}
+		for _, m := range []map[*ast.Ident]types.Object{pkg.TypesInfo.Defs, pkg.TypesInfo.Uses} {
+			for i, o := range m {
+				if o == nil || o.Name() != obj.Name() || p.fset.Position(o.Pos()) != want {
+					continue
+				}
+				if pos := p.fset.Position(i.Pos()); !seen[pos] {
+					seen[pos] = true
+					refs = append(refs, pos)
+				}
+			}
+		}
+	}
+	return refs
+}
+
+// maxJumps is the number of positions remembered in the jump list.
+const maxJumps = 100
+
+// jump is a position recorded in the jump list.
+type jump struct {
+	document *document
+	line     int
+	col      int
+}
+
+// recordJump records the cursor of the most recently active documentView in
+// the jump list, before it jumps elsewhere. The positions after the current
+// one in the list are forgotten, like the history of a web browser.
+func (e *editor) recordJump() {
+	for _, w := range e.lastActive {
+		if v, ok := w.View().(*documentView); ok && v.document != nil {
+			e.jumps = append(e.jumps[:e.jumpIndex], jump{v.document, v.CursorLine, v.CursorColumn})
+			if len(e.jumps) > maxJumps {
+				e.jumps = e.jumps[len(e.jumps)-maxJumps:]
+			}
+			e.jumpIndex = len(e.jumps)
+			return
+		}
+	}
+}
+
+// moveInJumpList moves by delta positions in the jump list. The positions in
+// closed documents are skipped.
+func (e *editor) moveInJumpList(delta int) error {
+	if e.jumpIndex == len(e.jumps) && delta < 0 {
+		// Remember where the cursor is, to come back with jump_forward.
+		e.recordJump()
+		e.jumpIndex--
+	}
+	for i := e.jumpIndex + delta; i >= 0 && i < len(e.jumps); i += delta {
+		if j := e.jumps[i]; !j.document.closed {
+			e.jumpIndex = i
+			return e.showLocation(j.document, j.line, j.col)
+		}
+	}
+	if delta < 0 {
+		return errors.New(jumpListStart.String())
+	}
+	return errors.New(jumpListEnd.String())
+}
+
+// Commands.
+
+func cmdFindReferences(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	v, ok := w.view.(*documentView)
+	if !ok {
+		return nil, errors.New(noDocument.String())
+	}
+	e.withGoProgram(v.document, func(p *goProgram, err error) {
+		if err != nil {
+			e.alertOnError(err)
+			return
+		}
+		id, obj, err := p.objectAt(v)
+		if err != nil {
+			e.alertOnError(err)
+			return
+		}
+		refs := p.references(obj)
+		// w may have been closed while the package was loading.
+		e.alertOnError(e.pickLocations(referencesTitle.Sprintf(id.Name, len(refs)), refs))
+	})
+	return nil, nil
+}
+
+func cmdGotoDefinition(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	v, ok := w.view.(*documentView)
+	if !ok {
+		return nil, errors.New(noDocument.String())
+	}
+	e.withGoProgram(v.document, func(p *goProgram, err error) {
+		if err == nil {
+			var obj types.Object
+			if _, obj, err = p.objectAt(v); err == nil {
+				err = e.gotoLocation(location(p.fset.Position(obj.Pos())))
+			}
+		}
+		e.alertOnError(err)
+	})
+	return nil, nil
+}
+
+func cmdJumpBack(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	return nil, e.moveInJumpList(-1)
+}
+
+func cmdJumpForward(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	return nil, e.moveInJumpList(1)
+}
+
+// RegisterGoTypesCommands registers the commands to navigate the Go code
+// using the type information.
+func RegisterGoTypesCommands(dispatcher wicore.CommandsW) {
+	cmds := []wicore.Command{
+		&privilegedCommandImpl{
+			"find_references",
+			nil,
+			cmdFindReferences,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Lists the references to the identifier",
+			},
+			lang.Map{
+				lang.En: "Lists the uses of the Go identifier at the cursor in all the packages of its module, including their tests. Use Enter to jump to the selected reference. The packages are type checked in the background and cached until a Go file is saved or modified on disk.",
+			},
+		},
+		&privilegedCommandImpl{
+			"goto_definition",
+			nil,
+			cmdGotoDefinition,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Jumps to the definition of the identifier",
+			},
+			lang.Map{
+				lang.En: "Jumps to the definition of the Go identifier at the cursor, including in the imported packages. The position is recorded in the jump list. The packages are type checked in the background and cached until a Go file is saved or modified on disk.",
+			},
+		},
+		&privilegedCommandImpl{
+			"jump_back",
+			nil,
+			cmdJumpBack,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Goes back in the jump list",
+			},
+			lang.Map{
+				lang.En: "Moves the cursor back to where it was before the last jump, e.g. done with goto_definition or document_goto.",
+			},
+		},
+		&privilegedCommandImpl{
+			"jump_forward",
+			nil,
+			cmdJumpForward,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Goes forward in the jump list",
+			},
+			lang.Map{
+				lang.En: "Moves the cursor forward in the jump list, undoing jump_back.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+}
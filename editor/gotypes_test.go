@@ -0,0 +1,246 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/key"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestGoTypes(t *testing.T) {
+	defer keepLog(t)()
+
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	tmpDir, err = filepath.EvalSymlinks(tmpDir)
+	ut.AssertEqual(t, nil, err)
+	srcA := "package a\n\nimport \"strings\"\n\n// T is a type.\ntype T struct{}\n\nfunc (t T) M() string {\n\treturn strings.ToUpper(\"x\")\n}\n"
+	srcB := "package a\n\nfunc F() {\n\tvar t T\n\tt.M()\n\tt.M()\n}\n"
+	// Another package of the module uses the method.
+	srcC := "package c\n\nimport \"example.com/m/a\"\n\nfunc G() string {\n\treturn a.T{}.M()\n}\n"
+	ut.AssertEqual(t, nil, os.Mkdir(filepath.Join(tmpDir, "a"), 0700))
+	ut.AssertEqual(t, nil, os.Mkdir(filepath.Join(tmpDir, "c"), 0700))
+	ut.AssertEqual(t, nil, ioutil.WriteFile(filepath.Join(tmpDir, "go.mod"), []byte("module example.com/m\n\ngo 1.20\n"), 0600))
+	ut.AssertEqual(t, nil, ioutil.WriteFile(filepath.Join(tmpDir, "a", "a.go"), []byte(srcA), 0600))
+	ut.AssertEqual(t, nil, ioutil.WriteFile(filepath.Join(tmpDir, "a", "b.go"), []byte(srcB), 0600))
+	ut.AssertEqual(t, nil, ioutil.WriteFile(filepath.Join(tmpDir, "c", "c.go"), []byte(srcC), 0600))
+
+	ed, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+	var cursors []string
+	var errs []string
+	var refs [][]string
+	active := func(name string) func() bool {
+		return func() bool {
+			v, ok := e.ActiveWindow().View().(*documentView)
+			return ok && filepath.Base(v.document.filePath) == name
+		}
+	}
+	activeView := func() *documentView {
+		return e.ActiveWindow().View().(*documentView)
+	}
+	record := func() {
+		v := activeView()
+		name := filepath.Base(v.document.filePath)
+		if name == "strings.go" {
+			// The line depends on the Go version.
+			cursors = append(cursors, name+":"+strings.SplitN(v.document.content[v.CursorLine], "(", 2)[0])
+			return
+		}
+		cursors = append(cursors, fmt.Sprintf("%s:%d:%d", name, v.CursorLine, v.CursorColumn))
+	}
+	post := func(cmd string) {
+		wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+			if o.Err != nil {
+				errs = append(errs, o.Err.Error())
+			}
+		}, cmd)
+	}
+	picker := func() bool {
+		_, ok := e.ActiveWindow().View().(*pickerView)
+		return ok
+	}
+	recordRefs := func() {
+		var out []string
+		for _, m := range e.ActiveWindow().View().(*pickerView).matches {
+			out = append(out, m.item.Text)
+		}
+		sort.Strings(out)
+		refs = append(refs, out)
+		e.TriggerTerminalKeyPressed(key.Press{Key: key.Escape})
+	}
+	// Each step runs once the previous condition is met.
+	steps := []struct {
+		run   func()
+		until func() bool
+	}{
+		{
+			func() {
+				v := activeView()
+				v.CursorLine, v.CursorColumn = 4, 3
+				post("goto_definition")
+			},
+			active("a.go"),
+		},
+		{
+			func() {
+				record()
+				v := activeView()
+				v.CursorLine, v.CursorColumn = 8, 16
+				post("goto_definition")
+			},
+			active("strings.go"),
+		},
+		{
+			func() {
+				record()
+				post("jump_back")
+			},
+			active("a.go"),
+		},
+		{
+			func() {
+				record()
+				post("jump_back")
+			},
+			active("b.go"),
+		},
+		{
+			func() {
+				record()
+				post("jump_back")
+				post("jump_forward")
+			},
+			active("a.go"),
+		},
+		{
+			func() {
+				record()
+				post("jump_forward")
+			},
+			active("strings.go"),
+		},
+		{
+			func() {
+				record()
+				post("jump_forward")
+				post("jump_back")
+				post("jump_back")
+			},
+			active("b.go"),
+		},
+		{
+			func() {
+				record()
+				post("find_references")
+			},
+			picker,
+		},
+		{
+			recordRefs,
+			active("b.go"),
+		},
+		{
+			func() {
+				// The package is loaded again after an edit.
+				v := activeView()
+				v.CursorLine, v.CursorColumn = 0, 0
+				v.insertNewline()
+				v.CursorLine, v.CursorColumn = 5, 3
+				post("find_references")
+			},
+			picker,
+		},
+		{
+			recordRefs,
+			active("b.go"),
+		},
+		{
+			func() {
+				ut.AssertEqual(t, 1, len(e.goTypes.packages))
+				post("document_save")
+				wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+					ut.AssertEqual(t, 0, len(e.goTypes.packages))
+					// A Go file modified on disk also invalidates the cache.
+					generation := e.goTypes.generation
+					e.onDocumentChangedOnDisk(activeView().document)
+					ut.AssertEqual(t, generation+1, e.goTypes.generation)
+					wicore.PostCommand(e, nil, "q!")
+				}, "editor_redraw")
+			},
+			func() bool { return true },
+		},
+	}
+	step := 0
+	var wait func(o wicore.CommandOutcome)
+	wait = func(o wicore.CommandOutcome) {
+		if !steps[step].until() {
+			wicore.PostCommand(e, wait, "editor_redraw")
+			return
+		}
+		step++
+		steps[step].run()
+		if step < len(steps)-1 {
+			wicore.PostCommand(e, wait, "editor_redraw")
+		}
+	}
+	wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+		ut.AssertEqual(t, nil, o.Err)
+		steps[0].run()
+		wait(o)
+	}, "open", filepath.Join(tmpDir, "a", "b.go"))
+	ut.AssertEqual(t, 0, e.EventLoop())
+
+	expected := []string{"a.go:7:11", "strings.go:func ToUpper", "a.go:8:16", "b.go:4:3", "a.go:8:16", "strings.go:func ToUpper", "b.go:4:3"}
+	ut.AssertEqual(t, expected, cursors)
+	ut.AssertEqual(t, []string{"At the start of the jump list.", "At the end of the jump list."}, errs)
+	expectedRefs := [][]string{
+		{"a.go:8:12  func (t T) M() string {", "b.go:5:4  t.M()", "b.go:6:4  t.M()", "c.go:6:15"},
+		{"a.go:8:12  func (t T) M() string {", "b.go:6:4  t.M()", "b.go:7:4  t.M()", "c.go:6:15"},
+	}
+	ut.AssertEqual(t, expectedRefs, refs)
+}
+
+func TestGoTypesOffline(t *testing.T) {
+	defer keepLog(t)()
+
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	// The dependency is not in the module cache and must not be downloaded.
+	ut.AssertEqual(t, nil, ioutil.WriteFile(filepath.Join(tmpDir, "go.mod"), []byte("module example.com/m\n\ngo 1.20\n\nrequire example.com/missing v1.0.0\n"), 0600))
+	ut.AssertEqual(t, nil, ioutil.WriteFile(filepath.Join(tmpDir, "m.go"), []byte("package m\n\nimport _ \"example.com/missing\"\n"), 0600))
+	p, err := loadGoProgram(tmpDir, nil)
+	var errs []string
+	if err != nil {
+		errs = append(errs, err.Error())
+	} else {
+		packages.Visit(p.packages, nil, func(pkg *packages.Package) {
+			for _, e := range pkg.Errors {
+				errs = append(errs, e.Msg)
+			}
+		})
+	}
+	ut.AssertEqual(t, true, strings.Contains(strings.Join(errs, "\n"), "GOPROXY=off"))
+}
@@ -0,0 +1,306 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/colors"
+	"github.com/wi-ed/wi/wicore/lang"
+	"github.com/wi-ed/wi/wicore/raster"
+)
+
+// signColors are the colors a sign can be drawn with.
+var signColors = map[string]colors.RGB{
+	"blue":    colors.BrightBlue,
+	"cyan":    colors.BrightCyan,
+	"green":   colors.BrightGreen,
+	"magenta": colors.BrightMagenta,
+	"red":     colors.BrightRed,
+	"white":   colors.White,
+	"yellow":  colors.BrightYellow,
+}
+
+// sign is a marker shown in the gutter of a document, like a diagnostic, a
+// breakpoint or a VCS change.
+//
+// It is anchored to a line; the line is updated as lines are inserted or
+// removed before it.
+type sign struct {
+	id    int
+	group string // Owner of the sign, e.g. "diagnostics", so they can be cleared at once.
+	line  int    // 0-based.
+	text  string // At most 2 characters.
+	fg    colors.RGB
+}
+
+// fold is a range of lines that can be collapsed.
+type fold struct {
+	start  int // First line, 0-based; it stays visible when closed.
+	end    int // Last line, inclusive.
+	closed bool
+}
+
+// placeSign adds a sign to the document and returns its ID.
+func (e *editor) placeSign(d *document, group string, line int, text string, fg colors.RGB) int {
+	e.lastSign++
+	if r := []rune(text); len(r) > 2 {
+		text = string(r[:2])
+	}
+	d.signs = append(d.signs, &sign{e.lastSign, group, line, text, fg})
+	return e.lastSign
+}
+
+// removeSigns removes the signs of the document matching the ID, or all the
+// signs of the group if id is 0. An empty group matches all the groups.
+func (d *document) removeSigns(id int, group string) int {
+	removed := 0
+	signs := d.signs[:0]
+	for _, s := range d.signs {
+		if (id != 0 && s.id == id) || (id == 0 && (group == "" || s.group == group)) {
+			removed++
+			continue
+		}
+		signs = append(signs, s)
+	}
+	d.signs = signs
+	return removed
+}
+
+// gutter is the left margin of a documentView: the fold markers, the signs
+// and the line numbers, in this order.
+type gutter struct {
+	fold   bool
+	sign   bool
+	number string // Value of the "number" setting.
+	digits int    // Width of the line numbers.
+}
+
+// gutter returns the gutter to draw according to the settings.
+func (v *documentView) gutter() gutter {
+	g := gutter{number: v.e.GetSetting(v.window, "number")}
+	switch v.e.GetSetting(v.window, "foldcolumn") {
+	case "yes":
+		g.fold = true
+	case "auto":
+		g.fold = len(v.folds) != 0
+	}
+	switch v.e.GetSetting(v.window, "signcolumn") {
+	case "yes":
+		g.sign = true
+	case "auto":
+		g.sign = len(v.document.signs) != 0
+	}
+	if g.number != "off" {
+		g.digits = len(strconv.Itoa(len(v.document.content)))
+	}
+	return g
+}
+
+// width returns the number of columns used by the gutter.
+func (g gutter) width() int {
+	w := 0
+	if g.fold {
+		w++
+	}
+	if g.sign {
+		w += 2
+	}
+	if g.number != "off" {
+		w += g.digits + 1
+	}
+	return w
+}
+
+// foldMarker returns the fold column character of the line.
+func (v *documentView) foldMarker(line int) rune {
+	out := ' '
+	for _, f := range v.folds {
+		switch {
+		case f.start == line && f.closed:
+			return '+'
+		case f.start == line:
+			out = '-'
+		case out == ' ' && line > f.start && line <= f.end:
+			out = '|'
+		}
+	}
+	return out
+}
+
+// draw draws the gutter for the rows. The continuation of wrapped lines is
+// left blank.
+func (g gutter) draw(buffer *raster.Buffer, v *documentView, rows []screenRow) {
+	base := v.DefaultFormat()
+	dim := base
+	dim.Fg = colors.DarkGray
+	signs := map[int]*sign{}
+	for _, s := range v.document.signs {
+		// The most recent sign wins.
+		if o := signs[s.line]; o == nil || o.id < s.id {
+			signs[s.line] = s
+		}
+	}
+	for row, r := range rows {
+		if r.wrapped {
+			continue
+		}
+		line := r.line
+		x := 0
+		if g.fold {
+			*buffer.Cell(x, row) = raster.Cell{R: v.foldMarker(line), F: dim}
+			x++
+		}
+		if g.sign {
+			if s := signs[line]; s != nil {
+				f := base
+				f.Fg = s.fg
+				buffer.DrawString(s.text, x, row, f)
+			}
+			x += 2
+		}
+		if g.number == "off" {
+			continue
+		}
+		n := line + 1
+		f := dim
+		if line == v.CursorLine {
+			f = base
+			if g.number == "relative" {
+				n = 0
+			}
+		} else if g.number == "relative" || g.number == "hybrid" {
+			n = line - v.CursorLine
+			if n < 0 {
+				n = -n
+			}
+		}
+		buffer.DrawString(fmt.Sprintf("%*d", g.digits, n), x, row, f)
+	}
+}
+
+// documentByRef returns the loaded document referred to by its ID, as
+// returned by Document.ID(), or by its path.
+func (e *editor) documentByRef(ref string) *document {
+	if strings.HasPrefix(ref, "document:") {
+		d := e.documents[ref[len("document:"):]]
+		if d != nil && !d.closed {
+			return d
+		}
+		return nil
+	}
+	return e.findDocument(ref)
+}
+
+// Commands.
+
+func cmdSignClear(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	d := e.documentByRef(args.String(0))
+	if d == nil {
+		return nil, errors.New(documentNotFound.Sprintf(args.String(0)))
+	}
+	n := d.removeSigns(0, args.String(1))
+	wicore.PostCommand(e, nil, "editor_redraw")
+	return wicore.CommandResult{strconv.Itoa(n)}, nil
+}
+
+func cmdSignPlace(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	d := e.documentByRef(args.String(0))
+	if d == nil {
+		return nil, errors.New(documentNotFound.Sprintf(args.String(0)))
+	}
+	line := args.Int(2)
+	if line < 1 || line > len(d.content) {
+		return nil, errors.New(invalidLine.Sprintf(line))
+	}
+	text := args.String(3)
+	if text == "" || raster.StringWidth(text) > 2 {
+		return nil, errors.New(invalidSign.Sprintf(text))
+	}
+	fg := colors.BrightRed
+	if args.Has(4) {
+		var ok bool
+		if fg, ok = signColors[args.String(4)]; !ok {
+			return nil, errors.New(invalidColor.Sprintf(args.String(4)))
+		}
+	}
+	id := e.placeSign(d, args.String(1), line-1, text, fg)
+	wicore.PostCommand(e, nil, "editor_redraw")
+	return wicore.CommandResult{strconv.Itoa(id)}, nil
+}
+
+func cmdSignRemove(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	d := e.documentByRef(args.String(0))
+	if d == nil {
+		return nil, errors.New(documentNotFound.Sprintf(args.String(0)))
+	}
+	if d.removeSigns(args.Int(1), "") == 0 {
+		return nil, errors.New(signNotFound.Sprintf(args.Int(1)))
+	}
+	wicore.PostCommand(e, nil, "editor_redraw")
+	return nil, nil
+}
+
+// RegisterGutterCommands registers the commands to manage the signs shown in
+// the gutter of the documents.
+func RegisterGutterCommands(dispatcher wicore.CommandsW) {
+	cmds := []wicore.Command{
+		&privilegedCommandImpl{
+			"sign_clear",
+			wicore.CommandArgs{
+				{Name: "document", Type: wicore.ArgString},
+				{Name: "group", Type: wicore.ArgString, Optional: true},
+			},
+			cmdSignClear,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Removes signs",
+			},
+			lang.Map{
+				lang.En: "Removes all the signs of the group, or all the signs if no group is specified, from the document. The document is specified by its ID or its path. Returns the number of signs removed.",
+			},
+		},
+		&privilegedCommandImpl{
+			"sign_place",
+			wicore.CommandArgs{
+				{Name: "document", Type: wicore.ArgString},
+				{Name: "group", Type: wicore.ArgString},
+				{Name: "line", Type: wicore.ArgInt},
+				{Name: "text", Type: wicore.ArgString},
+				{Name: "color", Type: wicore.ArgString, Optional: true},
+			},
+			cmdSignPlace,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Places a sign in the gutter",
+			},
+			lang.Map{
+				lang.En: "Places a sign of one or two characters in the gutter of the document, on the 1-based line. The document is specified by its ID or its path. The group, e.g. 'breakpoints', allows to clear the signs of a plugin at once. The sign stays on the same text as lines are inserted or removed. The color is one of blue, cyan, green, magenta, red, white or yellow. Returns the ID of the sign.",
+			},
+		},
+		&privilegedCommandImpl{
+			"sign_remove",
+			wicore.CommandArgs{
+				{Name: "document", Type: wicore.ArgString},
+				{Name: "id", Type: wicore.ArgInt},
+			},
+			cmdSignRemove,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Removes a sign",
+			},
+			lang.Map{
+				lang.En: "Removes the sign with this ID, as returned by sign_place, from the document.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+}
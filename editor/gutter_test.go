@@ -0,0 +1,103 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/key"
+)
+
+func TestGutter(t *testing.T) {
+	defer keepLog(t)()
+
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	path := filepath.Join(tmpDir, "a.txt")
+	content := ""
+	for i := 0; i < 10; i++ {
+		content += fmt.Sprintf("l%d\n", i)
+	}
+	ut.AssertEqual(t, nil, ioutil.WriteFile(path, []byte(content), 0600))
+
+	ed, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+	var v *documentView
+	lines := func(n int) []string {
+		b := v.Buffer()
+		out := make([]string, n)
+		for i := range out {
+			out[i] = strings.TrimRight(string(b.Line(i).Runes()), " ")
+		}
+		return out
+	}
+	var screens [][]string
+	var results []wicore.CommandResult
+	snapshot := func(o wicore.CommandOutcome) {
+		ut.AssertEqual(t, nil, o.Err)
+		if v == nil {
+			v = e.ActiveWindow().View().(*documentView)
+		}
+		if o.Result != nil {
+			results = append(results, o.Result)
+		}
+		screens = append(screens, lines(3))
+	}
+	wicore.PostCommand(e, snapshot, "open", path)
+	wicore.PostCommand(e, snapshot, "set", "global", "number", "absolute")
+	wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+		snapshot(o)
+		// A line typed before the sign moves it.
+		for _, c := range "new" {
+			e.TriggerTerminalKeyPressed(key.Press{Ch: c})
+		}
+		e.TriggerTerminalKeyPressed(key.Press{Key: key.Enter})
+		wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+			snapshot(o)
+			wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+				snapshot(o)
+				// Splitting the line at its start moves its sign with the text.
+				e.TriggerTerminalMetaKeyPressed(key.Press{Key: key.Up})
+				e.TriggerTerminalKeyPressed(key.Press{Key: key.Enter})
+				wicore.PostCommand(e, snapshot, "editor_redraw")
+				wicore.PostCommand(e, snapshot, "sign_clear", path, "test")
+				wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+					ut.AssertEqual(t, "There is no sign 1.", o.Err.Error())
+					v.folds = []fold{{0, 2, false}}
+					wicore.PostCommand(e, snapshot, "set", "global", "number", "relative")
+					wicore.PostCommand(e, nil, "q!")
+				}, "sign_remove", path, "1")
+			}, "sign_place", path, "test", "1", "W", "yellow")
+		}, "set", "global", "number", "hybrid")
+	}, "sign_place", path, "test", "2", "E", "red")
+	ut.AssertEqual(t, 0, e.EventLoop())
+
+	expected := [][]string{
+		{"l0", "l1", "l2"},
+		{" 1 l0", " 2 l1", " 3 l2"},
+		{"   1 l0", "E  2 l1", "   3 l2"},
+		{"   1 new", "   2 l0", "E  1 l1"},
+		{"W  1 new", "   2 l0", "E  1 l1"},
+		{"   1", "W  2 new", "   1 l0"},
+		{" 1", " 2 new", " 1 l0"},
+		{"- 1", "| 0 new", "| 1 l0"},
+	}
+	ut.AssertEqual(t, expected, screens)
+	ut.AssertEqual(t, []wicore.CommandResult{{"1"}, {"2"}, {"2"}}, results)
+}
@@ -0,0 +1,466 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/colors"
+	"github.com/wi-ed/wi/wicore/key"
+	"github.com/wi-ed/wi/wicore/lang"
+	"github.com/wi-ed/wi/wicore/raster"
+)
+
+// helpEntry is the documentation of a single command as seen from a Window.
+type helpEntry struct {
+	name      string
+	category  wicore.CommandCategory
+	usage     string
+	shortDesc string
+	longDesc  string
+	keys      []string
+}
+
+// matches returns true if the query is found in the name or the descriptions.
+func (h *helpEntry) matches(query string) bool {
+	query = strings.ToLower(query)
+	for _, s := range []string{h.name, h.shortDesc, h.longDesc} {
+		if strings.Contains(strings.ToLower(s), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// categoryNames are the section titles of the help.
+var categoryNames = map[wicore.CommandCategory]lang.Map{
+	wicore.UnknownCategory:  helpCategoryUnknown,
+	wicore.WindowCategory:   helpCategoryWindow,
+	wicore.CommandsCategory: helpCategoryCommands,
+	wicore.EditorCategory:   helpCategoryEditor,
+	wicore.DebugCategory:    helpCategoryDebug,
+}
+
+func categoryName(c wicore.CommandCategory) string {
+	if m, ok := categoryNames[c]; ok {
+		return m.String()
+	}
+	return c.String()
+}
+
+// getCommandKeys returns the keys bound to each command as seen from the
+// Window w. A key bound in a child Window hides the same key bound in a parent
+// Window.
+func getCommandKeys(w wicore.Window) map[string][]string {
+	out := map[string][]string{}
+	for _, mode := range []wicore.KeyboardMode{wicore.Normal, wicore.Insert} {
+		seen := map[key.Press]bool{}
+		for c := w; c != nil; c = c.Parent() {
+			bindings := c.View().KeyBindings()
+			for _, k := range bindings.GetAssigned(mode) {
+				if seen[k] {
+					continue
+				}
+				seen[k] = true
+				cmdName := bindings.Get(mode, k)
+				name := k.String()
+				if mode == wicore.Insert {
+					if bindings.Get(wicore.Normal, k) == cmdName {
+						// Already listed as a Normal mode binding.
+						continue
+					}
+					name = helpInsertKey.Sprintf(name)
+				}
+				out[cmdName] = append(out[cmdName], name)
+			}
+		}
+	}
+	for _, keys := range out {
+		sort.Strings(keys)
+	}
+	return out
+}
+
+// getHelpEntries returns the help for all the commands reachable from the
+// Window w, sorted by category then by name.
+func getHelpEntries(e wicore.Editor, w wicore.Window) []helpEntry {
+	keys := getCommandKeys(w)
+	names := wicore.GetCommandNames(e, w)
+	out := make([]helpEntry, 0, len(names))
+	for _, name := range names {
+		cmd := wicore.GetCommand(e, w, name)
+		out = append(out, helpEntry{
+			name:      name,
+			category:  cmd.Category(e, w),
+			usage:     cmd.Args().Usage(name),
+			shortDesc: cmd.ShortDesc(),
+			longDesc:  cmd.LongDesc(),
+			keys:      keys[name],
+		})
+	}
+	sort.Sort(helpEntries(out))
+	return out
+}
+
+// helpEntries sorts by category then by name.
+type helpEntries []helpEntry
+
+func (h helpEntries) Len() int      { return len(h) }
+func (h helpEntries) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h helpEntries) Less(i, j int) bool {
+	if h[i].category != h[j].category {
+		return h[i].category < h[j].category
+	}
+	return h[i].name < h[j].name
+}
+
+// wrapText splits text in lines of at most width characters, breaking at
+// whitespace when possible.
+func wrapText(text string, width int) []string {
+	if width <= 0 {
+		return []string{text}
+	}
+	out := []string{}
+	line := ""
+	for _, word := range strings.Fields(text) {
+		for len([]rune(word)) > width {
+			if line != "" {
+				out = append(out, line)
+				line = ""
+			}
+			r := []rune(word)
+			out = append(out, string(r[:width]))
+			word = string(r[width:])
+		}
+		if line == "" {
+			line = word
+		} else if len([]rune(line))+1+len([]rune(word)) <= width {
+			line += " " + word
+		} else {
+			out = append(out, line)
+			line = word
+		}
+	}
+	return append(out, line)
+}
+
+// helpIndexText returns the text of the help index, optionally filtered by
+// query.
+func helpIndexText(entries []helpEntry, query string) []string {
+	out := []string{}
+	if query != "" {
+		out = append(out, helpSearchResults.Sprintf(query), "")
+	}
+	const noCategory = wicore.CommandCategory(-1)
+	last := noCategory
+	for i := range entries {
+		h := &entries[i]
+		if query != "" && !h.matches(query) {
+			continue
+		}
+		if h.category != last {
+			if last != noCategory {
+				out = append(out, "")
+			}
+			out = append(out, categoryName(h.category))
+			last = h.category
+		}
+		line := fmt.Sprintf("  %-24s %s", h.name, h.shortDesc)
+		if len(h.keys) != 0 {
+			line += " (" + strings.Join(h.keys, ", ") + ")"
+		}
+		out = append(out, line)
+	}
+	if last == noCategory {
+		out = append(out, helpNoMatch.String())
+	}
+	return out
+}
+
+// helpCommandText returns the detailed help of a single command.
+func helpCommandText(h *helpEntry, width int) []string {
+	out := []string{h.usage, "", categoryName(h.category), ""}
+	out = append(out, wrapText(h.longDesc, width)...)
+	if len(h.keys) != 0 {
+		out = append(out, "", helpKeys.Sprintf(strings.Join(h.keys, ", ")))
+	}
+	return out
+}
+
+// helpView shows the auto-generated help about the commands reachable from
+// the parent Window.
+type helpView struct {
+	view
+	e       wicore.Editor
+	command string // Command to show the details of. When empty, the index is shown.
+	query   string // Search query to filter the index.
+	offset  int    // Number of lines scrolled.
+}
+
+// context returns the Window the help is about.
+func (v *helpView) context() wicore.Window {
+	if v.window == nil {
+		return v.e.ActiveWindow()
+	}
+	if p := v.window.Parent(); p != nil {
+		return p
+	}
+	return v.window
+}
+
+func (v *helpView) text() []string {
+	entries := getHelpEntries(v.e, v.context())
+	if v.command != "" {
+		for i := range entries {
+			if entries[i].name == v.command {
+				return helpCommandText(&entries[i], v.actualX)
+			}
+		}
+		return []string{notFound.Sprintf(v.command)}
+	}
+	return helpIndexText(entries, v.query)
+}
+
+func (v *helpView) Buffer() *raster.Buffer {
+	v.buffer.Fill(raster.Cell{R: ' ', F: v.DefaultFormat()})
+	lines := v.text()
+	if v.offset > len(lines)-1 {
+		v.offset = len(lines) - 1
+	}
+	if v.offset < 0 {
+		v.offset = 0
+	}
+	for i, line := range lines[v.offset:] {
+		if i >= v.actualY {
+			break
+		}
+		v.buffer.DrawString(line, 0, i, v.DefaultFormat())
+	}
+	return v.buffer
+}
+
+func (v *helpView) onTerminalKeyPressed(k key.Press) {
+	if v.window == nil || v.e.ActiveWindow() != v.window {
+		return
+	}
+	switch k.Ch {
+	case '/':
+		// Search within the help, via the command window.
+		wicore.PostCommand(v.e, nil, "window_new", v.window.ID(), "floating", "command", "help_search ")
+	case 'q':
+		wicore.PostCommand(v.e, nil, "window_close", v.window.ID())
+	}
+}
+
+func cmdToHelp(handler func(v *helpView, e wicore.EditorW, w wicore.Window, args wicore.ArgValues)) wicore.CommandImplHandler {
+	return func(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
+		v, ok := w.View().(*helpView)
+		if !ok {
+			return nil, errors.New("internal error")
+		}
+		handler(v, e, w, args)
+		wicore.PostCommand(e, nil, "editor_redraw")
+		return nil, nil
+	}
+}
+
+func cmdHelpClose(v *helpView, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) {
+	wicore.PostCommand(e, nil, "window_close", w.ID())
+}
+
+func cmdHelpScrollDown(v *helpView, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) {
+	v.offset++
+}
+
+func cmdHelpScrollUp(v *helpView, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) {
+	if v.offset > 0 {
+		v.offset--
+	}
+}
+
+func cmdHelpSearch(v *helpView, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) {
+	v.command = ""
+	v.query = strings.Join(args.Strings(0), " ")
+	v.offset = 0
+}
+
+// helpViewFactory returns the help index. If an argument is specified, the
+// help of this command is shown instead.
+func helpViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
+	dispatcher := makeCommands()
+	cmds := []wicore.Command{
+		&wicore.CommandImpl{
+			"help_close",
+			nil,
+			cmdToHelp(cmdHelpClose),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Closes the help",
+			},
+			lang.Map{
+				lang.En: "Closes the help window.",
+			},
+		},
+		&wicore.CommandImpl{
+			"help_scroll_down",
+			nil,
+			cmdToHelp(cmdHelpScrollDown),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Scrolls the help down",
+			},
+			lang.Map{
+				lang.En: "Scrolls the help down by one line.",
+			},
+		},
+		&wicore.CommandImpl{
+			"help_scroll_up",
+			nil,
+			cmdToHelp(cmdHelpScrollUp),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Scrolls the help up",
+			},
+			lang.Map{
+				lang.En: "Scrolls the help up by one line.",
+			},
+		},
+		&wicore.CommandImpl{
+			"help_search",
+			wicore.CommandArgs{{Name: "query", Type: wicore.ArgString, Optional: true, Variadic: true}},
+			cmdToHelp(cmdHelpSearch),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Searches the help",
+			},
+			lang.Map{
+				lang.En: "Lists only the commands where the query is found in the name or in the description. Use without argument to list all the commands again.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+	bindings := makeKeyBindings()
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Escape}, "help_close")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Down}, "help_scroll_down")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Up}, "help_scroll_up")
+
+	title := helpTitle.String()
+	command := ""
+	if len(args) != 0 {
+		command = args[0]
+		title += ": " + command
+	}
+	v := &helpView{
+		view{
+			commands:      dispatcher,
+			keyBindings:   bindings,
+			eventRegistry: e,
+			id:            id,
+			title:         title,
+			naturalX:      78,
+			naturalY:      22,
+			defaultFormat: raster.CellFormat{Fg: colors.White, Bg: colors.Blue},
+		},
+		e,
+		command,
+		"",
+		0,
+	}
+	v.events = append(v.events, e.RegisterTerminalKeyPressed(v.onTerminalKeyPressed))
+	return v
+}
+
+// Commands.
+
+func cmdHelp(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	viewArgs := []string{w.ID(), "floating", "help"}
+	if args.Has(0) {
+		cmdName := args.String(0)
+		if wicore.GetCommand(e, w, cmdName) == nil {
+			return nil, errors.New(notFound.Sprintf(cmdName))
+		}
+		viewArgs = append(viewArgs, cmdName)
+	}
+	return e.ExecuteCommand(w, "window_new", viewArgs...)
+}
+
+// RegisterHelpCommands registers the commands to browse the help.
+func RegisterHelpCommands(dispatcher wicore.CommandsW) {
+	cmds := []wicore.Command{
+		&wicore.CommandImpl{
+			"help",
+			wicore.CommandArgs{{Name: "command", Type: wicore.ArgString, Optional: true}},
+			cmdHelp,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Shows the help",
+			},
+			lang.Map{
+				lang.En: "Shows the list of the commands available in the current window, grouped by category, with their key bindings. When a command name is specified, shows the detailed help of this command instead. Type '/' in the help window to search.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+}
+
+// ExportHelp returns the help for all the commands registered at the root
+// Window in the requested format. Supported formats are "markdown" and "man".
+func ExportHelp(e wicore.Editor, format string) (string, error) {
+	entries := getHelpEntries(e, wicore.RootWindow(e.ActiveWindow()))
+	switch format {
+	case "markdown":
+		return helpMarkdown(entries), nil
+	case "man":
+		return helpMan(entries), nil
+	default:
+		return "", fmt.Errorf(helpUnknownFormat.String(), format)
+	}
+}
+
+func helpMarkdown(entries []helpEntry) string {
+	out := "# " + helpTitle.String() + "\n"
+	for i, h := range entries {
+		if i == 0 || h.category != entries[i-1].category {
+			out += "\n## " + categoryName(h.category) + "\n"
+		}
+		out += fmt.Sprintf("\n### `%s`\n\n%s\n", h.usage, h.longDesc)
+		if len(h.keys) != 0 {
+			out += "\n" + helpKeys.Sprintf("`"+strings.Join(h.keys, "`, `")+"`") + "\n"
+		}
+	}
+	return out
+}
+
+// manEscape escapes text for roff.
+func manEscape(s string) string {
+	s = strings.Replace(s, "\\", "\\e", -1)
+	s = strings.Replace(s, "-", "\\-", -1)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = "\\&" + s
+	}
+	return s
+}
+
+func helpMan(entries []helpEntry) string {
+	out := ".TH WI 1\n.SH NAME\nwi \\- right after vi\n.SH COMMANDS\n"
+	for i, h := range entries {
+		if i == 0 || h.category != entries[i-1].category {
+			out += ".SS " + manEscape(categoryName(h.category)) + "\n"
+		}
+		out += ".TP\n.B " + manEscape(h.usage) + "\n" + manEscape(h.longDesc) + "\n"
+		if len(h.keys) != 0 {
+			out += ".br\n" + manEscape(helpKeys.Sprintf(strings.Join(h.keys, ", "))) + "\n"
+		}
+	}
+	return out
+}
@@ -0,0 +1,51 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+)
+
+func TestHelp(t *testing.T) {
+	defer keepLog(t)()
+
+	terminal := NewTerminalFake(80, 25, []TerminalEvent{})
+	editor, err := MakeEditor(terminal, true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = editor.Close()
+	}()
+
+	md, err := ExportHelp(editor, "markdown")
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, true, strings.Contains(md, "\n## Windows\n"))
+	ut.AssertEqual(t, true, strings.Contains(md, "\n### `help [command]`\n"))
+	ut.AssertEqual(t, true, strings.Contains(md, "Keys: `F1`"))
+	man, err := ExportHelp(editor, "man")
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, true, strings.Contains(man, ".B editor_quit [safe|force] [exit_code]\n"))
+	_, err = ExportHelp(editor, "pdf")
+	ut.AssertEqual(t, false, err == nil)
+
+	entries := getHelpEntries(editor, editor.ActiveWindow())
+	lines := helpIndexText(entries, "QUIT")
+	ut.AssertEqual(t, "Commands matching \"QUIT\":", lines[0])
+	ut.AssertEqual(t, "Editor", lines[2])
+	ut.AssertEqual(t, "  editor_quit              Quits", lines[3])
+	ut.AssertEqual(t, []string{"No command matches."}, helpIndexText(entries, "nothing matches this")[2:])
+
+	wicore.PostCommand(editor, nil, "help", "invalid")
+	wicore.PostCommand(editor, nil, "help", "editor_quit")
+	wicore.PostCommand(editor, nil, "editor_redraw")
+	wicore.PostCommand(editor, nil, "editor_quit")
+	ut.AssertEqual(t, 0, editor.EventLoop())
+
+	ut.AssertEqual(t, "Help: editor_quit", editor.ActiveWindow().View().Title())
+	ut.AssertEqual(t, "editor_quit [safe|force] [exit_code]", strings.TrimSpace(string(terminal.Buffer.Line(1).Runes()[1:79])))
+}
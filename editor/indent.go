@@ -0,0 +1,296 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/colors"
+	"github.com/wi-ed/wi/wicore/raster"
+)
+
+const (
+	// defaultTabstop is used when the "tabstop" setting is not usable, e.g. by
+	// document.RenderInto() which doesn't know the View.
+	defaultTabstop = 8
+	// maxDetectedIndent is the largest indentation width detected.
+	maxDetectedIndent = 8
+)
+
+// whitespace describes how the whitespace is drawn.
+type whitespace struct {
+	tabstop  int
+	tab      [2]rune // First cell of a tab and the cells filling it; 0 to draw nothing.
+	trail    rune    // Trailing spaces; 0 to draw nothing.
+	nbsp     rune    // Non-breaking spaces; 0 to draw them as spaces.
+	markerFg colors.RGB
+}
+
+// parseListchars parses the "listchars" setting, a comma separated list of
+// kind:characters. Unknown kinds are ignored.
+func parseListchars(s string) whitespace {
+	var ws whitespace
+	for _, item := range strings.Split(s, ",") {
+		i := strings.IndexByte(item, ':')
+		if i == -1 {
+			continue
+		}
+		r := []rune(item[i+1:])
+		if len(r) == 0 {
+			continue
+		}
+		switch item[:i] {
+		case "tab":
+			ws.tab[0] = r[0]
+			ws.tab[1] = r[0]
+			if len(r) > 1 {
+				ws.tab[1] = r[1]
+			}
+		case "trail":
+			ws.trail = r[0]
+		case "nbsp":
+			ws.nbsp = r[0]
+		}
+	}
+	return ws
+}
+
+// tabstop returns the number of cells between tab stops.
+func (v *documentView) tabstop() int {
+	if n, _ := strconv.Atoi(v.e.GetSetting(v.window, "tabstop")); n > 0 {
+		return n
+	}
+	return defaultTabstop
+}
+
+// shiftwidth returns the number of cells of an indentation level.
+func (v *documentView) shiftwidth() int {
+	if n, _ := strconv.Atoi(v.e.GetSetting(v.window, "shiftwidth")); n > 0 {
+		return n
+	}
+	return v.tabstop()
+}
+
+// whitespace returns how the whitespace is drawn according to the settings.
+func (v *documentView) whitespace() whitespace {
+	var ws whitespace
+	if v.e.GetSetting(v.window, "list") == "true" {
+		ws = parseListchars(v.e.GetSetting(v.window, "listchars"))
+	}
+	ws.tabstop = v.tabstop()
+	ws.markerFg = colors.DarkGray
+	return ws
+}
+
+// indentation returns the leading whitespace of the line.
+func indentation(l string) string {
+	return l[:len(l)-len(strings.TrimLeft(l, " \t"))]
+}
+
+// makeIndent returns the whitespace to indent up to the cell width.
+func (v *documentView) makeIndent(width int) string {
+	if v.e.GetSetting(v.window, "expandtab") == "true" {
+		return strings.Repeat(" ", width)
+	}
+	ts := v.tabstop()
+	return strings.Repeat("\t", width/ts) + strings.Repeat(" ", width%ts)
+}
+
+// insert inserts s at the cursor.
+func (v *documentView) insert(s string) {
+	l := v.document.content[v.CursorLine]
+	v.document.content[v.CursorLine] = l[:v.CursorColumn] + s + l[v.CursorColumn:]
+	v.document.isDirty = true
+	v.e.(*editor).documentEdited(v.document, v.CursorLine, v.CursorColumn, v.CursorLine, v.CursorColumn+len(s))
+	v.CursorColumn += len(s)
+	v.updateColumnMax()
+}
+
+// insertNewline splits the line at the cursor. With "autoindent", the new
+// line is indented like the current one.
+func (v *documentView) insertNewline() {
+	l := v.document.content[v.CursorLine]
+	indent := ""
+	rest := l[v.CursorColumn:]
+	newCol := 0
+	if v.e.GetSetting(v.window, "autoindent") == "true" {
+		indent = indentation(l[:v.CursorColumn])
+		trimmed := strings.TrimLeft(rest, " \t")
+		newCol = len(indent) - (len(rest) - len(trimmed))
+		rest = indent + trimmed
+	}
+	content := make([]string, 0, len(v.document.content)+1)
+	content = append(content, v.document.content[:v.CursorLine]...)
+	content = append(content, l[:v.CursorColumn]+"\n", rest)
+	content = append(content, v.document.content[v.CursorLine+1:]...)
+	v.document.content = content
+	v.document.isDirty = true
+	v.e.(*editor).documentEdited(v.document, v.CursorLine, v.CursorColumn, v.CursorLine+1, newCol)
+	v.CursorLine++
+	v.CursorColumn = len(indent)
+	v.updateColumnMax()
+}
+
+// insertTab inserts a tab, or spaces up to the next indentation level with
+// "expandtab".
+func (v *documentView) insertTab() {
+	if v.e.GetSetting(v.window, "expandtab") != "true" {
+		v.insert("\t")
+		return
+	}
+	sw := v.shiftwidth()
+	x := displayColumn(v.document.content[v.CursorLine], v.CursorColumn, v.tabstop())
+	v.insert(strings.Repeat(" ", sw-x%sw))
+}
+
+// shiftLine changes the indentation of the line by levels indentation levels,
+// keeping the cursor on the same character.
+func (v *documentView) shiftLine(line, levels int) {
+	l := v.document.content[line]
+	if strings.TrimSpace(l) == "" {
+		return
+	}
+	old := indentation(l)
+	ts := v.tabstop()
+	sw := v.shiftwidth()
+	width := displayColumn(old, len(old), ts)
+	// Round to the indentation level, like vim's shiftround.
+	if levels > 0 {
+		width = (width/sw + levels) * sw
+	} else {
+		width = ((width+sw-1)/sw + levels) * sw
+	}
+	if width < 0 {
+		width = 0
+	}
+	indent := v.makeIndent(width)
+	if indent == old {
+		return
+	}
+	v.document.content[line] = indent + l[len(old):]
+	v.document.isDirty = true
+	v.e.(*editor).documentEdited(v.document, line, len(old), line, len(indent))
+	if line == v.CursorLine {
+		if v.CursorColumn < len(old) {
+			v.CursorColumn = 0
+		} else {
+			v.CursorColumn += len(indent) - len(old)
+		}
+		v.updateColumnMax()
+	}
+}
+
+// detectIndent guesses the indentation style of the content: tabs, or the
+// number of spaces per level. The more frequent style wins; the width is the
+// most frequent indentation change between two consecutive lines indented
+// with spaces. It returns false if there is not enough indented lines.
+func detectIndent(content []string) (bool, int, bool) {
+	tabs := 0
+	spaces := 0
+	deltas := [maxDetectedIndent + 1]int{}
+	prev := 0
+	for _, l := range content {
+		trimmed := strings.TrimLeft(l, " \t")
+		if trimmed == "" || trimmed == "\n" || trimmed == "\r\n" {
+			continue
+		}
+		if l[0] == '\t' {
+			tabs++
+			prev = -1
+			continue
+		}
+		n := len(l) - len(strings.TrimLeft(l, " "))
+		if strings.HasPrefix(trimmed, "*") {
+			// Continuation of a C style block comment, aligned with a space.
+			continue
+		}
+		if n != 0 {
+			spaces++
+		}
+		if prev != -1 {
+			d := n - prev
+			if d < 0 {
+				d = -d
+			}
+			if d > 0 && d <= maxDetectedIndent {
+				deltas[d]++
+			}
+		}
+		prev = n
+	}
+	if tabs == 0 && spaces == 0 {
+		return false, 0, false
+	}
+	if tabs >= spaces {
+		return false, 0, true
+	}
+	width := 0
+	for d := 1; d <= maxDetectedIndent; d++ {
+		if deltas[d] > deltas[width] {
+			width = d
+		}
+	}
+	if width == 0 {
+		return false, 0, false
+	}
+	return true, width, true
+}
+
+// detectDocumentIndent sets the indentation settings of the document as
+// detected from its content.
+func (e *editor) detectDocumentIndent(d *document) {
+	expandtab, width, ok := detectIndent(d.content)
+	if !ok {
+		return
+	}
+	e.settings.set(d.ID(), "expandtab", strconv.FormatBool(expandtab))
+	if expandtab {
+		e.settings.set(d.ID(), "shiftwidth", strconv.Itoa(width))
+	}
+}
+
+// draw draws the whitespace grapheme cluster c at x with the markers of ws
+// and returns true, or returns false if c is to be drawn as regular text.
+// width is the number of cells of c and trailing is true if c is part of the
+// trailing whitespace.
+func (ws *whitespace) draw(buffer *raster.Buffer, c string, x, y, width int, trailing bool, f raster.CellFormat) bool {
+	marker := f
+	marker.Fg = ws.markerFg
+	switch {
+	case c == "\t":
+		if ws.tab[0] != 0 {
+			*buffer.Cell(x, y) = raster.Cell{R: ws.tab[0], F: marker}
+			for i := 1; i < width; i++ {
+				*buffer.Cell(x+i, y) = raster.Cell{R: ws.tab[1], F: marker}
+			}
+		}
+		return true
+	case c == "\u00a0":
+		r := ws.nbsp
+		if r == 0 {
+			r = ' '
+		}
+		*buffer.Cell(x, y) = raster.Cell{R: r, F: marker}
+		return true
+	case c == " " && trailing && ws.trail != 0:
+		*buffer.Cell(x, y) = raster.Cell{R: ws.trail, F: marker}
+		return true
+	}
+	return false
+}
+
+// Commands.
+
+func cmdDocumentIndent(v *documentView, e wicore.EditorW) {
+	v.shiftLine(v.CursorLine, 1)
+	v.cursorMoved(e)
+}
+
+func cmdDocumentDedent(v *documentView, e wicore.EditorW) {
+	v.shiftLine(v.CursorLine, -1)
+	v.cursorMoved(e)
+}
@@ -0,0 +1,110 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/key"
+)
+
+func TestDetectIndent(t *testing.T) {
+	data := []struct {
+		content   string
+		expandtab bool
+		width     int
+		ok        bool
+	}{
+		{"a\nb\n", false, 0, false},
+		{"a\n\tb\n\t\tc\n", false, 0, true},
+		{"a\n  b\n    c\n  d\n", true, 2, true},
+		{"a\n    b\n        c\n\n    d\n", true, 4, true},
+		{"/*\n * a\n */\nb\n   c\n", true, 3, true},
+		{"a\n\tb\n  c\n\td\n", false, 0, true},
+	}
+	for i, d := range data {
+		content := strings.SplitAfter(d.content, "\n")
+		expandtab, width, ok := detectIndent(content)
+		ut.AssertEqualIndex(t, i, d.expandtab, expandtab)
+		ut.AssertEqualIndex(t, i, d.width, width)
+		ut.AssertEqualIndex(t, i, d.ok, ok)
+	}
+}
+
+func TestIndent(t *testing.T) {
+	defer keepLog(t)()
+
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	path := filepath.Join(tmpDir, "a.go")
+	ut.AssertEqual(t, nil, ioutil.WriteFile(path, []byte("func f() {\n  if x {\n    y\n  }\n}\n"), 0600))
+
+	ed, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+	var v *documentView
+	var lines []string
+	var screens []string
+	snapshot := func(o wicore.CommandOutcome) {
+		ut.AssertEqual(t, nil, o.Err)
+		lines = append(lines, fmt.Sprintf("%d:%d %q", v.CursorLine, v.CursorColumn, v.document.content[v.CursorLine]))
+		screens = append(screens, strings.TrimRight(string(v.Buffer().Line(v.CursorLine).Runes()), " "))
+	}
+	wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+		v = e.ActiveWindow().View().(*documentView)
+		v.SetSize(20, 10)
+		ut.AssertEqual(t, "true", e.GetSetting(v.window, "expandtab"))
+		ut.AssertEqual(t, "2", e.GetSetting(v.window, "shiftwidth"))
+		v.CursorLine = 2
+		v.CursorColumn = 5
+		e.TriggerTerminalKeyPressed(key.Press{Key: key.Enter})
+		e.TriggerTerminalKeyPressed(key.Press{Key: key.Tab})
+		e.TriggerTerminalKeyPressed(key.Press{Ch: 'z'})
+		wicore.PostCommand(e, snapshot, "document_dedent")
+		wicore.PostCommand(e, snapshot, "document_dedent")
+		wicore.PostCommand(e, snapshot, "document_indent")
+		wicore.PostCommand(e, nil, "set", "document", "expandtab", "false")
+		wicore.PostCommand(e, nil, "set", "document", "tabstop", "4")
+		wicore.PostCommand(e, snapshot, "document_indent")
+		wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+			e.TriggerTerminalKeyPressed(key.Press{Key: key.Tab})
+			e.TriggerTerminalKeyPressed(key.Press{Ch: ' '})
+			e.TriggerTerminalKeyPressed(key.Press{Ch: ' '})
+			wicore.PostCommand(e, snapshot, "set", "global", "list", "true")
+			wicore.PostCommand(e, nil, "q!")
+		}, "document_cursor_home")
+	}, "open", path)
+	ut.AssertEqual(t, 0, e.EventLoop())
+
+	expectedLines := []string{
+		`3:5 "    z\n"`,
+		`3:3 "  z\n"`,
+		`3:5 "    z\n"`,
+		`3:4 "\t  z\n"`,
+		`0:3 "\t  func f() {\n"`,
+	}
+	ut.AssertEqual(t, expectedLines, lines)
+	expectedScreens := []string{
+		"    z",
+		"  z",
+		"    z",
+		"      z",
+		"»     func f() {",
+	}
+	ut.AssertEqual(t, expectedScreens, screens)
+}
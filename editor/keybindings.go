@@ -5,6 +5,8 @@
 package editor
 
 import (
+	"errors"
+
 	"github.com/wi-ed/wi/wicore"
 	"github.com/wi-ed/wi/wicore/key"
 	"github.com/wi-ed/wi/wicore/lang"
@@ -69,41 +71,29 @@ func makeKeyBindings() wicore.KeyBindingsW {
 
 // Commands.
 
-func cmdKeyBind(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args ...string) {
-	location := args[0]
-	modeName := args[1]
-	keyName := args[2]
-	cmdName := args[3]
-
-	if location == "global" {
+func cmdKeyBind(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	if args.String(0) == "global" {
 		w = wicore.RootWindow(w)
-	} else if location != "window" {
-		cmd := wicore.GetCommand(e, w, "key_bind")
-		e.ExecuteCommand(w, "alert", cmd.LongDesc())
-		return
 	}
 
 	var mode wicore.KeyboardMode
-	if modeName == "command" {
+	switch args.String(1) {
+	case "command":
 		mode = wicore.Normal
-	} else if modeName == "edit" {
+	case "edit":
 		mode = wicore.Normal
-	} else if modeName == "all" {
+	case "all":
 		mode = wicore.AllMode
-	} else {
-		cmd := wicore.GetCommand(e, w, "key_bind")
-		e.ExecuteCommand(w, "alert", cmd.LongDesc())
-		return
 	}
-	// TODO(maruel): Refuse invalid keyName.
-	k := key.StringToPress(keyName)
+	k := args.Key(2)
+	cmdName := args.String(3)
 	// TODO(maruel): Handle views in different process?
 	viewW, ok := w.View().(wicore.ViewW)
 	if !ok {
-		e.ExecuteCommand(w, "alert", "internal failure")
-		return
+		return nil, errors.New("internal failure")
 	}
 	viewW.KeyBindingsW().Set(mode, k, cmdName)
+	return nil, nil
 }
 
 // RegisterKeyBindingCommands registers the keyboard mapping related commands.
@@ -111,14 +101,19 @@ func RegisterKeyBindingCommands(dispatcher wicore.CommandsW) {
 	cmds := []wicore.Command{
 		&wicore.CommandImpl{
 			"key_bind",
-			4,
+			wicore.CommandArgs{
+				{Name: "scope", Type: wicore.ArgEnum, Values: []string{"window", "global"}},
+				{Name: "mode", Type: wicore.ArgEnum, Values: []string{"command", "edit", "all"}},
+				{Name: "key", Type: wicore.ArgKey},
+				{Name: "command", Type: wicore.ArgString},
+			},
 			cmdKeyBind,
 			wicore.CommandsCategory,
 			lang.Map{
 				lang.En: "Binds a keyboard mapping to a command",
 			},
 			lang.Map{
-				lang.En: "Usage: key_bind [window|global] [command|edit|all] <key> <command>\nBinds a keyboard mapping to a command. The binding can be to the active view for view-specific key binding or to the root view for global key bindings.",
+				lang.En: "Binds a keyboard mapping to a command. The binding can be to the active view for view-specific key binding or to the root view for global key bindings.",
 			},
 		},
 	}
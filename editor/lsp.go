@@ -0,0 +1,1205 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/lang"
+)
+
+// lspLanguageIDs are the LSP language identifiers of the FileTypes.
+var lspLanguageIDs = map[wicore.FileType]string{
+	wicore.CodeCCHeader:   "c",
+	wicore.CodeCCSource:   "c",
+	wicore.CodeCCPPHeader: "cpp",
+	wicore.CodeCCPPSource: "cpp",
+	wicore.CodeGo:         "go",
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"` // In UTF-16 code units.
+}
+
+// clamp returns the position with a negative line or character moved to 0.
+func (p lspPosition) clamp() lspPosition {
+	if p.Line < 0 {
+		p.Line = 0
+	}
+	if p.Character < 0 {
+		p.Character = 0
+	}
+	return p
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+// lspLocation is either a Location or a LocationLink.
+type lspLocation struct {
+	URI                  string   `json:"uri"`
+	Range                lspRange `json:"range"`
+	TargetURI            string   `json:"targetUri"`
+	TargetSelectionRange lspRange `json:"targetSelectionRange"`
+}
+
+type lspTextEdit struct {
+	Range   lspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+type lspWorkspaceEdit struct {
+	Changes         map[string][]lspTextEdit `json:"changes"`
+	DocumentChanges []struct {
+		TextDocument struct {
+			URI string `json:"uri"`
+		} `json:"textDocument"`
+		Edits []lspTextEdit `json:"edits"`
+	} `json:"documentChanges"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspCompletionItem struct {
+	Label      string `json:"label"`
+	Detail     string `json:"detail"`
+	InsertText string `json:"insertText"`
+}
+
+type lspResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (l *lspResponseError) Error() string {
+	return fmt.Sprintf("%s (%d)", l.Message, l.Code)
+}
+
+// lspMessage is a JSON-RPC 2.0 request, response or notification.
+type lspMessage struct {
+	JSONRPC string            `json:"jsonrpc"`
+	ID      json.RawMessage   `json:"id,omitempty"`
+	Method  string            `json:"method,omitempty"`
+	Params  json.RawMessage   `json:"params,omitempty"`
+	Result  json.RawMessage   `json:"result,omitempty"`
+	Error   *lspResponseError `json:"error,omitempty"`
+}
+
+// writeLSPMessage writes the message preceded by its Content-Length header.
+func writeLSPMessage(w io.Writer, m *lspMessage) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(b), b)
+	return err
+}
+
+// maxLSPMessage is the largest message accepted from a language server.
+const maxLSPMessage = 64 << 20
+
+// readLSPMessage reads a message and its headers.
+func readLSPMessage(r *bufio.Reader) (*lspMessage, error) {
+	length := -1
+	for {
+		l, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		l = strings.TrimSpace(l)
+		if l == "" {
+			break
+		}
+		if i := strings.IndexByte(l, ':'); i != -1 && strings.EqualFold(l[:i], "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(l[i+1:])); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("missing Content-Length header")
+	}
+	if length > maxLSPMessage {
+		return nil, fmt.Errorf("message of %d bytes is too large", length)
+	}
+	b := make([]byte, length)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	m := &lspMessage{}
+	return m, json.Unmarshal(b, m)
+}
+
+// fileURI returns the file:// URI of the path.
+func fileURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	p := filepath.ToSlash(path)
+	if !strings.HasPrefix(p, "/") {
+		// Windows drive letter.
+		p = "/" + p
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
+
+// uriPath returns the path of the file:// URI.
+func uriPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("unsupported URI %q", uri)
+	}
+	p := u.Path
+	if len(p) > 2 && p[0] == '/' && p[2] == ':' {
+		// Windows drive letter.
+		p = p[1:]
+	}
+	return filepath.FromSlash(p), nil
+}
+
+// utf16Column returns the column in UTF-16 code units of the byte offset col
+// of the line.
+func utf16Column(l string, col int) int {
+	if col > len(l) {
+		col = len(l)
+	}
+	n := 0
+	for _, r := range l[:col] {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// byteColumn returns the byte offset of the column in UTF-16 code units of
+// the line. It stops at the line terminator.
+func byteColumn(l string, col int) int {
+	t := lineText(l)
+	n := 0
+	for i, r := range t {
+		if n >= col {
+			return i
+		}
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return len(t)
+}
+
+// lspOffset returns the byte offset in the document of the position. A
+// position outside of the document is clamped to it.
+func (d *document) lspOffset(pos lspPosition) int {
+	pos = pos.clamp()
+	if pos.Line >= len(d.content) {
+		return d.offset(len(d.content), 0)
+	}
+	return d.offset(pos.Line, byteColumn(d.content[pos.Line], pos.Character))
+}
+
+// isWordRune returns true for the runes of an identifier.
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// wordAt returns the byte offsets of the identifier at the byte offset col of
+// the line, or right before it.
+func wordAt(l string, col int) (int, int) {
+	start := col
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(l[:start])
+		if !isWordRune(r) {
+			break
+		}
+		start -= size
+	}
+	end := col
+	for end < len(l) {
+		r, size := utf8.DecodeRuneInString(l[end:])
+		if !isWordRune(r) {
+			break
+		}
+		end += size
+	}
+	return start, end
+}
+
+// lspMarkup returns the text of a MarkupContent, a MarkedString or a list of
+// MarkedString.
+func lspMarkup(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var m struct {
+		Value string `json:"value"`
+	}
+	if json.Unmarshal(raw, &m) == nil && m.Value != "" {
+		return m.Value
+	}
+	var l []json.RawMessage
+	if json.Unmarshal(raw, &l) == nil {
+		parts := make([]string, 0, len(l))
+		for _, i := range l {
+			if t := lspMarkup(i); t != "" {
+				parts = append(parts, t)
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+	return ""
+}
+
+// lspServer is a language server process for a FileType. It speaks JSON-RPC
+// over its stdin and stdout.
+//
+// Like a plugin, the server is out of process. It is quarantined once it
+// fails; configuring it again with lsp_server restarts it.
+type lspServer struct {
+	e        *editor
+	fileType wicore.FileType
+	proc     *os.Process
+	out      chan []byte // Messages to write to stdin, in order.
+	closed   chan struct{}
+
+	// Only accessed in the UI goroutine.
+	nextID   int
+	pending  map[int]func(result json.RawMessage, err error)
+	ready    bool              // The initialize request completed.
+	queue    [][]byte          // Messages sent before being ready.
+	versions map[*document]int // Documents opened on the server and the version sent.
+	err      error             // Set once the server failed.
+}
+
+func (s *lspServer) String() string {
+	if s.proc == nil {
+		return fmt.Sprintf("LSP(%s)", s.fileType)
+	}
+	return fmt.Sprintf("LSP(%s, %d)", s.fileType, s.proc.Pid)
+}
+
+// startLSPServer starts the language server and sends the initialize request.
+func startLSPServer(e *editor, fileType wicore.FileType, cmdLine []string) (*lspServer, error) {
+	cmd := exec.Command(cmdLine[0], cmdLine[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	s := &lspServer{
+		e:        e,
+		fileType: fileType,
+		proc:     cmd.Process,
+		// The server is quarantined once the buffer is full, e.g. if it
+		// stops reading its stdin.
+		out:      make(chan []byte, 1024),
+		closed:   make(chan struct{}),
+		pending:  map[int]func(json.RawMessage, error){},
+		versions: map[*document]int{},
+	}
+	log.Printf("%s started: %s", s, cmdLine)
+	wicore.Go("lspWriter", func() {
+		for b := range s.out {
+			if _, err := stdin.Write(b); err != nil {
+				s.e.post(s.closed, func() { s.fail(err) })
+				break
+			}
+		}
+		_ = stdin.Close()
+	})
+	wicore.Go("lspReader", func() {
+		r := bufio.NewReader(stdout)
+		for {
+			m, err := readLSPMessage(r)
+			if err != nil {
+				s.e.post(s.closed, func() { s.fail(err) })
+				return
+			}
+			if !s.e.post(s.closed, func() { s.handle(m) }) {
+				return
+			}
+		}
+	})
+	wicore.Go("lspStderr", func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			log.Printf("%s: %s", s, scanner.Text())
+		}
+	})
+
+	root, _ := os.Getwd()
+	params := map[string]interface{}{
+		"processId": os.Getpid(),
+		"rootUri":   fileURI(root),
+		"capabilities": map[string]interface{}{
+			"textDocument": map[string]interface{}{
+				"synchronization":    map[string]interface{}{"didSave": true},
+				"hover":              map[string]interface{}{"contentFormat": []string{"plaintext", "markdown"}},
+				"publishDiagnostics": map[string]interface{}{},
+			},
+			"workspace": map[string]interface{}{"workspaceEdit": map[string]interface{}{"documentChanges": true}},
+		},
+	}
+	s.send(s.makeRequest("initialize", params, func(result json.RawMessage, err error) {
+		if err != nil {
+			s.fail(err)
+			return
+		}
+		s.ready = true
+		s.send(s.makeNotification("initialized", struct{}{}), true)
+		for _, b := range s.queue {
+			s.send(b, true)
+		}
+		s.queue = nil
+	}), true)
+	return s, nil
+}
+
+// fail quarantines the server and fails the pending requests.
+func (s *lspServer) fail(err error) {
+	if s.err != nil {
+		return
+	}
+	s.err = fmt.Errorf("%s failed: %s", s, err)
+	log.Print(s.err)
+	pending := s.pending
+	s.pending = map[int]func(json.RawMessage, error){}
+	for _, f := range pending {
+		f(nil, s.err)
+	}
+}
+
+func (s *lspServer) encode(m *lspMessage) []byte {
+	m.JSONRPC = "2.0"
+	b := &bytes.Buffer{}
+	if err := writeLSPMessage(b, m); err != nil {
+		// All the parameters are marshallable.
+		panic(err)
+	}
+	return b.Bytes()
+}
+
+func (s *lspServer) makeRequest(method string, params interface{}, f func(result json.RawMessage, err error)) []byte {
+	p, _ := json.Marshal(params)
+	s.nextID++
+	s.pending[s.nextID] = f
+	return s.encode(&lspMessage{ID: json.RawMessage(strconv.Itoa(s.nextID)), Method: method, Params: p})
+}
+
+func (s *lspServer) makeNotification(method string, params interface{}) []byte {
+	p, _ := json.Marshal(params)
+	return s.encode(&lspMessage{Method: method, Params: p})
+}
+
+// send writes the message. Until the server is initialized, the messages are
+// queued unless now is true.
+func (s *lspServer) send(b []byte, now bool) {
+	select {
+	case <-s.closed:
+		return
+	default:
+	}
+	if !s.ready && !now {
+		s.queue = append(s.queue, b)
+		return
+	}
+	select {
+	case s.out <- b:
+	default:
+		// The UI goroutine must not block on a server not reading its stdin.
+		s.fail(errors.New("the server is not reading its input"))
+	}
+}
+
+// request sends a request; f is called in the UI goroutine with the result.
+func (s *lspServer) request(method string, params interface{}, f func(result json.RawMessage, err error)) {
+	if s.err != nil {
+		f(nil, s.err)
+		return
+	}
+	s.send(s.makeRequest(method, params, f), false)
+}
+
+func (s *lspServer) notify(method string, params interface{}) {
+	if s.err == nil {
+		s.send(s.makeNotification(method, params), false)
+	}
+}
+
+// handle processes a message received from the server.
+func (s *lspServer) handle(m *lspMessage) {
+	if m.Method == "" {
+		id, _ := strconv.Atoi(string(m.ID))
+		f := s.pending[id]
+		if f == nil {
+			return
+		}
+		delete(s.pending, id)
+		if m.Error != nil {
+			f(nil, m.Error)
+		} else {
+			f(m.Result, nil)
+		}
+		return
+	}
+	if len(m.ID) != 0 {
+		// A request from the server, e.g. workspace/configuration. None is
+		// supported; a null result is the default for most.
+		s.send(s.encode(&lspMessage{ID: m.ID, Result: json.RawMessage("null")}), true)
+		return
+	}
+	switch m.Method {
+	case "textDocument/publishDiagnostics":
+		s.e.onLSPDiagnostics(s, m.Params)
+	case "window/showMessage":
+		var p struct {
+			Type    int    `json:"type"`
+			Message string `json:"message"`
+		}
+		// Only the errors and the warnings are shown.
+		if json.Unmarshal(m.Params, &p) == nil && p.Type <= 2 {
+			s.e.alertOnError(errors.New(p.Message))
+		}
+	case "window/logMessage":
+		log.Printf("%s: %s", s, m.Params)
+	}
+}
+
+func textDocument(d *document) map[string]interface{} {
+	return map[string]interface{}{"uri": fileURI(d.filePath)}
+}
+
+// sync opens the document on the server or sends its content if it changed.
+func (s *lspServer) sync(d *document) {
+	if d.filePath == "" || d.closed {
+		return
+	}
+	v, ok := s.versions[d]
+	if ok && v == d.version {
+		return
+	}
+	s.versions[d] = d.version
+	text := strings.Join(d.content, "")
+	if !ok {
+		languageID := lspLanguageIDs[s.fileType]
+		if languageID == "" {
+			languageID = strings.ToLower(filepath.Ext(d.filePath))
+		}
+		s.notify("textDocument/didOpen", map[string]interface{}{
+			"textDocument": map[string]interface{}{
+				"uri":        fileURI(d.filePath),
+				"languageId": languageID,
+				"version":    d.version,
+				"text":       text,
+			},
+		})
+		return
+	}
+	s.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": fileURI(d.filePath), "version": d.version},
+		"contentChanges": []map[string]interface{}{{"text": text}},
+	})
+}
+
+// didSave tells the server the document was saved.
+func (s *lspServer) didSave(d *document) {
+	s.sync(d)
+	if _, ok := s.versions[d]; ok {
+		s.notify("textDocument/didSave", map[string]interface{}{"textDocument": textDocument(d)})
+	}
+}
+
+// didClose tells the server the document is not loaded anymore.
+func (s *lspServer) didClose(d *document) {
+	if _, ok := s.versions[d]; ok {
+		delete(s.versions, d)
+		s.notify("textDocument/didClose", map[string]interface{}{"textDocument": textDocument(d)})
+	}
+}
+
+// Close asks the server to exit, then kills it if it doesn't.
+func (s *lspServer) Close() error {
+	if s.proc == nil {
+		return nil
+	}
+	select {
+	case <-s.closed:
+		return nil
+	default:
+	}
+	if s.err == nil {
+		s.send(s.makeRequest("shutdown", nil, func(json.RawMessage, error) {}), true)
+		s.send(s.makeNotification("exit", nil), true)
+	}
+	// The writer closes stdin once the messages are written, which also tells
+	// the server to exit.
+	close(s.out)
+	close(s.closed)
+	err := stopProcess(s.proc, time.Second)
+	log.Printf("%s.Close()", s)
+	return err
+}
+
+// lspServers holds the language servers, by FileType.
+type lspServers struct {
+	commands map[wicore.FileType][]string
+	servers  map[wicore.FileType]*lspServer
+}
+
+func makeLSPServers() *lspServers {
+	return &lspServers{
+		commands: map[wicore.FileType][]string{},
+		servers:  map[wicore.FileType]*lspServer{},
+	}
+}
+
+func (l *lspServers) Close() error {
+	var err error
+	for ft, s := range l.servers {
+		if err2 := s.Close(); err2 != nil {
+			err = err2
+		}
+		delete(l.servers, ft)
+	}
+	return err
+}
+
+// lspServer returns the language server of the document, starting it as
+// needed. The documents of its FileType already loaded are opened on it.
+func (e *editor) lspServer(d *document) (*lspServer, error) {
+	ft := d.FileType()
+	if s := e.lsp.servers[ft]; s != nil {
+		return s, s.err
+	}
+	cmdLine := e.lsp.commands[ft]
+	if cmdLine == nil {
+		return nil, errors.New(noLanguageServer.Sprintf(ft))
+	}
+	s, err := startLSPServer(e, ft, cmdLine)
+	if err != nil {
+		// Keep the failure to not start it again on each event.
+		s = &lspServer{e: e, fileType: ft, err: fmt.Errorf("LSP(%s) failed to start: %s", ft, err)}
+		log.Print(s.err)
+	}
+	e.lsp.servers[ft] = s
+	if s.err == nil {
+		for _, o := range e.sortedDocuments() {
+			if o.FileType() == ft {
+				s.sync(o)
+			}
+		}
+	}
+	return s, s.err
+}
+
+// lspSync sends the content of the document to its language server, if one
+// is configured.
+func (e *editor) lspSync(d *document) {
+	if _, ok := e.lsp.commands[d.FileType()]; !ok || d.filePath == "" {
+		return
+	}
+	if s, err := e.lspServer(d); err == nil {
+		s.sync(d)
+	}
+}
+
+// lspDidSave tells the language server of the document it was saved.
+func (e *editor) lspDidSave(d *document) {
+	if s := e.lsp.servers[d.FileType()]; s != nil && s.err == nil {
+		s.didSave(d)
+	}
+}
+
+// lspDidClose tells the language servers the document was closed.
+func (e *editor) lspDidClose(d *document) {
+	for _, s := range e.lsp.servers {
+		if s.err == nil {
+			s.didClose(d)
+		}
+	}
+}
+
+func (e *editor) onLSPDocumentCreated(doc wicore.Document) {
+	if d, ok := doc.(*document); ok {
+		e.lspSync(d)
+	}
+}
+
+func (e *editor) onLSPDocumentCursorMoved(doc wicore.Document, col, line int) {
+	if d, ok := doc.(*document); ok {
+		e.lspSync(d)
+	}
+}
+
+// lspSource returns the source of the diagnostics of the language server of
+// the FileType.
+func lspSource(ft wicore.FileType) string {
+	return "lsp:" + string(ft)
+}
+
+// onLSPDiagnostics publishes the diagnostics sent by a language server.
+func (e *editor) onLSPDiagnostics(s *lspServer, params json.RawMessage) {
+	var p struct {
+		URI         string          `json:"uri"`
+		Diagnostics []lspDiagnostic `json:"diagnostics"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		log.Printf("Invalid diagnostics: %s", err)
+		return
+	}
+	path, err := uriPath(p.URI)
+	if err != nil {
+		return
+	}
+	lines := e.fileLines(path)
+	column := func(pos lspPosition) int {
+		if pos = pos.clamp(); pos.Line < len(lines) {
+			return byteColumn(lines[pos.Line], pos.Character)
+		}
+		return 0
+	}
+	diags := make([]*diagnostic, 0, len(p.Diagnostics))
+	for _, d := range p.Diagnostics {
+		sev := severity(d.Severity)
+		if sev < severityError || sev > severityHint {
+			sev = severityError
+		}
+		msg := d.Message
+		if d.Source != "" {
+			msg = d.Source + ": " + msg
+		}
+		start, end := d.Range.Start.clamp(), d.Range.End.clamp()
+		diags = append(diags, &diagnostic{"", sev, start.Line, column(start), end.Line, column(end), msg})
+	}
+	e.publishDiagnostics(path, lspSource(s.fileType), diags)
+}
+
+// fileLines returns the lines of the file, from the loaded document if any.
+func (e *editor) fileLines(path string) []string {
+	if d := e.findDocument(path); d != nil {
+		return d.content
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return splitLines(string(b))
+}
+
+// lspToPosition converts a position sent by a language server.
+func (e *editor) lspToPosition(uri string, pos lspPosition) (token.Position, error) {
+	path, err := uriPath(uri)
+	if err != nil {
+		return token.Position{}, err
+	}
+	pos = pos.clamp()
+	col := 0
+	if lines := e.fileLines(path); pos.Line < len(lines) {
+		col = byteColumn(lines[pos.Line], pos.Character)
+	}
+	return token.Position{Filename: path, Line: pos.Line + 1, Column: col + 1}, nil
+}
+
+// lspLocations decodes a Location, a list of Location or a list of
+// LocationLink as positions.
+func (e *editor) lspLocations(result json.RawMessage) ([]token.Position, error) {
+	var locs []lspLocation
+	var one lspLocation
+	if err := json.Unmarshal(result, &locs); err != nil {
+		if err := json.Unmarshal(result, &one); err != nil {
+			return nil, err
+		}
+		locs = []lspLocation{one}
+	}
+	out := make([]token.Position, 0, len(locs))
+	for _, l := range locs {
+		uri, pos := l.URI, l.Range.Start
+		if l.TargetURI != "" {
+			uri, pos = l.TargetURI, l.TargetSelectionRange.Start
+		}
+		if uri == "" {
+			continue
+		}
+		p, err := e.lspToPosition(uri, pos)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// lspEdit is a text edit converted to byte offsets.
+type lspEdit struct {
+	start int
+	end   int
+	text  string
+}
+
+// lspEditsByStart sorts the edits by their start, keeping the order of the
+// edits inserting at the same offset.
+type lspEditsByStart []lspEdit
+
+func (l lspEditsByStart) Len() int           { return len(l) }
+func (l lspEditsByStart) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l lspEditsByStart) Less(i, j int) bool { return l[i].start < l[j].start }
+
+// lspEdits converts the edits sent by a language server for the document,
+// sorted by their start. It returns an error if a range ends before its start
+// or if two ranges overlap.
+func (d *document) lspEdits(edits []lspTextEdit) (lspEditsByStart, error) {
+	converted := make(lspEditsByStart, 0, len(edits))
+	for _, t := range edits {
+		c := lspEdit{d.lspOffset(t.Range.Start), d.lspOffset(t.Range.End), t.NewText}
+		if c.end < c.start {
+			return nil, errors.New(lspInvalidEdits.String())
+		}
+		converted = append(converted, c)
+	}
+	sort.Stable(converted)
+	for i := 1; i < len(converted); i++ {
+		if converted[i].start < converted[i-1].end {
+			return nil, errors.New(lspInvalidEdits.String())
+		}
+	}
+	return converted, nil
+}
+
+// applyTextEdits applies the edits sent by a language server to the document.
+// All the ranges refer to the content before the edits. Nothing is applied if
+// the edits are invalid.
+func (e *editor) applyTextEdits(d *document, edits []lspTextEdit) error {
+	converted, err := d.lspEdits(edits)
+	if err != nil || len(converted) == 0 {
+		return err
+	}
+	text := strings.Join(d.content, "")
+	for i := len(converted) - 1; i >= 0; i-- {
+		c := converted[i]
+		text = text[:c.start] + c.text + text[c.end:]
+	}
+	d.isDirty = true
+	e.replaceContent(d, splitLines(text))
+	for _, v := range e.documentViews(d) {
+		if v.CursorLine >= len(d.content) {
+			v.CursorLine = len(d.content) - 1
+		}
+		if last := lastColumn(d.content[v.CursorLine]); v.CursorColumn > last {
+			v.CursorColumn = last
+		}
+		v.CursorColumn = prevColumn(d.content[v.CursorLine], nextColumn(d.content[v.CursorLine], v.CursorColumn))
+		v.updateColumnMax()
+		v.cursorMoved(e)
+	}
+	return nil
+}
+
+// applyWorkspaceEdit applies the edits to the documents, loading the ones not
+// loaded yet. Nothing is applied if the edits of a document are invalid.
+func (e *editor) applyWorkspaceEdit(result json.RawMessage) error {
+	var edit lspWorkspaceEdit
+	if err := json.Unmarshal(result, &edit); err != nil {
+		return err
+	}
+	changes := map[string][]lspTextEdit{}
+	for uri, edits := range edit.Changes {
+		changes[uri] = append(changes[uri], edits...)
+	}
+	for _, c := range edit.DocumentChanges {
+		changes[c.TextDocument.URI] = append(changes[c.TextDocument.URI], c.Edits...)
+	}
+	if len(changes) == 0 {
+		return errors.New(lspNoResult.String())
+	}
+	docs := map[*document][]lspTextEdit{}
+	for uri, edits := range changes {
+		path, err := uriPath(uri)
+		if err != nil {
+			return err
+		}
+		d, err := e.openDocument(path)
+		if err != nil {
+			return err
+		}
+		if _, err := d.lspEdits(edits); err != nil {
+			return err
+		}
+		docs[d] = edits
+	}
+	for d, edits := range docs {
+		if err := e.applyTextEdits(d, edits); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lspRequest sends a request about the document of the Window, at its cursor
+// if atCursor is true. f is called with the result in the UI goroutine; its
+// error is alerted.
+func (e *editor) lspRequest(w *window, method string, atCursor bool, extra map[string]interface{}, f func(v *documentView, result json.RawMessage) error) error {
+	v, ok := w.view.(*documentView)
+	if !ok {
+		return errors.New(noDocument.String())
+	}
+	s, err := e.lspServer(v.document)
+	if err != nil {
+		return err
+	}
+	s.sync(v.document)
+	params := map[string]interface{}{"textDocument": textDocument(v.document)}
+	if atCursor {
+		params["position"] = lspPosition{v.CursorLine, utf16Column(v.document.content[v.CursorLine], v.CursorColumn)}
+	}
+	for k, x := range extra {
+		params[k] = x
+	}
+	s.request(method, params, func(result json.RawMessage, err error) {
+		if err == nil {
+			err = f(v, result)
+		}
+		e.alertOnError(err)
+		wicore.PostCommand(e, nil, "editor_redraw")
+	})
+	return nil
+}
+
+// cursorWord returns the identifier at the cursor of the View.
+func (v *documentView) cursorWord() string {
+	l := v.document.content[v.CursorLine]
+	start, end := wordAt(l, v.CursorColumn)
+	return l[start:end]
+}
+
+// Commands.
+
+func cmdLSPCompletion(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	return nil, e.lspRequest(w, "textDocument/completion", true, nil, func(v *documentView, result json.RawMessage) error {
+		var list struct {
+			Items []lspCompletionItem `json:"items"`
+		}
+		if err := json.Unmarshal(result, &list.Items); err != nil {
+			if err := json.Unmarshal(result, &list); err != nil {
+				return err
+			}
+		}
+		if len(list.Items) == 0 {
+			return errors.New(lspNoResult.String())
+		}
+		items := make([]pickerItem, 0, len(list.Items))
+		for _, i := range list.Items {
+			text := i.Label
+			if i.Detail != "" {
+				text += "  " + i.Detail
+			}
+			insert := i.InsertText
+			if insert == "" {
+				insert = i.Label
+			}
+			items = append(items, pickerItem{text, insert})
+		}
+		if _, err := e.ExecuteCommand(e.rootWindow, "window_new", e.rootWindow.ID(), "floating", "picker", lspCompletionTitle.String(), "lsp_completion_insert"); err != nil {
+			return err
+		}
+		if picker, ok := newestChild(e.rootWindow).view.(*pickerView); ok {
+			picker.add(items)
+		}
+		return nil
+	})
+}
+
+func cmdLSPCompletionInsert(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	v, ok := w.view.(*documentView)
+	if !ok {
+		return nil, errors.New(noDocument.String())
+	}
+	// Replace the part of the identifier before the cursor. The text may span
+	// multiple lines.
+	d := v.document
+	l := d.content[v.CursorLine]
+	start, _ := wordAt(l, v.CursorColumn)
+	text := args.String(0)
+	lines := splitLines(l[:start] + text + l[v.CursorColumn:])
+	endLine := v.CursorLine + len(lines) - 1
+	endCol := start + len(text)
+	if i := strings.LastIndex(text, "\n"); i != -1 {
+		endCol = len(text) - i - 1
+	}
+	content := make([]string, 0, len(d.content)+len(lines)-1)
+	content = append(content, d.content[:v.CursorLine]...)
+	content = append(content, lines...)
+	content = append(content, d.content[v.CursorLine+1:]...)
+	d.content = content
+	d.isDirty = true
+	e.documentEdited(d, v.CursorLine, v.CursorColumn, endLine, endCol)
+	v.CursorLine = endLine
+	v.CursorColumn = endCol
+	v.updateColumnMax()
+	v.cursorMoved(e)
+	return nil, nil
+}
+
+func cmdLSPDefinition(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	return nil, e.lspRequest(w, "textDocument/definition", true, nil, func(v *documentView, result json.RawMessage) error {
+		locs, err := e.lspLocations(result)
+		if err != nil {
+			return err
+		}
+		if len(locs) == 0 {
+			return errors.New(lspNoResult.String())
+		}
+		return e.gotoLocation(location(locs[0]))
+	})
+}
+
+func cmdLSPFormat(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	v, ok := w.view.(*documentView)
+	if !ok {
+		return nil, errors.New(noDocument.String())
+	}
+	options := map[string]interface{}{
+		"tabSize":      v.tabstop(),
+		"insertSpaces": e.GetSetting(w, "expandtab") == "true",
+	}
+	return nil, e.lspRequest(w, "textDocument/formatting", false, map[string]interface{}{"options": options}, func(v *documentView, result json.RawMessage) error {
+		var edits []lspTextEdit
+		if err := json.Unmarshal(result, &edits); err != nil {
+			return err
+		}
+		return e.applyTextEdits(v.document, edits)
+	})
+}
+
+func cmdLSPHover(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	return nil, e.lspRequest(w, "textDocument/hover", true, nil, func(v *documentView, result json.RawMessage) error {
+		var hover struct {
+			Contents json.RawMessage `json:"contents"`
+		}
+		if err := json.Unmarshal(result, &hover); err != nil {
+			return err
+		}
+		text := strings.TrimSpace(lspMarkup(hover.Contents))
+		if text == "" {
+			return errors.New(lspNoResult.String())
+		}
+		lines := append([]string{lspHoverTitle.String()}, strings.Split(text, "\n")...)
+		_, err := e.ExecuteCommand(e.rootWindow, "window_new", append([]string{e.rootWindow.ID(), "floating", "text"}, lines...)...)
+		return err
+	})
+}
+
+func cmdLSPReferences(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	extra := map[string]interface{}{"context": map[string]interface{}{"includeDeclaration": true}}
+	return nil, e.lspRequest(w, "textDocument/references", true, extra, func(v *documentView, result json.RawMessage) error {
+		locs, err := e.lspLocations(result)
+		if err != nil {
+			return err
+		}
+		if len(locs) == 0 {
+			return errors.New(lspNoResult.String())
+		}
+		return e.pickLocations(referencesTitle.Sprintf(v.cursorWord(), len(locs)), locs)
+	})
+}
+
+func cmdLSPRename(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	v, ok := w.view.(*documentView)
+	if !ok {
+		return nil, errors.New(noDocument.String())
+	}
+	if _, err := e.lspServer(v.document); err != nil {
+		return nil, err
+	}
+	old := v.cursorWord()
+	if old == "" {
+		return nil, errors.New(noIdentifier.String())
+	}
+	e.Prompt(wicore.Prompt{wicore.PromptInput, lspRenamePrompt.Sprintf(old), []string{old}}, func(a wicore.PromptAnswer) {
+		if a.Cancelled || a.Answer == "" || a.Answer == old {
+			return
+		}
+		e.alertOnError(e.lspRequest(w, "textDocument/rename", true, map[string]interface{}{"newName": a.Answer}, func(v *documentView, result json.RawMessage) error {
+			return e.applyWorkspaceEdit(result)
+		}))
+	})
+	return nil, nil
+}
+
+func cmdLSPServer(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	ft := wicore.FileType(args.String(0))
+	if s := e.lsp.servers[ft]; s != nil {
+		delete(e.lsp.servers, ft)
+		if err := s.Close(); err != nil {
+			log.Printf("%s.Close() failed: %s", s, err)
+		}
+		e.clearDiagnostics(lspSource(ft))
+	}
+	cmdLine := wicore.SplitCommandLine(args.String(1))
+	if len(cmdLine) == 0 {
+		delete(e.lsp.commands, ft)
+		return nil, nil
+	}
+	e.lsp.commands[ft] = cmdLine
+	// Start it right away for the documents already loaded.
+	for _, d := range e.sortedDocuments() {
+		if d.FileType() == ft {
+			e.lspSync(d)
+		}
+	}
+	return nil, nil
+}
+
+// RegisterLSPCommands registers the commands using the language servers.
+func RegisterLSPCommands(dispatcher wicore.CommandsW) {
+	cmds := []wicore.Command{
+		&privilegedCommandImpl{
+			"lsp_completion",
+			nil,
+			cmdLSPCompletion,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Lists the completions at the cursor",
+			},
+			lang.Map{
+				lang.En: "Asks the language server for the completions at the cursor and shows them in a picker. The selected completion replaces the identifier before the cursor.",
+			},
+		},
+		&privilegedCommandImpl{
+			"lsp_completion_insert",
+			wicore.CommandArgs{{Name: "text", Type: wicore.ArgString}},
+			cmdLSPCompletionInsert,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Inserts a completion",
+			},
+			lang.Map{
+				lang.En: "Replaces the identifier before the cursor with the text. It is the continuation of lsp_completion.",
+			},
+		},
+		&privilegedCommandImpl{
+			"lsp_definition",
+			nil,
+			cmdLSPDefinition,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Jumps to the definition with the language server",
+			},
+			lang.Map{
+				lang.En: "Asks the language server for the definition of the symbol at the cursor and jumps to it. The position is recorded in the jump list.",
+			},
+		},
+		&privilegedCommandImpl{
+			"lsp_format",
+			nil,
+			cmdLSPFormat,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Formats the document with the language server",
+			},
+			lang.Map{
+				lang.En: "Asks the language server to format the document and applies its edits. The \"tabstop\" and \"expandtab\" settings are sent as the formatting options.",
+			},
+		},
+		&privilegedCommandImpl{
+			"lsp_hover",
+			nil,
+			cmdLSPHover,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Shows the documentation of the symbol at the cursor",
+			},
+			lang.Map{
+				lang.En: "Asks the language server for the information about the symbol at the cursor and shows it in a floating window.",
+			},
+		},
+		&privilegedCommandImpl{
+			"lsp_references",
+			nil,
+			cmdLSPReferences,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Lists the references with the language server",
+			},
+			lang.Map{
+				lang.En: "Asks the language server for the references to the symbol at the cursor, including its declaration. Use Enter to jump to the selected reference.",
+			},
+		},
+		&privilegedCommandImpl{
+			"lsp_rename",
+			nil,
+			cmdLSPRename,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Renames the symbol at the cursor",
+			},
+			lang.Map{
+				lang.En: "Prompts for a new name and asks the language server to rename the symbol at the cursor. The edits are applied to all the affected documents, which are loaded as needed and left unsaved.",
+			},
+		},
+		&privilegedCommandImpl{
+			"lsp_server",
+			wicore.CommandArgs{
+				{Name: "filetype", Type: wicore.ArgString},
+				{Name: "command", Type: wicore.ArgString, Optional: true},
+			},
+			cmdLSPServer,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Configures the language server of a file type",
+			},
+			lang.Map{
+				lang.En: "Configures the command line of the language server for the documents of the file type, e.g. lsp_server Code.Go gopls. The server is started when a document of this type is loaded and is sent the documents as they are edited and saved. Its diagnostics are published with the source lsp:<filetype>. Without a command, the server is stopped. A server that fails is not restarted until it is configured again.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+}
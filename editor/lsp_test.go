@@ -0,0 +1,337 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/key"
+)
+
+func TestLSP(t *testing.T) {
+	defer keepLog(t)()
+
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	tmpDir, err = filepath.EvalSymlinks(tmpDir)
+	ut.AssertEqual(t, nil, err)
+	server := filepath.Join(tmpDir, "wi-fake-lsp")
+	if out, err := exec.Command("go", "build", "-o", server, "github.com/wi-ed/wi/tools/wi-fake-lsp").CombinedOutput(); err != nil {
+		t.Skipf("failed to build the fake language server: %s\n%s", err, out)
+	}
+	// 𝒳 is 4 bytes in UTF-8 and 2 code units in UTF-16.
+	src := "package a\n\n// ERROR here\nfunc x𝒳y() {}  \n\nfunc main() {\n\tx𝒳y()\n\tx𝒳\n}\n"
+	path := filepath.Join(tmpDir, "a.go")
+	ut.AssertEqual(t, nil, ioutil.WriteFile(path, []byte(src), 0600))
+
+	ed, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+	var errs []string
+	var got []string
+	activeView := func() *documentView {
+		return e.ActiveWindow().View().(*documentView)
+	}
+	isDocument := func() bool {
+		_, ok := e.ActiveWindow().View().(*documentView)
+		return ok
+	}
+	signs := func() string {
+		var out []string
+		for _, s := range activeView().document.signs {
+			if s.group == "diagnostics" {
+				out = append(out, fmt.Sprintf("%d:%s", s.line, s.text))
+			}
+		}
+		return strings.Join(out, ",")
+	}
+	cursorAt := func(line int) func() bool {
+		return func() bool {
+			return isDocument() && activeView().CursorLine == line
+		}
+	}
+	recordCursor := func() {
+		v := activeView()
+		got = append(got, fmt.Sprintf("cursor %d:%d", v.CursorLine, v.CursorColumn))
+	}
+	post := func(cmd string, args ...string) {
+		wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+			if o.Err != nil {
+				errs = append(errs, o.Err.Error())
+			}
+		}, cmd, args...)
+	}
+	picker := func() bool {
+		_, ok := e.ActiveWindow().View().(*pickerView)
+		return ok
+	}
+	recordPicker := func() {
+		p := e.ActiveWindow().View().(*pickerView)
+		var items []string
+		for _, m := range p.matches {
+			items = append(items, m.item.Text)
+		}
+		sort.Strings(items)
+		got = append(got, p.title)
+		got = append(got, items...)
+	}
+	line := func(l int, content string) func() bool {
+		return func() bool {
+			return isDocument() && activeView().document.content[l] == content
+		}
+	}
+	e.RegisterViewActivated(func(v wicore.View) {
+		if p, ok := v.(*promptView); ok {
+			got = append(got, p.question)
+			for range p.text {
+				e.TriggerTerminalMetaKeyPressed(key.Press{Key: key.Backspace})
+			}
+			for _, c := range "zz" {
+				e.TriggerTerminalKeyPressed(key.Press{Ch: c})
+			}
+			e.TriggerTerminalKeyPressed(key.Press{Key: key.Enter})
+		}
+	})
+	// Each step runs once the previous condition is met.
+	steps := []struct {
+		run   func()
+		until func() bool
+	}{
+		{
+			// The server is started for the documents already loaded.
+			func() {
+				post("lsp_server", "Code.Go", server)
+			},
+			func() bool { return signs() == "2:E" },
+		},
+		{
+			func() {
+				v := activeView()
+				v.CursorLine, v.CursorColumn = 6, 6
+				post("lsp_definition")
+			},
+			cursorAt(3),
+		},
+		{
+			func() {
+				recordCursor()
+				post("jump_back")
+			},
+			cursorAt(6),
+		},
+		{
+			func() {
+				recordCursor()
+				post("lsp_references")
+			},
+			picker,
+		},
+		{
+			func() {
+				recordPicker()
+				e.TriggerTerminalKeyPressed(key.Press{Key: key.Escape})
+			},
+			isDocument,
+		},
+		{
+			func() {
+				post("lsp_hover")
+			},
+			func() bool {
+				_, ok := e.ActiveWindow().View().(*textView)
+				return ok
+			},
+		},
+		{
+			func() {
+				got = append(got, e.ActiveWindow().View().(*textView).lines...)
+				post("text_close")
+			},
+			isDocument,
+		},
+		{
+			func() {
+				v := activeView()
+				v.CursorLine, v.CursorColumn = 7, 6
+				post("lsp_completion")
+			},
+			picker,
+		},
+		{
+			func() {
+				recordPicker()
+				e.TriggerTerminalKeyPressed(key.Press{Key: key.Enter})
+			},
+			line(7, "\tx𝒳y\n"),
+		},
+		{
+			func() {
+				recordCursor()
+				v := activeView()
+				v.CursorLine, v.CursorColumn = 3, 5
+				post("lsp_rename")
+			},
+			line(3, "func zz() {}  \n"),
+		},
+		{
+			func() {
+				post("lsp_format")
+			},
+			line(3, "func zz() {}\n"),
+		},
+		{
+			func() {
+				// The diagnostics are updated as the document is edited.
+				d := activeView().document
+				d.content[2] = "// WARNING\n"
+				d.version++
+				activeView().cursorMoved(e)
+			},
+			func() bool { return signs() == "2:W" },
+		},
+		{
+			func() {
+				got = append(got, strings.Join(activeView().document.content, ""))
+				wicore.PostCommand(e, nil, "q!")
+			},
+			func() bool { return true },
+		},
+	}
+	step := 0
+	var wait func(o wicore.CommandOutcome)
+	wait = func(o wicore.CommandOutcome) {
+		if !steps[step].until() {
+			wicore.PostCommand(e, wait, "editor_redraw")
+			return
+		}
+		step++
+		steps[step].run()
+		if step < len(steps)-1 {
+			wicore.PostCommand(e, wait, "editor_redraw")
+		}
+	}
+	wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+		ut.AssertEqual(t, nil, o.Err)
+		steps[0].run()
+		wait(o)
+	}, "open", path)
+	ut.AssertEqual(t, 0, e.EventLoop())
+
+	expected := []string{
+		"cursor 3:5",
+		"cursor 6:6",
+		"References to x𝒳y (2)",
+		"a.go:4:6  func x𝒳y() {}",
+		"a.go:7:2  x𝒳y()",
+		"word x𝒳y",
+		"Completions",
+		"x𝒳y  word",
+		"cursor 7:7",
+		"Rename x𝒳y to:",
+		"package a\n\n// WARNING\nfunc zz() {}\n\nfunc main() {\n\tzz()\n\tzz\n}\n",
+	}
+	ut.AssertEqual(t, expected, got)
+	ut.AssertEqual(t, []string(nil), errs)
+}
+
+func TestLSPEdits(t *testing.T) {
+	defer keepLog(t)()
+
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	path := filepath.Join(tmpDir, "a.go")
+	ut.AssertEqual(t, nil, ioutil.WriteFile(path, []byte("a\nb\nc\n"), 0600))
+
+	ed, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+	edit := func(l1, c1, l2, c2 int, text string) lspTextEdit {
+		return lspTextEdit{lspRange{lspPosition{l1, c1}, lspPosition{l2, c2}}, text}
+	}
+	var got [][]string
+	e.RegisterViewActivated(func(v wicore.View) {
+		dv, ok := v.(*documentView)
+		if !ok {
+			return
+		}
+		d := dv.document
+		// Overlapping and inverted ranges are rejected without editing.
+		ut.AssertEqual(t, lspInvalidEdits.String(), e.applyTextEdits(d, []lspTextEdit{edit(0, 0, 1, 1, "x"), edit(1, 0, 2, 0, "y")}).Error())
+		ut.AssertEqual(t, lspInvalidEdits.String(), e.applyTextEdits(d, []lspTextEdit{edit(2, 0, 1, 0, "x")}).Error())
+		got = append(got, append([]string{}, d.content...))
+		// The positions outside of the document are clamped to it.
+		ut.AssertEqual(t, nil, e.applyTextEdits(d, []lspTextEdit{edit(-1, -3, 0, 0, "0\n"), edit(2, 9, 7, 0, "!")}))
+		got = append(got, append([]string{}, d.content...))
+		// A completion spanning lines is split in lines.
+		dv.CursorLine, dv.CursorColumn = 1, 1
+		_, err := e.ExecuteCommand(e.ActiveWindow(), "lsp_completion_insert", "x(\n\ty)")
+		ut.AssertEqual(t, nil, err)
+		got = append(got, append([]string{}, d.content...))
+		ut.AssertEqual(t, []int{2, 3}, []int{dv.CursorLine, dv.CursorColumn})
+		wicore.PostCommand(e, nil, "q!")
+	})
+	wicore.PostCommand(e, nil, "open", path)
+	ut.AssertEqual(t, 0, e.EventLoop())
+
+	expected := [][]string{
+		{"a\n", "b\n", "c\n"},
+		{"0\n", "a\n", "b\n", "c!"},
+		{"0\n", "x(\n", "\ty)\n", "b\n", "c!"},
+	}
+	ut.AssertEqual(t, expected, got)
+}
+
+func TestLSPMessageTooLarge(t *testing.T) {
+	defer keepLog(t)()
+
+	r := bufio.NewReader(strings.NewReader(fmt.Sprintf("Content-Length: %d\r\n\r\n{}", maxLSPMessage+1)))
+	_, err := readLSPMessage(r)
+	ut.AssertEqual(t, fmt.Sprintf("message of %d bytes is too large", maxLSPMessage+1), err.Error())
+	m, err := readLSPMessage(bufio.NewReader(strings.NewReader("Content-Length: 17\r\n\r\n{\"method\": \"foo\"}")))
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "foo", m.Method)
+}
+
+func TestLSPSendBlocked(t *testing.T) {
+	defer keepLog(t)()
+
+	// Nothing reads the messages, like a server not reading its stdin.
+	s := &lspServer{
+		fileType: wicore.CodeGo,
+		out:      make(chan []byte),
+		closed:   make(chan struct{}),
+		ready:    true,
+		pending:  map[int]func(json.RawMessage, error){},
+	}
+	var reqErr error
+	s.request("foo", nil, func(result json.RawMessage, err error) {
+		reqErr = err
+	})
+	ut.AssertEqual(t, "LSP(Code.Go) failed: the server is not reading its input", reqErr.Error())
+	ut.AssertEqual(t, reqErr, s.err)
+}
@@ -0,0 +1,492 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/colors"
+	"github.com/wi-ed/wi/wicore/key"
+	"github.com/wi-ed/wi/wicore/lang"
+	"github.com/wi-ed/wi/wicore/raster"
+)
+
+// symbol is a top level declaration of a Go source file.
+type symbol struct {
+	name     string
+	kind     string // "const", "func", "method" or "type".
+	recv     string // Receiver type of a method.
+	line     int    // 0-based.
+	col      int    // Byte offset of the name in the line.
+	children []*symbol
+}
+
+// symbolKinds are the letters shown before the symbols and their color.
+var symbolKinds = map[string]struct {
+	letter rune
+	fg     colors.RGB
+}{
+	"const":  {'c', colors.BrightMagenta},
+	"func":   {'f', colors.BrightYellow},
+	"method": {'m', colors.BrightYellow},
+	"type":   {'T', colors.BrightCyan},
+}
+
+// qualifiedName returns the name of the symbol as written in the package,
+// e.g. "Type.Method".
+func (s *symbol) qualifiedName() string {
+	if s.recv != "" {
+		return s.recv + "." + s.name
+	}
+	return s.name
+}
+
+// receiverType returns the name of the type of a method receiver, without
+// the pointer and the type parameters.
+func receiverType(expr ast.Expr) string {
+	for {
+		switch t := expr.(type) {
+		case *ast.Ident:
+			return t.Name
+		case *ast.StarExpr:
+			expr = t.X
+		case *ast.ParenExpr:
+			expr = t.X
+		case *ast.IndexExpr:
+			expr = t.X
+		case *ast.IndexListExpr:
+			expr = t.X
+		default:
+			return ""
+		}
+	}
+}
+
+// goSymbols returns the types, the functions and the constants of the Go
+// source in the order of declaration. The methods are listed under their
+// receiver type when it is declared in the same source.
+//
+// A source with syntax errors is listed as far as it could be parsed.
+func goSymbols(src string) []*symbol {
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, "", src, 0)
+	if f == nil {
+		return nil
+	}
+	newSymbol := func(name *ast.Ident, kind string) *symbol {
+		p := fset.Position(name.Pos())
+		return &symbol{name: name.Name, kind: kind, line: p.Line - 1, col: p.Column - 1}
+	}
+	var out []*symbol
+	types := map[string]*symbol{}
+	var methods []*symbol
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					t := newSymbol(s.Name, "type")
+					types[t.name] = t
+					out = append(out, t)
+				case *ast.ValueSpec:
+					if d.Tok != token.CONST {
+						continue
+					}
+					for _, n := range s.Names {
+						if n.Name != "_" {
+							out = append(out, newSymbol(n, "const"))
+						}
+					}
+				}
+			}
+		case *ast.FuncDecl:
+			if d.Recv == nil || len(d.Recv.List) == 0 {
+				out = append(out, newSymbol(d.Name, "func"))
+				continue
+			}
+			m := newSymbol(d.Name, "method")
+			m.recv = receiverType(d.Recv.List[0].Type)
+			methods = append(methods, m)
+		}
+	}
+	// The methods can be declared before their type.
+	for _, m := range methods {
+		if t := types[m.recv]; t != nil {
+			t.children = append(t.children, m)
+		} else {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// outlineRow is a visible line of the outlineView.
+type outlineRow struct {
+	symbol *symbol
+	depth  int
+}
+
+// outlineView lists the symbols of the Go document shown in the active
+// Window. The document is parsed again in the background when it is edited.
+type outlineView struct {
+	view
+	e        *editor
+	document *document // Document outlined.
+	version  int       // Version of the document the symbols were parsed from.
+	symbols  []*symbol
+	selected int  // Index of the selected row.
+	offset   int  // First row shown.
+	parsing  bool // A parse is in progress.
+	closed   chan struct{}
+}
+
+func (v *outlineView) Close() error {
+	select {
+	case <-v.closed:
+	default:
+		close(v.closed)
+	}
+	return v.view.Close()
+}
+
+// rows returns the visible rows.
+func (v *outlineView) rows() []outlineRow {
+	var out []outlineRow
+	for _, s := range v.symbols {
+		out = append(out, outlineRow{s, 0})
+		for _, c := range s.children {
+			out = append(out, outlineRow{c, 1})
+		}
+	}
+	return out
+}
+
+func (v *outlineView) selectedSymbol() *symbol {
+	rows := v.rows()
+	if v.selected >= len(rows) {
+		v.selected = len(rows) - 1
+	}
+	if v.selected < 0 {
+		v.selected = 0
+		return nil
+	}
+	return rows[v.selected].symbol
+}
+
+// track outlines the document d, parsing it if it changed since the last
+// parse. It must be called in the UI goroutine.
+func (v *outlineView) track(d *document) {
+	if d != v.document {
+		v.document = d
+		v.version = -1
+		v.symbols = nil
+		v.selected = 0
+		v.offset = 0
+		v.title = outlineTitle.String()
+		if d.filePath != "" {
+			v.title += ": " + filepath.Base(d.filePath)
+		}
+		wicore.PostCommand(v.e, nil, "editor_redraw")
+	}
+	if v.parsing || d.version == v.version {
+		return
+	}
+	if filepath.Ext(d.filePath) != ".go" {
+		v.version = d.version
+		return
+	}
+	v.parsing = true
+	version := d.version
+	src := strings.Join(d.content, "")
+	wicore.Go("outlineParse", func() {
+		symbols := goSymbols(src)
+		v.e.post(v.closed, func() {
+			v.parsing = false
+			if v.document == d {
+				v.symbols = symbols
+				v.version = version
+			}
+			// The document may have been edited meanwhile.
+			v.track(v.document)
+			wicore.PostCommand(v.e, nil, "editor_redraw")
+		})
+	})
+}
+
+// onDocumentCursorMoved follows the document of the active Window.
+func (v *outlineView) onDocumentCursorMoved(doc wicore.Document, col, row int) {
+	w := v.e.ActiveWindow()
+	if w == nil {
+		return
+	}
+	if dv, ok := w.View().(*documentView); ok && dv.document != nil {
+		v.track(dv.document)
+	}
+}
+
+func (v *outlineView) Buffer() *raster.Buffer {
+	v.buffer.Fill(raster.Cell{R: ' ', F: v.DefaultFormat()})
+	v.selectedSymbol()
+	rows := v.rows()
+	if len(rows) == 0 {
+		f := v.DefaultFormat()
+		f.Fg = colors.DarkGray
+		v.buffer.DrawString(outlineEmpty.String(), 0, 0, f)
+		return v.buffer
+	}
+	if v.selected < v.offset {
+		v.offset = v.selected
+	} else if v.actualY > 0 && v.selected >= v.offset+v.actualY {
+		v.offset = v.selected - v.actualY + 1
+	}
+	for i := v.offset; i < len(rows) && i-v.offset < v.actualY; i++ {
+		s := rows[i].symbol
+		f := v.DefaultFormat()
+		if i == v.selected {
+			f.Fg, f.Bg = f.Bg, f.Fg
+		}
+		x := 2 * rows[i].depth
+		kf := f
+		if i != v.selected {
+			kf.Fg = symbolKinds[s.kind].fg
+		}
+		*v.buffer.Cell(x, i-v.offset) = raster.Cell{R: symbolKinds[s.kind].letter, F: kf}
+		name := s.name
+		if rows[i].depth == 0 {
+			name = s.qualifiedName()
+		}
+		v.buffer.DrawString(name, x+2, i-v.offset, f)
+	}
+	return v.buffer
+}
+
+func (v *outlineView) onTerminalKeyPressed(k key.Press) {
+	if v.window == nil || v.e.ActiveWindow() != v.window {
+		return
+	}
+	switch {
+	case k.Key == key.Enter:
+		if s := v.selectedSymbol(); s != nil && v.document != nil {
+			v.e.alertOnError(v.e.gotoDocument(v.document, s.line, s.col))
+		}
+	case k.Ch == 'q':
+		wicore.PostCommand(v.e, nil, "window_close", v.window.ID())
+	}
+	wicore.PostCommand(v.e, nil, "editor_redraw")
+}
+
+func cmdToOutline(handler func(v *outlineView)) wicore.CommandImplHandler {
+	return func(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
+		v, ok := w.View().(*outlineView)
+		if !ok {
+			return nil, errors.New("internal error")
+		}
+		handler(v)
+		wicore.PostCommand(e, nil, "editor_redraw")
+		return nil, nil
+	}
+}
+
+func cmdOutlineCursorDown(v *outlineView) {
+	v.selected++
+	v.selectedSymbol()
+}
+
+func cmdOutlineCursorUp(v *outlineView) {
+	if v.selected > 0 {
+		v.selected--
+	}
+}
+
+// outlineViewFactory returns a View listing the symbols of the Go document
+// of the active Window.
+func outlineViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
+	dispatcher := makeCommands()
+	cmds := []wicore.Command{
+		&wicore.CommandImpl{
+			"outline_cursor_down",
+			nil,
+			cmdToOutline(cmdOutlineCursorDown),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Selects the next symbol",
+			},
+			lang.Map{
+				lang.En: "Selects the next symbol in the outline.",
+			},
+		},
+		&wicore.CommandImpl{
+			"outline_cursor_up",
+			nil,
+			cmdToOutline(cmdOutlineCursorUp),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Selects the previous symbol",
+			},
+			lang.Map{
+				lang.En: "Selects the previous symbol in the outline.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+	bindings := makeKeyBindings()
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Down}, "outline_cursor_down")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Up}, "outline_cursor_up")
+
+	v := &outlineView{
+		view{
+			commands:      dispatcher,
+			keyBindings:   bindings,
+			eventRegistry: e,
+			id:            id,
+			title:         outlineTitle.String(),
+			naturalX:      30,
+			naturalY:      -1,
+			defaultFormat: raster.CellFormat{Fg: colors.White, Bg: colors.Black},
+		},
+		e.(*editor),
+		nil,
+		-1,
+		nil,
+		0,
+		0,
+		false,
+		make(chan struct{}),
+	}
+	v.events = append(v.events, e.RegisterTerminalKeyPressed(v.onTerminalKeyPressed))
+	v.events = append(v.events, e.RegisterDocumentCursorMoved(v.onDocumentCursorMoved))
+	// The Window that was active when the outline was requested is still the
+	// active one.
+	if w := e.ActiveWindow(); w != nil {
+		if dv, ok := w.View().(*documentView); ok && dv.document != nil {
+			v.track(dv.document)
+		}
+	}
+	return v
+}
+
+// symbolItems returns the picker items for the symbols of the file at path,
+// including the methods.
+func symbolItems(path string, symbols []*symbol) []pickerItem {
+	var items []pickerItem
+	var add func(symbols []*symbol)
+	add = func(symbols []*symbol) {
+		for _, s := range symbols {
+			items = append(items, pickerItem{
+				fmt.Sprintf("%s  %s  %s:%d", s.qualifiedName(), s.kind, filepath.Base(path), s.line+1),
+				fmt.Sprintf("%s:%d:%d", path, s.line+1, s.col+1),
+			})
+			add(s.children)
+		}
+	}
+	add(symbols)
+	return items
+}
+
+// Commands.
+
+func cmdGotoSymbol(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	v, ok := w.view.(*documentView)
+	if !ok || filepath.Ext(v.document.filePath) != ".go" {
+		return nil, errors.New(noGoDocument.String())
+	}
+	dir, err := filepath.Abs(filepath.Dir(v.document.filePath))
+	if err != nil {
+		return nil, err
+	}
+	// The loaded documents may have unsaved edits; their content is taken in
+	// the UI goroutine.
+	loaded := map[string]string{}
+	for _, d := range e.documents {
+		if d.closed || filepath.Ext(d.filePath) != ".go" {
+			continue
+		}
+		if abs, err := filepath.Abs(d.filePath); err == nil && filepath.Dir(abs) == dir {
+			loaded[abs] = strings.Join(d.content, "")
+		}
+	}
+	if _, err := e.ExecuteCommand(w, "window_new", e.rootWindow.ID(), "floating", "picker", gotoSymbolTitle.Sprintf(dir), "document_goto"); err != nil {
+		return nil, err
+	}
+	p, ok := newestChild(e.rootWindow).view.(*pickerView)
+	if !ok {
+		return nil, errors.New("internal error")
+	}
+	p.stream("gotoSymbol", func(send func(items []pickerItem) bool) {
+		paths, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+		sort.Strings(paths)
+		for _, path := range paths {
+			src, ok := loaded[path]
+			if !ok {
+				b, err := ioutil.ReadFile(path)
+				if err != nil {
+					log.Printf("Failed to read %s: %s", path, err)
+					continue
+				}
+				src = string(b)
+			}
+			if !send(symbolItems(path, goSymbols(src))) {
+				return
+			}
+		}
+	})
+	return nil, nil
+}
+
+func cmdOutline(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	for _, child := range e.rootWindow.childrenWindows {
+		if _, ok := child.view.(*outlineView); ok {
+			return nil, e.activateWindow(child)
+		}
+	}
+	return e.ExecuteCommand(w, "window_new", e.rootWindow.ID(), "right", "outline")
+}
+
+// RegisterOutlineCommands registers the commands to navigate the symbols of
+// Go documents.
+func RegisterOutlineCommands(dispatcher wicore.CommandsW) {
+	cmds := []wicore.Command{
+		&privilegedCommandImpl{
+			"goto_symbol",
+			nil,
+			cmdGotoSymbol,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Finds a symbol in the package",
+			},
+			lang.Map{
+				lang.En: "Lists the types, functions, methods and constants declared in the Go files of the directory of the current document. Type to filter the symbols with fuzzy matching and use Enter to jump to the selected one.",
+			},
+		},
+		&privilegedCommandImpl{
+			"outline",
+			nil,
+			cmdOutline,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Shows the outline of the document",
+			},
+			lang.Map{
+				lang.En: "Shows the types, functions, methods and constants of the Go document of the active window in a window docked on the right. The outline follows the active window and is updated as the document is edited. Use Enter to jump to the selected symbol and 'q' to close the outline.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+}
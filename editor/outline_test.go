@@ -0,0 +1,147 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/key"
+)
+
+func TestGoSymbols(t *testing.T) {
+	src := "package a\n\nconst (\n\tX = 1\n\t_ = 2\n)\n\nvar v = 0\n\nfunc (t *T) M() {}\n\nfunc (u U[K]) N() {}\n\ntype T struct{}\n\nfunc F() {\n"
+	var out []string
+	var recurse func(symbols []*symbol, indent string)
+	recurse = func(symbols []*symbol, indent string) {
+		for _, s := range symbols {
+			out = append(out, fmt.Sprintf("%s%s %s %d:%d", indent, s.kind, s.qualifiedName(), s.line, s.col))
+			recurse(s.children, indent+" ")
+		}
+	}
+	recurse(goSymbols(src), "")
+	// Syntax errors are tolerated and the methods of an unknown type are
+	// listed at the top level.
+	expected := []string{"const X 3:1", "type T 13:5", " method T.M 9:12", "func F 15:5", "method U.N 11:14"}
+	ut.AssertEqual(t, expected, out)
+}
+
+func TestOutline(t *testing.T) {
+	defer keepLog(t)()
+
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	pathA := filepath.Join(tmpDir, "a.go")
+	pathB := filepath.Join(tmpDir, "b.go")
+	ut.AssertEqual(t, nil, ioutil.WriteFile(pathA, []byte("package a\n\nconst X = 1\n\nfunc (t *T) M() {}\n\ntype T struct{}\n\nfunc F() {}\n"), 0600))
+	ut.AssertEqual(t, nil, ioutil.WriteFile(pathB, []byte("package a\n\ntype B struct{}\n\nfunc (b B) Method() {}\n"), 0600))
+
+	ed, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+	var v *documentView
+	var outline *outlineView
+	var snapshots [][]string
+	var cursors []string
+	rows := func() []string {
+		var out []string
+		for _, r := range outline.rows() {
+			out = append(out, fmt.Sprintf("%s%c %s", strings.Repeat(" ", r.depth), symbolKinds[r.symbol.kind].letter, r.symbol.name))
+		}
+		return out
+	}
+	cursor := func() string {
+		dv := e.ActiveWindow().View().(*documentView)
+		return fmt.Sprintf("%s:%d:%d", filepath.Base(dv.document.filePath), dv.CursorLine, dv.CursorColumn)
+	}
+	// until runs then once cond is true.
+	var until func(cond func() bool, then func())
+	until = func(cond func() bool, then func()) {
+		if !cond() {
+			wicore.PostCommand(e, func(o wicore.CommandOutcome) { until(cond, then) }, "editor_redraw")
+			return
+		}
+		then()
+	}
+	parsed := func() bool {
+		return !outline.parsing && outline.version == v.document.version
+	}
+	gotoSymbol := func() {
+		wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+			ut.AssertEqual(t, nil, o.Err)
+			p := e.ActiveWindow().View().(*pickerView)
+			until(func() bool { return !p.loading }, func() {
+				for _, c := range "bmeth" {
+					e.TriggerTerminalKeyPressed(key.Press{Ch: c})
+				}
+				e.deferred <- func() {
+					var matched []string
+					for _, m := range p.matches {
+						matched = append(matched, m.item.Text)
+					}
+					snapshots = append(snapshots, matched)
+					e.TriggerTerminalKeyPressed(key.Press{Key: key.Enter})
+				}
+				until(func() bool {
+					dv, ok := e.ActiveWindow().View().(*documentView)
+					return ok && dv.document.filePath == pathB
+				}, func() {
+					cursors = append(cursors, cursor())
+					wicore.PostCommand(e, nil, "q!")
+				})
+			})
+		}, "goto_symbol")
+	}
+	edit := func() {
+		cursors = append(cursors, cursor())
+		// Add a function at the end.
+		v.CursorLine = 8
+		v.CursorColumn = len("func F() {}")
+		v.insertNewline()
+		v.insert("func G() {}")
+		v.cursorMoved(e)
+		until(parsed, func() {
+			snapshots = append(snapshots, rows())
+			gotoSymbol()
+		})
+	}
+	wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+		v = e.ActiveWindow().View().(*documentView)
+		v.SetSize(40, 10)
+	}, "open", pathA)
+	wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+		ut.AssertEqual(t, nil, o.Err)
+		outline = e.ActiveWindow().View().(*outlineView)
+		until(parsed, func() {
+			snapshots = append(snapshots, rows())
+			// Jump to T.M.
+			e.TriggerTerminalMetaKeyPressed(key.Press{Key: key.Down})
+			e.TriggerTerminalMetaKeyPressed(key.Press{Key: key.Down})
+			e.TriggerTerminalKeyPressed(key.Press{Key: key.Enter})
+			until(func() bool { return e.ActiveWindow() == v.window }, edit)
+		})
+	}, "outline")
+	ut.AssertEqual(t, 0, e.EventLoop())
+
+	expected := [][]string{
+		{"c X", "T T", " m M", "f F"},
+		{"c X", "T T", " m M", "f F", "f G"},
+		{"B.Method  method  b.go:5"},
+	}
+	ut.AssertEqual(t, expected, snapshots)
+	ut.AssertEqual(t, []string{"a.go:4:12", "b.go:4:11"}, cursors)
+}
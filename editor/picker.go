@@ -0,0 +1,378 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/colors"
+	"github.com/wi-ed/wi/wicore/key"
+	"github.com/wi-ed/wi/wicore/lang"
+	"github.com/wi-ed/wi/wicore/raster"
+)
+
+// pickerItem is an entry of a pickerView.
+type pickerItem struct {
+	Text  string // Shown and matched against the query.
+	Value string // Appended to the continuation command when selected.
+}
+
+// pickerMatch is an item matching the query, with its score.
+type pickerMatch struct {
+	item  *pickerItem
+	score int
+}
+
+type pickerMatches []pickerMatch
+
+func (p pickerMatches) Len() int      { return len(p) }
+func (p pickerMatches) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p pickerMatches) Less(i, j int) bool {
+	if p[i].score != p[j].score {
+		return p[i].score > p[j].score
+	}
+	if len(p[i].item.Text) != len(p[j].item.Text) {
+		return len(p[i].item.Text) < len(p[j].item.Text)
+	}
+	return p[i].item.Text < p[j].item.Text
+}
+
+// pickerView is a floating list of items filtered by fuzzy matching the text
+// typed. It is meant to be reused by all the pickers, e.g. find_file.
+//
+// The items are added by the code that created the View, while the View is
+// shown; see stream(). When an item is selected with Enter, the View is
+// closed and the continuation command is run with the item value appended.
+type pickerView struct {
+	view
+	e            *editor
+	continuation []string
+	query        string
+	items        []*pickerItem
+	matches      pickerMatches // Items matching query, the best first.
+	selected     int
+	// rank returns an extra score for an item value, e.g. its recency. It can
+	// be nil.
+	rank    func(value string) int
+	loading bool          // Items are still being added.
+	closed  chan struct{} // Closed when the View is closed, to stop stream().
+}
+
+func (v *pickerView) Close() error {
+	select {
+	case <-v.closed:
+	default:
+		close(v.closed)
+	}
+	return v.view.Close()
+}
+
+func (v *pickerView) score(item *pickerItem) (int, bool) {
+	score, ok := fuzzyMatch(v.query, item.Text)
+	if ok && v.rank != nil {
+		score += v.rank(item.Value)
+	}
+	return score, ok
+}
+
+// add adds items to the list. It must be called in the UI goroutine.
+func (v *pickerView) add(items []pickerItem) {
+	for i := range items {
+		item := &items[i]
+		v.items = append(v.items, item)
+		if score, ok := v.score(item); ok {
+			v.matches = append(v.matches, pickerMatch{item, score})
+		}
+	}
+	v.sort()
+}
+
+// filter recomputes the matches after the query changed. When the query was
+// only extended, the items that didn't match before can't match now.
+func (v *pickerView) filter(old string) {
+	var matches pickerMatches
+	if strings.HasPrefix(v.query, old) {
+		for _, m := range v.matches {
+			if score, ok := v.score(m.item); ok {
+				matches = append(matches, pickerMatch{m.item, score})
+			}
+		}
+	} else {
+		for _, item := range v.items {
+			if score, ok := v.score(item); ok {
+				matches = append(matches, pickerMatch{item, score})
+			}
+		}
+	}
+	sort.Sort(matches)
+	v.matches = matches
+	v.selected = 0
+}
+
+// sort sorts the matches, keeping the selection on the same item while the
+// items stream in.
+func (v *pickerView) sort() {
+	var selected *pickerItem
+	if v.selected < len(v.matches) {
+		selected = v.matches[v.selected].item
+	}
+	sort.Sort(v.matches)
+	v.selected = 0
+	for i, m := range v.matches {
+		if m.item == selected {
+			v.selected = i
+			break
+		}
+	}
+}
+
+// stream runs produce in a separate goroutine to add the items as they are
+// found. send takes ownership of the items. produce must stop as soon as send
+// returns false, which happens when the View was closed or the editor quit.
+func (v *pickerView) stream(name string, produce func(send func(items []pickerItem) bool)) {
+	v.loading = true
+	wicore.Go(name, func() {
+		produce(func(items []pickerItem) bool {
+			return v.e.post(v.closed, func() {
+				v.add(items)
+				wicore.PostCommand(v.e, nil, "editor_redraw")
+			})
+		})
+		v.e.post(v.closed, func() {
+			v.loading = false
+			wicore.PostCommand(v.e, nil, "editor_redraw")
+		})
+	})
+}
+
+func (v *pickerView) Buffer() *raster.Buffer {
+	v.buffer.Fill(raster.Cell{R: ' ', F: v.DefaultFormat()})
+	f := v.DefaultFormat()
+	status := fmt.Sprintf("%d/%d", len(v.matches), len(v.items))
+	if v.loading {
+		status += "..."
+	}
+	v.buffer.DrawString("> "+v.query, 0, 0, f)
+	if x := raster.StringWidth(v.query) + 2; x < v.actualX {
+		// Cursor.
+		*v.buffer.Cell(x, 0) = raster.Cell{R: ' ', F: raster.CellFormat{Fg: f.Bg, Bg: f.Fg}}
+	}
+	if x := v.actualX - len(status); x > 0 {
+		v.buffer.DrawString(status, x, 0, f)
+	}
+	offset := 0
+	if v.selected >= v.actualY-1 {
+		offset = v.selected - v.actualY + 2
+	}
+	for i := offset; i < len(v.matches) && i-offset < v.actualY-1; i++ {
+		cf := f
+		if i == v.selected {
+			cf = raster.CellFormat{Fg: f.Bg, Bg: f.Fg}
+		}
+		v.buffer.DrawString(v.matches[i].item.Text, 0, i-offset+1, cf)
+	}
+	return v.buffer
+}
+
+// accept closes the View and runs the continuation with the selected item.
+func (v *pickerView) accept() {
+	if v.selected >= len(v.matches) {
+		return
+	}
+	cmds := [][]string{{"window_close", v.window.ID()}}
+	if len(v.continuation) != 0 {
+		cmd := make([]string, len(v.continuation)+1)
+		copy(cmd, v.continuation)
+		cmd[len(cmd)-1] = v.matches[v.selected].item.Value
+		cmds = append(cmds, cmd)
+	}
+	// The continuation is run in the context of the Window that was active
+	// before.
+	v.e.TriggerCommands(wicore.EnqueuedCommands{cmds, true, nil})
+}
+
+func (v *pickerView) onTerminalKeyPressed(k key.Press) {
+	if v.window == nil || v.e.ActiveWindow() != v.window {
+		return
+	}
+	old := v.query
+	switch {
+	case k.Key == key.Escape:
+		wicore.PostCommand(v.e, nil, "window_close", v.window.ID())
+	case k.Key == key.Enter:
+		v.accept()
+	case k.Key == key.Space:
+		v.query += " "
+	case k.Ch != '\000':
+		v.query += string(k.Ch)
+	}
+	if v.query != old {
+		v.filter(old)
+	}
+	wicore.PostCommand(v.e, nil, "editor_redraw")
+}
+
+// location formats the position as accepted by document_goto.
+func location(pos token.Position) string {
+	return fmt.Sprintf("%s:%d:%d", pos.Filename, pos.Line, pos.Column)
+}
+
+// positions sorts the positions by file, line and column.
+type positions []token.Position
+
+func (p positions) Len() int      { return len(p) }
+func (p positions) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p positions) Less(i, j int) bool {
+	if p[i].Filename != p[j].Filename {
+		return p[i].Filename < p[j].Filename
+	}
+	if p[i].Line != p[j].Line {
+		return p[i].Line < p[j].Line
+	}
+	return p[i].Column < p[j].Column
+}
+
+// pickLocations shows the locations in a floating picker to jump to one of
+// them. The text of the line is shown for the loaded documents.
+func (e *editor) pickLocations(title string, locs []token.Position) error {
+	sort.Sort(positions(locs))
+	items := make([]pickerItem, 0, len(locs))
+	for _, pos := range locs {
+		text := fmt.Sprintf("%s:%d:%d", filepath.Base(pos.Filename), pos.Line, pos.Column)
+		if d := e.findDocument(pos.Filename); d != nil && pos.Line <= len(d.content) {
+			text += "  " + strings.TrimSpace(d.content[pos.Line-1])
+		}
+		items = append(items, pickerItem{text, location(pos)})
+	}
+	if _, err := e.ExecuteCommand(e.rootWindow, "window_new", e.rootWindow.ID(), "floating", "picker", title, "document_goto"); err != nil {
+		return err
+	}
+	if picker, ok := newestChild(e.rootWindow).view.(*pickerView); ok {
+		picker.add(items)
+	}
+	return nil
+}
+
+func cmdToPicker(handler func(v *pickerView)) wicore.CommandImplHandler {
+	return func(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
+		v, ok := w.View().(*pickerView)
+		if !ok {
+			return nil, errors.New("internal error")
+		}
+		handler(v)
+		wicore.PostCommand(e, nil, "editor_redraw")
+		return nil, nil
+	}
+}
+
+func cmdPickerBackspace(v *pickerView) {
+	if r := []rune(v.query); len(r) != 0 {
+		old := v.query
+		v.query = string(r[:len(r)-1])
+		v.filter(old)
+	}
+}
+
+func cmdPickerNext(v *pickerView) {
+	if v.selected < len(v.matches)-1 {
+		v.selected++
+	}
+}
+
+func cmdPickerPrevious(v *pickerView) {
+	if v.selected > 0 {
+		v.selected--
+	}
+}
+
+// pickerViewFactory returns a View to select an item with fuzzy matching. The
+// arguments are the title and the continuation command line, which can be
+// empty.
+func pickerViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
+	dispatcher := makeCommands()
+	cmds := []wicore.Command{
+		&wicore.CommandImpl{
+			"picker_backspace",
+			nil,
+			cmdToPicker(cmdPickerBackspace),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Deletes the last character",
+			},
+			lang.Map{
+				lang.En: "Deletes the last character of the text being matched.",
+			},
+		},
+		&wicore.CommandImpl{
+			"picker_next",
+			nil,
+			cmdToPicker(cmdPickerNext),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Selects the next item",
+			},
+			lang.Map{
+				lang.En: "Selects the next item in the list.",
+			},
+		},
+		&wicore.CommandImpl{
+			"picker_previous",
+			nil,
+			cmdToPicker(cmdPickerPrevious),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Selects the previous item",
+			},
+			lang.Map{
+				lang.En: "Selects the previous item in the list.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+	bindings := makeKeyBindings()
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Backspace}, "picker_backspace")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Down}, "picker_next")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Up}, "picker_previous")
+
+	title := ""
+	var continuation []string
+	if len(args) > 0 {
+		title = args[0]
+	}
+	if len(args) > 1 {
+		continuation = wicore.SplitCommandLine(args[1])
+	}
+	v := &pickerView{
+		view{
+			commands:      dispatcher,
+			keyBindings:   bindings,
+			eventRegistry: e,
+			id:            id,
+			title:         title,
+			naturalX:      78,
+			naturalY:      maxPromptListHeight + 1,
+			defaultFormat: raster.CellFormat{Fg: colors.White, Bg: colors.Black},
+		},
+		e.(*editor),
+		continuation,
+		"",
+		nil,
+		nil,
+		0,
+		nil,
+		false,
+		make(chan struct{}),
+	}
+	v.events = append(v.events, e.RegisterTerminalKeyPressed(v.onTerminalKeyPressed))
+	return v
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/rpc"
 	"os"
 	"os/exec"
@@ -18,10 +19,71 @@ import (
 	"sync"
 	"time"
 
+	"github.com/wi-ed/wi/internal"
 	"github.com/wi-ed/wi/wicore"
 	"github.com/wi-ed/wi/wicore/lang"
 )
 
+// editorRPC implements internal.EditorRPC to let plugins send requests to the
+// editor. The pending requests fail once the editor quit.
+type editorRPC struct {
+	e *editor
+}
+
+func (r *editorRPC) TriggerCommands(packet internal.PacketCommands, out *[]internal.PacketCommandOutcome) error {
+	done := make(chan []wicore.CommandOutcome, 1)
+	cmds := packet.Cmds
+	cmds.Callback = func(outcomes []wicore.CommandOutcome) {
+		done <- outcomes
+	}
+	r.e.TriggerCommands(cmds)
+	var outcomes []wicore.CommandOutcome
+	select {
+	case outcomes = <-done:
+	case <-r.e.done:
+		return errors.New(editorQuit.String())
+	}
+	*out = make([]internal.PacketCommandOutcome, len(outcomes))
+	for i, o := range outcomes {
+		(*out)[i].Command = o.Command
+		(*out)[i].Result = o.Result
+		if o.Err != nil {
+			(*out)[i].Err = o.Err.Error()
+		}
+	}
+	return nil
+}
+
+func (r *editorRPC) Prompt(in wicore.Prompt, out *wicore.PromptAnswer) error {
+	done := make(chan wicore.PromptAnswer, 1)
+	r.e.Prompt(in, func(answer wicore.PromptAnswer) {
+		done <- answer
+	})
+	select {
+	case *out = <-done:
+		return nil
+	case <-r.e.done:
+		return errors.New(editorQuit.String())
+	}
+}
+
+func (r *editorRPC) GetSetting(in internal.PacketGetSetting, out *string) error {
+	done := make(chan string, 1)
+	r.e.deferred <- func() {
+		var w wicore.Window
+		if in.WindowID != "" {
+			w = wicore.FindWindow(r.e, in.WindowID)
+		}
+		done <- r.e.GetSetting(w, in.Name)
+	}
+	select {
+	case *out = <-done:
+		return nil
+	case <-r.e.done:
+		return errors.New(editorQuit.String())
+	}
+}
+
 // pluginProcess represents an out-of-process plugin.
 type pluginProcess struct {
 	lock        sync.Mutex
@@ -32,6 +94,9 @@ type pluginProcess struct {
 	initialized bool                 // Initialized late after async call Init() completed.
 	err         error                // If set, the plugin had an error and is quarantined.
 	listener    wicore.EventListener
+	editorLn    net.Listener // Socket the plugin connects to for EditorRPC.
+	editorConn  net.Conn     // Connection of the plugin to EditorRPC.
+	tmpDir      string       // Directory containing the socket.
 }
 
 func (p *pluginProcess) Close() error {
@@ -42,6 +107,7 @@ func (p *pluginProcess) Close() error {
 		err = p.listener.Close()
 		p.listener = nil
 	}
+	p.closeEditorRPC()
 	if p.client != nil {
 		tmp := 0
 		call := p.client.Go("PluginRPC.Quit", 0, &tmp, nil)
@@ -59,7 +125,9 @@ func (p *pluginProcess) Close() error {
 		p.client = nil
 	}
 	if p.proc != nil {
-		if err1 := p.proc.Kill(); err1 != nil {
+		// Give the process a chance to exit by itself once its connection is
+		// closed.
+		if err1 := stopProcess(p.proc, time.Second); err1 != nil {
 			err = err1
 		}
 		p.proc = nil
@@ -71,6 +139,96 @@ func (p *pluginProcess) Close() error {
 	return err
 }
 
+// stopProcess waits for the process to exit by itself, up to timeout, then
+// kills it.
+func stopProcess(proc *os.Process, timeout time.Duration) error {
+	exited := make(chan struct{})
+	wicore.Go("processWait", func() {
+		_, _ = proc.Wait()
+		close(exited)
+	})
+	select {
+	case <-exited:
+		return nil
+	case <-time.After(timeout):
+		return proc.Kill()
+	}
+}
+
+// Quitting tells the plugin the event EditorQuitting was sent and waits for
+// it to be processed, up to timeout.
+func (p *pluginProcess) Quitting(timeout time.Duration) error {
+	p.lock.Lock()
+	client := p.client
+	p.lock.Unlock()
+	if client == nil {
+		return nil
+	}
+	tmp := 0
+	call := client.Go("PluginRPC.Quitting", 0, &tmp, nil)
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-time.After(timeout):
+		return fmt.Errorf("%s timed out", p)
+	}
+}
+
+// closeEditorRPC stops serving EditorRPC. The lock must be held.
+func (p *pluginProcess) closeEditorRPC() {
+	if p.editorLn != nil {
+		_ = p.editorLn.Close()
+		p.editorLn = nil
+	}
+	if p.editorConn != nil {
+		_ = p.editorConn.Close()
+		p.editorConn = nil
+	}
+	if p.tmpDir != "" {
+		_ = os.RemoveAll(p.tmpDir)
+		p.tmpDir = ""
+	}
+}
+
+// serveEditorRPC accepts the connection of the plugin process and serves
+// EditorRPC on it.
+func (p *pluginProcess) serveEditorRPC(e wicore.Editor) {
+	p.lock.Lock()
+	ln := p.editorLn
+	p.lock.Unlock()
+	if ln == nil {
+		return
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		log.Printf("%s failed to connect to the editor: %s", p, err)
+		return
+	}
+	p.lock.Lock()
+	if p.editorLn == nil {
+		// Closed in the meantime.
+		p.lock.Unlock()
+		_ = conn.Close()
+		return
+	}
+	// Only one connection is accepted; the socket is not needed anymore.
+	_ = p.editorLn.Close()
+	p.editorLn = nil
+	_ = os.RemoveAll(p.tmpDir)
+	p.tmpDir = ""
+	p.editorConn = conn
+	p.lock.Unlock()
+
+	server := rpc.NewServer()
+	// Expose an object which doesn't have any method beside the ones exposed.
+	obj := struct{ internal.EditorRPC }{&editorRPC{e.(*editor)}}
+	if err := server.RegisterName("EditorRPC", obj); err != nil {
+		log.Printf("%s: %s", p, err)
+		return
+	}
+	server.ServeConn(conn)
+}
+
 func (p *pluginProcess) String() string {
 	return fmt.Sprintf("Plugin(%s, %d)", p.details.Name, p.pid)
 }
@@ -88,6 +246,9 @@ func (p *pluginProcess) Init(e wicore.Editor) {
 	// Make sure all plugins have their event registry properly registered
 	// before doing anything silly. This is purely a process-local setup.
 	p.listener = registerPluginEvents(p.client, e)
+	wicore.Go("serveEditorRPC", func() {
+		p.serveEditorRPC(e)
+	})
 
 	out := 0
 	details := wicore.EditorDetails{
@@ -129,8 +290,27 @@ func (p Plugins) Close() error {
 // loadPlugin starts a plugin and returns the process.
 func loadPlugin(cmdLine []string) (wicore.Plugin, error) {
 	log.Printf("loadPlugin(%v)", cmdLine)
+	// The plugin connects back to this socket to send requests to the editor.
+	tmpDir, err := ioutil.TempDir("", "wi")
+	if err != nil {
+		return nil, err
+	}
+	sock := filepath.Join(tmpDir, "editor")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		_ = os.RemoveAll(tmpDir)
+		return nil, err
+	}
+	success := false
+	defer func() {
+		if !success {
+			_ = ln.Close()
+			_ = os.RemoveAll(tmpDir)
+		}
+	}()
+
 	cmd := exec.Command(cmdLine[0], cmdLine[1:]...)
-	cmd.Env = append(os.Environ(), "WI=plugin")
+	cmd.Env = append(os.Environ(), "WI=plugin", "WI_EDITOR="+sock)
 
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -191,10 +371,14 @@ func loadPlugin(cmdLine []string) (wicore.Plugin, error) {
 		false,
 		nil,
 		nil,
+		ln,
+		nil,
+		tmpDir,
 	}
 	if err = p.client.Call("PluginRPC.GetInfo", lang.Active(), &p.details); err != nil {
 		return nil, err
 	}
+	success = true
 	log.Printf("%s is now functional", p)
 	return p, nil
 }
@@ -0,0 +1,106 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/internal"
+	"github.com/wi-ed/wi/wicore"
+)
+
+func TestEditorRPC(t *testing.T) {
+	defer keepLog(t)()
+
+	terminal := NewTerminalFake(80, 25, []TerminalEvent{})
+	ed, err := MakeEditor(terminal, true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+
+	r := &editorRPC{e}
+	var out []internal.PacketCommandOutcome
+	done := make(chan error, 1)
+	go func() {
+		packet := internal.PacketCommands{wicore.EnqueuedCommands{[][]string{{"set", "global", "tabstop", "3"}, {"get", "tabstop"}, {"invalid"}}, false, nil}}
+		done <- r.TriggerCommands(packet, &out)
+		wicore.PostCommand(e, nil, "editor_quit")
+	}()
+	ut.AssertEqual(t, 0, e.EventLoop())
+	ut.AssertEqual(t, nil, <-done)
+	ut.AssertEqual(t, 3, len(out))
+	ut.AssertEqual(t, "", out[0].Err)
+	ut.AssertEqual(t, wicore.CommandResult{"3"}, out[1].Result)
+	ut.AssertEqual(t, "Command \"invalid\" is not registered.", out[2].Err)
+}
+
+func TestEditorRPCGetSetting(t *testing.T) {
+	defer keepLog(t)()
+
+	ed, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+
+	r := &editorRPC{e}
+	var values []string
+	done := make(chan error, 1)
+	wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+		root := wicore.RootWindow(e.ActiveWindow()).ID()
+		go func() {
+			var err error
+			for _, in := range []internal.PacketGetSetting{{"", "tabstop"}, {root, "tabstop"}, {"", "unknown"}} {
+				out := ""
+				if err2 := r.GetSetting(in, &out); err2 != nil {
+					err = err2
+				}
+				values = append(values, out)
+			}
+			done <- err
+			wicore.PostCommand(e, nil, "editor_quit")
+		}()
+	}, "set", "global", "tabstop", "3")
+	ut.AssertEqual(t, 0, e.EventLoop())
+	ut.AssertEqual(t, nil, <-done)
+	ut.AssertEqual(t, []string{"3", "3", ""}, values)
+}
+
+func TestEditorRPCQuit(t *testing.T) {
+	defer keepLog(t)()
+
+	ed, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+
+	// The requests pending when the editor quits fail instead of blocking.
+	r := &editorRPC{e}
+	done := make(chan error, 1)
+	e.RegisterViewActivated(func(v wicore.View) {
+		if _, ok := v.(*promptView); ok {
+			wicore.PostCommand(e, nil, "editor_quit", "force")
+		}
+	})
+	go func() {
+		out := wicore.PromptAnswer{}
+		done <- r.Prompt(wicore.Prompt{wicore.PromptYesNoCancel, "Save?", nil}, &out)
+	}()
+	ut.AssertEqual(t, 0, e.EventLoop())
+	ut.AssertEqual(t, "The editor quit.", (<-done).Error())
+
+	// So do the requests sent afterward.
+	var outcomes []internal.PacketCommandOutcome
+	err = r.TriggerCommands(internal.PacketCommands{wicore.EnqueuedCommands{[][]string{{"get", "tabstop"}}, false, nil}}, &outcomes)
+	ut.AssertEqual(t, "The editor quit.", err.Error())
+	value := ""
+	ut.AssertEqual(t, "The editor quit.", r.GetSetting(internal.PacketGetSetting{"", "tabstop"}, &value).Error())
+}
@@ -0,0 +1,22 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package editor
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup does nothing; the processes started by the command are not
+// killed with it on this OS.
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+// killProcessGroup kills only the process.
+func killProcessGroup(p *os.Process) error {
+	return p.Kill()
+}
@@ -0,0 +1,366 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"errors"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/colors"
+	"github.com/wi-ed/wi/wicore/key"
+	"github.com/wi-ed/wi/wicore/lang"
+	"github.com/wi-ed/wi/wicore/raster"
+)
+
+// maxPromptListHeight is the maximum number of choices shown at once.
+const maxPromptListHeight = 15
+
+// promptView is a modal dialog box asking a question to the user.
+//
+// The answer is delivered to the callback, if any, and to the continuation
+// command, if any. The continuation is run with the answer appended as its last
+// argument. It is not run when a PromptInput or PromptList is cancelled.
+type promptView struct {
+	view
+	e            wicore.Editor
+	kind         wicore.PromptKind
+	question     string
+	choices      []string
+	text         string // Text typed for PromptInput.
+	selected     int    // Index of the selected choice for PromptList.
+	continuation []string
+	callback     func(answer wicore.PromptAnswer)
+	answered     bool
+}
+
+func (v *promptView) Close() error {
+	if !v.answered {
+		// The Window was closed by other means.
+		v.answered = true
+		if v.callback != nil {
+			v.callback(v.cancelAnswer())
+		}
+	}
+	return v.view.Close()
+}
+
+func (v *promptView) Buffer() *raster.Buffer {
+	f := v.DefaultFormat()
+	v.buffer.Fill(raster.Cell{R: ' ', F: f})
+	v.buffer.DrawString(v.question, 0, 0, f)
+	switch v.kind {
+	case wicore.PromptYesNoCancel:
+		v.buffer.DrawString(promptYesNoCancel.String(), 0, 1, f)
+	case wicore.PromptInput:
+		v.buffer.DrawString(v.text, 0, 1, f)
+		if x := raster.StringWidth(v.text); x < v.actualX {
+			*v.buffer.Cell(x, 1) = raster.Cell{R: ' ', F: raster.CellFormat{Fg: f.Bg, Bg: f.Fg}}
+		}
+	case wicore.PromptList:
+		offset := 0
+		if v.selected >= v.actualY-1 {
+			offset = v.selected - v.actualY + 2
+		}
+		for i := offset; i < len(v.choices) && i-offset < v.actualY-1; i++ {
+			cf := f
+			if i == v.selected {
+				cf = raster.CellFormat{Fg: f.Bg, Bg: f.Fg}
+			}
+			v.buffer.DrawString(v.choices[i], 0, i-offset+1, cf)
+		}
+	}
+	return v.buffer
+}
+
+func (v *promptView) cancelAnswer() wicore.PromptAnswer {
+	if v.kind == wicore.PromptYesNoCancel {
+		return wicore.PromptAnswer{true, "cancel"}
+	}
+	return wicore.PromptAnswer{true, ""}
+}
+
+// answer closes the dialog and delivers the answer.
+//
+// The Window is closed first so the continuation is run in the context of the
+// Window that was active before the prompt.
+func (v *promptView) answer(a wicore.PromptAnswer) {
+	if v.answered || v.window == nil {
+		return
+	}
+	v.answered = true
+	cmds := [][]string{{"window_close", v.window.ID()}}
+	if len(v.continuation) != 0 && (!a.Cancelled || v.kind == wicore.PromptYesNoCancel) {
+		cmd := make([]string, len(v.continuation)+1)
+		copy(cmd, v.continuation)
+		cmd[len(cmd)-1] = a.Answer
+		cmds = append(cmds, cmd)
+	}
+	callback := v.callback
+	v.e.TriggerCommands(wicore.EnqueuedCommands{
+		cmds,
+		true,
+		func(outcomes []wicore.CommandOutcome) {
+			if callback != nil {
+				callback(a)
+			}
+		},
+	})
+}
+
+func (v *promptView) accept() {
+	switch v.kind {
+	case wicore.PromptInput:
+		v.answer(wicore.PromptAnswer{false, v.text})
+	case wicore.PromptList:
+		if len(v.choices) != 0 {
+			v.answer(wicore.PromptAnswer{false, v.choices[v.selected]})
+		}
+	}
+}
+
+func (v *promptView) onTerminalKeyPressed(k key.Press) {
+	if v.window == nil || v.e.ActiveWindow() != v.window {
+		return
+	}
+	switch {
+	case k.Key == key.Escape:
+		v.answer(v.cancelAnswer())
+	case k.Key == key.Enter:
+		v.accept()
+	case v.kind == wicore.PromptYesNoCancel:
+		switch k.Ch {
+		case 'y':
+			v.answer(wicore.PromptAnswer{false, "yes"})
+		case 'n':
+			v.answer(wicore.PromptAnswer{false, "no"})
+		case 'c':
+			v.answer(v.cancelAnswer())
+		}
+	case v.kind == wicore.PromptInput:
+		if k.Key == key.Space {
+			v.text += " "
+		} else if k.Ch != '\000' {
+			v.text += string(k.Ch)
+		}
+	}
+	wicore.PostCommand(v.e, nil, "editor_redraw")
+}
+
+func cmdToPrompt(handler func(v *promptView)) wicore.CommandImplHandler {
+	return func(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
+		v, ok := w.View().(*promptView)
+		if !ok {
+			return nil, errors.New("internal error")
+		}
+		handler(v)
+		wicore.PostCommand(e, nil, "editor_redraw")
+		return nil, nil
+	}
+}
+
+func cmdPromptBackspace(v *promptView) {
+	if r := []rune(v.text); len(r) != 0 {
+		v.text = string(r[:len(r)-1])
+	}
+}
+
+func cmdPromptNext(v *promptView) {
+	if v.selected < len(v.choices)-1 {
+		v.selected++
+	}
+}
+
+func cmdPromptPrevious(v *promptView) {
+	if v.selected > 0 {
+		v.selected--
+	}
+}
+
+// promptViewFactory returns a modal dialog. The arguments are the kind, the
+// question, the continuation command line, which can be empty, then the
+// choices.
+func promptViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
+	dispatcher := makeCommands()
+	cmds := []wicore.Command{
+		&wicore.CommandImpl{
+			"prompt_backspace",
+			nil,
+			cmdToPrompt(cmdPromptBackspace),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Deletes the last character",
+			},
+			lang.Map{
+				lang.En: "Deletes the last character of the answer being typed.",
+			},
+		},
+		&wicore.CommandImpl{
+			"prompt_next",
+			nil,
+			cmdToPrompt(cmdPromptNext),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Selects the next choice",
+			},
+			lang.Map{
+				lang.En: "Selects the next choice in the list.",
+			},
+		},
+		&wicore.CommandImpl{
+			"prompt_previous",
+			nil,
+			cmdToPrompt(cmdPromptPrevious),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Selects the previous choice",
+			},
+			lang.Map{
+				lang.En: "Selects the previous choice in the list.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+	bindings := makeKeyBindings()
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Backspace}, "prompt_backspace")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Down}, "prompt_next")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Up}, "prompt_previous")
+
+	kind := wicore.PromptYesNoCancel
+	question := ""
+	var continuation []string
+	var choices []string
+	if len(args) > 0 {
+		kind = wicore.StringToPromptKind(args[0])
+	}
+	if len(args) > 1 {
+		question = args[1]
+	}
+	if len(args) > 2 {
+		continuation = wicore.SplitCommandLine(args[2])
+	}
+	if len(args) > 3 {
+		choices = args[3:]
+	}
+	text := ""
+	if kind == wicore.PromptInput && len(choices) != 0 {
+		text = choices[0]
+		choices = nil
+	}
+
+	width := raster.StringWidth(question)
+	height := 2
+	switch kind {
+	case wicore.PromptYesNoCancel:
+		if l := raster.StringWidth(promptYesNoCancel.String()); l > width {
+			width = l
+		}
+	case wicore.PromptInput:
+		if width < 40 {
+			width = 40
+		}
+	case wicore.PromptList:
+		for _, c := range choices {
+			if l := raster.StringWidth(c); l > width {
+				width = l
+			}
+		}
+		height = len(choices) + 1
+		if height > maxPromptListHeight+1 {
+			height = maxPromptListHeight + 1
+		}
+	}
+	v := &promptView{
+		view{
+			commands:      dispatcher,
+			keyBindings:   bindings,
+			eventRegistry: e,
+			id:            id,
+			title:         "Prompt",
+			naturalX:      width,
+			naturalY:      height,
+			defaultFormat: raster.CellFormat{Fg: colors.Black, Bg: colors.Cyan},
+		},
+		e,
+		kind,
+		question,
+		choices,
+		text,
+		0,
+		continuation,
+		nil,
+		false,
+	}
+	v.events = append(v.events, e.RegisterTerminalKeyPressed(v.onTerminalKeyPressed))
+	return v
+}
+
+// promptArgs returns the arguments to pass to promptViewFactory.
+func promptArgs(p wicore.Prompt, continuation string) []string {
+	return append([]string{p.Kind.String(), p.Question, continuation}, p.Choices...)
+}
+
+// Prompt implements wicore.Editor. It is safe to call from any goroutine.
+func (e *editor) Prompt(p wicore.Prompt, callback func(answer wicore.PromptAnswer)) {
+	e.deferred <- func() {
+		// The prompt is parented to the root Window so it is not closed along
+		// the Window that was active.
+		w := e.ActiveWindow()
+		args := append([]string{wicore.RootWindow(w).ID(), "floating", "prompt"}, promptArgs(p, "")...)
+		if _, err := e.ExecuteCommand(w, "window_new", args...); err != nil {
+			e.alertOnError(err)
+			callback(wicore.PromptAnswer{true, ""})
+			return
+		}
+		// window_new activates the new Window.
+		v, ok := e.ActiveWindow().View().(*promptView)
+		if !ok {
+			callback(wicore.PromptAnswer{true, ""})
+			return
+		}
+		v.callback = callback
+	}
+}
+
+// Commands.
+
+func cmdPrompt(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	kind := wicore.StringToPromptKind(args.String(0))
+	choices := args.Strings(3)
+	if kind == wicore.PromptList && len(choices) == 0 {
+		return nil, errors.New(promptNoChoice.String())
+	}
+	p := wicore.Prompt{kind, args.String(1), choices}
+	viewArgs := append([]string{wicore.RootWindow(w).ID(), "floating", "prompt"}, promptArgs(p, args.String(2))...)
+	return e.ExecuteCommand(w, "window_new", viewArgs...)
+}
+
+// RegisterPromptCommands registers the commands to ask questions to the
+// user.
+func RegisterPromptCommands(dispatcher wicore.CommandsW) {
+	cmds := []wicore.Command{
+		&wicore.CommandImpl{
+			"prompt",
+			wicore.CommandArgs{
+				{Name: "kind", Type: wicore.ArgEnum, Values: wicore.PromptKindNames},
+				{Name: "question", Type: wicore.ArgString},
+				{Name: "continuation", Type: wicore.ArgString},
+				{Name: "choices", Type: wicore.ArgString, Optional: true, Variadic: true},
+			},
+			cmdPrompt,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Asks a question",
+			},
+			lang.Map{
+				lang.En: "Asks a question in a modal dialog. 'yesno' is answered with 'yes', 'no' or 'cancel', 'input' with a line of text, using the first choice as the initial text, and 'list' with one of the choices. Once answered, the continuation command line is run with the answer appended as its last argument. The continuation is not run when an 'input' or 'list' prompt is dismissed.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+}
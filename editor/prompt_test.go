@@ -0,0 +1,64 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/key"
+)
+
+func TestPrompt(t *testing.T) {
+	defer keepLog(t)()
+
+	terminal := NewTerminalFake(80, 25, []TerminalEvent{})
+	editor, err := MakeEditor(terminal, true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = editor.Close()
+	}()
+
+	var answers []wicore.PromptAnswer
+	typeText := func(s string) {
+		for _, c := range s {
+			editor.TriggerTerminalKeyPressed(key.Press{Ch: c})
+		}
+	}
+	editor.Prompt(wicore.Prompt{wicore.PromptYesNoCancel, "Save?", nil}, func(a wicore.PromptAnswer) {
+		answers = append(answers, a)
+		// The continuation receives the typed text.
+		wicore.PostCommand(editor, nil, "prompt", "input", "Theme?", "set global theme", "da")
+		typeText("lx")
+		editor.TriggerTerminalMetaKeyPressed(key.Press{Key: key.Backspace})
+		editor.TriggerTerminalMetaKeyPressed(key.Press{Key: key.Backspace})
+		editor.TriggerTerminalMetaKeyPressed(key.Press{Key: key.Backspace})
+		editor.TriggerTerminalMetaKeyPressed(key.Press{Key: key.Backspace})
+		typeText("light")
+		editor.TriggerTerminalKeyPressed(key.Press{Key: key.Enter})
+		editor.Prompt(wicore.Prompt{wicore.PromptList, "Pick", []string{"a", "b", "c"}}, func(a wicore.PromptAnswer) {
+			answers = append(answers, a)
+			editor.Prompt(wicore.Prompt{wicore.PromptInput, "Name?", nil}, func(a wicore.PromptAnswer) {
+				answers = append(answers, a)
+				wicore.PostCommand(editor, nil, "editor_quit")
+			})
+			typeText("foo")
+			editor.TriggerTerminalKeyPressed(key.Press{Key: key.Escape})
+		})
+		editor.TriggerTerminalMetaKeyPressed(key.Press{Key: key.Down})
+		editor.TriggerTerminalMetaKeyPressed(key.Press{Key: key.Down})
+		editor.TriggerTerminalMetaKeyPressed(key.Press{Key: key.Up})
+		editor.TriggerTerminalKeyPressed(key.Press{Key: key.Enter})
+	})
+	typeText("n")
+	ut.AssertEqual(t, 0, editor.EventLoop())
+
+	expected := []wicore.PromptAnswer{{false, "no"}, {false, "b"}, {true, ""}}
+	ut.AssertEqual(t, expected, answers)
+	ut.AssertEqual(t, "light", editor.GetSetting(nil, "theme"))
+	// All the prompts were closed.
+	ut.AssertEqual(t, 0, len(wicore.RootWindow(editor.ActiveWindow()).ChildrenWindows()))
+}
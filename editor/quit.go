@@ -0,0 +1,192 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wi-ed/wi/wicore"
+)
+
+// quitTimeout is the maximum amount of time a plugin has to process the event
+// EditorQuitting.
+const quitTimeout = 2 * time.Second
+
+// quitter is implemented by the plugins that can veto the shutdown.
+type quitter interface {
+	Quitting(timeout time.Duration) error
+}
+
+// dirtyDocuments returns the loaded documents that are not saved.
+func (e *editor) dirtyDocuments() []*document {
+	var out []*document
+	for _, d := range e.sortedDocuments() {
+		if d.IsDirty() {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// quit tells EventLoop() to return exitCode. Plugins are closed first.
+//
+// Only the first call has an effect, e.g. a forced quit while the shutdown
+// sequence is in progress wins over the sequence.
+func (e *editor) quit(exitCode int) {
+	select {
+	case <-e.done:
+		return
+	default:
+	}
+	e.exitCode = exitCode
+	close(e.done)
+	if err := e.Close(); err != nil {
+		log.Printf("Failed to close the plugins: %s", err)
+	}
+	// This tells the editor.EventLoop() to quit.
+	e.deferred <- nil
+}
+
+// quitAbort stops the shutdown sequence.
+func (e *editor) quitAbort() {
+	e.quitting = false
+	e.quitVetoes = nil
+}
+
+// quitSaveNext asks the user what to do with the first dirty document then
+// continues with the rest.
+func (e *editor) quitSaveNext(docs []*document, exitCode int) {
+	if len(docs) == 0 {
+		e.quitNotify(exitCode)
+		return
+	}
+	d := docs[0]
+	name := d.filePath
+	if name == "" {
+		name = untitledDocument.String()
+	}
+	e.Prompt(wicore.Prompt{wicore.PromptYesNoCancel, quitSaveDocument.Sprintf(name), nil}, func(a wicore.PromptAnswer) {
+		switch a.Answer {
+		case "yes":
+			e.saveDocumentAs(d, func(err error) {
+				if err != nil {
+					e.alertOnError(err)
+					e.quitAbort()
+					return
+				}
+				e.quitSaveNext(docs[1:], exitCode)
+			})
+		case "no":
+			e.quitSaveNext(docs[1:], exitCode)
+		default:
+			e.quitAbort()
+		}
+	})
+}
+
+// saveDocumentAs saves the document, asking for the file path if it was never
+// saved.
+func (e *editor) saveDocumentAs(d *document, done func(err error)) {
+	if d.filePath != "" {
+		done(e.saveDocument(d, ""))
+		return
+	}
+	e.Prompt(wicore.Prompt{wicore.PromptInput, saveAs.String(), nil}, func(a wicore.PromptAnswer) {
+		if a.Cancelled || a.Answer == "" {
+			done(errors.New(noFilePath.String()))
+			return
+		}
+		done(e.saveDocument(d, a.Answer))
+	})
+}
+
+// quitNotify triggers EditorQuitting then waits for the listeners to veto.
+func (e *editor) quitNotify(exitCode int) {
+	e.TriggerEditorQuitting()
+	// The event is processed in the event queue, then the in-process listeners'
+	// commands are enqueued after. Wait for both to be processed. The steps are
+	// enqueued from another goroutine since the UI goroutine must not block on
+	// its own queue.
+	wicore.Go("quitNotify", func() {
+		e.post(nil, func() {
+			wicore.Go("quitNotify", func() {
+				e.post(nil, func() {
+					e.quitWaitPlugins(exitCode)
+				})
+			})
+		})
+	})
+}
+
+// quitWaitPlugins waits for the plugins to process EditorQuitting, then
+// finishes the shutdown unless it was vetoed.
+func (e *editor) quitWaitPlugins(exitCode int) {
+	if len(e.plugins) == 0 {
+		e.quitFinish(exitCode)
+		return
+	}
+	plugins := e.plugins
+	wicore.Go("quitWaitPlugins", func() {
+		var wg sync.WaitGroup
+		for _, p := range plugins {
+			q, ok := p.(quitter)
+			if !ok {
+				continue
+			}
+			wg.Add(1)
+			wicore.Go("pluginQuitting", func() {
+				defer wg.Done()
+				if err := q.Quitting(quitTimeout); err != nil {
+					log.Printf("Quitting failed: %s", err)
+				}
+			})
+		}
+		wg.Wait()
+		e.post(nil, func() {
+			e.quitFinish(exitCode)
+		})
+	})
+}
+
+func (e *editor) quitFinish(exitCode int) {
+	vetoes := e.quitVetoes
+	e.quitAbort()
+	if len(vetoes) != 0 {
+		e.alertOnError(errors.New(quitVetoed.Sprintf(strings.Join(vetoes, "; "))))
+		return
+	}
+	e.quit(exitCode)
+}
+
+// Commands.
+
+func cmdEditorQuit(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	exitCode := 0
+	if args.Has(1) {
+		exitCode = args.Int(1)
+	}
+	if args.String(0) == "force" {
+		e.quit(exitCode)
+		return nil, nil
+	}
+	if e.quitting {
+		return nil, errors.New(quitInProgress.String())
+	}
+	e.quitting = true
+	e.quitSaveNext(e.dirtyDocuments(), exitCode)
+	return nil, nil
+}
+
+func cmdEditorQuitVeto(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	if !e.quitting {
+		return nil, errors.New(quitNotInProgress.String())
+	}
+	e.quitVetoes = append(e.quitVetoes, args.String(0))
+	return nil, nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/key"
+)
+
+func TestQuitDirtyCancel(t *testing.T) {
+	defer keepLog(t)()
+
+	terminal := NewTerminalFake(80, 25, []TerminalEvent{})
+	editor, err := MakeEditor(terminal, true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = editor.Close()
+	}()
+
+	var questions []string
+	editor.RegisterViewActivated(func(v wicore.View) {
+		if p, ok := v.(*promptView); ok {
+			questions = append(questions, p.question)
+			editor.TriggerTerminalKeyPressed(key.Press{Ch: 'c'})
+			wicore.PostCommand(editor, nil, "editor_quit", "force", "3")
+		}
+	})
+	quitting := 0
+	editor.RegisterEditorQuitting(func() {
+		quitting++
+	})
+	wicore.PostCommand(editor, nil, "new")
+	editor.TriggerTerminalKeyPressed(key.Press{Ch: 'x'})
+	wicore.PostCommand(editor, nil, "quit")
+	ut.AssertEqual(t, 3, editor.EventLoop())
+
+	ut.AssertEqual(t, []string{"Save changes to <untitled>?"}, questions)
+	ut.AssertEqual(t, 0, quitting)
+}
+
+func TestQuitDirtySave(t *testing.T) {
+	defer keepLog(t)()
+
+	terminal := NewTerminalFake(80, 25, []TerminalEvent{})
+	editor, err := MakeEditor(terminal, true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = editor.Close()
+	}()
+
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	path := tmpDir + "/saved.txt"
+
+	var questions []string
+	editor.RegisterViewActivated(func(v wicore.View) {
+		if p, ok := v.(*promptView); ok {
+			questions = append(questions, p.question)
+			if p.kind == wicore.PromptYesNoCancel {
+				editor.TriggerTerminalKeyPressed(key.Press{Ch: 'y'})
+				return
+			}
+			for _, c := range path {
+				editor.TriggerTerminalKeyPressed(key.Press{Ch: c})
+			}
+			editor.TriggerTerminalKeyPressed(key.Press{Key: key.Enter})
+		}
+	})
+	quitting := 0
+	editor.RegisterEditorQuitting(func() {
+		quitting++
+	})
+	wicore.PostCommand(editor, nil, "new")
+	editor.TriggerTerminalKeyPressed(key.Press{Ch: 'x'})
+	wicore.PostCommand(editor, nil, "quit")
+	ut.AssertEqual(t, 0, editor.EventLoop())
+
+	ut.AssertEqual(t, []string{"Save changes to <untitled>?", "Save as:"}, questions)
+	ut.AssertEqual(t, 1, quitting)
+	content, err := ioutil.ReadFile(path)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "xDummy content\nReally\n", string(content))
+}
+
+func TestQuitVeto(t *testing.T) {
+	defer keepLog(t)()
+
+	terminal := NewTerminalFake(80, 25, []TerminalEvent{})
+	editor, err := MakeEditor(terminal, true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = editor.Close()
+	}()
+
+	editor.RegisterEditorQuitting(func() {
+		wicore.PostCommand(editor, func(o wicore.CommandOutcome) {
+			ut.AssertEqual(t, nil, o.Err)
+			// If the veto was ignored, the exit code would be 0.
+			wicore.PostCommand(editor, nil, "q!", "5")
+		}, "editor_quit_veto", "busy")
+	})
+	var vetoErr error
+	wicore.PostCommand(editor, func(o wicore.CommandOutcome) { vetoErr = o.Err }, "editor_quit_veto", "early")
+	wicore.PostCommand(editor, nil, "quit")
+	ut.AssertEqual(t, 5, editor.EventLoop())
+	ut.AssertEqual(t, "The editor is not quitting.", vetoErr.Error())
+}
+
+func TestQuitTwice(t *testing.T) {
+	defer keepLog(t)()
+
+	terminal := NewTerminalFake(80, 25, []TerminalEvent{})
+	editor, err := MakeEditor(terminal, true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = editor.Close()
+	}()
+
+	// The second quit must be ignored, not panic.
+	editor.TriggerCommands(wicore.EnqueuedCommands{[][]string{{"editor_quit", "force", "2"}, {"editor_quit", "force", "3"}}, false, nil})
+	ut.AssertEqual(t, 2, editor.EventLoop())
+}
+
+func TestQuitForceDuringQuit(t *testing.T) {
+	defer keepLog(t)()
+
+	terminal := NewTerminalFake(80, 25, []TerminalEvent{})
+	editor, err := MakeEditor(terminal, true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = editor.Close()
+	}()
+
+	editor.RegisterEditorQuitting(func() {
+		wicore.PostCommand(editor, nil, "editor_quit", "force", "4")
+	})
+	wicore.PostCommand(editor, nil, "quit")
+	ut.AssertEqual(t, 4, editor.EventLoop())
+}
@@ -0,0 +1,221 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/lang"
+	"github.com/wi-ed/wi/wicore/raster"
+)
+
+// sessionVersion is the version of the session file format.
+const sessionVersion = 1
+
+// transientViewFactories are the views that are not persisted in a session.
+var transientViewFactories = map[string]bool{
+	"buffers":       true,
+	"command":       true,
+	"infobar_alert": true,
+	"picker":        true,
+	"prompt":        true,
+	"text":          true,
+}
+
+// sessionView is implemented by the View that have a state to persist in a
+// session, in addition to the arguments passed to their ViewFactory.
+type sessionView interface {
+	sessionState() interface{}
+	restoreSessionState(data []byte) error
+}
+
+// session is the content of a session file.
+type session struct {
+	Version int
+	Active  string          // ID of the active Window when the session was saved.
+	Windows []sessionWindow // Children of the root Window.
+}
+
+// sessionWindow is a Window and its View.
+type sessionWindow struct {
+	ID       string // ID of the Window when the session was saved.
+	Docking  string
+	Border   string
+	Rect     raster.Rect // Only used for floating Window; others are laid out by their parent.
+	Factory  string
+	Args     []string        `json:",omitempty"`
+	State    json.RawMessage `json:",omitempty"`
+	Children []sessionWindow `json:",omitempty"`
+}
+
+// saveSessionWindows returns the persistable children of w.
+func saveSessionWindows(w *window) ([]sessionWindow, error) {
+	out := []sessionWindow{}
+	for _, c := range w.childrenWindows {
+		if transientViewFactories[c.factoryName] {
+			continue
+		}
+		s := sessionWindow{
+			ID:      c.ID(),
+			Docking: wicore.DockingTypeName(c.docking),
+			Border:  wicore.BorderTypeName(c.border),
+			Rect:    c.rect,
+			Factory: c.factoryName,
+			Args:    c.factoryArgs,
+		}
+		if v, ok := c.view.(sessionView); ok {
+			b, err := json.Marshal(v.sessionState())
+			if err != nil {
+				return nil, err
+			}
+			s.State = b
+		}
+		children, err := saveSessionWindows(c)
+		if err != nil {
+			return nil, err
+		}
+		s.Children = children
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// restoreSessionWindows recreates the Windows under parent. It continues on
+// failure and returns all the errors. ids maps the saved IDs to the new
+// Windows.
+func (e *editor) restoreSessionWindows(parent *window, windows []sessionWindow, ids map[string]*window) []error {
+	var errs []error
+	for _, s := range windows {
+		args := append([]string{parent.ID(), s.Docking, s.Factory}, s.Args...)
+		if _, err := e.ExecuteCommand(parent, "window_new", args...); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		// Keep the saved order; window_new puts a DockingFill Window first.
+		child := newestChild(parent)
+		for i, c := range parent.childrenWindows {
+			if c == child {
+				copy(parent.childrenWindows[i:], parent.childrenWindows[i+1:])
+				parent.childrenWindows[len(parent.childrenWindows)-1] = child
+				break
+			}
+		}
+		if b := wicore.StringToBorderType(s.Border); b >= 0 && b != child.border {
+			child.border = b
+			if child.windowBuffer != nil {
+				child.updateBorder()
+			}
+		}
+		if child.docking == wicore.DockingFloating && !s.Rect.Empty() {
+			child.setRect(s.Rect)
+		}
+		parent.resizeChildren()
+		if v, ok := child.view.(sessionView); ok && len(s.State) != 0 {
+			if err := v.restoreSessionState(s.State); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		ids[s.ID] = child
+		errs = append(errs, e.restoreSessionWindows(child, s.Children, ids)...)
+	}
+	return errs
+}
+
+// Commands.
+
+func cmdSessionLoad(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	b, err := ioutil.ReadFile(args.String(0))
+	if err != nil {
+		return nil, err
+	}
+	s := &session{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+	if s.Version != sessionVersion {
+		return nil, fmt.Errorf(sessionUnsupportedVersion.String(), s.Version)
+	}
+	if len(e.dirtyDocuments()) != 0 {
+		return nil, errors.New(sessionDirty.String())
+	}
+
+	// Replace the whole Window tree.
+	for len(e.rootWindow.childrenWindows) != 0 {
+		c := e.rootWindow.childrenWindows[0]
+		if _, err := e.ExecuteCommand(e.rootWindow, "window_close", c.ID()); err != nil {
+			return nil, err
+		}
+	}
+	ids := map[string]*window{}
+	errs := e.restoreSessionWindows(e.rootWindow, s.Windows, ids)
+	if active := ids[s.Active]; active != nil && !active.view.IsDisabled() {
+		if err := e.activateWindow(active); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	wicore.PostCommand(e, nil, "editor_redraw")
+	if len(errs) != 0 {
+		msgs := make([]string, len(errs))
+		for i, err := range errs {
+			log.Printf("session_load: %s", err)
+			msgs[i] = err.Error()
+		}
+		return nil, errors.New(sessionPartial.Sprintf(strings.Join(msgs, "; ")))
+	}
+	return nil, nil
+}
+
+func cmdSessionSave(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	windows, err := saveSessionWindows(e.rootWindow)
+	if err != nil {
+		return nil, err
+	}
+	s := &session{sessionVersion, e.ActiveWindow().ID(), windows}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return nil, ioutil.WriteFile(args.String(0), append(b, '\n'), 0644)
+}
+
+// RegisterSessionCommands registers the commands to save and restore the
+// layout of the editor.
+func RegisterSessionCommands(dispatcher wicore.CommandsW) {
+	cmds := []wicore.Command{
+		&privilegedCommandImpl{
+			"session_load",
+			wicore.CommandArgs{{Name: "path", Type: wicore.ArgPath}},
+			cmdSessionLoad,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Restores a session",
+			},
+			lang.Map{
+				lang.En: "Replaces all the windows with the ones saved in a session file by session_save, reopening the documents at their last cursor position. It fails if a document is not saved.",
+			},
+		},
+		&privilegedCommandImpl{
+			"session_save",
+			wicore.CommandArgs{{Name: "path", Type: wicore.ArgPath}},
+			cmdSessionSave,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Saves the session",
+			},
+			lang.Map{
+				lang.En: "Saves the window layout, the views, the documents they show and the cursor and scroll positions to a JSON file. Use session_load or the -session flag to restore it.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+)
+
+func TestSession(t *testing.T) {
+	defer keepLog(t)()
+
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	docPath := tmpDir + "/doc.txt"
+	sessionPath := tmpDir + "/session.json"
+	ut.AssertEqual(t, nil, ioutil.WriteFile(docPath, []byte("first\nsecond\nthird\n"), 0600))
+
+	editor, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = editor.Close()
+	}()
+	wicore.PostCommand(editor, nil, "editor_bootstrap_ui")
+	wicore.PostCommand(editor, nil, "window_new", "0", "fill", "new_document", docPath)
+	wicore.PostCommand(editor, nil, "document_cursor_down")
+	wicore.PostCommand(editor, nil, "document_cursor_right")
+	var saveErr error
+	wicore.PostCommand(editor, func(o wicore.CommandOutcome) { saveErr = o.Err }, "session_save", sessionPath)
+	wicore.PostCommand(editor, nil, "editor_quit")
+	ut.AssertEqual(t, 0, editor.EventLoop())
+	ut.AssertEqual(t, nil, saveErr)
+
+	b, err := ioutil.ReadFile(sessionPath)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, true, strings.Contains(string(b), "\"Factory\": \"status_root\""))
+
+	editor2, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = editor2.Close()
+	}()
+	var loadErr, invalidErr error
+	var restored, clamped documentViewState
+	wicore.PostCommand(editor2, func(o wicore.CommandOutcome) {
+		loadErr = o.Err
+		v := editor2.ActiveWindow().View().(*documentView)
+		restored = v.documentViewState
+		// The positions of a session file edited by hand are clamped.
+		invalidErr = v.restoreSessionState([]byte(`{"CursorLine": -3, "CursorColumn": -1, "OffsetLine": -2, "OffsetColumn": -4}`))
+		clamped = v.documentViewState
+	}, "session_load", sessionPath)
+	wicore.PostCommand(editor2, nil, "editor_quit")
+	ut.AssertEqual(t, 0, editor2.EventLoop())
+	ut.AssertEqual(t, nil, loadErr)
+	ut.AssertEqual(t, nil, invalidErr)
+	ut.AssertEqual(t, documentViewState{1, 1, 1, 0, 0}, restored)
+	ut.AssertEqual(t, documentViewState{0, 0, 0, 0, 0}, clamped)
+
+	v, ok := editor2.ActiveWindow().View().(*documentView)
+	ut.AssertEqual(t, true, ok)
+	ut.AssertEqual(t, docPath, v.document.filePath)
+	ut.AssertEqual(t, "second\n", v.document.content[1])
+	root := wicore.RootWindow(editor2.ActiveWindow())
+	ut.AssertEqual(t, 2, len(root.ChildrenWindows()))
+}
+
+func TestSessionFillOrder(t *testing.T) {
+	defer keepLog(t)()
+
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	pathA := tmpDir + "/a.txt"
+	pathB := tmpDir + "/b.txt"
+	sessionPath := tmpDir + "/session.json"
+	ut.AssertEqual(t, nil, ioutil.WriteFile(pathA, []byte("a\n"), 0600))
+	ut.AssertEqual(t, nil, ioutil.WriteFile(pathB, []byte("b\n"), 0600))
+	paths := func(e wicore.Editor) []string {
+		var out []string
+		for _, w := range wicore.RootWindow(e.ActiveWindow()).ChildrenWindows() {
+			if v, ok := w.View().(*documentView); ok {
+				out = append(out, filepath.Base(v.document.filePath))
+			}
+		}
+		return out
+	}
+
+	editor, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = editor.Close()
+	}()
+	wicore.PostCommand(editor, nil, "editor_bootstrap_ui")
+	wicore.PostCommand(editor, nil, "window_new", "0", "fill", "new_document", pathA)
+	wicore.PostCommand(editor, nil, "window_new", "0", "fill", "new_document", pathB)
+	wicore.PostCommand(editor, nil, "session_save", sessionPath)
+	wicore.PostCommand(editor, nil, "editor_quit")
+	ut.AssertEqual(t, 0, editor.EventLoop())
+	// The visible DockingFill Window is the first one.
+	ut.AssertEqual(t, []string{"b.txt", "a.txt"}, paths(editor))
+
+	editor2, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = editor2.Close()
+	}()
+	wicore.PostCommand(editor2, nil, "session_load", sessionPath)
+	wicore.PostCommand(editor2, nil, "editor_quit")
+	ut.AssertEqual(t, 0, editor2.EventLoop())
+	ut.AssertEqual(t, []string{"b.txt", "a.txt"}, paths(editor2))
+}
+
+func TestOpenUnreadable(t *testing.T) {
+	defer keepLog(t)()
+
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+
+	editor, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = editor.Close()
+	}()
+	wicore.PostCommand(editor, nil, "editor_bootstrap_ui")
+	var before int
+	var openErr error
+	wicore.PostCommand(editor, func(o wicore.CommandOutcome) {
+		before = len(editor.AllDocuments())
+		_, openErr = editor.ExecuteCommand(editor.ActiveWindow(), "document_open", tmpDir)
+	}, "editor_redraw")
+	wicore.PostCommand(editor, nil, "editor_quit", "force")
+	ut.AssertEqual(t, 0, editor.EventLoop())
+	ut.AssertEqual(t, true, openErr != nil)
+	// No empty document is shown instead.
+	ut.AssertEqual(t, before, len(editor.AllDocuments()))
+}
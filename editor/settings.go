@@ -0,0 +1,210 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"errors"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/colors"
+	"github.com/wi-ed/wi/wicore/lang"
+	"github.com/wi-ed/wi/wicore/raster"
+)
+
+// themes are the valid values for the "theme" setting.
+var themes = map[string]raster.CellFormat{
+	"dark":  {Fg: colors.BrightYellow, Bg: colors.Black},
+	"light": {Fg: colors.Black, Bg: colors.White},
+}
+
+// settings holds the registered settings and the values set at each scope.
+type settings struct {
+	defs   map[string]wicore.Setting
+	values map[string]map[string]string // Keyed by the owner ID; "" is the global scope.
+}
+
+func makeSettings() *settings {
+	s := &settings{
+		defs:   make(map[string]wicore.Setting),
+		values: make(map[string]map[string]string),
+	}
+	for _, def := range wicore.DefaultSettings {
+		s.defs[def.Name] = def
+	}
+	return s
+}
+
+func (s *settings) get(owner, name string) (string, bool) {
+	v, ok := s.values[owner][name]
+	return v, ok
+}
+
+func (s *settings) set(owner, name, value string) {
+	m := s.values[owner]
+	if m == nil {
+		m = map[string]string{}
+		s.values[owner] = m
+	}
+	m[name] = value
+}
+
+// rename moves the values set on the owner from to the owner to, e.g. when a
+// document is saved under a new file path.
+func (s *settings) rename(from, to string) {
+	if from == to {
+		return
+	}
+	if m, ok := s.values[from]; ok {
+		s.values[to] = m
+		delete(s.values, from)
+	}
+}
+
+// forgetWindow discards the values set on a Window tree.
+func (s *settings) forgetWindow(w wicore.Window) {
+	for _, c := range w.ChildrenWindows() {
+		s.forgetWindow(c)
+	}
+	delete(s.values, w.ID())
+}
+
+// getDocument returns the Document viewed in the Window w, if any.
+func getDocument(w wicore.Window) wicore.Document {
+	if d, ok := w.View().(wicore.DocumentView); ok {
+		return d.Document()
+	}
+	return nil
+}
+
+// settingOwner returns the ID of the object holding the values for scope as
+// seen from the Window w.
+func settingOwner(w wicore.Window, scope wicore.SettingScope) (string, error) {
+	switch scope {
+	case wicore.WindowScope:
+		return w.ID(), nil
+	case wicore.DocumentScope:
+		d := getDocument(w)
+		if d == nil {
+			return "", errors.New(noDocument.String())
+		}
+		return d.ID(), nil
+	default:
+		return "", nil
+	}
+}
+
+func (e *editor) RegisterSetting(s wicore.Setting) bool {
+	_, present := e.settings.defs[s.Name]
+	e.settings.defs[s.Name] = s
+	return !present
+}
+
+func (e *editor) GetSetting(w wicore.Window, name string) string {
+	def, ok := e.settings.defs[name]
+	if !ok {
+		return ""
+	}
+	if w == nil {
+		w = e.ActiveWindow()
+	}
+	if d := getDocument(w); d != nil {
+		if v, ok := e.settings.get(d.ID(), name); ok {
+			return v
+		}
+	}
+	for c := w; c != nil; c = c.Parent() {
+		if v, ok := e.settings.get(c.ID(), name); ok {
+			return v
+		}
+	}
+	if v, ok := e.settings.get("", name); ok {
+		return v
+	}
+	return def.Default
+}
+
+// Commands.
+
+func cmdGet(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	name := args.String(0)
+	if _, ok := e.settings.defs[name]; !ok {
+		return nil, errors.New(unknownSetting.Sprintf(name))
+	}
+	value := e.GetSetting(w, name)
+	if args.Has(1) {
+		scope := wicore.StringToSettingScope(args.String(1))
+		owner, err := settingOwner(w, scope)
+		if err != nil {
+			return nil, err
+		}
+		v, ok := e.settings.get(owner, name)
+		if !ok {
+			return nil, errors.New(settingNotSet.Sprintf(name, scope))
+		}
+		value = v
+	}
+	return wicore.CommandResult{value}, nil
+}
+
+func cmdSet(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	scope := wicore.StringToSettingScope(args.String(0))
+	name := args.String(1)
+	def, ok := e.settings.defs[name]
+	if !ok {
+		return nil, errors.New(unknownSetting.Sprintf(name))
+	}
+	value, err := def.Normalize(args.String(2))
+	if err != nil {
+		return nil, err
+	}
+	owner, err := settingOwner(w, scope)
+	if err != nil {
+		return nil, err
+	}
+	e.settings.set(owner, name, value)
+	e.TriggerSettingChanged(scope, owner, name, value)
+	wicore.PostCommand(e, nil, "editor_redraw")
+	return nil, nil
+}
+
+// RegisterSettingCommands registers the commands to manipulate settings.
+func RegisterSettingCommands(dispatcher wicore.CommandsW) {
+	cmds := []wicore.Command{
+		&privilegedCommandImpl{
+			"get",
+			wicore.CommandArgs{
+				{Name: "name", Type: wicore.ArgString},
+				{Name: "scope", Type: wicore.ArgEnum, Optional: true, Values: wicore.SettingScopeNames},
+			},
+			cmdGet,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Gets a setting value",
+			},
+			lang.Map{
+				lang.En: "Gets the effective value of a setting in the current window. When a scope is specified, gets the value set at this scope only.",
+			},
+		},
+		&privilegedCommandImpl{
+			"set",
+			wicore.CommandArgs{
+				{Name: "scope", Type: wicore.ArgEnum, Values: wicore.SettingScopeNames},
+				{Name: "name", Type: wicore.ArgString},
+				{Name: "value", Type: wicore.ArgString},
+			},
+			cmdSet,
+			wicore.EditorCategory,
+			lang.Map{
+				lang.En: "Sets a setting value",
+			},
+			lang.Map{
+				lang.En: "Sets a setting value. A global value applies everywhere, a window value applies to the current window and its children and a document value applies to the current document in every window. The document value has precedence over the window value, which has precedence over the global value.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+}
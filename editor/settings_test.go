@@ -0,0 +1,55 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+)
+
+func TestSettings(t *testing.T) {
+	defer keepLog(t)()
+
+	terminal := NewTerminalFake(80, 25, []TerminalEvent{})
+	editor, err := MakeEditor(terminal, true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = editor.Close()
+	}()
+
+	f, err := ioutil.TempFile("", "wirc")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.Remove(f.Name())
+	}()
+	_, err = f.WriteString("# Comment.\n\nset global tabstop 4\nset global wordwrap on\nset global theme blue\n")
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, nil, f.Close())
+
+	var changed []string
+	editor.RegisterSettingChanged(func(scope wicore.SettingScope, owner, name, value string) {
+		changed = append(changed, fmt.Sprintf("%s %s=%s", scope, name, value))
+	})
+	ut.AssertEqual(t, nil, RunConfig(editor, f.Name()))
+	wicore.PostCommand(editor, nil, "new")
+	wicore.PostCommand(editor, nil, "set", "document", "tabstop", "2")
+	var got wicore.CommandOutcome
+	wicore.PostCommand(editor, func(o wicore.CommandOutcome) { got = o }, "get", "tabstop", "window")
+	wicore.PostCommand(editor, nil, "editor_quit")
+	ut.AssertEqual(t, 0, editor.EventLoop())
+
+	ut.AssertEqual(t, []string{"global tabstop=4", "global wordwrap=true", "document tabstop=2"}, changed)
+	ut.AssertEqual(t, "Setting \"tabstop\" is not set in the window scope.", got.Err.Error())
+	ut.AssertEqual(t, "2", editor.GetSetting(nil, "tabstop"))
+	ut.AssertEqual(t, "true", editor.GetSetting(nil, "wordwrap"))
+	ut.AssertEqual(t, "dark", editor.GetSetting(nil, "theme"))
+	ut.AssertEqual(t, "4", editor.GetSetting(wicore.RootWindow(editor.ActiveWindow()), "tabstop"))
+	ut.AssertEqual(t, "", editor.GetSetting(nil, "unknown"))
+}
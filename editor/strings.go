@@ -12,35 +12,411 @@ var activateDisabled = lang.Map{
 	lang.En: "Can't activate a disabled view.",
 }
 
+var bufferDirty = lang.Map{
+	lang.En: "Buffer %d is modified; save it first.",
+}
+
+var bufferNone = lang.Map{
+	lang.En: "No buffer is loaded.",
+}
+
+var bufferNotFound = lang.Map{
+	lang.En: "There is no buffer %d.",
+}
+
+var buffersTitle = lang.Map{
+	lang.En: "Buffers",
+}
+
+var buffersViews = lang.Map{
+	lang.En: "%d windows",
+}
+
+var buildCancelled = lang.Map{
+	lang.En: "cancelled",
+}
+
+var buildExited = lang.Map{
+	lang.En: "failed after %s: %s",
+}
+
+var buildRunning = lang.Map{
+	lang.En: "running",
+}
+
+var buildSucceeded = lang.Map{
+	lang.En: "succeeded after %s",
+}
+
 var cantAddTwoWindowWithSameDocking = lang.Map{
 	lang.En: "Can't create two windows with the same docking \"%s\".",
 }
 
-var invalidDocking = lang.Map{
-	lang.En: "String \"%s\" does not refer to a valid Docking type.",
+var cantCloseRootWindow = lang.Map{
+	lang.En: "Can't close the root window.",
+}
+
+var commandSkipped = lang.Map{
+	lang.En: "Command \"%s\" was skipped due to a previous failure.",
+}
+
+var coverageNoFile = lang.Map{
+	lang.En: "None of the files of %s were found.",
+}
+
+var diagnosticsEmpty = lang.Map{
+	lang.En: "No diagnostics.",
+}
+
+var diagnosticsTitle = lang.Map{
+	lang.En: "Diagnostics: %d errors, %d warnings",
+}
+
+var documentAlreadyLoaded = lang.Map{
+	lang.En: "%s is already loaded in another buffer.",
+}
+
+var documentNotFound = lang.Map{
+	lang.En: "There is no loaded document \"%s\".",
+}
+
+var editorQuit = lang.Map{
+	lang.En: "The editor quit.",
+}
+
+var emptyCommand = lang.Map{
+	lang.En: "Empty command.",
+}
+
+var emptyDocument = lang.Map{
+	lang.En: "<Empty document>",
+}
+
+var fileChangedDiffTitle = lang.Map{
+	lang.En: "Changes on disk to %s",
+}
+
+var fileChangedOnDisk = lang.Map{
+	lang.En: "%s was modified on disk.",
+}
+
+var fileTreeCreate = lang.Map{
+	lang.En: "New file in %s (end with / for a directory):",
+}
+
+var fileTreeDelete = lang.Map{
+	lang.En: "Delete %s?",
+}
+
+var fileTreeRename = lang.Map{
+	lang.En: "Rename %s to:",
+}
+
+var findFileTitle = lang.Map{
+	lang.En: "Find file in %s",
+}
+
+var foldSummary = lang.Map{
+	lang.En: "··· %d lines",
+}
+
+var goTestEmpty = lang.Map{
+	lang.En: "No test was run yet.",
+}
+
+var goTestFailed = lang.Map{
+	lang.En: "%s failed",
+}
+
+var goTestOutputTitle = lang.Map{
+	lang.En: "Output of %s",
+}
+
+var goTestRunningTitle = lang.Map{
+	lang.En: "Tests running: %d passed, %d failed, %d skipped",
+}
+
+var goTestTitle = lang.Map{
+	lang.En: "Tests: %d passed, %d failed, %d skipped",
+}
+
+var gotoSymbolTitle = lang.Map{
+	lang.En: "Symbols of %s",
+}
+
+var helpCategoryCommands = lang.Map{
+	lang.En: "Commands",
+}
+
+var helpCategoryDebug = lang.Map{
+	lang.En: "Debugging",
+}
+
+var helpCategoryEditor = lang.Map{
+	lang.En: "Editor",
+}
+
+var helpCategoryUnknown = lang.Map{
+	lang.En: "Miscellaneous",
+}
+
+var helpCategoryWindow = lang.Map{
+	lang.En: "Windows",
+}
+
+var helpInsertKey = lang.Map{
+	lang.En: "%s (insert)",
+}
+
+var helpKeys = lang.Map{
+	lang.En: "Keys: %s",
+}
+
+var helpNoMatch = lang.Map{
+	lang.En: "No command matches.",
+}
+
+var helpSearchResults = lang.Map{
+	lang.En: "Commands matching \"%s\":",
+}
+
+var helpTitle = lang.Map{
+	lang.En: "Help",
+}
+
+var helpUnknownFormat = lang.Map{
+	lang.En: "Unknown help format \"%s\"; use \"markdown\" or \"man\".",
+}
+
+var invalidBuildKind = lang.Map{
+	lang.En: "Invalid build kind \"%s\"; expected build or run.",
+}
+
+var invalidColor = lang.Map{
+	lang.En: "Invalid color \"%s\".",
+}
+
+var invalidCoverProfile = lang.Map{
+	lang.En: "Invalid coverage profile on line %d.",
+}
+
+var invalidDiagnostics = lang.Map{
+	lang.En: "Each diagnostic is a range, a severity and a message.",
+}
+
+var invalidLine = lang.Map{
+	lang.En: "Invalid line %d.",
 }
 
-var invalidRect = lang.Map{
-	lang.En: "\"%s, %s, %s, %s\" does not refer to a valid Rect.",
+var invalidLocation = lang.Map{
+	lang.En: "Invalid location \"%s\"; expected path:line or path:line:column.",
+}
+
+var invalidRange = lang.Map{
+	lang.En: "Invalid range \"%s\"; use line:col or line:col-line:col.",
+}
+
+var invalidSeverity = lang.Map{
+	lang.En: "Invalid severity \"%s\"; use error, warning, info or hint.",
+}
+
+var invalidSign = lang.Map{
+	lang.En: "A sign is one or two characters, got \"%s\".",
 }
 
 var invalidViewFactory = lang.Map{
 	lang.En: "\"%s\" does not refer to a valid ViewFactory. Make sure the view factory was properly registered.",
 }
 
-var isNotValidWindow = lang.Map{
-	lang.En: "ID \"%s\" does not refer to a valid window ID.",
+var jumpListEnd = lang.Map{
+	lang.En: "At the end of the jump list.",
+}
+
+var jumpListStart = lang.Map{
+	lang.En: "At the start of the jump list.",
+}
+
+var lspCompletionTitle = lang.Map{
+	lang.En: "Completions",
+}
+
+var lspHoverTitle = lang.Map{
+	lang.En: "Hover",
+}
+
+var lspInvalidEdits = lang.Map{
+	lang.En: "The language server sent overlapping or invalid edits.",
+}
+
+var lspNoResult = lang.Map{
+	lang.En: "The language server returned no result.",
+}
+
+var lspRenamePrompt = lang.Map{
+	lang.En: "Rename %s to:",
+}
+
+var noBuildCommand = lang.Map{
+	lang.En: "No %s command configured for \"%s\"; use build_command.",
+}
+
+var noBuildOutput = lang.Map{
+	lang.En: "Nothing was built yet.",
+}
+
+var noDefinition = lang.Map{
+	lang.En: "No definition found for \"%s\".",
+}
+
+var noDocument = lang.Map{
+	lang.En: "The current window doesn't contain a document.",
+}
+
+var noFilePath = lang.Map{
+	lang.En: "The document has no file path.",
+}
+
+var noFold = lang.Map{
+	lang.En: "There is no fold at the cursor.",
+}
+
+var noGoDocument = lang.Map{
+	lang.En: "The current document is not a Go file.",
+}
+
+var noIdentifier = lang.Map{
+	lang.En: "There is no identifier at the cursor.",
+}
+
+var noLanguageServer = lang.Map{
+	lang.En: "No language server is configured for %s; use lsp_server.",
+}
+
+var noMoreDiagnostics = lang.Map{
+	lang.En: "There are no more diagnostics in this direction.",
+}
+
+var noMoreQuickfix = lang.Map{
+	lang.En: "There are no more errors in this direction.",
+}
+
+var noTestAtCursor = lang.Map{
+	lang.En: "The cursor is not in a test function.",
+}
+
+var noTestInFile = lang.Map{
+	lang.En: "The document has no test function.",
 }
 
 var notFound = lang.Map{
 	lang.En: "Command \"%s\" is not registered.",
 }
 
+var notGoDocument = lang.Map{
+	lang.En: "The document is not a Go file.",
+}
+
 // notMapped describes that a key is not mapped to any command.
 var notMapped = lang.Map{
 	lang.En: "\"%s\" is not mapped to any command.",
 }
 
+var outlineEmpty = lang.Map{
+	lang.En: "No symbols.",
+}
+
+var outlineTitle = lang.Map{
+	lang.En: "Outline",
+}
+
+var outputTitle = lang.Map{
+	lang.En: "%s: %s",
+}
+
+var promptNoChoice = lang.Map{
+	lang.En: "A list prompt requires at least one choice.",
+}
+
+var promptPending = lang.Map{
+	lang.En: "Answer the prompt first.",
+}
+
+var promptYesNoCancel = lang.Map{
+	lang.En: "[y]es [n]o [c]ancel",
+}
+
+var quitInProgress = lang.Map{
+	lang.En: "Already quitting.",
+}
+
+var quitNotInProgress = lang.Map{
+	lang.En: "The editor is not quitting.",
+}
+
+var quitSaveDocument = lang.Map{
+	lang.En: "Save changes to %s?",
+}
+
+var quitVetoed = lang.Map{
+	lang.En: "Quitting was cancelled: %s",
+}
+
+var referencesTitle = lang.Map{
+	lang.En: "References to %s (%d)",
+}
+
+var saveAs = lang.Map{
+	lang.En: "Save as:",
+}
+
+var sessionDirty = lang.Map{
+	lang.En: "Save the modified documents before loading a session.",
+}
+
+var sessionPartial = lang.Map{
+	lang.En: "The session was partially restored: %s",
+}
+
+var sessionUnsupportedVersion = lang.Map{
+	lang.En: "Unsupported session file version %d.",
+}
+
+var settingNotSet = lang.Map{
+	lang.En: "Setting \"%s\" is not set in the %s scope.",
+}
+
+var signNotFound = lang.Map{
+	lang.En: "There is no sign %d.",
+}
+
+var swapDisabled = lang.Map{
+	lang.En: "Swap files are disabled.",
+}
+
+var swapNone = lang.Map{
+	lang.En: "No swap file to recover.",
+}
+
+var swapOrphans = lang.Map{
+	lang.En: "Found %d unsaved documents from a crashed session. Recover them?",
+}
+
+var swapRecover = lang.Map{
+	lang.En: "Recover the unsaved changes of %s?",
+}
+
+var swapRecoverTitle = lang.Map{
+	lang.En: "Recovery of %s (%s)",
+}
+
+var unknownSetting = lang.Map{
+	lang.En: "\"%s\" is not a registered setting.",
+}
+
+var untitledDocument = lang.Map{
+	lang.En: "<untitled>",
+}
+
 var viewDirty = lang.Map{
 	lang.En: "View \"%s\" is not saved, aborting quit.",
 }
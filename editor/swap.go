@@ -0,0 +1,416 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/lang"
+)
+
+// swapInterval is the delay between two snapshots of the modified documents.
+const swapInterval = 2 * time.Second
+
+// swapContext is the number of unchanged lines shown around each change in
+// the recovery preview.
+const swapContext = 3
+
+// SwapFilesDir returns the default directory for the swap files.
+func SwapFilesDir() string {
+	if d := os.Getenv("XDG_CACHE_HOME"); d != "" {
+		return filepath.Join(d, "wi", "swap")
+	}
+	if runtime.GOOS == "windows" {
+		if d := os.Getenv("LOCALAPPDATA"); d != "" {
+			return filepath.Join(d, "wi", "swap")
+		}
+	}
+	if d := os.Getenv("HOME"); d != "" {
+		return filepath.Join(d, ".cache", "wi", "swap")
+	}
+	return ""
+}
+
+// swapFile is the content of a swap file. It is a snapshot of a modified
+// document.
+type swapFile struct {
+	Path    string    // Path of the document. Empty if it was never saved.
+	PID     int       // Process that wrote the swap file.
+	Time    time.Time // When the snapshot was taken.
+	Content []string
+}
+
+func readSwapFile(path string) (*swapFile, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &swapFile{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// writeSwapFile writes the swap file atomically, so a crash while writing
+// doesn't corrupt the previous snapshot.
+func writeSwapFile(path string, s *swapFile) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
+
+// processAlive returns true if the process pid is running.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		// FindProcess fails on Windows if the process doesn't exist.
+		return true
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
+
+// findOrphanSwapFiles returns the swap files in dir that were left by a
+// process that is not running anymore, sorted by name.
+func findOrphanSwapFiles(dir string) []string {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.swp"))
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, p := range paths {
+		s, err := readSwapFile(p)
+		if err != nil {
+			log.Printf("Ignoring swap file %s: %s", p, err)
+			continue
+		}
+		if !processAlive(s.PID) {
+			out = append(out, p)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// swapFiles journals the modified documents into swap files.
+//
+// The snapshots are taken in the UI goroutine and written to disk by a
+// separate goroutine.
+type swapFiles struct {
+	dir     string
+	pid     int
+	lock    sync.Mutex
+	files   map[*document]string // Swap file of each journaled document.
+	pending map[*document]bool   // Documents modified since the last snapshot.
+	next    int                  // Suffix of the next swap file.
+	closed  bool
+	writes  chan func()
+	stop    chan struct{}
+	done    chan bool
+}
+
+func makeSwapFiles(dir string) *swapFiles {
+	s := &swapFiles{
+		dir:     dir,
+		pid:     os.Getpid(),
+		files:   map[*document]string{},
+		pending: map[*document]bool{},
+		writes:  make(chan func(), 64),
+		stop:    make(chan struct{}),
+		done:    make(chan bool),
+	}
+	wicore.Go("swapWriter", func() {
+		defer close(s.done)
+		for f := range s.writes {
+			f()
+		}
+	})
+	return s
+}
+
+// modified marks the document to be snapshotted. It is called on each
+// modification of the content of the document.
+func (s *swapFiles) modified(d *document) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.pending[d] = true
+}
+
+// snapshot enqueues the writes of the modified documents and the removal of
+// the swap files of the saved and closed documents. It must be called in the
+// UI goroutine.
+func (s *swapFiles) snapshot() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return
+	}
+	for d, name := range s.files {
+		if d.closed || !d.isDirty {
+			delete(s.files, d)
+			n := name
+			s.writes <- func() {
+				removeSwapFile(n)
+			}
+		}
+	}
+	for d := range s.pending {
+		delete(s.pending, d)
+		if d.closed || !d.isDirty {
+			continue
+		}
+		name, f := s.prepare(d)
+		s.writes <- func() {
+			if err := writeSwapFile(name, f); err != nil {
+				log.Printf("Failed to write swap file %s: %s", name, err)
+			}
+		}
+	}
+}
+
+// prepare returns the swap file path and a copy of the content of the
+// document. s.lock must be held.
+func (s *swapFiles) prepare(d *document) (string, *swapFile) {
+	name, ok := s.files[d]
+	if !ok {
+		s.next++
+		name = filepath.Join(s.dir, fmt.Sprintf("%d-%d.swp", s.pid, s.next))
+		s.files[d] = name
+	}
+	content := make([]string, len(d.content))
+	copy(content, d.content)
+	return name, &swapFile{d.filePath, s.pid, time.Now(), content}
+}
+
+// flush synchronously writes the modified documents. It is best effort, as it
+// is called after a panic when the editor state may be inconsistent.
+func (s *swapFiles) flush() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for d := range s.pending {
+		func() {
+			defer func() {
+				if i := recover(); i != nil {
+					log.Printf("Failed to flush %s: %s", d, i)
+				}
+			}()
+			if d.closed || !d.isDirty {
+				return
+			}
+			name, f := s.prepare(d)
+			if err := writeSwapFile(name, f); err != nil {
+				log.Printf("Failed to write swap file %s: %s", name, err)
+			}
+		}()
+	}
+	s.pending = map[*document]bool{}
+}
+
+// Close stops journaling and removes the swap files of this process.
+func (s *swapFiles) Close() error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.stop)
+	for _, name := range s.files {
+		n := name
+		s.writes <- func() {
+			removeSwapFile(n)
+		}
+	}
+	close(s.writes)
+	s.lock.Unlock()
+	<-s.done
+	return nil
+}
+
+func removeSwapFile(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove swap file %s: %s", path, err)
+	}
+}
+
+// EnableSwapFiles starts journaling the modified documents in dir and offers
+// to recover the documents left by a crashed process.
+func (e *editor) EnableSwapFiles(dir string) error {
+	if e.swap != nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	s := makeSwapFiles(dir)
+	e.swap = s
+	wicore.Go("swapTicker", func() {
+		t := time.NewTicker(swapInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if !e.post(s.stop, s.snapshot) {
+					return
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	})
+
+	if orphans := findOrphanSwapFiles(dir); len(orphans) != 0 {
+		e.Prompt(wicore.Prompt{wicore.PromptYesNoCancel, swapOrphans.Sprintf(len(orphans)), nil}, func(a wicore.PromptAnswer) {
+			if a.Answer == "yes" {
+				wicore.PostCommand(e, nil, "document_recover")
+			}
+		})
+	}
+	return nil
+}
+
+// FlushSwapFiles writes the pending snapshots synchronously. It is meant to
+// be called after a panic, when the UI goroutine is not running anymore.
+func (e *editor) FlushSwapFiles() {
+	if e.swap != nil {
+		e.swap.flush()
+	}
+}
+
+// recoverSwapFile shows the changes in the swap file at path and asks the
+// user what to do with it. done is called with true if the user wants to
+// continue with the next swap file.
+func (e *editor) recoverSwapFile(path string, done func(next bool)) error {
+	s, err := readSwapFile(path)
+	if err != nil {
+		return err
+	}
+	name := s.Path
+	original := []string{}
+	if name == "" {
+		name = untitledDocument.String()
+	} else {
+		d, err := loadDocument(s.Path)
+		if err != nil {
+			return err
+		}
+		original = d.content
+	}
+
+	title := swapRecoverTitle.Sprintf(name, s.Time.Format(time.Stamp))
+	args := append([]string{e.rootWindow.ID(), "floating", "text", title}, diffPreview(original, s.Content, swapContext)...)
+	if _, err := e.ExecuteCommand(e.rootWindow, "window_new", args...); err != nil {
+		return err
+	}
+	preview := newestChild(e.rootWindow)
+	e.Prompt(wicore.Prompt{wicore.PromptYesNoCancel, swapRecover.Sprintf(name), nil}, func(a wicore.PromptAnswer) {
+		if _, err := e.ExecuteCommand(e.rootWindow, "window_close", preview.ID()); err != nil {
+			log.Printf("Failed to close the preview: %s", err)
+		}
+		switch a.Answer {
+		case "yes":
+			var args []string
+			if s.Path != "" {
+				args = []string{s.Path}
+			}
+			if _, err := e.ExecuteCommand(e.rootWindow, "window_new", append([]string{e.rootWindow.ID(), "fill", "new_document"}, args...)...); err != nil {
+				e.alertOnError(err)
+				done(false)
+				return
+			}
+			v, ok := newestChild(e.rootWindow).view.(*documentView)
+			if !ok {
+				e.alertOnError(errors.New("internal error"))
+				done(false)
+				return
+			}
+			v.document.isDirty = true
+			e.replaceContent(v.document, s.Content)
+			removeSwapFile(path)
+			wicore.PostCommand(e, nil, "editor_redraw")
+			done(true)
+		case "no":
+			removeSwapFile(path)
+			done(true)
+		default:
+			done(false)
+		}
+	})
+	return nil
+}
+
+// Commands.
+
+func cmdDocumentRecover(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	if args.Has(0) {
+		return nil, e.recoverSwapFile(args.String(0), func(bool) {})
+	}
+	if e.swap == nil {
+		return nil, errors.New(swapDisabled.String())
+	}
+	orphans := findOrphanSwapFiles(e.swap.dir)
+	if len(orphans) == 0 {
+		return nil, errors.New(swapNone.String())
+	}
+	return nil, e.recoverSwapFile(orphans[0], func(next bool) {
+		// Stop if the swap file couldn't be deleted, to not loop on it.
+		if _, err := os.Stat(orphans[0]); next && len(orphans) > 1 && os.IsNotExist(err) {
+			wicore.PostCommand(e, nil, "document_recover")
+		}
+	})
+}
+
+// RegisterSwapCommands registers the commands to recover the documents from
+// the swap files.
+func RegisterSwapCommands(dispatcher wicore.CommandsW) {
+	cmds := []wicore.Command{
+		&privilegedCommandImpl{
+			"document_recover",
+			wicore.CommandArgs{{Name: "swap_file", Type: wicore.ArgPath, Optional: true}},
+			cmdDocumentRecover,
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Recovers a document after a crash",
+			},
+			lang.Map{
+				lang.En: "Shows the difference between the file on disk and the unsaved content journaled in a swap file by a process that crashed, then asks whether to reopen the document with the recovered content. Without argument, it goes through all the swap files left by crashed processes.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/key"
+)
+
+func TestSwapFiles(t *testing.T) {
+	defer keepLog(t)()
+
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	docPath := tmpDir + "/doc.txt"
+	swapDir := tmpDir + "/swap"
+	ut.AssertEqual(t, nil, ioutil.WriteFile(docPath, []byte("first\nsecond\n"), 0600))
+	ut.AssertEqual(t, nil, os.Mkdir(swapDir, 0700))
+	// This PID is larger than any valid PID so the process is not running.
+	orphan := swapDir + "/1073741824-1.swp"
+	ut.AssertEqual(t, nil, writeSwapFile(orphan, &swapFile{docPath, 1 << 30, time.Now(), []string{"first\n", "modified\n"}}))
+
+	ed, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+	var questions []string
+	var preview []string
+	var journaled, edited *swapFile
+	e.RegisterViewActivated(func(v wicore.View) {
+		switch v := v.(type) {
+		case *promptView:
+			questions = append(questions, v.question)
+			e.TriggerTerminalKeyPressed(key.Press{Ch: 'y'})
+		case *textView:
+			preview = v.lines
+		case *documentView:
+			// The recovered document is journaled again by this process.
+			e.FlushSwapFiles()
+			journaled, err = readSwapFile(e.swap.files[v.document])
+			ut.AssertEqual(t, nil, err)
+			// All the edits are journaled, even without moving the cursor.
+			ut.AssertEqual(t, nil, e.applyTextEdits(v.document, []lspTextEdit{{lspRange{lspPosition{0, 0}, lspPosition{0, 0}}, "zeroth\n"}}))
+			e.FlushSwapFiles()
+			edited, err = readSwapFile(e.swap.files[v.document])
+			ut.AssertEqual(t, nil, err)
+			wicore.PostCommand(e, nil, "q!")
+		}
+	})
+	ut.AssertEqual(t, nil, e.EnableSwapFiles(swapDir))
+	ut.AssertEqual(t, 0, e.EventLoop())
+
+	expected := []string{
+		"Found 1 unsaved documents from a crashed session. Recover them?",
+		"Recover the unsaved changes of " + docPath + "?",
+	}
+	ut.AssertEqual(t, expected, questions)
+	ut.AssertEqual(t, []string{"@@ -1 +1 @@", " first", "-second", "+modified"}, preview)
+	ut.AssertEqual(t, docPath, journaled.Path)
+	ut.AssertEqual(t, []string{"first\n", "modified\n"}, journaled.Content)
+	ut.AssertEqual(t, []string{"zeroth\n", "first\n", "modified\n"}, edited.Content)
+	// The orphan was consumed and the editor removed its own swap file on exit.
+	files, err := ioutil.ReadDir(swapDir)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 0, len(files))
+}
@@ -0,0 +1,164 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"errors"
+
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/colors"
+	"github.com/wi-ed/wi/wicore/key"
+	"github.com/wi-ed/wi/wicore/lang"
+	"github.com/wi-ed/wi/wicore/raster"
+)
+
+// textView is a read-only View of a few lines of text, like a diff preview.
+type textView struct {
+	view
+	e      wicore.Editor
+	lines  []string
+	offset int // Number of lines scrolled.
+}
+
+func (v *textView) Buffer() *raster.Buffer {
+	v.buffer.Fill(raster.Cell{R: ' ', F: v.DefaultFormat()})
+	for i, line := range v.lines[v.offset:] {
+		if i >= v.actualY {
+			break
+		}
+		f := v.DefaultFormat()
+		// Colorize diffs.
+		if len(line) != 0 {
+			switch line[0] {
+			case '-':
+				f.Fg = colors.Red
+			case '+':
+				f.Fg = colors.Green
+			case '@':
+				f.Fg = colors.Cyan
+			}
+		}
+		v.buffer.DrawString(line, 0, i, f)
+	}
+	return v.buffer
+}
+
+func (v *textView) onTerminalKeyPressed(k key.Press) {
+	if v.window == nil || v.e.ActiveWindow() != v.window {
+		return
+	}
+	if k.Ch == 'q' {
+		wicore.PostCommand(v.e, nil, "window_close", v.window.ID())
+	}
+}
+
+func cmdToText(handler func(v *textView, e wicore.EditorW, w wicore.Window)) wicore.CommandImplHandler {
+	return func(c *wicore.CommandImpl, e wicore.EditorW, w wicore.Window, args wicore.ArgValues) (wicore.CommandResult, error) {
+		v, ok := w.View().(*textView)
+		if !ok {
+			return nil, errors.New("internal error")
+		}
+		handler(v, e, w)
+		wicore.PostCommand(e, nil, "editor_redraw")
+		return nil, nil
+	}
+}
+
+func cmdTextClose(v *textView, e wicore.EditorW, w wicore.Window) {
+	wicore.PostCommand(e, nil, "window_close", w.ID())
+}
+
+func cmdTextScrollDown(v *textView, e wicore.EditorW, w wicore.Window) {
+	if v.offset < len(v.lines)-1 {
+		v.offset++
+	}
+}
+
+func cmdTextScrollUp(v *textView, e wicore.EditorW, w wicore.Window) {
+	if v.offset > 0 {
+		v.offset--
+	}
+}
+
+// textViewFactory returns a read-only View. The first argument is the title,
+// the rest are the lines to show.
+func textViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
+	dispatcher := makeCommands()
+	cmds := []wicore.Command{
+		&wicore.CommandImpl{
+			"text_close",
+			nil,
+			cmdToText(cmdTextClose),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Closes the text",
+			},
+			lang.Map{
+				lang.En: "Closes the text window.",
+			},
+		},
+		&wicore.CommandImpl{
+			"text_scroll_down",
+			nil,
+			cmdToText(cmdTextScrollDown),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Scrolls the text down",
+			},
+			lang.Map{
+				lang.En: "Scrolls the text down by one line.",
+			},
+		},
+		&wicore.CommandImpl{
+			"text_scroll_up",
+			nil,
+			cmdToText(cmdTextScrollUp),
+			wicore.WindowCategory,
+			lang.Map{
+				lang.En: "Scrolls the text up",
+			},
+			lang.Map{
+				lang.En: "Scrolls the text up by one line.",
+			},
+		},
+	}
+	for _, cmd := range cmds {
+		dispatcher.Register(cmd)
+	}
+	bindings := makeKeyBindings()
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Escape}, "text_close")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Down}, "text_scroll_down")
+	bindings.Set(wicore.AllMode, key.Press{Key: key.Up}, "text_scroll_up")
+
+	title := ""
+	var lines []string
+	if len(args) != 0 {
+		title = args[0]
+		lines = args[1:]
+	}
+	width := raster.StringWidth(title)
+	for _, l := range lines {
+		if w := raster.StringWidth(l); w > width {
+			width = w
+		}
+	}
+	v := &textView{
+		view{
+			commands:      dispatcher,
+			keyBindings:   bindings,
+			eventRegistry: e,
+			id:            id,
+			title:         title,
+			naturalX:      width,
+			naturalY:      len(lines),
+			defaultFormat: raster.CellFormat{Fg: colors.White, Bg: colors.Black},
+		},
+		e,
+		lines,
+		0,
+	}
+	v.events = append(v.events, e.RegisterTerminalKeyPressed(v.onTerminalKeyPressed))
+	return v
+}
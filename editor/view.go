@@ -8,7 +8,6 @@ import (
 	"fmt"
 	"log"
 	"time"
-	"unicode/utf8"
 
 	"github.com/wi-ed/wi/wicore"
 	"github.com/wi-ed/wi/wicore/colors"
@@ -117,7 +116,7 @@ func (v *staticDisabledView) Buffer() *raster.Buffer {
 	// TODO(maruel): Use the parent view format by default. No idea how to
 	// surface this information here. Cost is at least a RPC, potentially
 	// multiple when multiple plugins are involved in the tree.
-	v.buffer.Fill(raster.Cell{' ', v.DefaultFormat()})
+	v.buffer.Fill(raster.Cell{R: ' ', F: v.DefaultFormat()})
 	v.buffer.DrawString(v.Title(), 0, 0, v.DefaultFormat())
 	return v.buffer
 }
@@ -155,8 +154,11 @@ func statusRootViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW
 				[][]string{
 					{"window_new", id, "left", "status_active_window_name"},
 					{"window_new", id, "right", "status_position"},
+					{"window_new", id, "right", "status_diagnostics"},
+					{"window_new", id, "right", "status_coverage"},
 					{"window_new", id, "fill", "status_mode"},
 				},
+				false,
 				nil,
 			})
 	}
@@ -196,7 +198,7 @@ func statusPositionViewFactory(e wicore.Editor, id int, args ...string) wicore.V
 
 func infobarAlertViewFactory(e wicore.Editor, id int, args ...string) wicore.ViewW {
 	out := "Alert: " + args[0]
-	l := utf8.RuneCountInString(out)
+	l := raster.StringWidth(out)
 	v := makeStaticDisabledView(e, id, out, l, 1)
 	v.onAttach = func(v *view, w wicore.Window) {
 		wicore.Go("infobarAlert", func() {
@@ -210,13 +212,25 @@ func infobarAlertViewFactory(e wicore.Editor, id int, args ...string) wicore.Vie
 
 // RegisterDefaultViewFactories registers the builtins views factories.
 func RegisterDefaultViewFactories(e Editor) {
+	e.RegisterViewFactory("buffers", buffersViewFactory)
 	e.RegisterViewFactory("command", commandViewFactory)
+	e.RegisterViewFactory("diagnostics", diagnosticsViewFactory)
+	e.RegisterViewFactory("file_tree", fileTreeViewFactory)
+	e.RegisterViewFactory("go_test", goTestViewFactory)
+	e.RegisterViewFactory("help", helpViewFactory)
 	e.RegisterViewFactory("infobar_alert", infobarAlertViewFactory)
 	e.RegisterViewFactory("new_document", documentViewFactory)
+	e.RegisterViewFactory("outline", outlineViewFactory)
+	e.RegisterViewFactory("output", outputViewFactory)
+	e.RegisterViewFactory("picker", pickerViewFactory)
+	e.RegisterViewFactory("prompt", promptViewFactory)
 	e.RegisterViewFactory("status_active_window_name", statusActiveWindowNameViewFactory)
+	e.RegisterViewFactory("status_coverage", statusCoverageViewFactory)
+	e.RegisterViewFactory("status_diagnostics", statusDiagnosticsViewFactory)
 	e.RegisterViewFactory("status_mode", statusModeViewFactory)
 	e.RegisterViewFactory("status_position", statusPositionViewFactory)
 	e.RegisterViewFactory("status_root", statusRootViewFactory)
+	e.RegisterViewFactory("text", textViewFactory)
 }
 
 // Commands
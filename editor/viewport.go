@@ -0,0 +1,374 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/wi-ed/wi/wicore/raster"
+)
+
+// screenRow is a row of a documentView, showing a segment of a line.
+type screenRow struct {
+	line    int  // Document line, 0-based.
+	start   int  // Byte offset of the first grapheme cluster shown.
+	end     int  // Byte offset after the last grapheme cluster shown.
+	wrapped bool // Continuation of the previous row; showbreak is drawn first.
+}
+
+// rowPos is the position of a row in the document: the line and the index of
+// the wrapped segment in the line.
+type rowPos struct {
+	line    int
+	segment int
+}
+
+// viewport maps the document lines to the screen rows, according to the
+// settings in effect.
+//
+// The rows are recalculated from the top row on each call; the wrapped lines
+// are not cached.
+type viewport struct {
+	v         *documentView
+	width     int // Columns for the text, excluding the gutter.
+	height    int
+	wrap      bool
+	showbreak string
+	scrolloff int
+	tabstop   int
+}
+
+// viewport returns the viewport of the View with a gutter of gutterWidth.
+func (v *documentView) viewport(gutterWidth int) viewport {
+	p := viewport{
+		v:         v,
+		width:     v.actualX - gutterWidth,
+		height:    v.actualY,
+		wrap:      v.e.GetSetting(v.window, "wordwrap") == "true",
+		showbreak: v.e.GetSetting(v.window, "showbreak"),
+		tabstop:   v.tabstop(),
+	}
+	p.scrolloff, _ = strconv.Atoi(v.e.GetSetting(v.window, "scrolloff"))
+	if max := (p.height - 1) / 2; p.scrolloff > max {
+		p.scrolloff = max
+	}
+	if p.scrolloff < 0 {
+		p.scrolloff = 0
+	}
+	return p
+}
+
+// lineText returns the line without the line terminator.
+func lineText(l string) string {
+	return strings.TrimRight(l, "\r\n")
+}
+
+// nextColumn returns the byte offset of the grapheme cluster following the
+// one at col.
+func nextColumn(l string, col int) int {
+	if col >= len(l) {
+		return len(l)
+	}
+	size, _ := raster.Grapheme(l[col:])
+	return col + size
+}
+
+// prevColumn returns the byte offset of the grapheme cluster preceding col.
+func prevColumn(l string, col int) int {
+	prev := 0
+	for i := 0; i < col && i < len(l); i = nextColumn(l, i) {
+		prev = i
+	}
+	return prev
+}
+
+// lastColumn returns the byte offset of the last grapheme cluster of the
+// line, usually the line terminator.
+func lastColumn(l string) int {
+	return prevColumn(l, len(l))
+}
+
+// graphemeAt returns the size in bytes and the width in cells of the grapheme
+// cluster at the byte offset i of the line, x being its cell. A tab extends to
+// the next tab stop.
+func graphemeAt(l string, i, x, tabstop int) (int, int) {
+	if l[i] == '\t' {
+		return 1, tabstop - x%tabstop
+	}
+	return raster.Grapheme(l[i:])
+}
+
+// columnAt returns the byte offset of the grapheme cluster covering the cell
+// x, or len(l) if the line is shorter.
+func columnAt(l string, x, tabstop int) int {
+	w := 0
+	for i := 0; i < len(l); {
+		size, cw := graphemeAt(l, i, w, tabstop)
+		if w+cw > x {
+			return i
+		}
+		w += cw
+		i += size
+	}
+	return len(l)
+}
+
+// displayColumn returns the cell of the grapheme cluster at the byte offset
+// col.
+func displayColumn(l string, col, tabstop int) int {
+	w := 0
+	for i := 0; i < col && i < len(l); {
+		size, cw := graphemeAt(l, i, w, tabstop)
+		w += cw
+		i += size
+	}
+	return w
+}
+
+// hidden returns true if the line is hidden in a closed fold.
+func (v *documentView) hidden(line int) bool {
+	for _, f := range v.folds {
+		if f.closed && line > f.start && line <= f.end {
+			return true
+		}
+	}
+	return false
+}
+
+// visibleLine returns the line shown for line: the start of the closed fold
+// hiding it, if any.
+func (v *documentView) visibleLine(line int) int {
+	for v.hidden(line) {
+		line--
+	}
+	return line
+}
+
+// nextLine returns the next visible line, or -1.
+func (v *documentView) nextLine(line int) int {
+	for line++; line < len(v.document.content); line++ {
+		if !v.hidden(line) {
+			return line
+		}
+	}
+	return -1
+}
+
+// prevLine returns the previous visible line, or -1.
+func (v *documentView) prevLine(line int) int {
+	for line--; line >= 0; line-- {
+		if !v.hidden(line) {
+			return line
+		}
+	}
+	return -1
+}
+
+// lineRows returns the rows showing the line. Without word wrap, a line is
+// always a single row, scrolled horizontally.
+func (p viewport) lineRows(line int) []screenRow {
+	t := lineText(p.v.document.content[line])
+	if !p.wrap || p.width <= 0 || p.v.closedFold(line) != nil {
+		// A closed fold is shown as a single summary row.
+		return []screenRow{{line, 0, len(t), false}}
+	}
+	var out []screenRow
+	breakWidth := raster.StringWidth(p.showbreak)
+	for start := 0; ; {
+		avail := p.width
+		if start != 0 {
+			avail -= breakWidth
+			if avail < 1 {
+				avail = 1
+			}
+		}
+		// Take the grapheme clusters that fit, at least one, and remember the
+		// last space to break after it.
+		end := start
+		space := -1
+		x := displayColumn(t, start, p.tabstop)
+		for w := 0; end < len(t); {
+			size, cw := graphemeAt(t, end, x+w, p.tabstop)
+			if w+cw > avail && end > start {
+				break
+			}
+			if r, _ := utf8.DecodeRuneInString(t[end:]); unicode.IsSpace(r) && end > start {
+				space = end + size
+			}
+			w += cw
+			end += size
+		}
+		if end == len(t) {
+			return append(out, screenRow{line, start, end, start != 0})
+		}
+		if space != -1 {
+			end = space
+		}
+		out = append(out, screenRow{line, start, end, start != 0})
+		start = end
+	}
+}
+
+// step returns the position k rows after pos, or before if k is negative. It
+// stops at the first or last row of the document.
+func (p viewport) step(pos rowPos, k int) rowPos {
+	for ; k > 0; k-- {
+		if pos.segment < len(p.lineRows(pos.line))-1 {
+			pos.segment++
+		} else if next := p.v.nextLine(pos.line); next != -1 {
+			pos = rowPos{next, 0}
+		} else {
+			break
+		}
+	}
+	for ; k < 0; k++ {
+		if pos.segment > 0 {
+			pos.segment--
+		} else if prev := p.v.prevLine(pos.line); prev != -1 {
+			pos = rowPos{prev, len(p.lineRows(prev)) - 1}
+		} else {
+			break
+		}
+	}
+	return pos
+}
+
+// distance returns the number of rows from a to b; it is negative if b is
+// before a.
+func (p viewport) distance(a, b rowPos) int {
+	if b.line < a.line || (b.line == a.line && b.segment < a.segment) {
+		return -p.distance(b, a)
+	}
+	d := 0
+	for a.line != b.line {
+		d += len(p.lineRows(a.line)) - a.segment
+		a = rowPos{p.v.nextLine(a.line), 0}
+		if a.line == -1 {
+			return d
+		}
+	}
+	return d + b.segment - a.segment
+}
+
+// cursor returns the position of the row showing the cursor.
+func (p viewport) cursor() rowPos {
+	line := p.v.visibleLine(p.v.CursorLine)
+	rows := p.lineRows(line)
+	for i, r := range rows {
+		if p.v.CursorColumn < r.end {
+			return rowPos{line, i}
+		}
+	}
+	return rowPos{line, len(rows) - 1}
+}
+
+// top returns the position of the first row shown.
+func (p viewport) top() rowPos {
+	line := p.v.OffsetLine
+	if line >= len(p.v.document.content) {
+		line = len(p.v.document.content) - 1
+	}
+	line = p.v.visibleLine(line)
+	pos := rowPos{line, p.v.offsetSegment}
+	if n := len(p.lineRows(line)); pos.segment >= n {
+		pos.segment = n - 1
+	}
+	return pos
+}
+
+func (p viewport) setTop(pos rowPos) {
+	p.v.OffsetLine = pos.line
+	p.v.offsetSegment = pos.segment
+}
+
+// rows returns the rows shown.
+func (p viewport) rows() []screenRow {
+	var out []screenRow
+	pos := p.top()
+	for line := pos.line; line != -1 && len(out) < p.height; line = p.v.nextLine(line) {
+		rows := p.lineRows(line)
+		if line == pos.line {
+			rows = rows[pos.segment:]
+		}
+		if !p.wrap {
+			// Skip the cells scrolled horizontally. A wide character cut by
+			// the left edge is not shown.
+			t := lineText(p.v.document.content[line])
+			start := columnAt(t, p.v.OffsetColumn, p.tabstop)
+			if displayColumn(t, start, p.tabstop) < p.v.OffsetColumn {
+				start = nextColumn(t, start)
+			}
+			rows[0].start = start
+		}
+		out = append(out, rows...)
+	}
+	if len(out) > p.height {
+		out = out[:p.height]
+	}
+	return out
+}
+
+// scrollToCursor adjusts the offsets so the cursor is visible, with
+// scrolloff rows of context above and below when possible.
+func (p viewport) scrollToCursor() {
+	if p.height <= 0 || len(p.v.document.content) == 0 {
+		return
+	}
+	top := p.top()
+	d := p.distance(top, p.cursor())
+	if d < p.scrolloff {
+		top = p.step(top, d-p.scrolloff)
+	} else if bottom := p.height - 1 - p.scrolloff; d > bottom {
+		top = p.step(top, d-bottom)
+	}
+	p.setTop(top)
+
+	if p.wrap {
+		p.v.OffsetColumn = 0
+		return
+	}
+	t := lineText(p.v.document.content[p.v.CursorLine])
+	x := displayColumn(t, p.v.CursorColumn, p.tabstop)
+	cw := 1
+	if p.v.CursorColumn < len(t) {
+		if _, cw = graphemeAt(t, p.v.CursorColumn, x, p.tabstop); cw == 0 {
+			cw = 1
+		}
+	}
+	if x < p.v.OffsetColumn {
+		p.v.OffsetColumn = x
+	} else if p.width > 0 && x+cw > p.v.OffsetColumn+p.width {
+		p.v.OffsetColumn = x + cw - p.width
+	}
+}
+
+// scroll scrolls by k rows, moving the cursor by the same number of rows.
+func (p viewport) scroll(k int) {
+	if p.height <= 0 {
+		return
+	}
+	p.setTop(p.step(p.top(), k))
+	old := p.cursor()
+	// Keep the cursor at the same cell of the row.
+	t := lineText(p.v.document.content[old.line])
+	start := p.lineRows(old.line)[old.segment].start
+	x := displayColumn(t, p.v.CursorColumn, p.tabstop) - displayColumn(t, start, p.tabstop)
+	pos := p.step(old, k)
+	rows := p.lineRows(pos.line)
+	row := rows[pos.segment]
+	l := p.v.document.content[pos.line]
+	p.v.CursorLine = pos.line
+	p.v.CursorColumn = columnAt(l, displayColumn(l, row.start, p.tabstop)+x, p.tabstop)
+	if pos.segment < len(rows)-1 && p.v.CursorColumn >= row.end {
+		p.v.CursorColumn = prevColumn(l, row.end)
+	}
+	if last := lastColumn(l); p.v.CursorColumn > last {
+		p.v.CursorColumn = last
+	}
+	p.scrollToCursor()
+}
@@ -0,0 +1,82 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+)
+
+func TestViewport(t *testing.T) {
+	defer keepLog(t)()
+
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	path := filepath.Join(tmpDir, "a.txt")
+	content := "aaa bbb ccc ddd\n"
+	for i := 1; i < 10; i++ {
+		content += fmt.Sprintf("l%d\n", i)
+	}
+	ut.AssertEqual(t, nil, ioutil.WriteFile(path, []byte(content), 0600))
+
+	ed, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+	var v *documentView
+	var screens [][]string
+	var cursors []int
+	snapshot := func(o wicore.CommandOutcome) {
+		ut.AssertEqual(t, nil, o.Err)
+		b := v.Buffer()
+		out := make([]string, 4)
+		for i := range out {
+			out[i] = strings.TrimRight(string(b.Line(i).Runes()), " ")
+		}
+		screens = append(screens, out)
+		cursors = append(cursors, v.CursorLine)
+	}
+	wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+		v = e.ActiveWindow().View().(*documentView)
+		v.SetSize(10, 4)
+	}, "open", path)
+	wicore.PostCommand(e, nil, "set", "global", "scrolloff", "1")
+	wicore.PostCommand(e, nil, "set", "global", "showbreak", ">")
+	wicore.PostCommand(e, snapshot, "set", "global", "wordwrap", "true")
+	wicore.PostCommand(e, snapshot, "document_cursor_down")
+	wicore.PostCommand(e, snapshot, "document_cursor_down")
+	wicore.PostCommand(e, snapshot, "document_page_down")
+	wicore.PostCommand(e, snapshot, "document_half_page_up")
+	wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+		v.CursorLine = 0
+		v.CursorColumn = 14
+		snapshot(o)
+		wicore.PostCommand(e, nil, "q!")
+	}, "set", "global", "wordwrap", "false")
+	ut.AssertEqual(t, 0, e.EventLoop())
+
+	expected := [][]string{
+		{"aaa bbb", ">ccc ddd", "l1", "l2"},
+		{"aaa bbb", ">ccc ddd", "l1", "l2"},
+		{">ccc ddd", "l1", "l2", "l3"},
+		{"l2", "l3", "l4", "l5"},
+		{">ccc ddd", "l1", "l2", "l3"},
+		{"bb ccc ddd", "", "", ""},
+	}
+	ut.AssertEqual(t, expected, screens)
+	ut.AssertEqual(t, []int{0, 1, 2, 4, 2, 0}, cursors)
+}
@@ -0,0 +1,304 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/wi-ed/wi/wicore"
+)
+
+// pollInterval is the delay between two checks of the files by the polling
+// fileWatcher.
+const pollInterval = time.Second
+
+// fileWatcher notifies when files are modified on disk.
+//
+// The callback is called from a separate goroutine with the path as it was
+// passed to Add(). It may be called spuriously, e.g. when the file is saved by
+// the editor itself.
+type fileWatcher interface {
+	io.Closer
+
+	// Add starts watching path. It is fine to call it multiple times for the
+	// same path. A directory is reported when an entry is added, removed or
+	// renamed in it, and with the native watcher, when a file in it is written.
+	Add(path string) error
+	// Remove stops watching path.
+	Remove(path string)
+}
+
+// makeFileWatcher returns the native file watcher of the OS, falling back to
+// polling if it is not available.
+func makeFileWatcher(changed func(path string)) fileWatcher {
+	w, err := makeNativeWatcher(changed)
+	if err == nil {
+		return w
+	}
+	log.Printf("Falling back to polling files: %s", err)
+	return makePollWatcher(changed, pollInterval)
+}
+
+// fileStamp is the state of a file used to detect modifications by polling.
+type fileStamp struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+func getFileStamp(path string) fileStamp {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{true, fi.Size(), fi.ModTime()}
+}
+
+// pollWatcher is a fileWatcher that periodically checks the files metadata.
+type pollWatcher struct {
+	lock    sync.Mutex
+	files   map[string]fileStamp
+	changed func(path string)
+	stop    chan bool
+	done    chan bool
+}
+
+func makePollWatcher(changed func(path string), interval time.Duration) *pollWatcher {
+	p := &pollWatcher{
+		files:   map[string]fileStamp{},
+		changed: changed,
+		stop:    make(chan bool),
+		done:    make(chan bool),
+	}
+	wicore.Go("pollWatcher", func() {
+		defer close(p.done)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				p.poll()
+			case <-p.stop:
+				return
+			}
+		}
+	})
+	return p
+}
+
+func (p *pollWatcher) poll() {
+	p.lock.Lock()
+	paths := make([]string, 0, len(p.files))
+	for path := range p.files {
+		paths = append(paths, path)
+	}
+	p.lock.Unlock()
+	for _, path := range paths {
+		stamp := getFileStamp(path)
+		p.lock.Lock()
+		old, ok := p.files[path]
+		if ok {
+			p.files[path] = stamp
+		}
+		p.lock.Unlock()
+		// A deleted file is not reported, there is nothing to reload.
+		if ok && old != stamp && stamp.exists {
+			p.changed(path)
+		}
+	}
+}
+
+func (p *pollWatcher) Add(path string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if _, ok := p.files[path]; !ok {
+		p.files[path] = getFileStamp(path)
+	}
+	return nil
+}
+
+func (p *pollWatcher) Remove(path string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.files, path)
+}
+
+func (p *pollWatcher) Close() error {
+	close(p.stop)
+	<-p.done
+	return nil
+}
+
+// syncWatches makes the watched files match the loaded documents.
+func (e *editor) syncWatches() {
+	if e.watcher == nil {
+		return
+	}
+	paths := map[string]bool{}
+	for _, d := range e.documents {
+		if d.filePath != "" {
+			paths[d.filePath] = true
+		}
+	}
+	for p := range e.watched {
+		if !paths[p] {
+			e.watcher.Remove(p)
+			delete(e.watched, p)
+		}
+	}
+	for p := range paths {
+		if !e.watched[p] {
+			if err := e.watcher.Add(p); err != nil {
+				log.Printf("Failed to watch %s: %s", p, err)
+				continue
+			}
+			e.watched[p] = true
+		}
+	}
+}
+
+// onFileChanged is called in the UI goroutine when a watched file or
+// directory changed.
+func (e *editor) onFileChanged(path string) {
+	for _, d := range e.sortedDocuments() {
+		if !d.closed && d.filePath == path {
+			e.TriggerDocumentChangedOnDisk(d)
+		}
+	}
+	for _, w := range e.rootWindow.childrenWindows {
+		if v, ok := w.view.(*fileTreeView); ok {
+			v.onFileChanged(path)
+		}
+	}
+}
+
+// documentViews returns the Views of the document d.
+func (e *editor) documentViews(d *document) []*documentView {
+	var out []*documentView
+	var recurse func(w *window)
+	recurse = func(w *window) {
+		if v, ok := w.view.(*documentView); ok && v.document == d {
+			out = append(out, v)
+		}
+		for _, c := range w.childrenWindows {
+			recurse(c)
+		}
+	}
+	recurse(e.rootWindow)
+	return out
+}
+
+// readDisk returns the content of the file backing the document. It returns
+// nil if the file doesn't exist anymore.
+func readDisk(d *document) []string {
+	if _, err := os.Stat(d.filePath); err != nil {
+		return nil
+	}
+	disk, err := loadDocument(d.filePath)
+	if err != nil {
+		log.Printf("Failed to read %s: %s", d.filePath, err)
+		return nil
+	}
+	return disk.content
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// onDocumentChangedOnDisk reloads the document if it is not modified,
+// otherwise asks the user what to do.
+func (e *editor) onDocumentChangedOnDisk(doc wicore.Document) {
+	d, ok := doc.(*document)
+	if !ok {
+		return
+	}
+	if filepath.Ext(d.filePath) == ".go" {
+		// Other packages may import the one of the file.
+		e.goTypes.invalidate()
+	}
+	if d.closed || d.conflict {
+		return
+	}
+	content := readDisk(d)
+	if content == nil || equalLines(content, d.content) {
+		// Deleted, or saved by the editor itself.
+		return
+	}
+	if !d.isDirty {
+		e.reloadDocument(d, content)
+		return
+	}
+	d.conflict = true
+	e.resolveConflict(d, nil)
+}
+
+// resolveConflict asks the user what to do with a modified document that was
+// also modified on disk. preview is the Window showing the differences, if
+// any.
+func (e *editor) resolveConflict(d *document, preview *window) {
+	choices := []string{"reload", "keep", "diff"}
+	if preview != nil {
+		choices = choices[:2]
+	}
+	e.Prompt(wicore.Prompt{wicore.PromptList, fileChangedOnDisk.Sprintf(d.filePath), choices}, func(a wicore.PromptAnswer) {
+		if preview != nil {
+			if _, err := e.ExecuteCommand(e.rootWindow, "window_close", preview.ID()); err != nil {
+				log.Printf("Failed to close the preview: %s", err)
+			}
+		}
+		content := readDisk(d)
+		switch {
+		case a.Cancelled || a.Answer == "keep" || content == nil:
+			d.conflict = false
+		case a.Answer == "reload":
+			d.conflict = false
+			e.reloadDocument(d, content)
+		case a.Answer == "diff":
+			args := append([]string{e.rootWindow.ID(), "floating", "text", fileChangedDiffTitle.Sprintf(d.filePath)}, diffPreview(d.content, content, swapContext)...)
+			if _, err := e.ExecuteCommand(e.rootWindow, "window_new", args...); err != nil {
+				e.alertOnError(err)
+				d.conflict = false
+				return
+			}
+			e.resolveConflict(d, newestChild(e.rootWindow))
+		}
+	})
+}
+
+// reloadDocument replaces the content of the document, keeping the cursors
+// on the same lines.
+func (e *editor) reloadDocument(d *document, content []string) {
+	d.isDirty = false
+	script := e.replaceContent(d, content)
+	for _, v := range e.documentViews(d) {
+		v.CursorLine = mapLine(script, v.CursorLine)
+		v.OffsetLine = mapLine(script, v.OffsetLine)
+		if v.OffsetLine > v.CursorLine {
+			v.OffsetLine = v.CursorLine
+		}
+		if l := lastColumn(content[v.CursorLine]); v.CursorColumn > l {
+			v.CursorColumn = l
+		}
+		if v.CursorColumn < 0 {
+			v.CursorColumn = 0
+		}
+		v.cursorMoved(e)
+	}
+	wicore.PostCommand(e, nil, "editor_redraw")
+}
@@ -0,0 +1,163 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// +build linux
+
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/wi-ed/wi/wicore"
+)
+
+// inotifyMask are the events that denote a new content. The directory is
+// watched instead of the file, so files replaced by a rename, like most tools
+// do, are still detected.
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO
+
+// inotifyDirMask are the events that denote a change of the entries of a
+// watched directory, in addition to inotifyMask.
+const inotifyDirMask = inotifyMask | syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM
+
+// inotifyWatcher is a fileWatcher based on inotify.
+type inotifyWatcher struct {
+	fd      int
+	file    *os.File
+	lock    sync.Mutex
+	dirs    map[string]int32    // Watch descriptor of each directory.
+	wds     map[int32]string    // Directory of each watch descriptor.
+	files   map[string][]string // Watched paths, indexed by their cleaned path.
+	watch   map[string]string   // Directory watched for each cleaned path; itself for a directory.
+	changed func(path string)
+	done    chan bool
+}
+
+func makeNativeWatcher(changed func(path string)) (fileWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	i := &inotifyWatcher{
+		fd: fd,
+		// The file descriptor is non blocking so Close() unblocks Read().
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		dirs:    map[string]int32{},
+		wds:     map[int32]string{},
+		files:   map[string][]string{},
+		watch:   map[string]string{},
+		changed: changed,
+		done:    make(chan bool),
+	}
+	wicore.Go("inotifyWatcher", i.readLoop)
+	return i, nil
+}
+
+func (i *inotifyWatcher) readLoop() {
+	defer close(i.done)
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := i.file.Read(buf)
+		if err != nil {
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			name := strings.TrimRight(string(buf[offset+syscall.SizeofInotifyEvent:offset+syscall.SizeofInotifyEvent+int(event.Len)]), "\x00")
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+			i.lock.Lock()
+			dir, ok := i.wds[event.Wd]
+			var paths []string
+			if ok && name != "" {
+				if event.Mask&inotifyMask != 0 {
+					paths = append(paths, i.files[filepath.Join(dir, name)]...)
+				}
+				if i.watch[dir] == dir {
+					paths = append(paths, i.files[dir]...)
+				}
+			}
+			i.lock.Unlock()
+			for _, p := range paths {
+				i.changed(p)
+			}
+		}
+	}
+}
+
+func (i *inotifyWatcher) Add(path string) error {
+	clean, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	for _, p := range i.files[clean] {
+		if p == path {
+			return nil
+		}
+	}
+	dir, ok := i.watch[clean]
+	if !ok {
+		dir = filepath.Dir(clean)
+		if fi, err := os.Stat(clean); err == nil && fi.IsDir() {
+			dir = clean
+		}
+	}
+	if _, ok := i.dirs[dir]; !ok {
+		wd, err := syscall.InotifyAddWatch(i.fd, dir, inotifyDirMask)
+		if err != nil {
+			return err
+		}
+		i.dirs[dir] = int32(wd)
+		i.wds[int32(wd)] = dir
+	}
+	i.files[clean] = append(i.files[clean], path)
+	i.watch[clean] = dir
+	return nil
+}
+
+func (i *inotifyWatcher) Remove(path string) {
+	clean, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	paths := i.files[clean]
+	for j, p := range paths {
+		if p == path {
+			paths = append(paths[:j], paths[j+1:]...)
+			break
+		}
+	}
+	if len(paths) != 0 {
+		i.files[clean] = paths
+		return
+	}
+	delete(i.files, clean)
+	// Stop watching the directory if it was the last path using it.
+	dir := i.watch[clean]
+	delete(i.watch, clean)
+	for _, d := range i.watch {
+		if d == dir {
+			return
+		}
+	}
+	if wd, ok := i.dirs[dir]; ok {
+		_, _ = syscall.InotifyRmWatch(i.fd, uint32(wd))
+		delete(i.dirs, dir)
+		delete(i.wds, wd)
+	}
+}
+
+func (i *inotifyWatcher) Close() error {
+	err := i.file.Close()
+	<-i.done
+	return err
+}
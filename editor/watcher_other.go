@@ -0,0 +1,17 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// +build !linux
+
+package editor
+
+import (
+	"errors"
+)
+
+// makeNativeWatcher always fails on this OS, so the files are polled. FSEvents
+// on OSX and ReadDirectoryChangesW on Windows would avoid the polling.
+func makeNativeWatcher(changed func(path string)) (fileWatcher, error) {
+	return nil, errors.New("no native file watcher on this OS")
+}
@@ -0,0 +1,117 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/key"
+)
+
+func TestFileWatcher(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	path := tmpDir + "/file.txt"
+	ut.AssertEqual(t, nil, ioutil.WriteFile(path, []byte("a\n"), 0600))
+
+	for i, content := range []string{"poll\n", "native\n"} {
+		changed := make(chan string, 16)
+		callback := func(p string) {
+			changed <- p
+		}
+		var w fileWatcher
+		if i == 0 {
+			w = makePollWatcher(callback, 10*time.Millisecond)
+		} else if w, err = makeNativeWatcher(callback); err != nil {
+			t.Logf("No native watcher: %s", err)
+			continue
+		}
+		ut.AssertEqual(t, nil, w.Add(path))
+		ut.AssertEqual(t, nil, ioutil.WriteFile(path, []byte(content), 0600))
+		select {
+		case p := <-changed:
+			ut.AssertEqual(t, path, p)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: no notification", content)
+		}
+		ut.AssertEqual(t, nil, w.Close())
+	}
+}
+
+func TestDocumentChangedOnDisk(t *testing.T) {
+	defer keepLog(t)()
+
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	path := tmpDir + "/doc.txt"
+	ut.AssertEqual(t, nil, ioutil.WriteFile(path, []byte("a\nb\nc\n"), 0600))
+
+	ed, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+	// The notifications are simulated with onFileChanged() to be deterministic.
+	ut.AssertEqual(t, nil, e.watcher.Close())
+	e.watcher = nil
+	var questions []string
+	answered := false
+	e.RegisterViewActivated(func(v wicore.View) {
+		if p, ok := v.(*promptView); ok {
+			questions = append(questions, p.question)
+			ut.AssertEqual(t, []string{"reload", "keep", "diff"}, p.choices)
+			answered = true
+			e.TriggerTerminalKeyPressed(key.Press{Key: key.Enter})
+		}
+	})
+	e.RegisterDocumentCursorMoved(func(doc wicore.Document, col, line int) {
+		if answered {
+			// The document was reloaded.
+			wicore.PostCommand(e, nil, "q!")
+		}
+	})
+
+	var v *documentView
+	wicore.PostCommand(e, nil, "window_new", "0", "fill", "new_document", path)
+	wicore.PostCommand(e, nil, "document_cursor_down")
+	wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+		v = e.ActiveWindow().View().(*documentView)
+		ut.AssertEqual(t, 2, v.CursorLine)
+		// Wait for DocumentCreated to be processed.
+		e.deferred <- func() {
+			// A clean document is reloaded and the cursor stays on "c".
+			ut.AssertEqual(t, nil, ioutil.WriteFile(path, []byte("new\na\nb\nc\n"), 0600))
+			e.onFileChanged(path)
+			e.deferred <- func() {
+				ut.AssertEqual(t, []string{"new\n", "a\n", "b\n", "c\n"}, v.document.content)
+				ut.AssertEqual(t, 3, v.CursorLine)
+				// A modified document asks the user.
+				e.TriggerTerminalKeyPressed(key.Press{Ch: 'x'})
+				e.deferred <- func() {
+					ut.AssertEqual(t, nil, ioutil.WriteFile(path, []byte("new\na\nb\nc\nd\n"), 0600))
+					e.onFileChanged(path)
+				}
+			}
+		}
+	}, "document_cursor_down")
+	ut.AssertEqual(t, 0, e.EventLoop())
+
+	ut.AssertEqual(t, []string{path + " was modified on disk."}, questions)
+	ut.AssertEqual(t, []string{"new\n", "a\n", "b\n", "c\n", "d\n"}, v.document.content)
+	ut.AssertEqual(t, false, v.document.isDirty)
+	ut.AssertEqual(t, 3, v.CursorLine)
+}
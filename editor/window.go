@@ -5,6 +5,7 @@
 package editor
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
@@ -49,6 +50,8 @@ type window struct {
 	border          wicore.BorderType
 	effectiveBorder drawnBorder       // effectiveBorder automatically collapses borders when the Window Rect is too small and is based on docking.
 	borderFormat    raster.CellFormat // Format to be used in borders. It can be different from .View().DefaultFormat().
+	factoryName     string            // Name of the ViewFactory that created the View. Empty for the root Window.
+	factoryArgs     []string          // Arguments passed to the ViewFactory.
 }
 
 // wicore.Window interface.
@@ -95,6 +98,16 @@ func (w *window) View() wicore.View {
 
 // Private methods.
 
+// Recursively close the View of a window tree.
+func closeRecursively(w *window) {
+	for _, c := range w.childrenWindows {
+		closeRecursively(c)
+	}
+	if err := w.view.Close(); err != nil {
+		log.Printf("%s.Close() failed: %s", w.view, err)
+	}
+}
+
 // Recursively detach a window tree.
 func detachRecursively(w *window) {
 	for _, c := range w.childrenWindows {
@@ -145,7 +158,8 @@ func (w *window) setRect(rect raster.Rect) {
 	if w.rect != rect {
 		w.rect = rect
 		// Internal consistency check.
-		if w.parent != nil {
+		// Floating Window are relative to the screen, not the parent Window.
+		if w.parent != nil && w.docking != wicore.DockingFloating {
 			if !w.rect.In(w.parent.clientAreaRect) {
 				panic(fmt.Sprintf("Child %v doesn't fit parent's client area %v: %v", w, w.parent, w.parent.clientAreaRect))
 			}
@@ -205,11 +219,11 @@ func (w *window) resizeChildren() {
 	log.Printf("%s.resizeChildren()", w)
 	// When borders are used, w.clientAreaRect.X and .Y are likely 1.
 	remaining := w.clientAreaRect
-	var fill *window
+	var fills []*window
 	for _, child := range w.childrenWindows {
 		switch child.Docking() {
 		case wicore.DockingFill:
-			fill = child
+			fills = append(fills, child)
 
 		case wicore.DockingFloating:
 			// Floating uses its own thing.
@@ -272,8 +286,12 @@ func (w *window) resizeChildren() {
 			panic("Fill me")
 		}
 	}
-	if fill != nil {
-		fill.setRect(remaining)
+	if len(fills) != 0 {
+		// The hidden ones are kept at the same size so they are ready to be
+		// shown.
+		for _, fill := range fills {
+			fill.setRect(remaining)
+		}
 		w.viewRect.X = 0
 		w.viewRect.Y = 0
 		w.viewRect.Width = 0
@@ -387,7 +405,7 @@ func (w *window) getBorderFormat() raster.CellFormat {
 }
 
 func (w *window) cell(r rune) raster.Cell {
-	return raster.Cell{r, w.getBorderFormat()}
+	return raster.Cell{R: r, F: w.getBorderFormat()}
 }
 
 func makeWindow(parent *window, view wicore.ViewW, docking wicore.DockingType) *window {
@@ -447,148 +465,153 @@ func drawRecurse(w *window, offsetX, offsetY int, out *raster.Buffer) {
 	}
 }
 
-// Commands
-
-func cmdWindowActivate(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
-	windowName := args[0]
+// newestChild returns the child Window of parent that was created last.
+func newestChild(parent *window) *window {
+	var out *window
+	for _, c := range parent.childrenWindows {
+		if out == nil || c.id > out.id {
+			out = c
+		}
+	}
+	return out
+}
 
-	child := e.idToWindow(windowName)
-	if child == nil {
-		e.ExecuteCommand(w, "alert", isNotValidWindow.Sprintf(windowName))
-		return
+// bringToFront makes w and its parents the visible DockingFill Window of
+// their parent.
+func bringToFront(w *window) {
+	for ; w.parent != nil; w = w.parent {
+		if w.docking != wicore.DockingFill {
+			continue
+		}
+		siblings := w.parent.childrenWindows
+		for i, c := range siblings {
+			if c == w {
+				copy(siblings[1:i+1], siblings[:i])
+				siblings[0] = w
+				break
+			}
+		}
 	}
-	e.activateWindow(child)
 }
 
-func cmdWindowClose(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
-	windowName := args[0]
+// Commands
 
-	child := e.idToWindow(windowName)
-	if child == nil {
-		e.ExecuteCommand(w, "alert", isNotValidWindow.Sprintf(windowName))
-		return
+func cmdWindowActivate(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	return nil, e.activateWindow(args.Window(0))
+}
+
+func cmdWindowClose(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	child := args.Window(0).(*window)
+	parent := child.parent
+	if parent == nil {
+		return nil, errors.New(cantCloseRootWindow.String())
 	}
-	for i, v := range child.parent.childrenWindows {
+	for i, v := range parent.childrenWindows {
 		if v == child {
-			copy(w.childrenWindows[i:], w.childrenWindows[i+1:])
-			w.childrenWindows[len(w.childrenWindows)-1] = nil
-			w.childrenWindows = w.childrenWindows[:len(w.childrenWindows)-1]
-			detachRecursively(v)
+			copy(parent.childrenWindows[i:], parent.childrenWindows[i+1:])
+			parent.childrenWindows[len(parent.childrenWindows)-1] = nil
+			parent.childrenWindows = parent.childrenWindows[:len(parent.childrenWindows)-1]
+			e.forgetWindow(child)
+			e.settings.forgetWindow(child)
+			closeRecursively(child)
+			detachRecursively(child)
+			e.pruneDocuments()
+			parent.resizeChildren()
 			wicore.PostCommand(e, nil, "editor_redraw")
-			return
+			return nil, nil
 		}
 	}
+	return nil, nil
 }
 
-func cmdWindowNew(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
-	windowName := args[0]
-	dockingName := args[1]
-	viewFactoryName := args[2]
+func cmdWindowNew(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	parent := args.Window(0).(*window)
+	docking := args.Docking(1)
+	viewFactoryName := args.String(2)
 
-	parent := e.idToWindow(windowName)
-	if parent == nil {
-		if viewFactoryName != "infobar_alert" {
-			e.ExecuteCommand(w, "alert", isNotValidWindow.Sprintf(windowName))
-		}
-		return
-	}
-
-	docking := wicore.StringToDockingType(dockingName)
-	if docking == wicore.DockingUnknown {
-		if viewFactoryName != "infobar_alert" {
-			e.ExecuteCommand(w, "alert", invalidDocking.Sprintf(dockingName))
-		}
-		return
-	}
-	// TODO(maruel): Only the first child Window with DockingFill is visible.
-	// TODO(maruel): Reorder .childrenWindows with
-	// CommandDispatcherFull.ActivateWindow() but only with DockingFill.
-	// TODO(maruel): Also allow DockingFloating.
-	//if docking != wicore.DockingFill {
+	// Only the first child Window with DockingFill is visible; activating a
+	// Window brings it first. Floating Windows can be stacked, e.g. a prompt
+	// over a help view.
 	for _, child := range parent.childrenWindows {
-		if child.Docking() == docking {
-			if viewFactoryName != "infobar_alert" {
-				e.ExecuteCommand(w, "alert", cantAddTwoWindowWithSameDocking.Sprintf(docking))
+		if child.Docking() == docking && docking != wicore.DockingFloating && docking != wicore.DockingFill {
+			if viewFactoryName == "infobar_alert" {
+				// Do not recurse into alerting that the alert can't be shown.
+				return nil, nil
 			}
-			return
+			return nil, errors.New(cantAddTwoWindowWithSameDocking.Sprintf(docking))
 		}
 	}
-	//}
 
 	viewFactory, ok := e.viewFactories[viewFactoryName]
 	if !ok {
-		if viewFactoryName != "infobar_alert" {
-			e.ExecuteCommand(w, "alert", invalidViewFactory.Sprintf(viewFactoryName))
+		if viewFactoryName == "infobar_alert" {
+			return nil, nil
+		}
+		return nil, errors.New(invalidViewFactory.Sprintf(viewFactoryName))
+	}
+	if factoryArgs := args.Strings(3); viewFactoryName == "new_document" && len(factoryArgs) != 0 && factoryArgs[0] != "" {
+		// Load the file first so a failure is returned instead of showing an
+		// empty document; the factory then finds it loaded.
+		if _, err := e.openDocument(factoryArgs[0]); err != nil {
+			return nil, err
 		}
-		return
 	}
 	// TODO(maruel): e.nextViewID is an implementation detail, it's wrong.
-	view := viewFactory(e, e.nextViewID, args[3:]...)
+	view := viewFactory(e, e.nextViewID, args.Strings(3)...)
 	e.nextViewID++
 
 	child := makeWindow(parent, view, docking)
+	child.factoryName = viewFactoryName
+	child.factoryArgs = args.Strings(3)
+	if docking == wicore.DockingFill {
+		// The new Window is the visible one.
+		parent.childrenWindows = append([]*window{child}, parent.childrenWindows...)
+	} else {
+		parent.childrenWindows = append(parent.childrenWindows, child)
+	}
 	if docking == wicore.DockingFloating {
 		width, height := view.NaturalSize()
 		if child.border != wicore.BorderNone {
 			width += 2
 			height += 2
 		}
-		// TODO(maruel): Handle when width or height > scren size.
 		// TODO(maruel): Not clean. Doesn't handle root Window resize properly.
 		rootRect := e.rootWindow.Rect()
-		child.rect.X = (rootRect.Width - width - 1) / 2
-		child.rect.Y = (rootRect.Height - height - 1) / 2
-		child.rect.Width = width
-		child.rect.Height = height
+		if width > rootRect.Width {
+			width = rootRect.Width
+		}
+		if height > rootRect.Height {
+			height = rootRect.Height
+		}
+		// setRect() must be used so the Window's buffer is allocated.
+		child.setRect(raster.Rect{(rootRect.Width - width - 1) / 2, (rootRect.Height - height - 1) / 2, width, height})
 	}
-	parent.childrenWindows = append(parent.childrenWindows, child)
 	parent.resizeChildren()
 	// Call OnAttach() after the Window is attached to the parent.
 	view.OnAttach(child)
-	e.activateWindow(child)
+	if view.IsDisabled() {
+		// A disabled View, like the status bar, can't have the focus.
+		return nil, nil
+	}
+	return nil, e.activateWindow(child)
 }
 
-func cmdWindowSetDocking(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
-	windowName := args[0]
-	dockingName := args[1]
-
-	child := e.idToWindow(windowName)
-	if child == nil {
-		e.ExecuteCommand(w, "alert", isNotValidWindow.Sprintf(windowName))
-		return
-	}
-	docking := wicore.StringToDockingType(dockingName)
-	if docking == wicore.DockingUnknown {
-		e.ExecuteCommand(w, "alert", invalidDocking.Sprintf(dockingName))
-		return
-	}
-	if w.docking != docking {
+func cmdWindowSetDocking(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	child := args.Window(0).(*window)
+	docking := args.Docking(1)
+	if child.docking != docking {
 		// TODO(maruel): Check no other parent's child window have the same dock.
-		w.docking = docking
-		w.parent.resizeChildren()
-		wicore.PostCommand(w.e, nil, "editor_redraw")
+		child.docking = docking
+		child.parent.resizeChildren()
+		wicore.PostCommand(e, nil, "editor_redraw")
 	}
+	return nil, nil
 }
 
-func cmdWindowSetRect(c *privilegedCommandImpl, e *editor, w *window, args ...string) {
-	windowName := args[0]
-
-	child := e.idToWindow(windowName)
-	if child == nil {
-		e.ExecuteCommand(w, "alert", isNotValidWindow.Sprintf(windowName))
-		return
-	}
-	r := raster.Rect{}
-	var err1, err2, err3, err4 error
-	r.X, err1 = strconv.Atoi(args[1])
-	r.Y, err2 = strconv.Atoi(args[2])
-	r.Width, err3 = strconv.Atoi(args[3])
-	r.Height, err4 = strconv.Atoi(args[4])
-	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
-		e.ExecuteCommand(w, "alert", invalidRect.Sprintf(args[1], args[2], args[3], args[4]))
-		return
-	}
-	child.setRect(r)
+func cmdWindowSetRect(c *privilegedCommandImpl, e *editor, w *window, args wicore.ArgValues) (wicore.CommandResult, error) {
+	child := args.Window(0).(*window)
+	child.setRect(raster.Rect{args.Int(1), args.Int(2), args.Int(3), args.Int(4)})
+	return nil, nil
 }
 
 // RegisterWindowCommands registers all the commands relative to window
@@ -597,7 +620,7 @@ func RegisterWindowCommands(dispatcher wicore.CommandsW) {
 	cmds := []wicore.Command{
 		&privilegedCommandImpl{
 			"window_activate",
-			1,
+			wicore.CommandArgs{{Name: "window", Type: wicore.ArgWindowID}},
 			cmdWindowActivate,
 			wicore.WindowCategory,
 			lang.Map{
@@ -609,7 +632,7 @@ func RegisterWindowCommands(dispatcher wicore.CommandsW) {
 		},
 		&privilegedCommandImpl{
 			"window_close",
-			1,
+			wicore.CommandArgs{{Name: "window", Type: wicore.ArgWindowID}},
 			cmdWindowClose,
 			wicore.WindowCategory,
 			lang.Map{
@@ -621,19 +644,27 @@ func RegisterWindowCommands(dispatcher wicore.CommandsW) {
 		},
 		&privilegedCommandImpl{
 			"window_new",
-			-1,
+			wicore.CommandArgs{
+				{Name: "parent", Type: wicore.ArgWindowID},
+				{Name: "docking", Type: wicore.ArgDocking},
+				{Name: "view name", Type: wicore.ArgString},
+				{Name: "view args", Type: wicore.ArgString, Optional: true, Variadic: true},
+			},
 			cmdWindowNew,
 			wicore.WindowCategory,
 			lang.Map{
 				lang.En: "Creates a new window",
 			},
 			lang.Map{
-				lang.En: "Usage: window_new <parent> <docking> <view name> <view args...>\nCreates a new window. The new window is created as a child to the specified parent. It creates inside the window the view specified. The Window is activated. It is invalid to add a child Window with the same docking as one already present.",
+				lang.En: "Creates a new window. The new window is created as a child to the specified parent. It creates inside the window the view specified. The Window is activated. It is invalid to add a child Window with the same docking as one already present.",
 			},
 		},
 		&privilegedCommandImpl{
 			"window_set_docking",
-			2,
+			wicore.CommandArgs{
+				{Name: "window", Type: wicore.ArgWindowID},
+				{Name: "docking", Type: wicore.ArgDocking},
+			},
 			cmdWindowSetDocking,
 			wicore.WindowCategory,
 			lang.Map{
@@ -645,14 +676,20 @@ func RegisterWindowCommands(dispatcher wicore.CommandsW) {
 		},
 		&privilegedCommandImpl{
 			"window_set_rect",
-			5,
+			wicore.CommandArgs{
+				{Name: "window", Type: wicore.ArgWindowID},
+				{Name: "x", Type: wicore.ArgInt},
+				{Name: "y", Type: wicore.ArgInt},
+				{Name: "w", Type: wicore.ArgInt},
+				{Name: "h", Type: wicore.ArgInt},
+			},
 			cmdWindowSetRect,
 			wicore.WindowCategory,
 			lang.Map{
 				lang.En: "Move a window",
 			},
 			lang.Map{
-				lang.En: "Usage: window_set_rect <window> <x> <y> <w> <h>\nMoves a Window relative to the parent window, unless it is floating, where it is relative to the view port.",
+				lang.En: "Moves a Window relative to the parent window, unless it is floating, where it is relative to the view port.",
 			},
 		},
 	}
@@ -0,0 +1,72 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package editor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore"
+	"github.com/wi-ed/wi/wicore/raster"
+)
+
+func TestWindowFill(t *testing.T) {
+	defer keepLog(t)()
+
+	tmpDir, err := ioutil.TempDir("", "wi")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	pathA := tmpDir + "/a.txt"
+	pathB := tmpDir + "/b.txt"
+	ut.AssertEqual(t, nil, ioutil.WriteFile(pathA, []byte("a\n"), 0600))
+	ut.AssertEqual(t, nil, ioutil.WriteFile(pathB, []byte("b\n"), 0600))
+
+	ed, err := MakeEditor(NewTerminalFake(80, 25, []TerminalEvent{}), true)
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		_ = ed.Close()
+	}()
+	e := ed.(*editor)
+	var order []string
+	var rects []raster.Rect
+	snapshot := func(o wicore.CommandOutcome) {
+		ut.AssertEqual(t, nil, o.Err)
+		var names []string
+		for _, w := range e.rootWindow.childrenWindows {
+			if w.docking == wicore.DockingFill {
+				names = append(names, filepath.Base(w.view.(*documentView).document.filePath))
+				rects = append(rects, w.Rect())
+			}
+		}
+		order = append(order, strings.Join(names, ","))
+	}
+	wicore.PostCommand(e, nil, "editor_bootstrap_ui")
+	wicore.PostCommand(e, snapshot, "window_new", "0", "fill", "new_document", pathA)
+	// Several DockingFill Windows can be stacked, the newest is visible.
+	wicore.PostCommand(e, snapshot, "window_new", "0", "fill", "new_document", pathB)
+	wicore.PostCommand(e, func(o wicore.CommandOutcome) {
+		// Activating the hidden Window brings it to the front.
+		for _, w := range e.rootWindow.childrenWindows {
+			if v, ok := w.view.(*documentView); ok && v.document.filePath == pathA {
+				wicore.PostCommand(e, snapshot, "window_activate", w.ID())
+			}
+		}
+		wicore.PostCommand(e, nil, "editor_quit")
+	}, "editor_redraw")
+	ut.AssertEqual(t, 0, e.EventLoop())
+
+	ut.AssertEqual(t, []string{"a.txt", "b.txt,a.txt", "a.txt,b.txt"}, order)
+	// The hidden ones are kept at the size of the visible one.
+	for _, r := range rects {
+		ut.AssertEqual(t, rects[0], r)
+	}
+	ut.AssertEqual(t, pathA, e.ActiveWindow().View().(*documentView).document.filePath)
+}
@@ -13,10 +13,13 @@ import (
 // It is implemented by wi/wicore/plugin, exported here to be used via RPC.
 type EventTriggerRPC interface {
 	TriggerCommandsRPC(packet PacketCommands, ignored *int) error
+	TriggerDocumentChangedOnDiskRPC(packet PacketDocumentChangedOnDisk, ignored *int) error
 	TriggerDocumentCreatedRPC(packet PacketDocumentCreated, ignored *int) error
 	TriggerDocumentCursorMovedRPC(packet PacketDocumentCursorMoved, ignored *int) error
 	TriggerEditorKeyboardModeChangedRPC(packet PacketEditorKeyboardModeChanged, ignored *int) error
 	TriggerEditorLanguageRPC(packet PacketEditorLanguage, ignored *int) error
+	TriggerEditorQuittingRPC(packet PacketEditorQuitting, ignored *int) error
+	TriggerSettingChangedRPC(packet PacketSettingChanged, ignored *int) error
 	TriggerTerminalKeyPressedRPC(packet PacketTerminalKeyPressed, ignored *int) error
 	TriggerTerminalMetaKeyPressedRPC(packet PacketTerminalMetaKeyPressed, ignored *int) error
 	TriggerTerminalResizedRPC(packet PacketTerminalResized, ignored *int) error
@@ -31,6 +34,11 @@ type PacketCommands struct {
 	Cmds wicore.EnqueuedCommands
 }
 
+// PacketDocumentChangedOnDisk is exported for internal RPC use.
+type PacketDocumentChangedOnDisk struct {
+	Doc wicore.Document
+}
+
 // PacketDocumentCreated is exported for internal RPC use.
 type PacketDocumentCreated struct {
 	Doc wicore.Document
@@ -53,6 +61,18 @@ type PacketEditorLanguage struct {
 	L lang.Language
 }
 
+// PacketEditorQuitting is exported for internal RPC use.
+type PacketEditorQuitting struct {
+}
+
+// PacketSettingChanged is exported for internal RPC use.
+type PacketSettingChanged struct {
+	Scope wicore.SettingScope
+	Owner string
+	Name  string
+	Value string
+}
+
 // PacketTerminalKeyPressed is exported for internal RPC use.
 type PacketTerminalKeyPressed struct {
 	K key.Press
@@ -17,7 +17,40 @@ type PluginRPC interface {
 	GetInfo(ignored lang.Language, out *wicore.PluginDetails) error
 	// Init is called on plugin startup. All initialization should be done there.
 	Init(in wicore.EditorDetails, ignored *int) error
+	// Quitting is called after the event EditorQuitting was sent to the plugin.
+	// It returns once the plugin processed the event, including the commands
+	// its listeners sent to the editor, so a veto is never missed.
+	Quitting(in int, ignored *int) error
 	// Quit is called on editor termination. The editor waits for the function to
 	// return.
 	Quit(in int, ignored *int) error
 }
+
+// EditorRPC is the low-level interface exposed by the editor to a plugin for
+// use by net/rpc. It is served on the socket specified to the plugin process
+// in the environment variable WI_EDITOR. The calls fail if the editor quits
+// before answering.
+type EditorRPC interface {
+	// TriggerCommands enqueues commands in the editor. It returns once the
+	// commands were executed.
+	TriggerCommands(packet PacketCommands, out *[]PacketCommandOutcome) error
+	// Prompt asks a question to the user. It returns once the user answered.
+	Prompt(in wicore.Prompt, out *wicore.PromptAnswer) error
+	// GetSetting returns the effective value of a setting as seen from a
+	// Window.
+	GetSetting(in PacketGetSetting, out *string) error
+}
+
+// PacketGetSetting is the request of EditorRPC.GetSetting.
+type PacketGetSetting struct {
+	WindowID string // Empty for the active Window.
+	Name     string
+}
+
+// PacketCommandOutcome is wicore.CommandOutcome in a form that can be sent
+// over RPC.
+type PacketCommandOutcome struct {
+	Command []string
+	Result  wicore.CommandResult
+	Err     string // Empty if the command succeeded.
+}
@@ -43,12 +43,16 @@ import (
 	"github.com/wi-ed/wi/wicore"
 )
 
-func terminalThread(mustClose chan<- func()) int {
+func terminalThread(mustClose chan<- func(), onPanic chan<- func()) int {
 	// "flag" and "termbox" use a lot of global variables so they can't be easily
 	// included in parallel tests.
 	command := flag.Bool("c", false, "Runs the commands specified on startup")
 	version := flag.Bool("v", false, "Prints version and exit")
 	noPlugin := flag.Bool("no-plugin", false, "Disable loading plugins")
+	noWirc := flag.Bool("no-wirc", false, "Disable running the wirc startup scripts")
+	noSwap := flag.Bool("no-swap", false, "Disable journaling the modified documents in swap files")
+	session := flag.String("session", "", "Restores the session saved by session_save in this file")
+	helpExport := flag.String("help-export", "", "Prints the help about all the commands in the specified format (markdown or man) and exit")
 	flag.Parse()
 
 	// Process this one early. No one wants version output to take 1s.
@@ -57,6 +61,17 @@ func terminalThread(mustClose chan<- func()) int {
 		return 0
 	}
 
+	out := debugHook()
+	if out != nil {
+		defer func() {
+			_ = out.Close()
+		}()
+	}
+
+	if *helpExport != "" {
+		return exportHelp(*helpExport, *noPlugin)
+	}
+
 	if *command && flag.NArg() == 0 {
 		fmt.Fprintf(os.Stderr, "error: -c implies specifying commands to execute")
 		return 1
@@ -67,13 +82,6 @@ func terminalThread(mustClose chan<- func()) int {
 		return 1
 	}
 
-	out := debugHook()
-	if out != nil {
-		defer func() {
-			_ = out.Close()
-		}()
-	}
-
 	// It is really important that all other goroutine wrap with handlePanic(),
 	// otherwise the terminal will be left in a broken state.
 	mustClose <- termbox.Close
@@ -88,8 +96,22 @@ func terminalThread(mustClose chan<- func()) int {
 		_ = e.Close()
 	}()
 	debugHookEditor(e)
+	if !*noSwap {
+		// Save what can be saved if the editor panics.
+		onPanic <- e.FlushSwapFiles
+	}
 
+	if !*noWirc {
+		for _, path := range editor.ConfigPaths() {
+			if err := editor.RunConfig(e, path); err != nil {
+				wicore.PostCommand(e, nil, "alert", err.Error())
+			}
+		}
+	}
 	wicore.PostCommand(e, nil, "editor_bootstrap_ui")
+	if *session != "" {
+		wicore.PostCommand(e, nil, "session_load", *session)
+	}
 	if *command {
 		for _, i := range flag.Args() {
 			wicore.PostCommand(e, nil, i)
@@ -98,24 +120,55 @@ func terminalThread(mustClose chan<- func()) int {
 		for _, i := range flag.Args() {
 			wicore.PostCommand(e, nil, "open", i)
 		}
-	} else {
+	} else if *session == "" {
 		// If nothing, opens a blank editor.
 		wicore.PostCommand(e, nil, "new")
 	}
+	if !*noSwap {
+		// Done last so the offer to recover documents is shown on top.
+		if dir := editor.SwapFilesDir(); dir != "" {
+			if err := e.EnableSwapFiles(dir); err != nil {
+				wicore.PostCommand(e, nil, "alert", err.Error())
+			}
+		}
+	}
 	return e.EventLoop()
 }
 
+// exportHelp prints the help without initializing the terminal.
+func exportHelp(format string, noPlugin bool) int {
+	e, err := editor.MakeEditor(editor.NewTerminalFake(80, 25, nil), noPlugin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s", err)
+		return 1
+	}
+	defer func() {
+		_ = e.Close()
+	}()
+	out, err := editor.ExportHelp(e, format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s", err)
+		return 1
+	}
+	fmt.Print(out)
+	return 0
+}
+
 func mainImpl() int {
 	returnCode := make(chan int)
 	var closer func()
+	var flush func()
 	mustClose := make(chan func())
+	onPanic := make(chan func())
 	wicore.Go("terminalThread", func() {
-		returnCode <- terminalThread(mustClose)
+		returnCode <- terminalThread(mustClose, onPanic)
 	})
 	for {
 		select {
 		case c := <-mustClose:
 			closer = c
+		case f := <-onPanic:
+			flush = f
 		case r := <-returnCode:
 			if closer != nil {
 				closer()
@@ -126,6 +179,9 @@ func mainImpl() int {
 			if closer != nil {
 				closer()
 			}
+			if flush != nil {
+				flush()
+			}
 			fmt.Fprintf(os.Stderr, "Panic: %s\n", p)
 			return 1
 		}
@@ -271,7 +271,13 @@ func (t TermBox) Blit(b *raster.Buffer) {
 		for x := 0; x < width; x++ {
 			i := y*width + x
 			cell := b.Cell(x, y)
+			// termbox skips the cell following a wide character by itself.
+			// termbox doesn't support combining characters, so cell.Comb is
+			// not drawn.
 			cells[i].Ch = cell.R
+			if cell.R == raster.Continuation {
+				cells[i].Ch = ' '
+			}
 			cells[i].Fg = rgbToTermBox(cell.F.Fg)
 			// TODO(maruel): Not sure.
 			if cell.F.Underline {
@@ -0,0 +1,303 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// wi-fake-lsp is a minimal language server to test the LSP client of the
+// editor. It knows about the words of the documents, not about any language:
+//   - The lines containing ERROR or WARNING are reported as diagnostics.
+//   - The definition of a word is its first occurrence in the document and
+//     its references are all its occurrences.
+//   - The completions are the words of the document starting with the prefix
+//     before the cursor.
+//   - Formatting removes the trailing whitespace.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type rng struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type location struct {
+	URI   string `json:"uri"`
+	Range rng    `json:"range"`
+}
+
+type textEdit struct {
+	Range   rng    `json:"range"`
+	NewText string `json:"newText"`
+}
+
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  interface{}     `json:"result,omitempty"`
+}
+
+type params struct {
+	TextDocument struct {
+		URI  string `json:"uri"`
+		Text string `json:"text"`
+	} `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+	Position position `json:"position"`
+	NewName  string   `json:"newName"`
+}
+
+// word is an occurrence of a word, in UTF-16 code units.
+type word struct {
+	text  string
+	line  int
+	start int
+	end   int
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func runeLen(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeLen(r)
+	}
+	return n
+}
+
+// words returns the words of the text.
+func words(text string) []word {
+	var out []word
+	for i, l := range strings.Split(text, "\n") {
+		var cur []rune
+		col := 0
+		start := 0
+		flush := func() {
+			if len(cur) != 0 {
+				out = append(out, word{string(cur), i, start, col})
+				cur = nil
+			}
+		}
+		for _, r := range l {
+			if isWordRune(r) {
+				if len(cur) == 0 {
+					start = col
+				}
+				cur = append(cur, r)
+			} else {
+				flush()
+			}
+			col += runeLen(r)
+		}
+		flush()
+	}
+	return out
+}
+
+// wordAt returns the word at the position, or ending at it.
+func wordAt(text string, pos position) (word, bool) {
+	for _, w := range words(text) {
+		if w.line == pos.Line && w.start <= pos.Character && pos.Character <= w.end {
+			return w, true
+		}
+	}
+	return word{}, false
+}
+
+func (w word) rng() rng {
+	return rng{position{w.line, w.start}, position{w.line, w.end}}
+}
+
+type server struct {
+	w    io.Writer
+	docs map[string]string
+}
+
+func (s *server) send(m *message) {
+	m.JSONRPC = "2.0"
+	b, err := json.Marshal(m)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := fmt.Fprintf(s.w, "Content-Length: %d\r\n\r\n%s", len(b), b); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func (s *server) publish(uri string) {
+	diags := []interface{}{}
+	for i, l := range strings.Split(s.docs[uri], "\n") {
+		for severity, marker := range []string{"ERROR", "WARNING"} {
+			if c := strings.Index(l, marker); c != -1 {
+				c = utf16Len(l[:c])
+				diags = append(diags, map[string]interface{}{
+					"range":    rng{position{i, c}, position{i, c + len(marker)}},
+					"severity": severity + 1,
+					"message":  marker,
+				})
+			}
+		}
+	}
+	p, _ := json.Marshal(map[string]interface{}{"uri": uri, "diagnostics": diags})
+	s.send(&message{Method: "textDocument/publishDiagnostics", Params: p})
+}
+
+// handle returns the result of a request.
+func (s *server) handle(method string, p *params) interface{} {
+	uri := p.TextDocument.URI
+	text := s.docs[uri]
+	switch method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":           1,
+				"hoverProvider":              true,
+				"completionProvider":         map[string]interface{}{},
+				"definitionProvider":         true,
+				"referencesProvider":         true,
+				"renameProvider":             true,
+				"documentFormattingProvider": true,
+			},
+		}
+	case "textDocument/hover":
+		if w, ok := wordAt(text, p.Position); ok {
+			return map[string]interface{}{"contents": map[string]string{"kind": "plaintext", "value": "word " + w.text}}
+		}
+	case "textDocument/completion":
+		// Only the part of the word before the cursor is the prefix.
+		w, _ := wordAt(text, p.Position)
+		prefix := ""
+		for i, r := range w.text {
+			if w.start+utf16Len(w.text[:i]) >= p.Position.Character {
+				break
+			}
+			prefix += string(r)
+		}
+		seen := map[string]bool{prefix: true}
+		var labels []string
+		for _, o := range words(text) {
+			if strings.HasPrefix(o.text, prefix) && !seen[o.text] {
+				seen[o.text] = true
+				labels = append(labels, o.text)
+			}
+		}
+		sort.Strings(labels)
+		items := []interface{}{}
+		for _, l := range labels {
+			items = append(items, map[string]string{"label": l, "detail": "word"})
+		}
+		return items
+	case "textDocument/definition", "textDocument/references", "textDocument/rename":
+		w, ok := wordAt(text, p.Position)
+		if !ok {
+			break
+		}
+		locs := []location{}
+		edits := []textEdit{}
+		for _, o := range words(text) {
+			if o.text == w.text {
+				locs = append(locs, location{uri, o.rng()})
+				edits = append(edits, textEdit{o.rng(), p.NewName})
+			}
+		}
+		switch method {
+		case "textDocument/definition":
+			return locs[0]
+		case "textDocument/references":
+			return locs
+		default:
+			return map[string]interface{}{"changes": map[string][]textEdit{uri: edits}}
+		}
+	case "textDocument/formatting":
+		edits := []textEdit{}
+		for i, l := range strings.Split(text, "\n") {
+			if t := strings.TrimRight(l, " \t"); t != l {
+				edits = append(edits, textEdit{rng{position{i, utf16Len(t)}, position{i, utf16Len(l)}}, ""})
+			}
+		}
+		return edits
+	}
+	return nil
+}
+
+func main() {
+	log.SetFlags(0)
+	s := &server{os.Stdout, map[string]string{}}
+	r := bufio.NewReader(os.Stdin)
+	for {
+		length := 0
+		for {
+			l, err := r.ReadString('\n')
+			if err != nil {
+				// The client closed stdin.
+				os.Exit(0)
+			}
+			l = strings.TrimSpace(l)
+			if l == "" {
+				break
+			}
+			if strings.HasPrefix(l, "Content-Length:") {
+				length, _ = strconv.Atoi(strings.TrimSpace(l[len("Content-Length:"):]))
+			}
+		}
+		b := make([]byte, length)
+		if _, err := io.ReadFull(r, b); err != nil {
+			log.Fatal(err)
+		}
+		m := &message{}
+		if err := json.Unmarshal(b, m); err != nil {
+			log.Fatal(err)
+		}
+		p := &params{}
+		_ = json.Unmarshal(m.Params, p)
+		switch m.Method {
+		case "exit":
+			os.Exit(0)
+		case "textDocument/didOpen":
+			s.docs[p.TextDocument.URI] = p.TextDocument.Text
+			s.publish(p.TextDocument.URI)
+		case "textDocument/didChange":
+			for _, c := range p.ContentChanges {
+				s.docs[p.TextDocument.URI] = c.Text
+			}
+			s.publish(p.TextDocument.URI)
+		case "textDocument/didClose":
+			delete(s.docs, p.TextDocument.URI)
+		}
+		if len(m.ID) != 0 {
+			result := s.handle(m.Method, p)
+			if result == nil {
+				// Result is omitted when nil; send an explicit null.
+				result = json.RawMessage("null")
+			}
+			s.send(&message{ID: m.ID, Result: result})
+		}
+	}
+}
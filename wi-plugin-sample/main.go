@@ -51,6 +51,9 @@ func (p *pluginImpl) Init(e wicore.Editor) {
 	e.RegisterEditorLanguage(func(l lang.Language) {
 		log.Printf("EditorLanguage(%s)", l)
 	})
+	e.RegisterEditorQuitting(func() {
+		log.Printf("EditorQuitting()")
+	})
 	e.RegisterTerminalResized(func() {
 		log.Printf("TerminalResized()")
 	})
@@ -8,18 +8,19 @@ package wicore
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/wi-ed/wi/wicore/lang"
 )
 
-// CommandImplHandler is the CommandHandler to use when coupled with CommandImpl.
-type CommandImplHandler func(c *CommandImpl, e EditorW, w Window, args ...string)
+// CommandImplHandler is the handler of a CommandImpl.
+type CommandImplHandler func(c *CommandImpl, e EditorW, w Window, args ArgValues) (CommandResult, error)
 
 // CommandImpl is the boilerplate Command implementation.
 type CommandImpl struct {
 	NameValue      string
-	ExpectedArgs   int // If >= 0, the command will be aborted if the number of arguments is not exactly this value. Set to -1 to disable verification. On abort, an alert with the long description of the command is done.
+	ArgsValue      CommandArgs // Arguments are validated and converted according to this schema before HandlerValue is called.
 	HandlerValue   CommandImplHandler
 	CategoryValue  CommandCategory
 	ShortDescValue lang.Map
@@ -31,12 +32,14 @@ func (c *CommandImpl) Name() string {
 	return c.NameValue
 }
 
+// Args implements Command.
+func (c *CommandImpl) Args() CommandArgs {
+	return c.ArgsValue
+}
+
 // Handle implements Command.
-func (c *CommandImpl) Handle(e EditorW, w Window, args ...string) {
-	if c.ExpectedArgs != -1 && len(args) != c.ExpectedArgs {
-		e.ExecuteCommand(w, "alert", c.LongDesc())
-	}
-	c.HandlerValue(c, e, w, args...)
+func (c *CommandImpl) Handle(e EditorW, w Window, args ArgValues) (CommandResult, error) {
+	return c.HandlerValue(c, e, w, args)
 }
 
 // Category implements Command.
@@ -68,26 +71,27 @@ func (c *CommandAlias) Name() string {
 	return c.NameValue
 }
 
+// Args implements Command. The arguments are validated by the aliased
+// command.
+func (c *CommandAlias) Args() CommandArgs {
+	return AnyArgs
+}
+
 // Handle implements Command.
-func (c *CommandAlias) Handle(e EditorW, w Window, args ...string) {
+func (c *CommandAlias) Handle(e EditorW, w Window, args ArgValues) (CommandResult, error) {
 	// The alias is executed inline. This is important for command queue
 	// ordering.
-	cmd := GetCommand(e, w, c.CommandValue)
-	if cmd != nil {
-		cmd.Handle(e, w, args...)
-	} else {
-		// TODO(maruel): This makes assumption on "alert".
-		cmd = GetCommand(e, w, "alert")
-		txt := fmt.Sprintf(AliasNotFound.String(), c.NameValue, c.CommandValue)
-		cmd.Handle(e, w, txt)
+	if GetCommand(e, w, c.CommandValue) == nil {
+		return nil, fmt.Errorf(AliasNotFound.String(), c.NameValue, c.CommandValue)
 	}
+	return e.ExecuteCommand(w, c.CommandValue, append(append([]string{}, c.ArgsValue...), args.Strings(0)...)...)
 }
 
 // Category implements Command.
 func (c *CommandAlias) Category(e Editor, w Window) CommandCategory {
 	cmd := GetCommand(e, w, c.CommandValue)
 	if cmd != nil {
-		return c.Category(e, w)
+		return cmd.Category(e, w)
 	}
 	return UnknownCategory
 }
@@ -113,12 +117,18 @@ func (c *CommandAlias) merged() string {
 // Utility functions.
 
 // PostCommand appends a Command at the end of the queue. It is a shortcut to
-// e.TriggerCommands(EnqueuedCommands{...}).
-func PostCommand(e EventRegistry, callback func(), cmdName string, args ...string) {
+// e.TriggerCommands(EnqueuedCommands{...}). callback can be nil.
+func PostCommand(e EventRegistry, callback func(outcome CommandOutcome), cmdName string, args ...string) {
 	line := make([]string, len(args)+1)
 	line[0] = cmdName
 	copy(line[1:], args)
-	e.TriggerCommands(EnqueuedCommands{[][]string{line}, callback})
+	var c func(outcomes []CommandOutcome)
+	if callback != nil {
+		c = func(outcomes []CommandOutcome) {
+			callback(outcomes[0])
+		}
+	}
+	e.TriggerCommands(EnqueuedCommands{[][]string{line}, false, c})
 }
 
 // GetCommand traverses the Window hierarchy tree to find a View that has
@@ -139,3 +149,105 @@ func GetCommand(e Editor, w Window, cmdName string) Command {
 		}
 	}
 }
+
+// SplitCommandLine splits a command line into its tokens. Tokens are
+// separated by whitespace. Single or double quotes can be used to include
+// whitespace in a token. A backslash escapes the next character, except inside
+// single quotes.
+func SplitCommandLine(line string) []string {
+	out := []string{}
+	var current []rune
+	inToken := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			current = append(current, r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inToken = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current = append(current, r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inToken = true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inToken {
+				out = append(out, string(current))
+				current = current[:0]
+				inToken = false
+			}
+		default:
+			current = append(current, r)
+			inToken = true
+		}
+	}
+	if inToken {
+		out = append(out, string(current))
+	}
+	return out
+}
+
+// JoinCommandLine is the reverse of SplitCommandLine. Tokens are quoted as
+// necessary.
+func JoinCommandLine(tokens []string) string {
+	out := make([]string, len(tokens))
+	for i, t := range tokens {
+		if t == "" || strings.ContainsAny(t, " \t\r\n\"'\\") {
+			t = "\"" + strings.Replace(strings.Replace(t, "\\", "\\\\", -1), "\"", "\\\"", -1) + "\""
+		}
+		out[i] = t
+	}
+	return strings.Join(out, " ")
+}
+
+// GetCommandNames returns the names of all the commands reachable from the
+// Window w, sorted. If Window is nil, it starts with the Editor's active
+// Window.
+func GetCommandNames(e Editor, w Window) []string {
+	if w == nil {
+		w = e.ActiveWindow()
+	}
+	seen := map[string]bool{}
+	out := []string{}
+	for ; w != nil; w = w.Parent() {
+		for _, name := range w.View().Commands().GetNames() {
+			if !seen[name] {
+				seen[name] = true
+				out = append(out, name)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// CompleteCommandLine returns the completion candidates for the last token of
+// a partially typed command line. The command name is completed first, then
+// its arguments according to the Command's Args().
+func CompleteCommandLine(e Editor, w Window, line string) []string {
+	tokens := SplitCommandLine(line)
+	if len(line) == 0 || strings.HasSuffix(line, " ") {
+		tokens = append(tokens, "")
+	}
+	if len(tokens) == 1 {
+		out := []string{}
+		for _, name := range GetCommandNames(e, w) {
+			if strings.HasPrefix(name, tokens[0]) {
+				out = append(out, name)
+			}
+		}
+		return out
+	}
+	cmd := GetCommand(e, w, tokens[0])
+	if cmd == nil {
+		return nil
+	}
+	return cmd.Args().Complete(e, tokens[1:])
+}
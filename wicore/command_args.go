@@ -0,0 +1,376 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Typed argument schema for commands. The schema is used to validate and
+// convert the arguments before the command is executed, to generate the usage
+// text and to complete arguments in the command window.
+
+package wicore
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wi-ed/wi/wicore/key"
+)
+
+// ArgType is the type of a single command argument.
+type ArgType int
+
+// Supported argument types.
+const (
+	// ArgString accepts any string.
+	ArgString ArgType = iota
+	// ArgInt accepts a base 10 integer.
+	ArgInt
+	// ArgWindowID accepts a Window.ID(). It is converted to a Window.
+	ArgWindowID
+	// ArgDocking accepts a docking name as accepted by StringToDockingType().
+	// It is converted to a DockingType.
+	ArgDocking
+	// ArgKey accepts a key name as accepted by key.StringToPress(). It is
+	// converted to a key.Press.
+	ArgKey
+	// ArgPath accepts a non-empty file path.
+	ArgPath
+	// ArgEnum accepts one of CommandArg.Values.
+	ArgEnum
+	// ArgBool accepts "true", "false", "on", "off", "1" and "0". It is
+	// converted to a bool.
+	ArgBool
+)
+
+func (a ArgType) String() string {
+	switch a {
+	case ArgString:
+		return "string"
+	case ArgInt:
+		return "int"
+	case ArgWindowID:
+		return "window"
+	case ArgDocking:
+		return "docking"
+	case ArgKey:
+		return "key"
+	case ArgPath:
+		return "path"
+	case ArgEnum:
+		return "enum"
+	case ArgBool:
+		return "bool"
+	default:
+		return fmt.Sprintf("ArgType(%d)", int(a))
+	}
+}
+
+// dockingNames is the list of valid values for ArgDocking.
+var dockingNames = []string{"bottom", "fill", "floating", "left", "right", "top"}
+
+// boolNames is the list of canonical values for ArgBool.
+var boolNames = []string{"false", "true"}
+
+// CommandArg describes a single argument accepted by a Command.
+type CommandArg struct {
+	Name     string   // Name as shown in the usage text.
+	Type     ArgType  // Type is used for validation, conversion and completion.
+	Optional bool     // Optional arguments can be omitted. Only trailing arguments can be optional.
+	Variadic bool     // Variadic consumes all the remaining arguments. Only the last argument can be variadic.
+	Values   []string // Values are the valid values when Type is ArgEnum.
+}
+
+// Usage returns the usage text for this argument, e.g. "<name>" or
+// "[window|global]".
+func (c CommandArg) Usage() string {
+	out := c.Name
+	if c.Type == ArgEnum && len(c.Values) != 0 {
+		out = strings.Join(c.Values, "|")
+	}
+	if c.Variadic {
+		out += "..."
+	}
+	if c.Optional {
+		return "[" + out + "]"
+	}
+	return "<" + out + ">"
+}
+
+// Convert validates and converts a single value.
+func (c CommandArg) Convert(e Editor, value string) (interface{}, error) {
+	switch c.Type {
+	case ArgString:
+		return value, nil
+
+	case ArgInt:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf(ArgNotInt.String(), value, c.Name)
+		}
+		return i, nil
+
+	case ArgWindowID:
+		w := FindWindow(e, value)
+		if w == nil {
+			return nil, fmt.Errorf(ArgNotWindow.String(), value, c.Name)
+		}
+		return w, nil
+
+	case ArgDocking:
+		d := StringToDockingType(value)
+		if d == DockingUnknown {
+			return nil, fmt.Errorf(ArgNotInList.String(), value, c.Name, strings.Join(dockingNames, ", "))
+		}
+		return d, nil
+
+	case ArgKey:
+		k := key.StringToPress(value)
+		// The round trip ensures unknown key names are refused.
+		if !k.IsValid() || k.String() != value {
+			return nil, fmt.Errorf(ArgNotKey.String(), value, c.Name)
+		}
+		return k, nil
+
+	case ArgPath:
+		if value == "" {
+			return nil, fmt.Errorf(ArgEmptyPath.String(), c.Name)
+		}
+		return value, nil
+
+	case ArgEnum:
+		for _, v := range c.Values {
+			if v == value {
+				return value, nil
+			}
+		}
+		return nil, fmt.Errorf(ArgNotInList.String(), value, c.Name, strings.Join(c.Values, ", "))
+
+	case ArgBool:
+		switch value {
+		case "true", "on", "1":
+			return true, nil
+		case "false", "off", "0":
+			return false, nil
+		}
+		return nil, fmt.Errorf(ArgNotInList.String(), value, c.Name, strings.Join(boolNames, ", "))
+
+	default:
+		return nil, fmt.Errorf("unknown argument type %s", c.Type)
+	}
+}
+
+// Complete returns the candidate values for this argument starting with
+// prefix.
+func (c CommandArg) Complete(e Editor, prefix string) []string {
+	var candidates []string
+	switch c.Type {
+	case ArgWindowID:
+		candidates = windowIDs(RootWindow(e.ActiveWindow()), nil)
+	case ArgDocking:
+		candidates = dockingNames
+	case ArgEnum:
+		candidates = c.Values
+	case ArgBool:
+		candidates = boolNames
+	case ArgPath:
+		matches, _ := filepath.Glob(prefix + "*")
+		return matches
+	default:
+		return nil
+	}
+	out := []string{}
+	for _, v := range candidates {
+		if strings.HasPrefix(v, prefix) {
+			out = append(out, v)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// CommandArgs is the argument schema of a Command.
+type CommandArgs []CommandArg
+
+// AnyArgs accepts any number of string arguments. It is used when the
+// validation is deferred to another command, like CommandAlias does.
+var AnyArgs = CommandArgs{{Name: "args", Type: ArgString, Optional: true, Variadic: true}}
+
+// Usage returns the usage text for the command cmdName.
+func (c CommandArgs) Usage(cmdName string) string {
+	out := cmdName
+	for _, a := range c {
+		out += " " + a.Usage()
+	}
+	return out
+}
+
+// Parse validates and converts the arguments according to the schema.
+//
+// The returned ArgValues has exactly one item per CommandArg. Missing optional
+// arguments are nil. A variadic argument is returned as a slice of converted
+// values.
+func (c CommandArgs) Parse(e Editor, cmdName string, args []string) (ArgValues, error) {
+	out := make(ArgValues, len(c))
+	i := 0
+	for index, arg := range c {
+		if i >= len(args) {
+			if arg.Optional {
+				continue
+			}
+			return nil, &ArgsError{cmdName, c.Usage(cmdName), fmt.Sprintf(ArgMissing.String(), arg.Name)}
+		}
+		if arg.Variadic {
+			items := make([]interface{}, 0, len(args)-i)
+			for ; i < len(args); i++ {
+				v, err := arg.Convert(e, args[i])
+				if err != nil {
+					return nil, &ArgsError{cmdName, c.Usage(cmdName), err.Error()}
+				}
+				items = append(items, v)
+			}
+			out[index] = items
+			continue
+		}
+		v, err := arg.Convert(e, args[i])
+		if err != nil {
+			return nil, &ArgsError{cmdName, c.Usage(cmdName), err.Error()}
+		}
+		out[index] = v
+		i++
+	}
+	if i != len(args) {
+		return nil, &ArgsError{cmdName, c.Usage(cmdName), fmt.Sprintf(ArgTooMany.String(), len(args)-i)}
+	}
+	return out, nil
+}
+
+// Complete returns the completion candidates for the last item of args. args
+// excludes the command name.
+func (c CommandArgs) Complete(e Editor, args []string) []string {
+	if len(args) == 0 || len(c) == 0 {
+		return nil
+	}
+	index := len(args) - 1
+	if index >= len(c) {
+		if !c[len(c)-1].Variadic {
+			return nil
+		}
+		index = len(c) - 1
+	}
+	return c[index].Complete(e, args[len(args)-1])
+}
+
+// ArgsError is returned by CommandArgs.Parse() when the arguments do not match
+// the schema.
+type ArgsError struct {
+	Command string
+	Usage   string
+	Reason  string
+}
+
+func (a *ArgsError) Error() string {
+	return fmt.Sprintf(ArgUsage.String(), a.Reason, a.Usage)
+}
+
+// ArgValues are the arguments converted by CommandArgs.Parse().
+//
+// The accessors return the zero value when the argument was optional and
+// omitted.
+type ArgValues []interface{}
+
+// Has returns true if the argument at index i was specified.
+func (a ArgValues) Has(i int) bool {
+	return i < len(a) && a[i] != nil
+}
+
+// String returns the argument at index i for ArgString, ArgPath and ArgEnum.
+func (a ArgValues) String(i int) string {
+	if !a.Has(i) {
+		return ""
+	}
+	return a[i].(string)
+}
+
+// Int returns the argument at index i for ArgInt.
+func (a ArgValues) Int(i int) int {
+	if !a.Has(i) {
+		return 0
+	}
+	return a[i].(int)
+}
+
+// Bool returns the argument at index i for ArgBool.
+func (a ArgValues) Bool(i int) bool {
+	if !a.Has(i) {
+		return false
+	}
+	return a[i].(bool)
+}
+
+// Window returns the argument at index i for ArgWindowID.
+func (a ArgValues) Window(i int) Window {
+	if !a.Has(i) {
+		return nil
+	}
+	return a[i].(Window)
+}
+
+// Docking returns the argument at index i for ArgDocking.
+func (a ArgValues) Docking(i int) DockingType {
+	if !a.Has(i) {
+		return DockingUnknown
+	}
+	return a[i].(DockingType)
+}
+
+// Key returns the argument at index i for ArgKey.
+func (a ArgValues) Key(i int) key.Press {
+	if !a.Has(i) {
+		return key.Press{}
+	}
+	return a[i].(key.Press)
+}
+
+// Strings returns the variadic argument at index i as strings.
+func (a ArgValues) Strings(i int) []string {
+	if !a.Has(i) {
+		return nil
+	}
+	items := a[i].([]interface{})
+	out := make([]string, len(items))
+	for j, item := range items {
+		out[j] = fmt.Sprintf("%v", item)
+	}
+	return out
+}
+
+// windowIDs returns the ID of w and all its children recursively.
+func windowIDs(w Window, out []string) []string {
+	out = append(out, w.ID())
+	for _, child := range w.ChildrenWindows() {
+		out = windowIDs(child, out)
+	}
+	return out
+}
+
+// FindWindow returns the Window with the ID id or nil if not found.
+func FindWindow(e Editor, id string) Window {
+	return findWindowRecurse(RootWindow(e.ActiveWindow()), id)
+}
+
+func findWindowRecurse(w Window, id string) Window {
+	if w.ID() == id {
+		return w
+	}
+	if !strings.HasPrefix(id, w.ID()+":") {
+		return nil
+	}
+	for _, child := range w.ChildrenWindows() {
+		if found := findWindowRecurse(child, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package wicore
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+	"github.com/wi-ed/wi/wicore/key"
+)
+
+var testArgs = CommandArgs{
+	{Name: "scope", Type: ArgEnum, Values: []string{"window", "global"}},
+	{Name: "count", Type: ArgInt},
+	{Name: "key", Type: ArgKey},
+	{Name: "docking", Type: ArgDocking, Optional: true},
+	{Name: "rest", Type: ArgString, Optional: true, Variadic: true},
+}
+
+func TestCommandArgsUsage(t *testing.T) {
+	ut.AssertEqual(t, "foo <window|global> <count> <key> [docking] [rest...]", testArgs.Usage("foo"))
+	ut.AssertEqual(t, "foo", CommandArgs(nil).Usage("foo"))
+}
+
+func TestCommandArgsParse(t *testing.T) {
+	values, err := testArgs.Parse(nil, "foo", []string{"global", "42", "Ctrl-c"})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "global", values.String(0))
+	ut.AssertEqual(t, 42, values.Int(1))
+	ut.AssertEqual(t, key.Press{Ctrl: true, Ch: 'c'}, values.Key(2))
+	ut.AssertEqual(t, false, values.Has(3))
+	ut.AssertEqual(t, DockingUnknown, values.Docking(3))
+	ut.AssertEqual(t, []string(nil), values.Strings(4))
+
+	values, err = testArgs.Parse(nil, "foo", []string{"window", "-1", "F1", "left", "a", "b"})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, DockingLeft, values.Docking(3))
+	ut.AssertEqual(t, []string{"a", "b"}, values.Strings(4))
+}
+
+func TestCommandArgsParseErrors(t *testing.T) {
+	data := [][]string{
+		{},
+		{"local", "1", "a"},
+		{"window", "one", "a"},
+		{"window", "1", "NotAKey"},
+		{"window", "1", "a", "sideways"},
+	}
+	for i, line := range data {
+		_, err := testArgs.Parse(nil, "foo", line)
+		_, ok := err.(*ArgsError)
+		ut.AssertEqualIndex(t, i, true, ok)
+	}
+	_, err := CommandArgs(nil).Parse(nil, "foo", []string{"extra"})
+	ut.AssertEqual(t, "1 unexpected argument(s).\nUsage: foo", err.Error())
+}
+
+func TestCommandArgsComplete(t *testing.T) {
+	ut.AssertEqual(t, []string{"global"}, testArgs.Complete(nil, []string{"g"}))
+	ut.AssertEqual(t, []string{"window"}, testArgs.Complete(nil, []string{"w"}))
+	ut.AssertEqual(t, []string{"fill", "floating"}, testArgs.Complete(nil, []string{"window", "1", "a", "f"}))
+	ut.AssertEqual(t, []string(nil), testArgs.Complete(nil, []string{"window", "1"}))
+}
+
+func TestSplitCommandLine(t *testing.T) {
+	data := []struct {
+		in  string
+		out []string
+	}{
+		{"", []string{}},
+		{"  foo  bar ", []string{"foo", "bar"}},
+		{"alert \"hello world\"", []string{"alert", "hello world"}},
+		{"alert 'a \"b\" c'", []string{"alert", "a \"b\" c"}},
+		{"alert a\\ b \"\"", []string{"alert", "a b", ""}},
+	}
+	for i, line := range data {
+		ut.AssertEqualIndex(t, i, line.out, SplitCommandLine(line.in))
+		if len(line.out) != 0 {
+			ut.AssertEqualIndex(t, i, line.out, SplitCommandLine(JoinCommandLine(line.out)))
+		}
+	}
+}
+
+func TestSettingNormalize(t *testing.T) {
+	s := GetDefaultSetting("wordwrap")
+	v, err := s.Normalize("on")
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "true", v)
+	_, err = s.Normalize("maybe")
+	ut.AssertEqual(t, false, err == nil)
+	v, err = GetDefaultSetting("tabstop").Normalize("04")
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "4", v)
+	ut.AssertEqual(t, (*Setting)(nil), GetDefaultSetting("unknown"))
+}
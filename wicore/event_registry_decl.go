@@ -15,7 +15,7 @@ type EventListener interface {
 }
 
 // NumberEvents is the number of known events.
-const NumberEvents = 12
+const NumberEvents = 15
 
 // EventRegistry permits to register callbacks that are called on events.
 //
@@ -24,10 +24,13 @@ type EventRegistry interface {
 	EventTrigger
 
 	RegisterCommands(callback func(cmds EnqueuedCommands)) EventListener
+	RegisterDocumentChangedOnDisk(callback func(doc Document)) EventListener
 	RegisterDocumentCreated(callback func(doc Document)) EventListener
 	RegisterDocumentCursorMoved(callback func(doc Document, col, row int)) EventListener
 	RegisterEditorKeyboardModeChanged(callback func(mode KeyboardMode)) EventListener
 	RegisterEditorLanguage(callback func(l lang.Language)) EventListener
+	RegisterEditorQuitting(callback func()) EventListener
+	RegisterSettingChanged(callback func(scope SettingScope, owner, name, value string)) EventListener
 	RegisterTerminalKeyPressed(callback func(k key.Press)) EventListener
 	RegisterTerminalMetaKeyPressed(callback func(k key.Press)) EventListener
 	RegisterTerminalResized(callback func()) EventListener
@@ -66,6 +66,27 @@ func StringToDockingType(s string) DockingType {
 	}
 }
 
+// DockingTypeName returns the name of a DockingType as accepted by
+// StringToDockingType().
+func DockingTypeName(d DockingType) string {
+	switch d {
+	case DockingFill:
+		return "fill"
+	case DockingFloating:
+		return "floating"
+	case DockingLeft:
+		return "left"
+	case DockingRight:
+		return "right"
+	case DockingTop:
+		return "top"
+	case DockingBottom:
+		return "bottom"
+	default:
+		return ""
+	}
+}
+
 // BorderType defines the type of border for a Window.
 type BorderType int
 
@@ -79,6 +100,36 @@ const (
 	BorderDouble
 )
 
+// StringToBorderType converts a string back to a BorderType. Returns -1 if
+// unknown.
+func StringToBorderType(s string) BorderType {
+	switch s {
+	case "none":
+		return BorderNone
+	case "single":
+		return BorderSingle
+	case "double":
+		return BorderDouble
+	default:
+		return BorderType(-1)
+	}
+}
+
+// BorderTypeName returns the name of a BorderType as accepted by
+// StringToBorderType().
+func BorderTypeName(b BorderType) string {
+	switch b {
+	case BorderNone:
+		return "none"
+	case BorderSingle:
+		return "single"
+	case BorderDouble:
+		return "double"
+	default:
+		return ""
+	}
+}
+
 // Proxyable represents an object that can be proxied to a plugin.
 type Proxyable interface {
 	// ID represents the unique object id. The IDs must be unique through the
@@ -96,12 +147,25 @@ type EventTrigger interface {
 	// this function guarantees that all the commands will be executed in order
 	// without commands interfering.
 	//
-	// `callback` is called synchronously after the command is executed.
+	// `cmds.Callback` is called synchronously after the commands are executed
+	// with the outcome of each command. Failures are also shown to the user as
+	// an alert.
 	TriggerCommands(cmds EnqueuedCommands)
+	// TriggerDocumentChangedOnDisk is triggered when the file backing a
+	// document was modified by another program.
+	TriggerDocumentChangedOnDisk(doc Document)
 	TriggerDocumentCreated(doc Document)
 	TriggerDocumentCursorMoved(doc Document, col, row int)
 	TriggerEditorKeyboardModeChanged(mode KeyboardMode)
 	TriggerEditorLanguage(l lang.Language)
+	// TriggerEditorQuitting is triggered when the editor is about to quit, after
+	// the user decided what to do with the dirty documents. A listener can veto
+	// the shutdown by running the command "editor_quit_veto". Plugins have a
+	// limited amount of time to do so.
+	TriggerEditorQuitting()
+	// TriggerSettingChanged is triggered when a setting value is set. owner is
+	// the ID of the Window or the Document, or "" for GlobalScope.
+	TriggerSettingChanged(scope SettingScope, owner string, name string, value string)
 	TriggerTerminalKeyPressed(k key.Press)
 	TriggerTerminalMetaKeyPressed(k key.Press)
 	TriggerTerminalResized()
@@ -133,6 +197,15 @@ type Editor interface {
 	// Technically, each View could have their own KeyboardMode but in practice
 	// it just creates a cognitive overhead without much benefit.
 	KeyboardMode() KeyboardMode
+	// GetSetting returns the effective value of the setting name as seen from
+	// the Window w. The Document scope has precedence over the Window scope,
+	// which has precedence over the global scope. Returns "" if the setting is
+	// not registered. If w is nil, the active Window is used.
+	GetSetting(w Window, name string) string
+	// Prompt asks a question to the user in a modal dialog. The callback is
+	// called asynchronously with the answer once the user answered or dismissed
+	// the dialog.
+	Prompt(p Prompt, callback func(answer PromptAnswer))
 	// Version returns the version number of this build of wi.
 	Version() string
 }
@@ -143,12 +216,18 @@ type EditorW interface {
 
 	// ExecuteCommand executes a command now. This is only meant to run a command
 	// reentrantly; e.g. running a command triggers another one. This usually
-	// happens for key binding, command aliases, when a command triggers an error.
+	// happens for key binding and command aliases.
+	//
+	// The error is returned to the caller as-is, no alert is shown. It is up to
+	// the caller to propagate it.
 	//
 	// TODO(maruel): Remove?
-	ExecuteCommand(w Window, cmdName string, args ...string)
+	ExecuteCommand(w Window, cmdName string, args ...string) (CommandResult, error)
 	// RegisterViewFactory makes a new view available by name.
 	RegisterViewFactory(name string, viewFactory ViewFactory) bool
+	// RegisterSetting makes a new setting available. Returns false if a setting
+	// with the same name was replaced.
+	RegisterSetting(s Setting) bool
 }
 
 // Window is a View container. It defines the position, Z-ordering via
@@ -249,6 +328,14 @@ type ViewW interface {
 	OnAttach(w Window)
 }
 
+// DocumentView is a View presenting a Document.
+type DocumentView interface {
+	View
+
+	// Document returns the Document shown in this View.
+	Document() Document
+}
+
 // ViewFactory returns a new View.
 type ViewFactory func(e Editor, id int, args ...string) ViewW
 
@@ -270,6 +357,8 @@ type Document interface {
 	FileType() FileType
 	// IsDirty is true if the content should be saved before quitting.
 	IsDirty() bool
+	// ViewCount is the number of View showing this document.
+	ViewCount() int
 }
 
 // CommandCategory is used to put commands into sections for help purposes.
@@ -292,8 +381,10 @@ const (
 	// TODO(maruel): Add other categories.
 )
 
-// CommandHandler executes the command cmd on the Window w.
-type CommandHandler func(e EditorW, w Window, args ...string)
+// CommandResult is the output of a Command that succeeded. Each item is one
+// value, for example the value of a setting. Most commands do not have any
+// output and return nil.
+type CommandResult []string
 
 // Command describes a registered command that can be triggered directly at the
 // command prompt, via a keybinding or a plugin.
@@ -303,8 +394,14 @@ type CommandHandler func(e EditorW, w Window, args ...string)
 type Command interface {
 	// Name is the name of the command.
 	Name() string
-	// Handle executes the command.
-	Handle(e EditorW, w Window, args ...string)
+	// Args returns the argument schema of the command. The editor validates
+	// and converts the arguments with it before calling Handle(). It is also
+	// used to generate the usage text and for argument completion.
+	Args() CommandArgs
+	// Handle executes the command on the Window w with the arguments converted
+	// according to Args(). A failure is reported by returning an error; the
+	// editor takes care of notifying the user.
+	Handle(e EditorW, w Window, args ArgValues) (CommandResult, error)
 	// Category returns the category the command should be bucketed in, for help
 	// documentation purpose.
 	Category(e Editor, w Window) CommandCategory
@@ -338,8 +435,16 @@ type CommandsW interface {
 // EnqueuedCommands is used internally to dispatch commands through
 // EventRegistry.
 type EnqueuedCommands struct {
-	Commands [][]string
-	Callback func()
+	Commands    [][]string
+	StopOnError bool                            // If true, the remaining commands are skipped after the first failure.
+	Callback    func(outcomes []CommandOutcome) // Called with one item per item in Commands. It can be nil.
+}
+
+// CommandOutcome is the outcome of one command executed via EnqueuedCommands.
+type CommandOutcome struct {
+	Command []string // The command line as enqueued.
+	Result  CommandResult
+	Err     error // Set if the command failed or was skipped.
 }
 
 // KeyboardMode defines the keyboard mapping (input mode) to use.
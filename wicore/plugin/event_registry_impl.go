@@ -26,10 +26,13 @@ func makeEventRegistry() (wicore.EventRegistry, internal.EventTriggerRPC, chan f
 		eventRegistry{
 			deferred:                  c,
 			commands:                  make([]listenerCommands, 0, 64),
+			documentChangedOnDisk:     make([]listenerDocumentChangedOnDisk, 0, 64),
 			documentCreated:           make([]listenerDocumentCreated, 0, 64),
 			documentCursorMoved:       make([]listenerDocumentCursorMoved, 0, 64),
 			editorKeyboardModeChanged: make([]listenerEditorKeyboardModeChanged, 0, 64),
 			editorLanguage:            make([]listenerEditorLanguage, 0, 64),
+			editorQuitting:            make([]listenerEditorQuitting, 0, 64),
+			settingChanged:            make([]listenerSettingChanged, 0, 64),
 			terminalKeyPressed:        make([]listenerTerminalKeyPressed, 0, 64),
 			terminalMetaKeyPressed:    make([]listenerTerminalMetaKeyPressed, 0, 64),
 			terminalResized:           make([]listenerTerminalResized, 0, 64),
@@ -47,6 +50,11 @@ func (er *eventTriggerRPC) TriggerCommandsRPC(packet internal.PacketCommands, ig
 	return nil
 }
 
+func (er *eventTriggerRPC) TriggerDocumentChangedOnDiskRPC(packet internal.PacketDocumentChangedOnDisk, ignored *int) error {
+	er.triggerDocumentChangedOnDisk(packet.Doc)
+	return nil
+}
+
 func (er *eventTriggerRPC) TriggerDocumentCreatedRPC(packet internal.PacketDocumentCreated, ignored *int) error {
 	er.triggerDocumentCreated(packet.Doc)
 	return nil
@@ -67,6 +75,16 @@ func (er *eventTriggerRPC) TriggerEditorLanguageRPC(packet internal.PacketEditor
 	return nil
 }
 
+func (er *eventTriggerRPC) TriggerEditorQuittingRPC(packet internal.PacketEditorQuitting, ignored *int) error {
+	er.triggerEditorQuitting()
+	return nil
+}
+
+func (er *eventTriggerRPC) TriggerSettingChangedRPC(packet internal.PacketSettingChanged, ignored *int) error {
+	er.triggerSettingChanged(packet.Scope, packet.Owner, packet.Name, packet.Value)
+	return nil
+}
+
 func (er *eventTriggerRPC) TriggerTerminalKeyPressedRPC(packet internal.PacketTerminalKeyPressed, ignored *int) error {
 	er.triggerTerminalKeyPressed(packet.K)
 	return nil
@@ -106,6 +124,10 @@ func (er *eventRegistry) TriggerCommands(cmds wicore.EnqueuedCommands) {
 	// TODO(maruel): Send it upstream to the editor.
 }
 
+func (er *eventRegistry) TriggerDocumentChangedOnDisk(doc wicore.Document) {
+	// TODO(maruel): Send it upstream to the editor.
+}
+
 func (er *eventRegistry) TriggerDocumentCreated(doc wicore.Document) {
 	// TODO(maruel): Send it upstream to the editor.
 }
@@ -122,6 +144,14 @@ func (er *eventRegistry) TriggerEditorLanguage(l lang.Language) {
 	// TODO(maruel): Send it upstream to the editor.
 }
 
+func (er *eventRegistry) TriggerEditorQuitting() {
+	// TODO(maruel): Send it upstream to the editor.
+}
+
+func (er *eventRegistry) TriggerSettingChanged(scope wicore.SettingScope, owner, name, value string) {
+	// TODO(maruel): Send it upstream to the editor.
+}
+
 func (er *eventRegistry) TriggerTerminalKeyPressed(k key.Press) {
 	// TODO(maruel): Send it upstream to the editor.
 }
@@ -155,6 +185,11 @@ type listenerCommands struct {
 	callback func(cmds wicore.EnqueuedCommands)
 }
 
+type listenerDocumentChangedOnDisk struct {
+	id       int
+	callback func(doc wicore.Document)
+}
+
 type listenerDocumentCreated struct {
 	id       int
 	callback func(doc wicore.Document)
@@ -175,6 +210,16 @@ type listenerEditorLanguage struct {
 	callback func(l lang.Language)
 }
 
+type listenerEditorQuitting struct {
+	id       int
+	callback func()
+}
+
+type listenerSettingChanged struct {
+	id       int
+	callback func(scope wicore.SettingScope, owner, name, value string)
+}
+
 type listenerTerminalKeyPressed struct {
 	id       int
 	callback func(k key.Press)
@@ -219,10 +264,13 @@ type eventRegistry struct {
 	deferred chan<- func()
 
 	commands                  []listenerCommands
+	documentChangedOnDisk     []listenerDocumentChangedOnDisk
 	documentCreated           []listenerDocumentCreated
 	documentCursorMoved       []listenerDocumentCursorMoved
 	editorKeyboardModeChanged []listenerEditorKeyboardModeChanged
 	editorLanguage            []listenerEditorLanguage
+	editorQuitting            []listenerEditorQuitting
+	settingChanged            []listenerSettingChanged
 	terminalKeyPressed        []listenerTerminalKeyPressed
 	terminalMetaKeyPressed    []listenerTerminalMetaKeyPressed
 	terminalResized           []listenerTerminalResized
@@ -247,6 +295,14 @@ func (er *eventRegistry) unregister(eventID int) {
 			}
 		}
 	case 0x2000000:
+		for index, value := range er.documentChangedOnDisk {
+			if value.id == eventID {
+				copy(er.documentChangedOnDisk[index:], er.documentChangedOnDisk[index+1:])
+				er.documentChangedOnDisk = er.documentChangedOnDisk[0 : len(er.documentChangedOnDisk)-1]
+				return
+			}
+		}
+	case 0x3000000:
 		for index, value := range er.documentCreated {
 			if value.id == eventID {
 				copy(er.documentCreated[index:], er.documentCreated[index+1:])
@@ -254,7 +310,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0x3000000:
+	case 0x4000000:
 		for index, value := range er.documentCursorMoved {
 			if value.id == eventID {
 				copy(er.documentCursorMoved[index:], er.documentCursorMoved[index+1:])
@@ -262,7 +318,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0x4000000:
+	case 0x5000000:
 		for index, value := range er.editorKeyboardModeChanged {
 			if value.id == eventID {
 				copy(er.editorKeyboardModeChanged[index:], er.editorKeyboardModeChanged[index+1:])
@@ -270,7 +326,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0x5000000:
+	case 0x6000000:
 		for index, value := range er.editorLanguage {
 			if value.id == eventID {
 				copy(er.editorLanguage[index:], er.editorLanguage[index+1:])
@@ -278,7 +334,23 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0x6000000:
+	case 0x7000000:
+		for index, value := range er.editorQuitting {
+			if value.id == eventID {
+				copy(er.editorQuitting[index:], er.editorQuitting[index+1:])
+				er.editorQuitting = er.editorQuitting[0 : len(er.editorQuitting)-1]
+				return
+			}
+		}
+	case 0x8000000:
+		for index, value := range er.settingChanged {
+			if value.id == eventID {
+				copy(er.settingChanged[index:], er.settingChanged[index+1:])
+				er.settingChanged = er.settingChanged[0 : len(er.settingChanged)-1]
+				return
+			}
+		}
+	case 0x9000000:
 		for index, value := range er.terminalKeyPressed {
 			if value.id == eventID {
 				copy(er.terminalKeyPressed[index:], er.terminalKeyPressed[index+1:])
@@ -286,7 +358,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0x7000000:
+	case 0xa000000:
 		for index, value := range er.terminalMetaKeyPressed {
 			if value.id == eventID {
 				copy(er.terminalMetaKeyPressed[index:], er.terminalMetaKeyPressed[index+1:])
@@ -294,7 +366,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0x8000000:
+	case 0xb000000:
 		for index, value := range er.terminalResized {
 			if value.id == eventID {
 				copy(er.terminalResized[index:], er.terminalResized[index+1:])
@@ -302,7 +374,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0x9000000:
+	case 0xc000000:
 		for index, value := range er.viewActivated {
 			if value.id == eventID {
 				copy(er.viewActivated[index:], er.viewActivated[index+1:])
@@ -310,7 +382,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0xa000000:
+	case 0xd000000:
 		for index, value := range er.viewCreated {
 			if value.id == eventID {
 				copy(er.viewCreated[index:], er.viewCreated[index+1:])
@@ -318,7 +390,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0xb000000:
+	case 0xe000000:
 		for index, value := range er.windowCreated {
 			if value.id == eventID {
 				copy(er.windowCreated[index:], er.windowCreated[index+1:])
@@ -326,7 +398,7 @@ func (er *eventRegistry) unregister(eventID int) {
 				return
 			}
 		}
-	case 0xc000000:
+	case 0xf000000:
 		for index, value := range er.windowResized {
 			if value.id == eventID {
 				copy(er.windowResized[index:], er.windowResized[index+1:])
@@ -346,13 +418,22 @@ func (er *eventRegistry) RegisterCommands(callback func(cmds wicore.EnqueuedComm
 	return &eventListener{er, i | 0x1000000}
 }
 
+func (er *eventRegistry) RegisterDocumentChangedOnDisk(callback func(doc wicore.Document)) wicore.EventListener {
+	er.lock.Lock()
+	defer er.lock.Unlock()
+	i := er.nextID
+	er.nextID++
+	er.documentChangedOnDisk = append(er.documentChangedOnDisk, listenerDocumentChangedOnDisk{i, callback})
+	return &eventListener{er, i | 0x2000000}
+}
+
 func (er *eventRegistry) RegisterDocumentCreated(callback func(doc wicore.Document)) wicore.EventListener {
 	er.lock.Lock()
 	defer er.lock.Unlock()
 	i := er.nextID
 	er.nextID++
 	er.documentCreated = append(er.documentCreated, listenerDocumentCreated{i, callback})
-	return &eventListener{er, i | 0x2000000}
+	return &eventListener{er, i | 0x3000000}
 }
 
 func (er *eventRegistry) RegisterDocumentCursorMoved(callback func(doc wicore.Document, col, row int)) wicore.EventListener {
@@ -361,7 +442,7 @@ func (er *eventRegistry) RegisterDocumentCursorMoved(callback func(doc wicore.Do
 	i := er.nextID
 	er.nextID++
 	er.documentCursorMoved = append(er.documentCursorMoved, listenerDocumentCursorMoved{i, callback})
-	return &eventListener{er, i | 0x3000000}
+	return &eventListener{er, i | 0x4000000}
 }
 
 func (er *eventRegistry) RegisterEditorKeyboardModeChanged(callback func(mode wicore.KeyboardMode)) wicore.EventListener {
@@ -370,7 +451,7 @@ func (er *eventRegistry) RegisterEditorKeyboardModeChanged(callback func(mode wi
 	i := er.nextID
 	er.nextID++
 	er.editorKeyboardModeChanged = append(er.editorKeyboardModeChanged, listenerEditorKeyboardModeChanged{i, callback})
-	return &eventListener{er, i | 0x4000000}
+	return &eventListener{er, i | 0x5000000}
 }
 
 func (er *eventRegistry) RegisterEditorLanguage(callback func(l lang.Language)) wicore.EventListener {
@@ -379,7 +460,25 @@ func (er *eventRegistry) RegisterEditorLanguage(callback func(l lang.Language))
 	i := er.nextID
 	er.nextID++
 	er.editorLanguage = append(er.editorLanguage, listenerEditorLanguage{i, callback})
-	return &eventListener{er, i | 0x5000000}
+	return &eventListener{er, i | 0x6000000}
+}
+
+func (er *eventRegistry) RegisterEditorQuitting(callback func()) wicore.EventListener {
+	er.lock.Lock()
+	defer er.lock.Unlock()
+	i := er.nextID
+	er.nextID++
+	er.editorQuitting = append(er.editorQuitting, listenerEditorQuitting{i, callback})
+	return &eventListener{er, i | 0x7000000}
+}
+
+func (er *eventRegistry) RegisterSettingChanged(callback func(scope wicore.SettingScope, owner, name, value string)) wicore.EventListener {
+	er.lock.Lock()
+	defer er.lock.Unlock()
+	i := er.nextID
+	er.nextID++
+	er.settingChanged = append(er.settingChanged, listenerSettingChanged{i, callback})
+	return &eventListener{er, i | 0x8000000}
 }
 
 func (er *eventRegistry) RegisterTerminalKeyPressed(callback func(k key.Press)) wicore.EventListener {
@@ -388,7 +487,7 @@ func (er *eventRegistry) RegisterTerminalKeyPressed(callback func(k key.Press))
 	i := er.nextID
 	er.nextID++
 	er.terminalKeyPressed = append(er.terminalKeyPressed, listenerTerminalKeyPressed{i, callback})
-	return &eventListener{er, i | 0x6000000}
+	return &eventListener{er, i | 0x9000000}
 }
 
 func (er *eventRegistry) RegisterTerminalMetaKeyPressed(callback func(k key.Press)) wicore.EventListener {
@@ -397,7 +496,7 @@ func (er *eventRegistry) RegisterTerminalMetaKeyPressed(callback func(k key.Pres
 	i := er.nextID
 	er.nextID++
 	er.terminalMetaKeyPressed = append(er.terminalMetaKeyPressed, listenerTerminalMetaKeyPressed{i, callback})
-	return &eventListener{er, i | 0x7000000}
+	return &eventListener{er, i | 0xa000000}
 }
 
 func (er *eventRegistry) RegisterTerminalResized(callback func()) wicore.EventListener {
@@ -406,7 +505,7 @@ func (er *eventRegistry) RegisterTerminalResized(callback func()) wicore.EventLi
 	i := er.nextID
 	er.nextID++
 	er.terminalResized = append(er.terminalResized, listenerTerminalResized{i, callback})
-	return &eventListener{er, i | 0x8000000}
+	return &eventListener{er, i | 0xb000000}
 }
 
 func (er *eventRegistry) RegisterViewActivated(callback func(view wicore.View)) wicore.EventListener {
@@ -415,7 +514,7 @@ func (er *eventRegistry) RegisterViewActivated(callback func(view wicore.View))
 	i := er.nextID
 	er.nextID++
 	er.viewActivated = append(er.viewActivated, listenerViewActivated{i, callback})
-	return &eventListener{er, i | 0x9000000}
+	return &eventListener{er, i | 0xc000000}
 }
 
 func (er *eventRegistry) RegisterViewCreated(callback func(view wicore.View)) wicore.EventListener {
@@ -424,7 +523,7 @@ func (er *eventRegistry) RegisterViewCreated(callback func(view wicore.View)) wi
 	i := er.nextID
 	er.nextID++
 	er.viewCreated = append(er.viewCreated, listenerViewCreated{i, callback})
-	return &eventListener{er, i | 0xa000000}
+	return &eventListener{er, i | 0xd000000}
 }
 
 func (er *eventRegistry) RegisterWindowCreated(callback func(window wicore.Window)) wicore.EventListener {
@@ -433,7 +532,7 @@ func (er *eventRegistry) RegisterWindowCreated(callback func(window wicore.Windo
 	i := er.nextID
 	er.nextID++
 	er.windowCreated = append(er.windowCreated, listenerWindowCreated{i, callback})
-	return &eventListener{er, i | 0xb000000}
+	return &eventListener{er, i | 0xe000000}
 }
 
 func (er *eventRegistry) RegisterWindowResized(callback func(window wicore.Window)) wicore.EventListener {
@@ -442,7 +541,7 @@ func (er *eventRegistry) RegisterWindowResized(callback func(window wicore.Windo
 	i := er.nextID
 	er.nextID++
 	er.windowResized = append(er.windowResized, listenerWindowResized{i, callback})
-	return &eventListener{er, i | 0xc000000}
+	return &eventListener{er, i | 0xf000000}
 }
 
 func (er *eventRegistry) triggerCommands(cmds wicore.EnqueuedCommands) {
@@ -462,6 +561,23 @@ func (er *eventRegistry) triggerCommands(cmds wicore.EnqueuedCommands) {
 	}
 }
 
+func (er *eventRegistry) triggerDocumentChangedOnDisk(doc wicore.Document) {
+	er.deferred <- func() {
+		items := func() []func(doc wicore.Document) {
+			er.lock.Lock()
+			defer er.lock.Unlock()
+			items := make([]func(doc wicore.Document), 0, len(er.documentChangedOnDisk))
+			for _, item := range er.documentChangedOnDisk {
+				items = append(items, item.callback)
+			}
+			return items
+		}()
+		for _, item := range items {
+			item(doc)
+		}
+	}
+}
+
 func (er *eventRegistry) triggerDocumentCreated(doc wicore.Document) {
 	er.deferred <- func() {
 		items := func() []func(doc wicore.Document) {
@@ -530,6 +646,40 @@ func (er *eventRegistry) triggerEditorLanguage(l lang.Language) {
 	}
 }
 
+func (er *eventRegistry) triggerEditorQuitting() {
+	er.deferred <- func() {
+		items := func() []func() {
+			er.lock.Lock()
+			defer er.lock.Unlock()
+			items := make([]func(), 0, len(er.editorQuitting))
+			for _, item := range er.editorQuitting {
+				items = append(items, item.callback)
+			}
+			return items
+		}()
+		for _, item := range items {
+			item()
+		}
+	}
+}
+
+func (er *eventRegistry) triggerSettingChanged(scope wicore.SettingScope, owner, name, value string) {
+	er.deferred <- func() {
+		items := func() []func(scope wicore.SettingScope, owner, name, value string) {
+			er.lock.Lock()
+			defer er.lock.Unlock()
+			items := make([]func(scope wicore.SettingScope, owner, name, value string), 0, len(er.settingChanged))
+			for _, item := range er.settingChanged {
+				items = append(items, item.callback)
+			}
+			return items
+		}()
+		for _, item := range items {
+			item(scope, owner, name, value)
+		}
+	}
+}
+
 func (er *eventRegistry) triggerTerminalKeyPressed(k key.Press) {
 	er.deferred <- func() {
 		items := func() []func(k key.Press) {
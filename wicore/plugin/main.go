@@ -6,11 +6,13 @@
 package plugin
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/rpc"
 	"os"
+	"sync"
 
 	"github.com/wi-ed/wi/internal"
 	"github.com/wi-ed/wi/wicore"
@@ -70,6 +72,19 @@ func (p *pluginRPC) Init(details wicore.EditorDetails, ignored *int) error {
 	return nil
 }
 
+func (p *pluginRPC) Quitting(int, *int) error {
+	// Wait for the listeners of EditorQuitting to run. They were enqueued before
+	// this call.
+	done := make(chan struct{})
+	p.e.deferred <- func() {
+		close(done)
+	}
+	<-done
+	// Then wait for the commands they sent to the editor to be executed.
+	p.e.pending.Wait()
+	return nil
+}
+
 func (p *pluginRPC) Quit(int, *int) error {
 	// TODO(maruel): Is it really worth cancelling event listeners? It's just
 	// unnecessary slow down, we should favor performance in the shutdown code.
@@ -95,6 +110,65 @@ type editorProxy struct {
 	factoryNames []string
 	keyboardMode wicore.KeyboardMode
 	version      string
+	editor       *rpc.Client    // Connection to internal.EditorRPC; nil if not available.
+	pending      sync.WaitGroup // Calls to EditorRPC.TriggerCommands in flight.
+}
+
+// TriggerCommands sends the commands to the editor. The callback, if any, is
+// run in the plugin's event loop once the commands were executed.
+func (e *editorProxy) TriggerCommands(cmds wicore.EnqueuedCommands) {
+	if e.editor == nil {
+		log.Printf("TriggerCommands(%v): not connected to the editor", cmds.Commands)
+		return
+	}
+	var out []internal.PacketCommandOutcome
+	e.pending.Add(1)
+	call := e.editor.Go("EditorRPC.TriggerCommands", internal.PacketCommands{cmds}, &out, nil)
+	wicore.Go("EditorRPC.TriggerCommands", func() {
+		_ = <-call.Done
+		defer e.pending.Done()
+		if call.Error != nil {
+			log.Printf("TriggerCommands(%v) failed: %s", cmds.Commands, call.Error)
+		}
+		if cmds.Callback == nil {
+			return
+		}
+		outcomes := make([]wicore.CommandOutcome, len(out))
+		for i, o := range out {
+			outcomes[i].Command = o.Command
+			outcomes[i].Result = o.Result
+			if o.Err != "" {
+				outcomes[i].Err = errors.New(o.Err)
+			}
+		}
+		e.deferred <- func() {
+			cmds.Callback(outcomes)
+		}
+	})
+}
+
+// Prompt asks the editor to show the question to the user. The callback is
+// run in the plugin's event loop.
+func (e *editorProxy) Prompt(p wicore.Prompt, callback func(answer wicore.PromptAnswer)) {
+	if e.editor == nil {
+		log.Printf("Prompt(%q): not connected to the editor", p.Question)
+		e.deferred <- func() {
+			callback(wicore.PromptAnswer{true, ""})
+		}
+		return
+	}
+	out := wicore.PromptAnswer{}
+	call := e.editor.Go("EditorRPC.Prompt", p, &out, nil)
+	wicore.Go("EditorRPC.Prompt", func() {
+		_ = <-call.Done
+		if call.Error != nil {
+			log.Printf("Prompt(%q) failed: %s", p.Question, call.Error)
+			out = wicore.PromptAnswer{true, ""}
+		}
+		e.deferred <- func() {
+			callback(out)
+		}
+	})
 }
 
 func (e *editorProxy) ID() string {
@@ -125,6 +199,27 @@ func (e *editorProxy) KeyboardMode() wicore.KeyboardMode {
 	return e.keyboardMode
 }
 
+// GetSetting queries the editor for the effective value of the setting. It
+// returns the default value if the editor can't be queried.
+func (e *editorProxy) GetSetting(w wicore.Window, name string) string {
+	if e.editor != nil {
+		in := internal.PacketGetSetting{Name: name}
+		if w != nil {
+			in.WindowID = w.ID()
+		}
+		out := ""
+		err := e.editor.Call("EditorRPC.GetSetting", in, &out)
+		if err == nil {
+			return out
+		}
+		log.Printf("GetSetting(%q) failed: %s", name, err)
+	}
+	if s := wicore.GetDefaultSetting(name); s != nil {
+		return s.Default
+	}
+	return ""
+}
+
 func (e *editorProxy) Version() string {
 	return e.version
 }
@@ -145,7 +240,14 @@ func Main(plugin wicore.Plugin) int {
 	// kill the plugin process in this case.
 	conn := wicore.MakeReadWriteCloser(os.Stdin, os.Stdout)
 	server := rpc.NewServer()
-	reg, rpc, deferred := makeEventRegistry()
+	reg, eventRPC, deferred := makeEventRegistry()
+	var editor *rpc.Client
+	if sock := os.Getenv("WI_EDITOR"); sock != "" {
+		var err error
+		if editor, err = rpc.Dial("unix", sock); err != nil {
+			log.Printf("Failed to connect to the editor: %s", err)
+		}
+	}
 	e := &editorProxy{
 		reg,
 		deferred,
@@ -154,7 +256,15 @@ func Main(plugin wicore.Plugin) int {
 		[]string{},
 		wicore.Normal,
 		"",
+		editor,
+		sync.WaitGroup{},
 	}
+	// The event loop of the plugin. Events and callbacks are run sequentially.
+	wicore.Go("eventLoop", func() {
+		for f := range deferred {
+			f()
+		}
+	})
 	p := &pluginRPC{
 		e:      e,
 		conn:   os.Stdin,
@@ -168,7 +278,7 @@ func Main(plugin wicore.Plugin) int {
 	}
 	// Expose an object which doesn't have any method beside the ones exposed.
 	// Otherwise it spew the logs with noise.
-	objEventTriggerRPC := struct{ internal.EventTriggerRPC }{rpc}
+	objEventTriggerRPC := struct{ internal.EventTriggerRPC }{eventRPC}
 	if err := server.RegisterName("EventTriggerRPC", objEventTriggerRPC); err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err)
 		return 1
@@ -0,0 +1,65 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package wicore
+
+import (
+	"fmt"
+)
+
+// PromptKind is the kind of question asked to the user.
+type PromptKind int
+
+const (
+	// PromptYesNoCancel asks a question answered by "yes", "no" or "cancel".
+	PromptYesNoCancel PromptKind = iota
+	// PromptInput asks for a line of text.
+	PromptInput
+	// PromptList asks to pick one of the choices.
+	PromptList
+)
+
+func (p PromptKind) String() string {
+	switch p {
+	case PromptYesNoCancel:
+		return "yesno"
+	case PromptInput:
+		return "input"
+	case PromptList:
+		return "list"
+	default:
+		return fmt.Sprintf("PromptKind(%d)", int(p))
+	}
+}
+
+// StringToPromptKind converts a string back to a PromptKind. Returns -1 if
+// unknown.
+func StringToPromptKind(s string) PromptKind {
+	switch s {
+	case "yesno":
+		return PromptYesNoCancel
+	case "input":
+		return PromptInput
+	case "list":
+		return PromptList
+	default:
+		return PromptKind(-1)
+	}
+}
+
+// PromptKindNames is the list of valid values for a PromptKind argument.
+var PromptKindNames = []string{"yesno", "input", "list"}
+
+// Prompt is a question to ask to the user via Editor.Prompt().
+type Prompt struct {
+	Kind     PromptKind
+	Question string
+	Choices  []string // Choices to pick from for PromptList. For PromptInput, the first item is the initial text.
+}
+
+// PromptAnswer is the answer to a Prompt.
+type PromptAnswer struct {
+	Cancelled bool   // Cancelled is true if the user dismissed the prompt. For PromptYesNoCancel, Answer is also "cancel".
+	Answer    string // Answer is "yes", "no" or "cancel" for PromptYesNoCancel, the text typed for PromptInput or the choice picked for PromptList.
+}
@@ -7,6 +7,7 @@ package raster
 
 import (
 	"fmt"
+	"unicode"
 	"unicode/utf8"
 
 	"github.com/wi-ed/wi/wicore/colors"
@@ -51,25 +52,36 @@ func (c CellFormat) Empty() bool {
 
 // Cell represents the properties of a single character on screen.
 //
+// A character two cells wide is followed by a cell with R set to
+// Continuation.
+//
 // Some properties are ignored on different terminals.
 type Cell struct {
-	R rune
-	F CellFormat
+	R    rune
+	F    CellFormat
+	Comb string // Combining characters drawn over R, if any.
 }
 
 // MakeCell is a shorthand to return a Cell.
 func MakeCell(R rune, Fg, Bg colors.RGB) Cell {
-	return Cell{R, CellFormat{Fg: Fg, Bg: Bg}}
+	return Cell{R: R, F: CellFormat{Fg: Fg, Bg: Bg}}
 }
 
 // CellStride is a slice of cells.
 type CellStride []Cell
 
-// Runes returns runes as a slice.
+// Runes returns runes as a slice, including the combining characters. The
+// continuation cells of wide characters are skipped.
 func (c CellStride) Runes() []rune {
-	out := make([]rune, len(c))
-	for i, cell := range c {
-		out[i] = cell.R
+	out := make([]rune, 0, len(c))
+	for _, cell := range c {
+		if cell.R == Continuation {
+			continue
+		}
+		out = append(out, cell.R)
+		for _, r := range cell.Comb {
+			out = append(out, r)
+		}
 	}
 	return out
 }
@@ -105,7 +117,7 @@ func (b *Buffer) String() string {
 // If the requested line number if outside the buffer, an empty slice is
 // returned.
 func (b *Buffer) Line(Y int) CellStride {
-	if Y >= b.Height {
+	if Y < 0 || Y >= b.Height {
 		return emptySlice
 	}
 	base := Y * b.Stride
@@ -117,7 +129,7 @@ func (b *Buffer) Line(Y int) CellStride {
 // If the position is outside the buffer, an empty temporary cell is returned.
 func (b *Buffer) Cell(X, Y int) *Cell {
 	line := b.Line(Y)
-	if len(line) < X {
+	if X < 0 || len(line) <= X {
 		return &Cell{}
 	}
 	return &line[X]
@@ -125,18 +137,48 @@ func (b *Buffer) Cell(X, Y int) *Cell {
 
 // DrawString draws a string into the buffer.
 //
-// Text will be automatically elided if necessary.
+// The text is laid out by grapheme clusters: wide characters take two cells,
+// combining characters are merged into the cell of their base character and
+// zero width characters take no space. Text will be automatically elided if
+// necessary.
 func (b *Buffer) DrawString(s string, X, Y int, f CellFormat) {
 	line := b.Line(Y)
-	if len(line) <= X {
+	if X < 0 || len(line) <= X {
 		return
 	}
-	bytes := []byte(ElideText(s, len(line)-X))
-	for x := X; x < len(line) && len(bytes) > 0; x++ {
-		r, size := utf8.DecodeRune(bytes)
-		line[x].R = r
-		line[x].F = f
-		bytes = bytes[size:]
+	if X > 0 && line[X].R == Continuation {
+		// Overwriting the right half of a wide character.
+		line[X-1].R = ' '
+		line[X-1].Comb = ""
+	}
+	s = ElideText(s, len(line)-X)
+	x := X
+	for len(s) != 0 && x < len(line) {
+		size, width := Grapheme(s)
+		c := s[:size]
+		s = s[size:]
+		r, l := utf8.DecodeRuneInString(c)
+		if width == 0 {
+			if x > X && !unicode.Is(unicode.Cf, r) {
+				// Combining mark without a base character; keep it with the
+				// previous character.
+				prev := x - 1
+				if line[prev].R == Continuation {
+					prev--
+				}
+				line[prev].Comb += c
+			}
+			continue
+		}
+		line[x] = Cell{R: r, F: f, Comb: c[l:]}
+		if width == 2 {
+			line[x+1] = Cell{R: Continuation, F: f}
+		}
+		x += width
+	}
+	if x < len(line) && line[x].R == Continuation {
+		// The left half of a wide character was overwritten.
+		line[x].R = ' '
 	}
 }
 
@@ -173,7 +215,7 @@ func FormatText(s string) string {
 		if c == 0 {
 			out += "NUL"
 		} else if c == 9 {
-			// TODO(maruel): Need positional information AND desired tabwidth.
+			// TODO(maruel): Need positional information AND desired tabstop.
 			out += string(c)
 		} else if c <= 32 {
 			out += "^" + string(c+'A'-1)
@@ -184,16 +226,25 @@ func FormatText(s string) string {
 	return out
 }
 
-// ElideText elide a string as necessary.
+// ElideText elide a string as necessary so it fits in width cells.
 func ElideText(s string, width int) string {
 	if width <= 0 {
 		return ""
 	}
-	length := utf8.RuneCountInString(s)
-	if length <= width {
+	if StringWidth(s) <= width {
 		return s
 	}
-	return s[:width-1] + "…"
+	w := 0
+	i := 0
+	for i < len(s) {
+		size, cw := Grapheme(s[i:])
+		if w+cw > width-1 {
+			break
+		}
+		w += cw
+		i += size
+	}
+	return s[:i] + "…"
 }
 
 // Blit copies src into b.
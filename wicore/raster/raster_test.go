@@ -41,6 +41,8 @@ func TestBuffer(t *testing.T) {
 	b2.Cell(0, 0).F.Fg = colors.Blue
 
 	ut.AssertEqual(t, Cell{}, *b.Cell(4, 4))
+	ut.AssertEqual(t, Cell{}, *b.Cell(4, 0))
+	ut.AssertEqual(t, Cell{}, *b.Cell(-1, -1))
 	ut.AssertEqual(t, "FOOO", string(b.Line(0).Runes()))
 	ut.AssertEqual(t, "aaaa", string(b.Line(1).Runes()))
 	ut.AssertEqual(t, "a…aa", string(b.Line(2).Runes()))
@@ -80,8 +82,87 @@ func TestElideText(t *testing.T) {
 		{"hell", "he…"},
 		{"hello", "he…"},
 		{"\000hello", "\000h…"},
+		{"日本", "日…"},
+		{"a日本", "a…"},
+		{"e\u0301e\u0301e\u0301", "e\u0301e\u0301e\u0301"},
 	}
 	for i, v := range data {
 		ut.AssertEqualIndex(t, i, v[1], ElideText(v[0], 3))
 	}
 }
+
+func TestRuneWidth(t *testing.T) {
+	data := []struct {
+		r        rune
+		expected int
+	}{
+		{'a', 1},
+		{'é', 1},
+		{'\u0301', 0},
+		{'\u200b', 0},
+		{'\u200d', 0},
+		{'日', 2},
+		{'ｱ', 1},
+		{'Ａ', 2},
+		{'한', 2},
+		{'😀', 2},
+		{'❤', 1},
+	}
+	for i, v := range data {
+		ut.AssertEqualIndex(t, i, v.expected, RuneWidth(v.r))
+	}
+}
+
+func TestGrapheme(t *testing.T) {
+	data := []struct {
+		s     string
+		size  int
+		width int
+	}{
+		{"", 0, 0},
+		{"ab", 1, 1},
+		{"\r\n", 2, 1},
+		{"e\u0301x", 3, 1},
+		{"\u0301", 2, 0},
+		{"\u200bx", 3, 0},
+		{"日本", 3, 2},
+		{"\u2764\ufe0f", 6, 2},
+		{"👍🏽", 8, 2},
+		{"👨\u200d👩\u200d👧x", 18, 2},
+		{"🇫🇷🇩🇪", 8, 2},
+		{"🇫", 4, 1},
+		{"\u1100\u1161\u11a8", 9, 2},
+	}
+	for i, v := range data {
+		size, width := Grapheme(v.s)
+		ut.AssertEqualIndex(t, i, v.size, size)
+		ut.AssertEqualIndex(t, i, v.width, width)
+	}
+	ut.AssertEqual(t, 10, StringWidth("a日本e\u0301\u200b👍🏽🇫🇷"))
+}
+
+func TestDrawStringWide(t *testing.T) {
+	b := NewBuffer(5, 3)
+	b.Fill(MakeCell(' ', colors.White, colors.Black))
+	b.DrawString("a日e\u0301\u200bz", 0, 0, CellFormat{})
+	b.DrawString("日本語", 0, 1, CellFormat{})
+	b.DrawString("abcde", 0, 2, CellFormat{})
+	b.DrawString("日", 1, 2, CellFormat{})
+	ut.AssertEqual(t, "a日e\u0301z", string(b.Line(0).Runes()))
+	ut.AssertEqual(t, Cell{R: Continuation}, *b.Cell(2, 0))
+	ut.AssertEqual(t, Cell{R: 'e', Comb: "\u0301"}, *b.Cell(3, 0))
+	ut.AssertEqual(t, "日本…", string(b.Line(1).Runes()))
+	ut.AssertEqual(t, "a日de", string(b.Line(2).Runes()))
+
+	// Overwriting half of a wide character clears the other half.
+	b.DrawString("x", 2, 1, CellFormat{})
+	ut.AssertEqual(t, "日x …", string(b.Line(1).Runes()))
+	b.DrawString("y", 0, 1, CellFormat{})
+	ut.AssertEqual(t, "y x …", string(b.Line(1).Runes()))
+
+	// A wide character that doesn't fit.
+	b.DrawString("ab日", 3, 2, CellFormat{})
+	ut.AssertEqual(t, "a日a…", string(b.Line(2).Runes()))
+	b.DrawString("日", 0, 2, CellFormat{})
+	ut.AssertEqual(t, "日 a…", string(b.Line(2).Runes()))
+}
@@ -0,0 +1,250 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package raster
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// wide is the set of characters taking two cells: East Asian Wide and
+// Fullwidth characters and the emoji with a default emoji presentation.
+//
+// The table is a hand-written approximation of EastAsianWidth.txt and
+// emoji-data.txt.
+var wide = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x1100, 0x115f, 1},
+		{0x231a, 0x231b, 1},
+		{0x2329, 0x232a, 1},
+		{0x23e9, 0x23ec, 1},
+		{0x23f0, 0x23f0, 1},
+		{0x23f3, 0x23f3, 1},
+		{0x25fd, 0x25fe, 1},
+		{0x2614, 0x2615, 1},
+		{0x2648, 0x2653, 1},
+		{0x267f, 0x267f, 1},
+		{0x2693, 0x2693, 1},
+		{0x26a1, 0x26a1, 1},
+		{0x26aa, 0x26ab, 1},
+		{0x26bd, 0x26be, 1},
+		{0x26c4, 0x26c5, 1},
+		{0x26ce, 0x26ce, 1},
+		{0x26d4, 0x26d4, 1},
+		{0x26ea, 0x26ea, 1},
+		{0x26f2, 0x26f3, 1},
+		{0x26f5, 0x26f5, 1},
+		{0x26fa, 0x26fa, 1},
+		{0x26fd, 0x26fd, 1},
+		{0x2705, 0x2705, 1},
+		{0x270a, 0x270b, 1},
+		{0x2728, 0x2728, 1},
+		{0x274c, 0x274c, 1},
+		{0x274e, 0x274e, 1},
+		{0x2753, 0x2755, 1},
+		{0x2757, 0x2757, 1},
+		{0x2795, 0x2797, 1},
+		{0x27b0, 0x27b0, 1},
+		{0x27bf, 0x27bf, 1},
+		{0x2b1b, 0x2b1c, 1},
+		{0x2b50, 0x2b50, 1},
+		{0x2b55, 0x2b55, 1},
+		{0x2e80, 0x303e, 1},
+		{0x3041, 0x33ff, 1},
+		{0x3400, 0x4dbf, 1},
+		{0x4e00, 0x9fff, 1},
+		{0xa000, 0xa4cf, 1},
+		{0xa960, 0xa97f, 1},
+		{0xac00, 0xd7a3, 1},
+		{0xf900, 0xfaff, 1},
+		{0xfe10, 0xfe19, 1},
+		{0xfe30, 0xfe6f, 1},
+		{0xff00, 0xff60, 1},
+		{0xffe0, 0xffe6, 1},
+	},
+	R32: []unicode.Range32{
+		{0x16fe0, 0x16fe4, 1},
+		{0x17000, 0x18cff, 1},
+		{0x1b000, 0x1b2ff, 1},
+		{0x1f004, 0x1f004, 1},
+		{0x1f0cf, 0x1f0cf, 1},
+		{0x1f18e, 0x1f18e, 1},
+		{0x1f191, 0x1f19a, 1},
+		{0x1f200, 0x1f202, 1},
+		{0x1f210, 0x1f23b, 1},
+		{0x1f240, 0x1f248, 1},
+		{0x1f250, 0x1f251, 1},
+		{0x1f260, 0x1f265, 1},
+		{0x1f300, 0x1f320, 1},
+		{0x1f32d, 0x1f335, 1},
+		{0x1f337, 0x1f37c, 1},
+		{0x1f37e, 0x1f393, 1},
+		{0x1f3a0, 0x1f3ca, 1},
+		{0x1f3cf, 0x1f3d3, 1},
+		{0x1f3e0, 0x1f3f0, 1},
+		{0x1f3f4, 0x1f3f4, 1},
+		{0x1f3f8, 0x1f43e, 1},
+		{0x1f440, 0x1f440, 1},
+		{0x1f442, 0x1f4fc, 1},
+		{0x1f4ff, 0x1f53d, 1},
+		{0x1f54b, 0x1f54e, 1},
+		{0x1f550, 0x1f567, 1},
+		{0x1f57a, 0x1f57a, 1},
+		{0x1f595, 0x1f596, 1},
+		{0x1f5a4, 0x1f5a4, 1},
+		{0x1f5fb, 0x1f64f, 1},
+		{0x1f680, 0x1f6c5, 1},
+		{0x1f6cc, 0x1f6cc, 1},
+		{0x1f6d0, 0x1f6d2, 1},
+		{0x1f6d5, 0x1f6d7, 1},
+		{0x1f6eb, 0x1f6ec, 1},
+		{0x1f6f4, 0x1f6fc, 1},
+		{0x1f7e0, 0x1f7eb, 1},
+		{0x1f90c, 0x1f93a, 1},
+		{0x1f93c, 0x1f945, 1},
+		{0x1f947, 0x1f9ff, 1},
+		{0x1fa70, 0x1faff, 1},
+		{0x20000, 0x2fffd, 1},
+		{0x30000, 0x3fffd, 1},
+	},
+}
+
+// pictographic approximates Extended_Pictographic: the characters that can be
+// joined with a zero width joiner to form a single emoji.
+var pictographic = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x00a9, 0x00a9, 1},
+		{0x00ae, 0x00ae, 1},
+		{0x203c, 0x203c, 1},
+		{0x2049, 0x2049, 1},
+		{0x2122, 0x2122, 1},
+		{0x2139, 0x2139, 1},
+		{0x2194, 0x21aa, 1},
+		{0x231a, 0x23ff, 1},
+		{0x24c2, 0x24c2, 1},
+		{0x25aa, 0x25fe, 1},
+		{0x2600, 0x27bf, 1},
+		{0x2934, 0x2935, 1},
+		{0x2b05, 0x2b55, 1},
+		{0x3030, 0x3030, 1},
+		{0x303d, 0x303d, 1},
+		{0x3297, 0x3299, 1},
+	},
+	R32: []unicode.Range32{
+		{0x1f000, 0x1faff, 1},
+	},
+}
+
+const (
+	zwj      = 0x200d
+	vs16     = 0xfe0f // Requests the emoji presentation.
+	riFirst  = 0x1f1e6
+	riLast   = 0x1f1ff
+	modFirst = 0x1f3fb // Skin tone modifiers.
+	modLast  = 0x1f3ff
+)
+
+// Continuation is the rune of the cell following a character two cells wide.
+// The cell is covered by the character on its left.
+const Continuation rune = -1
+
+// RuneWidth returns the number of cells used by the rune when displayed in a
+// monospace font: 0 for combining marks and zero width characters like U+200B,
+// 2 for East Asian wide characters and most emoji, 1 otherwise.
+func RuneWidth(r rune) int {
+	switch {
+	case r < 0x300:
+		// Fast path; the control characters are escaped by FormatText.
+		if r == 0xad {
+			// Soft hyphen.
+			return 0
+		}
+		return 1
+	case isExtend(r), unicode.Is(unicode.Cf, r):
+		return 0
+	case unicode.Is(wide, r):
+		return 2
+	}
+	return 1
+}
+
+// isExtend returns true if the rune extends the grapheme cluster before it.
+func isExtend(r rune) bool {
+	switch {
+	case r == zwj, r >= 0xfe00 && r <= 0xfe0f, r >= 0xe0020 && r <= 0xe007f, r >= 0xe0100 && r <= 0xe01ef:
+		// Variation selectors and tags.
+		return true
+	case r >= modFirst && r <= modLast:
+		return true
+	case r >= 0x1160 && r <= 0x11ff, r >= 0xd7b0 && r <= 0xd7ff:
+		// Hangul medial vowels and final consonants.
+		return true
+	}
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc)
+}
+
+// Grapheme returns the size in bytes and the width in cells of the first
+// grapheme cluster of s, the unit perceived as a single character.
+//
+// A base character and its combining marks, an emoji sequence joined with
+// U+200D, a pair of regional indicators forming a flag and "\r\n" are each a
+// single grapheme cluster. A combining mark without a base character is a
+// cluster of width 0.
+//
+// It implements a reasonable subset of the rules of Unicode UAX #29.
+func Grapheme(s string) (size, width int) {
+	if len(s) == 0 {
+		return 0, 0
+	}
+	if s[0] < utf8.RuneSelf && (len(s) == 1 || s[1] < utf8.RuneSelf) {
+		// Fast path for ASCII.
+		if s[0] == '\r' && len(s) > 1 && s[1] == '\n' {
+			return 2, 1
+		}
+		return 1, 1
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	width = RuneWidth(r)
+	if r == '\r' && len(s) > 1 && s[1] == '\n' {
+		return 2, 1
+	}
+	if r < ' ' || r == 0x7f || (unicode.Is(unicode.Cf, r) && r != zwj) {
+		// Control characters are never extended.
+		return size, width
+	}
+	if r >= riFirst && r <= riLast {
+		if n, l := utf8.DecodeRuneInString(s[size:]); n >= riFirst && n <= riLast {
+			return size + l, 2
+		}
+		return size, width
+	}
+	prev := r
+	for size < len(s) {
+		n, l := utf8.DecodeRuneInString(s[size:])
+		switch {
+		case isExtend(n):
+			if n == vs16 && width == 1 {
+				width = 2
+			}
+		case prev == zwj && unicode.Is(pictographic, n):
+		default:
+			return size, width
+		}
+		prev = n
+		size += l
+	}
+	return size, width
+}
+
+// StringWidth returns the number of cells used by s.
+func StringWidth(s string) int {
+	w := 0
+	for len(s) != 0 {
+		size, width := Grapheme(s)
+		w += width
+		s = s[size:]
+	}
+	return w
+}
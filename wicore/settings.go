@@ -0,0 +1,224 @@
+// Copyright 2015 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package wicore
+
+import (
+	"fmt"
+
+	"github.com/wi-ed/wi/wicore/lang"
+)
+
+// SettingScope is where a setting value applies.
+type SettingScope int
+
+const (
+	// GlobalScope applies to the whole editor.
+	GlobalScope SettingScope = iota
+	// WindowScope applies to a Window and its children Window.
+	WindowScope
+	// DocumentScope applies to a Document, independent of the Window it is
+	// viewed in.
+	DocumentScope
+)
+
+func (s SettingScope) String() string {
+	switch s {
+	case GlobalScope:
+		return "global"
+	case WindowScope:
+		return "window"
+	case DocumentScope:
+		return "document"
+	default:
+		return fmt.Sprintf("SettingScope(%d)", int(s))
+	}
+}
+
+// StringToSettingScope converts a string back to a SettingScope. Returns -1
+// if unknown.
+func StringToSettingScope(s string) SettingScope {
+	switch s {
+	case "global":
+		return GlobalScope
+	case "window":
+		return WindowScope
+	case "document":
+		return DocumentScope
+	default:
+		return SettingScope(-1)
+	}
+}
+
+// SettingScopeNames is the list of valid values for a SettingScope argument.
+var SettingScopeNames = []string{"global", "window", "document"}
+
+// Setting describes a typed option. The values are always stored in their
+// canonical string form, so they can be transfered over RPC as-is.
+type Setting struct {
+	Name    string
+	Type    ArgType  // One of ArgBool, ArgInt, ArgString or ArgEnum.
+	Values  []string // Values are the valid values when Type is ArgEnum.
+	Default string   // Default is the value used when the setting is not set at any scope.
+	Desc    lang.Map
+}
+
+// Normalize validates value and returns its canonical form.
+func (s *Setting) Normalize(value string) (string, error) {
+	v, err := CommandArg{Name: s.Name, Type: s.Type, Values: s.Values}.Convert(nil, value)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%v", v), nil
+}
+
+// DefaultSettings are the settings known by the editor itself. Plugins can
+// register more via EditorW.RegisterSetting().
+var DefaultSettings = []Setting{
+	{
+		"autoindent",
+		ArgBool,
+		nil,
+		"true",
+		lang.Map{
+			lang.En: "Indents a new line like the previous one.",
+		},
+	},
+	{
+		"expandtab",
+		ArgBool,
+		nil,
+		"false",
+		lang.Map{
+			lang.En: "Inserts spaces instead of a tab character. It is detected from the content when a document is loaded.",
+		},
+	},
+	{
+		"foldcolumn",
+		ArgEnum,
+		[]string{"auto", "yes", "no"},
+		"auto",
+		lang.Map{
+			lang.En: "Shows the fold markers in the gutter of the documents; 'auto' shows them only when the document has folds.",
+		},
+	},
+	{
+		"foldmarker",
+		ArgString,
+		nil,
+		"{{{,}}}",
+		lang.Map{
+			lang.En: "Start and end markers of the folds, separated by a comma, when \"foldmethod\" is 'marker'.",
+		},
+	},
+	{
+		"foldmethod",
+		ArgEnum,
+		[]string{"none", "indent", "marker", "syntax"},
+		"syntax",
+		lang.Map{
+			lang.En: "How the folds are defined: by the indentation, by markers in the text, or by the syntax. 'syntax' folds the Go functions and blocks, and by indentation the other file types.",
+		},
+	},
+	{
+		"list",
+		ArgBool,
+		nil,
+		"false",
+		lang.Map{
+			lang.En: "Shows the whitespace with the markers of \"listchars\".",
+		},
+	},
+	{
+		"listchars",
+		ArgString,
+		nil,
+		"tab:» ,trail:·,nbsp:␣",
+		lang.Map{
+			lang.En: "Markers drawn for the whitespace when \"list\" is set, as a comma separated list of kind:characters. 'tab' takes one or two characters, the second one filling the rest of the tab; 'trail' is for the trailing spaces and 'nbsp' for the non-breaking spaces.",
+		},
+	},
+	{
+		"number",
+		ArgEnum,
+		[]string{"off", "absolute", "relative", "hybrid"},
+		"off",
+		lang.Map{
+			lang.En: "Shows the line numbers in the gutter of the documents. 'relative' shows the distance to the cursor line, 'hybrid' does too except for the cursor line.",
+		},
+	},
+	{
+		"scrolloff",
+		ArgInt,
+		nil,
+		"3",
+		lang.Map{
+			lang.En: "Minimum number of rows kept visible above and below the cursor.",
+		},
+	},
+	{
+		"shiftwidth",
+		ArgInt,
+		nil,
+		"0",
+		lang.Map{
+			lang.En: "Number of columns of an indentation level; 0 uses \"tabstop\". It is detected from the content when a document is loaded.",
+		},
+	},
+	{
+		"showbreak",
+		ArgString,
+		nil,
+		"↪ ",
+		lang.Map{
+			lang.En: "Text shown at the start of the continuation rows of wrapped lines.",
+		},
+	},
+	{
+		"signcolumn",
+		ArgEnum,
+		[]string{"auto", "yes", "no"},
+		"auto",
+		lang.Map{
+			lang.En: "Shows the signs in the gutter of the documents; 'auto' shows them only when the document has signs.",
+		},
+	},
+	{
+		"tabstop",
+		ArgInt,
+		nil,
+		"8",
+		lang.Map{
+			lang.En: "Number of columns between tab stops. It is usually set in the document scope.",
+		},
+	},
+	{
+		"theme",
+		ArgEnum,
+		[]string{"dark", "light"},
+		"dark",
+		lang.Map{
+			lang.En: "Color theme of the documents.",
+		},
+	},
+	{
+		"wordwrap",
+		ArgBool,
+		nil,
+		"false",
+		lang.Map{
+			lang.En: "Wraps long lines instead of scrolling horizontally.",
+		},
+	},
+}
+
+// GetDefaultSetting returns the Setting in DefaultSettings or nil.
+func GetDefaultSetting(name string) *Setting {
+	for i := range DefaultSettings {
+		if DefaultSettings[i].Name == name {
+			return &DefaultSettings[i]
+		}
+	}
+	return nil
+}
@@ -17,3 +17,43 @@ var AliasFor = lang.Map{
 var AliasNotFound = lang.Map{
 	lang.En: "\"%s\" is an alias to command \"%s\" but this command is not registered.",
 }
+
+// ArgEmptyPath describes an empty path argument.
+var ArgEmptyPath = lang.Map{
+	lang.En: "Argument \"%s\" must be a non-empty path.",
+}
+
+// ArgMissing describes a missing required argument.
+var ArgMissing = lang.Map{
+	lang.En: "Argument \"%s\" is missing.",
+}
+
+// ArgNotInList describes a value that is not one of the accepted values.
+var ArgNotInList = lang.Map{
+	lang.En: "\"%s\" is not a valid value for argument \"%s\"; expected one of: %s.",
+}
+
+// ArgNotInt describes a value that is not an integer.
+var ArgNotInt = lang.Map{
+	lang.En: "\"%s\" is not a valid integer for argument \"%s\".",
+}
+
+// ArgNotKey describes a value that is not a valid key name.
+var ArgNotKey = lang.Map{
+	lang.En: "\"%s\" is not a valid key for argument \"%s\".",
+}
+
+// ArgNotWindow describes a value that is not a valid Window ID.
+var ArgNotWindow = lang.Map{
+	lang.En: "\"%s\" is not a valid window ID for argument \"%s\".",
+}
+
+// ArgTooMany describes extraneous arguments.
+var ArgTooMany = lang.Map{
+	lang.En: "%d unexpected argument(s).",
+}
+
+// ArgUsage is the error message for invalid arguments.
+var ArgUsage = lang.Map{
+	lang.En: "%s\nUsage: %s",
+}